@@ -62,6 +62,9 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to initialize database", "error", err)
 	}
+	if err := database.SetBaseCurrency(cli.BaseCurrency); err != nil {
+		logger.Fatal("Invalid base currency", "error", err)
+	}
 
 	// Initialize embedding provider using Kong-parsed CLI values
 	embeddingProvider, err := commands.SetupEmbeddingProvider(context.Background(), cli.EmbeddingConfig, logger)
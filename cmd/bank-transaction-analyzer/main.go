@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"text/tabwriter"
 	"time"
 
 	"github.com/alecthomas/kong"
@@ -22,6 +23,7 @@ import (
 type CLI struct {
 	commands.CommonConfig
 	commands.EmbeddingConfig
+	commands.AgentConfig
 
 	OpenRouterKey   string `help:"OpenRouter API key" env:"OPENROUTER_API_KEY" required:""`
 	OpenRouterModel string `help:"OpenRouter model to use for analysis" default:"google/gemini-2.5-flash-preview" env:"OPENROUTER_MODEL"`
@@ -32,6 +34,15 @@ type CLI struct {
 	DryRun          bool   `help:"Print parsed transactions and exit (no analysis)" default:"false"`
 	Limit           int    `help:"Limit the number of transactions to process (0 = no limit)" default:"0"`
 	Print           bool   `help:"Print classified transactions after processing (does not skip analysis/storage)" default:"false"`
+
+	NoRedact        bool     `help:"Send transaction text to the LLM without redacting card, account and phone numbers or names" default:"false"`
+	StrictRedaction []string `help:"Banks to apply strict redaction to (also redacts counterparties and long reference numbers)" sep:"," env:"STRICT_REDACTION_BANKS"`
+
+	HelperTools bool `help:"Let the model look up known merchants, similar transactions and bank rules before classifying" default:"false"`
+
+	AlertSensitivity string `help:"How unusual new transactions must be to raise an alert, or off" default:"medium" enum:"off,low,medium,high" env:"ALERT_SENSITIVITY"`
+	HomeCountry      string `help:"Country you live in, for alerting on foreign spending when you're not travelling" default:"AU" env:"HOME_COUNTRY"`
+	HomeState        string `help:"State you live in, so interstate spending is detected as trips (empty = only overseas trips)" env:"HOME_STATE"`
 }
 
 func (c *CLI) Run() error {
@@ -55,6 +66,9 @@ func (c *CLI) Run() error {
 	if err != nil {
 		logger.Fatal("Failed to initialize database", "error", err)
 	}
+	if err := database.SetBaseCurrency(c.BaseCurrency); err != nil {
+		logger.Fatal("Invalid base currency", "error", err)
+	}
 	defer database.Close()
 
 	// Create context with timeout for operations
@@ -62,7 +76,11 @@ func (c *CLI) Run() error {
 	defer cancel()
 
 	// Initialize OpenRouter agent for transaction analysis
-	agentInst := agent.NewOpenRouterAgent(logger, c.OpenRouterKey, c.OpenRouterModel, 3)
+	agentOpts, err := c.AgentOptions()
+	if err != nil {
+		logger.Fatal("Invalid agent options", "error", err)
+	}
+	agentInst := agent.NewOpenRouterAgent(logger, c.OpenRouterKey, c.OpenRouterModel, agentOpts...)
 
 	// Initialize bank registry
 	registry := bank.NewRegistry()
@@ -94,6 +112,17 @@ func (c *CLI) Run() error {
 		return err
 	}
 
+	var alertConfig *db.AlertConfig
+	if c.AlertSensitivity != "off" {
+		config, err := db.AlertConfigFor(c.AlertSensitivity, c.HomeCountry)
+		if err != nil {
+			return err
+		}
+		alertConfig = &config
+	}
+
+	tripConfig := db.DefaultTripConfig(c.HomeCountry, c.HomeState)
+
 	// Process transactions
 	analyzedTransactions, err := an.AnalyzeTransactions(processCtx, transactions, analyzer.Config{
 		OpenRouterModel: c.OpenRouterModel,
@@ -101,6 +130,12 @@ func (c *CLI) Run() error {
 		Progress:        !c.NoProgress,
 		DryRun:          c.DryRun,
 		Limit:           c.Limit,
+
+		NoRedact:             c.NoRedact,
+		StrictRedactionBanks: c.StrictRedaction,
+		HelperTools:          c.HelperTools,
+		Alerts:               alertConfig,
+		Trips:                &tripConfig,
 	}, bankImpl)
 	if err != nil {
 		logger.Fatal("Failed to process transactions", "error", err)
@@ -119,9 +154,40 @@ func (c *CLI) Run() error {
 
 	logger.Info("Transactions processed successfully", "count", len(analyzedTransactions))
 
+	if alertConfig != nil {
+		ids := make([]string, len(analyzedTransactions))
+		for i, t := range analyzedTransactions {
+			ids[i] = db.GenerateTransactionID(t.Transaction)
+		}
+		alerts, err := database.GetTransactionAlerts(processCtx, ids)
+		if err != nil {
+			return err
+		}
+		printAlerts(alerts)
+	}
+
 	return nil
 }
 
+// printAlerts prints the alerts raised on newly imported transactions
+func printAlerts(alerts []db.Alert) {
+	if len(alerts) == 0 {
+		return
+	}
+	fmt.Printf("\n%d alerts on new transactions:\n", len(alerts))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tDATE\tAMOUNT\tALERT")
+	for _, a := range alerts {
+		var date, amount string
+		if a.Transaction != nil {
+			date, amount = a.Transaction.Date, a.Transaction.Amount.String()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", a.ID, a.Kind, date, amount, a.Message)
+	}
+	w.Flush()
+	fmt.Println("\nDismiss alerts once checked with bank-transaction-manage alerts dismiss <id>")
+}
+
 // Initialize the analyzer with the embedding provider and vector storage
 func initAnalyzer(ctx context.Context, config *CLI, agentInst *agent.Agent, database *db.DB, logger *log.Logger) (*analyzer.Analyzer, error) {
 	// Initialize embedding provider using the common setup
@@ -138,6 +204,9 @@ func initAnalyzer(ctx context.Context, config *CLI, agentInst *agent.Agent, data
 		return nil, err
 	}
 
+	// Merchant names that don't match an alias are resolved by embedding similarity
+	database.SetMerchantEmbedder(embeddingProvider.GenerateEmbedding)
+
 	// Create analyzer with all the required dependencies
 	return analyzer.NewAnalyzer(agentInst, logger, database, embeddingProvider, vectorStorage), nil
 }
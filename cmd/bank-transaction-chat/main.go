@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/agent"
+	"github.com/lox/bank-transaction-analyzer/internal/commands"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/embeddings"
+	"github.com/lox/bank-transaction-analyzer/internal/redact"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxSources is the number of relied-on transactions printed after an answer
+const maxSources = 10
+
+type CLI struct {
+	commands.CommonConfig
+	commands.EmbeddingConfig
+	commands.AgentConfig
+
+	BaseURL string `help:"Base URL of an OpenAI-compatible chat API (e.g. http://localhost:11434/v1 for Ollama)" default:"https://openrouter.ai/api/v1" env:"CHAT_BASE_URL"`
+	APIKey  string `help:"API key for the chat API" env:"CHAT_API_KEY,OPENROUTER_API_KEY"`
+	Model   string `help:"Model to chat with" default:"google/gemini-2.5-flash-preview" env:"CHAT_MODEL"`
+
+	MaxTurns  int           `help:"Maximum rounds of tool calls per question" default:"8"`
+	Timeout   time.Duration `help:"Timeout for answering each question" default:"2m"`
+	NoVector  bool          `help:"Use text search only, without embeddings" default:"false"`
+	NoSources bool          `help:"Don't print the transactions each answer relied on" default:"false"`
+	NoRedact  bool          `help:"Send transaction text to the chat API without redacting card, account and phone numbers or names" default:"false"`
+	Question  string        `arg:"" optional:"" help:"Question to answer; starts an interactive session if omitted"`
+}
+
+func (c *CLI) Run() error {
+	logger := log.New(os.Stderr)
+
+	level, err := log.ParseLevel(c.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+	logger.SetLevel(level)
+
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return fmt.Errorf("failed to load timezone: %w", err)
+	}
+
+	database, err := db.New(c.DataDir, logger, loc)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer database.Close()
+	if err := database.SetBaseCurrency(c.BaseCurrency); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	// Vector search is optional, the agent falls back to text search without it
+	var provider embeddings.EmbeddingProvider
+	var vectors embeddings.VectorStorage
+	if !c.NoVector {
+		provider, vectors, err = c.setupVectorComponents(ctx, logger)
+		if err != nil {
+			logger.Warn("Vector search unavailable, using text search only", "error", err)
+		} else {
+			defer commands.CloseEmbeddingProvider(provider, logger)
+		}
+	}
+
+	agentOpts, err := c.AgentOptions()
+	if err != nil {
+		return err
+	}
+	agentInst := agent.NewOpenAICompatibleAgent(logger, c.BaseURL, c.APIKey, c.Model, agentOpts...)
+
+	var redactor *redact.Redactor
+	if !c.NoRedact {
+		redactor = redact.New(false)
+	}
+	tools := newChatTools(database, logger, loc, provider, vectors, redactor)
+	registry := tools.registry()
+	system := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: systemPrompt(time.Now().In(loc)),
+	}
+	messages := []openai.ChatCompletionMessage{system}
+
+	ask := func(question string) error {
+		askCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+
+		result, err := agentInst.Chat(askCtx, append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: question,
+		}), registry, c.MaxTurns)
+		sources := tools.takeSources()
+		if err != nil {
+			return err
+		}
+		messages = result.Messages
+
+		// The conversation keeps the placeholders, the user sees the original values
+		fmt.Println(strings.TrimSpace(tools.restore(result.Reply)))
+		if !c.NoSources {
+			printSources(tools, result.ToolCalls, sources)
+		}
+		return nil
+	}
+
+	if c.Question != "" {
+		return ask(c.Question)
+	}
+
+	fmt.Println("Ask about your transactions. Type /reset to start over, or exit to quit.")
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+		question := strings.TrimSpace(scanner.Text())
+		switch question {
+		case "":
+			continue
+		case "exit", "quit":
+			return nil
+		case "/reset":
+			messages = []openai.ChatCompletionMessage{system}
+			fmt.Println("Conversation reset.")
+			continue
+		}
+		if err := ask(question); err != nil {
+			logger.Error("Failed to answer question", "error", err)
+		}
+		fmt.Println()
+	}
+}
+
+// setupVectorComponents initializes the embedding provider and vector storage
+func (c *CLI) setupVectorComponents(ctx context.Context, logger *log.Logger) (embeddings.EmbeddingProvider, embeddings.VectorStorage, error) {
+	provider, err := commands.SetupEmbeddingProvider(ctx, c.EmbeddingConfig, logger)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize embedding provider: %w", err)
+	}
+
+	vectors, err := commands.SetupVectorStorage(ctx, c.DataDir, provider, logger)
+	if err != nil {
+		commands.CloseEmbeddingProvider(provider, logger)
+		return nil, nil, fmt.Errorf("failed to create vector storage: %w", err)
+	}
+
+	return provider, vectors, nil
+}
+
+// systemPrompt tells the model how to answer questions from the transaction tools
+func systemPrompt(now time.Time) string {
+	return fmt.Sprintf(`You answer questions about the user's bank transactions using the tools provided.
+
+Today is %s.
+
+RULES:
+1. Always use the tools to look up transactions, never guess amounts or dates
+2. Amounts are signed: spending is negative and income or refunds are positive
+3. Use aggregate_transactions for totals, averages over months or "how much" questions, rather than adding up listed transactions yourself
+4. Use search_transactions for vague descriptions and list_transactions for exact filters
+5. Dates passed to tools are YYYY-MM-DD
+6. Call several tools at once when they don't depend on each other
+7. Answer concisely in plain text, quoting amounts to the cent
+
+TRANSACTION TYPES: %s
+CATEGORIES: %s`,
+		now.Format("Monday 2 January 2006"),
+		strings.Join(typeNames(), ", "),
+		strings.Join(categoryNames(), ", "))
+}
+
+// printSources prints the tool calls made and the transactions the answer relied on
+func printSources(tools *chatTools, toolCalls []openai.ToolCall, sources []types.TransactionWithDetails) {
+	if len(toolCalls) == 0 {
+		return
+	}
+	fmt.Println()
+	for _, tc := range toolCalls {
+		fmt.Printf("  ↳ %s %s\n", tc.Function.Name, tools.restore(tc.Function.Arguments))
+	}
+	if len(sources) == 0 {
+		return
+	}
+	fmt.Println("\nTransactions:")
+	for i, t := range sources {
+		if i == maxSources {
+			fmt.Printf("  ... and %d more\n", len(sources)-maxSources)
+			break
+		}
+		fmt.Printf("  %s  %10s  %-40s  %s\n", t.Date, t.Amount, t.Payee, t.ID)
+	}
+}
+
+func main() {
+	var cli CLI
+	ctx := kong.Parse(&cli,
+		kong.Name("bank-transaction-chat"),
+		kong.Description("Ask questions about your transactions"),
+		kong.UsageOnError(),
+	)
+
+	if err := ctx.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
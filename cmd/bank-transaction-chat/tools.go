@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/agent"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/embeddings"
+	"github.com/lox/bank-transaction-analyzer/internal/redact"
+	"github.com/lox/bank-transaction-analyzer/internal/search"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/shopspring/decimal"
+)
+
+// Default and maximum number of transactions a tool returns to the model
+const (
+	defaultToolLimit = 25
+	maxToolLimit     = 200
+)
+
+// chatTools backs the chat agent's tools with the local database, and records
+// every transaction shown to the model so the answer can cite them
+type chatTools struct {
+	db         *db.DB
+	logger     *log.Logger
+	timezone   *time.Location
+	embeddings embeddings.EmbeddingProvider
+	vectors    embeddings.VectorStorage
+
+	// redaction replaces card and account numbers, phone numbers and transfer names in tool
+	// results with placeholders for the whole session, or is nil to send them as stored
+	redaction *redact.Redaction
+
+	mu      sync.Mutex
+	sources map[string]types.TransactionWithDetails
+}
+
+// newChatTools creates the chat tools, redacting their results with redactor unless it's nil
+func newChatTools(database *db.DB, logger *log.Logger, timezone *time.Location, provider embeddings.EmbeddingProvider, vectors embeddings.VectorStorage, redactor *redact.Redactor) *chatTools {
+	c := &chatTools{
+		db:         database,
+		logger:     logger,
+		timezone:   timezone,
+		embeddings: provider,
+		vectors:    vectors,
+		sources:    make(map[string]types.TransactionWithDetails),
+	}
+	if redactor != nil {
+		c.redaction = redactor.Redact("")
+	}
+	return c
+}
+
+// filterArgs are the filters shared by the list, search and aggregate tools
+type filterArgs struct {
+	FromDate    string           `json:"from_date"`
+	ToDate      string           `json:"to_date"`
+	Days        int              `json:"days"`
+	Category    string           `json:"category"`
+	Type        string           `json:"type"`
+	Merchant    string           `json:"merchant"`
+	Bank        string           `json:"bank"`
+	Cardholder  string           `json:"cardholder"`
+	Country     string           `json:"country"`
+	State       string           `json:"state"`
+	Locality    string           `json:"locality"`
+	Tags        []string         `json:"tags"`
+	AllTags     []string         `json:"all_tags"`
+	ExcludeTags []string         `json:"exclude_tags"`
+	MinAmount   *decimal.Decimal `json:"min_amount"`
+	MaxAmount   *decimal.Decimal `json:"max_amount"`
+	Limit       int              `json:"limit"`
+}
+
+// filterProperties are the JSON schema properties for filterArgs
+func filterProperties() map[string]any {
+	return map[string]any{
+		"from_date": map[string]any{"type": "string", "description": "Earliest date to include, as YYYY-MM-DD"},
+		"to_date":   map[string]any{"type": "string", "description": "Latest date to include, as YYYY-MM-DD"},
+		"days":      map[string]any{"type": "integer", "description": "Only include the last N days"},
+		"category": map[string]any{
+			"type": "string",
+			"enum": categoryNames(),
+		},
+		"type": map[string]any{
+			"type": "string",
+			"enum": typeNames(),
+		},
+		"merchant":     map[string]any{"type": "string", "description": "Exact merchant name, ignoring case"},
+		"bank":         map[string]any{"type": "string"},
+		"cardholder":   map[string]any{"type": "string", "description": "Person whose card was used"},
+		"country":      map[string]any{"type": "string", "description": "Country the transaction was made in, as a name or ISO code"},
+		"state":        map[string]any{"type": "string", "description": "State the transaction was made in, e.g. NSW or California"},
+		"locality":     map[string]any{"type": "string", "description": "City or suburb the transaction was made in"},
+		"tags":         map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Only transactions with any of these tags"},
+		"all_tags":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Only transactions with all of these tags"},
+		"exclude_tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Leave out transactions with any of these tags"},
+		"min_amount":   map[string]any{"type": "number", "description": "Minimum signed amount (spending is negative)"},
+		"max_amount":   map[string]any{"type": "number", "description": "Maximum signed amount (spending is negative)"},
+		"limit":        map[string]any{"type": "integer", "description": "Maximum number of results"},
+	}
+}
+
+// options converts the filters to database query options
+func (f filterArgs) options(timezone *time.Location) ([]db.TransactionQueryOption, error) {
+	var opts []db.TransactionQueryOption
+	var from, to time.Time
+	var err error
+	if f.FromDate != "" {
+		if from, err = time.ParseInLocation("2006-01-02", f.FromDate, timezone); err != nil {
+			return nil, fmt.Errorf("from_date must be YYYY-MM-DD: %w", err)
+		}
+	}
+	if f.ToDate != "" {
+		if to, err = time.ParseInLocation("2006-01-02", f.ToDate, timezone); err != nil {
+			return nil, fmt.Errorf("to_date must be YYYY-MM-DD: %w", err)
+		}
+	}
+	if !from.IsZero() || !to.IsZero() {
+		opts = append(opts, db.FilterByDateRange(from, to))
+	}
+	if f.Days > 0 {
+		opts = append(opts, db.FilterByDays(f.Days))
+	}
+	if f.Category != "" {
+		opts = append(opts, db.FilterByCategory(f.Category))
+	}
+	if f.Type != "" {
+		opts = append(opts, db.FilterByType(f.Type))
+	}
+	if f.Merchant != "" {
+		opts = append(opts, db.FilterByMerchant(f.Merchant))
+	}
+	if f.Bank != "" {
+		opts = append(opts, db.FilterByBank(f.Bank))
+	}
+	if f.Cardholder != "" {
+		opts = append(opts, db.FilterByCardholder(f.Cardholder))
+	}
+	if f.Country != "" {
+		opts = append(opts, db.FilterByCountry(f.Country))
+	}
+	if f.State != "" {
+		opts = append(opts, db.FilterByState(f.State))
+	}
+	if f.Locality != "" {
+		opts = append(opts, db.FilterByLocality(f.Locality))
+	}
+	if len(f.Tags) > 0 {
+		opts = append(opts, db.FilterByAnyTag(f.Tags...))
+	}
+	if len(f.AllTags) > 0 {
+		opts = append(opts, db.FilterByAllTags(f.AllTags...))
+	}
+	if len(f.ExcludeTags) > 0 {
+		opts = append(opts, db.ExcludeTags(f.ExcludeTags...))
+	}
+	minAmount, err := amountFilter(f.MinAmount)
+	if err != nil {
+		return nil, fmt.Errorf("min_amount: %w", err)
+	}
+	maxAmount, err := amountFilter(f.MaxAmount)
+	if err != nil {
+		return nil, fmt.Errorf("max_amount: %w", err)
+	}
+	if minAmount != "" || maxAmount != "" {
+		opts = append(opts, db.FilterByAmount(minAmount, maxAmount))
+	}
+	return opts, nil
+}
+
+// amountFilter formats an amount filter in the currency amounts are stored in, rejecting amounts
+// with more decimal places than it has rather than rounding them
+func amountFilter(amount *decimal.Decimal) (string, error) {
+	if amount == nil {
+		return "", nil
+	}
+	m, err := types.ParseMoney(amount.String(), types.DefaultCurrency)
+	if err != nil {
+		return "", err
+	}
+	return m.String(), nil
+}
+
+func (f filterArgs) limit() int {
+	if f.Limit <= 0 {
+		return defaultToolLimit
+	}
+	return min(f.Limit, maxToolLimit)
+}
+
+// registry builds the tools available to the chat agent
+func (c *chatTools) registry() *agent.ToolRegistry {
+	registry := agent.NewToolRegistry()
+
+	searchProps := filterProperties()
+	searchProps["query"] = map[string]any{"type": "string", "description": "What to search for, e.g. \"takeaway\" or \"flights to Japan\""}
+	registry.Register(openai.FunctionDefinition{
+		Name:        "search_transactions",
+		Description: "Search transactions by meaning and keywords, most relevant first",
+		Parameters:  map[string]any{"type": "object", "properties": searchProps, "required": []string{"query"}},
+	}, c.search)
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "list_transactions",
+		Description: "List transactions matching filters, newest first",
+		Parameters:  map[string]any{"type": "object", "properties": filterProperties()},
+	}, c.list)
+
+	aggregateProps := filterProperties()
+	aggregateProps["group_by"] = map[string]any{
+		"type": "string",
+		"enum": db.GroupBys,
+	}
+	aggregateProps["include_transfers"] = map[string]any{"type": "boolean", "description": "Include transfers between your own accounts, which are left out by default"}
+	aggregateProps["limit"] = map[string]any{"type": "integer", "description": "Maximum number of groups, largest first. Days, weeks, months, quarters and years are never limited."}
+	registry.Register(openai.FunctionDefinition{
+		Name:        "aggregate_transactions",
+		Description: "Total, count, average, min and max of transactions matching filters, with money out (debits) and in (credits) totalled separately, grouped by category, merchant, type, bank, account, tag, place or by day, week, month, quarter or year. Use this for any question about totals.",
+		Parameters:  map[string]any{"type": "object", "properties": aggregateProps, "required": []string{"group_by"}},
+	}, c.aggregate)
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "get_transaction",
+		Description: "Get the full details of a transaction by ID",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{"id": map[string]any{"type": "string"}},
+			"required":   []string{"id"},
+		},
+	}, c.get)
+
+	return registry
+}
+
+func (c *chatTools) search(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		filterArgs
+	}
+	if err := json.Unmarshal([]byte(c.restore(arguments)), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	if strings.TrimSpace(args.Query) == "" {
+		return "", fmt.Errorf("query is required")
+	}
+	filters, err := args.options(c.timezone)
+	if err != nil {
+		return "", err
+	}
+	opts := []search.SearchOption{
+		search.WithLimit(args.limit()),
+		search.OrderByRelevance(),
+		search.WithFilters(filters...),
+	}
+
+	var results []types.TransactionSearchResult
+	var total int
+	if c.embeddings != nil && c.vectors != nil {
+		searchResults, err := search.HybridSearch(ctx, c.logger, c.db, c.embeddings, c.vectors, args.Query, opts...)
+		if err != nil {
+			return "", err
+		}
+		results, total = searchResults.Results, searchResults.TotalCount
+	} else {
+		results, total, err = search.TextSearch(ctx, c.db, args.Query, opts...)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	transactions := make([]types.TransactionWithDetails, 0, len(results))
+	for _, r := range results {
+		transactions = append(transactions, r.TransactionWithDetails)
+	}
+	return c.formatTransactions(transactions, total), nil
+}
+
+func (c *chatTools) list(ctx context.Context, arguments string) (string, error) {
+	var args filterArgs
+	if err := json.Unmarshal([]byte(c.restore(arguments)), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	opts, err := args.options(c.timezone)
+	if err != nil {
+		return "", err
+	}
+	// Fetch one extra row to tell whether the list was truncated
+	transactions, err := c.db.GetTransactions(ctx, append(opts, db.WithLimit(args.limit()+1))...)
+	if err != nil {
+		return "", err
+	}
+	total := len(transactions)
+	if total > args.limit() {
+		transactions = transactions[:args.limit()]
+	}
+	return c.formatTransactions(transactions, total), nil
+}
+
+func (c *chatTools) aggregate(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		GroupBy          string `json:"group_by"`
+		IncludeTransfers bool   `json:"include_transfers"`
+		filterArgs
+	}
+	if err := json.Unmarshal([]byte(c.restore(arguments)), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	opts, err := args.options(c.timezone)
+	if err != nil {
+		return "", err
+	}
+	// Money moved between our own accounts isn't spending or income, as in budgets
+	if !args.IncludeTransfers {
+		opts = append(opts, db.ExcludeInternalTransfers())
+	}
+	// Dropping periods would leave gaps in a series, so only other groups are limited, fetching
+	// one extra to tell whether they were
+	limited := !db.IsPeriodGroup(args.GroupBy)
+	if limited {
+		opts = append(opts, db.WithLimit(args.limit()+1))
+	}
+	rows, err := c.db.Aggregate(ctx, args.GroupBy, opts...)
+	if err != nil {
+		return "", err
+	}
+	if len(rows) == 0 {
+		return "No matching transactions", nil
+	}
+	var sb strings.Builder
+	if limited && len(rows) > args.limit() {
+		rows = rows[:args.limit()]
+		sb.WriteString(fmt.Sprintf("Showing the %d largest groups, more match. Narrow the filters or raise the limit to see the rest.\n", len(rows)))
+	}
+	sb.WriteString(fmt.Sprintf("%s | total | count | average | min | max | debits | credits\n", args.GroupBy))
+	for _, r := range rows {
+		key := r.Key
+		if key == "" {
+			key = "(none)"
+		}
+		sb.WriteString(fmt.Sprintf("%s | %s | %d | %s | %s | %s | %s | %s\n", c.redact(key), r.Total.StringFixed(2), r.Count,
+			r.Average.StringFixed(2), r.Min.StringFixed(2), r.Max.StringFixed(2), r.Debits.StringFixed(2), r.Credits.StringFixed(2)))
+	}
+	return sb.String(), nil
+}
+
+func (c *chatTools) get(ctx context.Context, arguments string) (string, error) {
+	var args struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(c.restore(arguments)), &args); err != nil {
+		return "", fmt.Errorf("invalid arguments: %w", err)
+	}
+	t, err := c.db.GetTransactionByID(ctx, args.ID)
+	if err != nil {
+		return "", err
+	}
+	c.record(*t)
+	data, err := json.MarshalIndent(c.redactTransaction(*t), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// formatTransactions renders transactions compactly for the model and records them as sources
+func (c *chatTools) formatTransactions(transactions []types.TransactionWithDetails, total int) string {
+	if len(transactions) == 0 {
+		return "No matching transactions"
+	}
+	var sb strings.Builder
+	if total > len(transactions) {
+		sb.WriteString(fmt.Sprintf("Showing %d of %d or more matching transactions. Use aggregate_transactions for totals.\n", len(transactions), total))
+	}
+	sb.WriteString("id | date | amount | payee | merchant | category | type\n")
+	for _, t := range transactions {
+		c.record(t)
+		t = c.redactTransaction(t)
+		sb.WriteString(fmt.Sprintf("%s | %s | %s | %s | %s | %s | %s\n",
+			t.ID, t.Date, t.Amount, t.Payee, t.Details.Merchant, t.Details.Category, t.Details.Type))
+		for _, split := range t.Splits {
+			sb.WriteString(fmt.Sprintf("  split: %s\n", split))
+		}
+		if len(t.Details.Tags) > 0 {
+			sb.WriteString(fmt.Sprintf("  tags: %s\n", strings.Join(t.Details.Tags, ", ")))
+		}
+		if t.Details.Notes != "" {
+			sb.WriteString(fmt.Sprintf("  notes: %s\n", t.Details.Notes))
+		}
+	}
+	return sb.String()
+}
+
+// redact replaces sensitive values in text sent to the model with placeholders
+func (c *chatTools) redact(text string) string {
+	if c.redaction == nil {
+		return text
+	}
+	return c.redaction.Apply(text)
+}
+
+// restore replaces placeholders the model sent back, in tool arguments or its reply, with the
+// original values
+func (c *chatTools) restore(text string) string {
+	if c.redaction == nil {
+		return text
+	}
+	return c.redaction.Restore(text)
+}
+
+// redactTransaction returns a copy of the transaction with its payee and other free text redacted
+func (c *chatTools) redactTransaction(t types.TransactionWithDetails) types.TransactionWithDetails {
+	if c.redaction == nil {
+		return t
+	}
+	t.Payee = c.redact(t.Payee)
+	t.Details.Merchant = c.redact(t.Details.Merchant)
+	t.Details.Location = c.redact(t.Details.Location)
+	t.Details.Description = c.redact(t.Details.Description)
+	t.Details.SearchBody = c.redact(t.Details.SearchBody)
+	t.Details.CardNumber = c.redact(t.Details.CardNumber)
+	t.Details.Notes = c.redact(t.Details.Notes)
+	if t.Details.TransferDetails != nil {
+		transfer := *t.Details.TransferDetails
+		transfer.ToAccount = c.redact(transfer.ToAccount)
+		transfer.FromAccount = c.redact(transfer.FromAccount)
+		transfer.Reference = c.redact(transfer.Reference)
+		t.Details.TransferDetails = &transfer
+	}
+	splits := make([]types.Split, len(t.Splits))
+	for i, split := range t.Splits {
+		split.Note = c.redact(split.Note)
+		splits[i] = split
+	}
+	t.Splits = splits
+	return t
+}
+
+func (c *chatTools) record(t types.TransactionWithDetails) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sources[t.ID] = t
+}
+
+// takeSources returns the transactions shown to the model since the last call, newest first
+func (c *chatTools) takeSources() []types.TransactionWithDetails {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sources := make([]types.TransactionWithDetails, 0, len(c.sources))
+	for _, t := range c.sources {
+		sources = append(sources, t)
+	}
+	c.sources = make(map[string]types.TransactionWithDetails)
+
+	sort.Slice(sources, func(i, j int) bool {
+		di, _ := time.Parse("02/01/2006", sources[i].Date)
+		dj, _ := time.Parse("02/01/2006", sources[j].Date)
+		if !di.Equal(dj) {
+			return di.After(dj)
+		}
+		return sources[i].ID < sources[j].ID
+	})
+	return sources
+}
+
+func categoryNames() []string {
+	names := make([]string, len(types.AllowedCategories))
+	for i, c := range types.AllowedCategories {
+		names[i] = c.Name
+	}
+	return names
+}
+
+func typeNames() []string {
+	names := make([]string, len(types.AllowedTypes))
+	for i, t := range types.AllowedTypes {
+		names[i] = t.Name
+	}
+	return names
+}
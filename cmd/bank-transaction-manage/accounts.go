@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+type AccountsCmd struct {
+	List     AccountsListCmd     `cmd:"" help:"List accounts and the currency each is held in."`
+	Currency AccountsCurrencyCmd `cmd:"" help:"Set the currency an account is held in."`
+}
+
+type AccountsListCmd struct{}
+
+type AccountsCurrencyCmd struct {
+	Account  string `arg:"" help:"Account name, as assigned to cards, or the bank for transactions without one"`
+	Currency string `arg:"" help:"3-letter currency code (e.g. USD)"`
+}
+
+func (c *AccountsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	accounts, err := database.GetAccounts(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		fmt.Println("No accounts found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tCURRENCY\tTRANSACTIONS")
+	for _, a := range accounts {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", a.Name, a.Currency, a.TransactionCount)
+	}
+	return w.Flush()
+}
+
+func (c *AccountsCurrencyCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	moved, err := database.SetAccountCurrency(context.Background(), c.Account, c.Currency)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Set %s to %s, moving %d existing transactions\n", c.Account, c.Currency, moved)
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+type AlertsCmd struct {
+	List    AlertsListCmd    `cmd:"" help:"List alerts on unusual transactions."`
+	Dismiss AlertsDismissCmd `cmd:"" help:"Dismiss alerts once they've been checked."`
+}
+
+type AlertsListCmd struct {
+	All bool `help:"Include dismissed alerts"`
+}
+
+type AlertsDismissCmd struct {
+	Alerts []int64 `arg:"" help:"Alert IDs"`
+}
+
+func (c *AlertsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	alerts, err := database.GetAlerts(context.Background(), c.All)
+	if err != nil {
+		return err
+	}
+	if len(alerts) == 0 {
+		fmt.Println("No alerts found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tDATE\tAMOUNT\tTRANSACTION\tALERT")
+	for _, a := range alerts {
+		var date, amount string
+		if a.Transaction != nil {
+			date, amount = a.Transaction.Date, a.Transaction.Amount.String()
+		}
+		message := a.Message
+		if a.Dismissed {
+			message += " (dismissed)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", a.ID, a.Kind, date, amount, a.TransactionID, message)
+	}
+	return w.Flush()
+}
+
+func (c *AlertsDismissCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	for _, id := range c.Alerts {
+		if err := database.DismissAlert(context.Background(), id); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Dismissed %d alerts\n", len(c.Alerts))
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/commands"
+)
+
+type NotesCmd struct {
+	Set   NotesSetCmd   `cmd:"" help:"Set the notes on a transaction."`
+	Clear NotesClearCmd `cmd:"" help:"Remove the notes from a transaction."`
+}
+
+type NotesSetCmd struct {
+	ID    string `arg:"" help:"Transaction ID"`
+	Notes string `arg:"" help:"Notes, e.g. \"client dinner, claimable\""`
+}
+
+type NotesClearCmd struct {
+	ID string `arg:"" help:"Transaction ID"`
+}
+
+type AttachmentsCmd struct {
+	Add    AttachmentsAddCmd    `cmd:"" help:"Attach files such as receipts to a transaction."`
+	List   AttachmentsListCmd   `cmd:"" help:"List the files attached to a transaction."`
+	Open   AttachmentsOpenCmd   `cmd:"" help:"Open an attached file."`
+	Remove AttachmentsRemoveCmd `cmd:"" help:"Remove an attached file."`
+}
+
+type AttachmentsAddCmd struct {
+	ID    string   `arg:"" help:"Transaction ID"`
+	Files []string `arg:"" type:"existingfile" help:"Files to attach"`
+}
+
+type AttachmentsListCmd struct {
+	ID string `arg:"" help:"Transaction ID"`
+}
+
+type AttachmentsOpenCmd struct {
+	Attachment int64 `arg:"" help:"Attachment ID"`
+}
+
+type AttachmentsRemoveCmd struct {
+	Attachment int64 `arg:"" help:"Attachment ID"`
+}
+
+func (c *NotesSetCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.SetNotes(context.Background(), c.ID, c.Notes); err != nil {
+		return err
+	}
+	fmt.Printf("Set notes on %s\n", c.ID)
+	return nil
+}
+
+func (c *NotesClearCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.SetNotes(context.Background(), c.ID, ""); err != nil {
+		return err
+	}
+	fmt.Printf("Removed notes from %s\n", c.ID)
+	return nil
+}
+
+func (c *AttachmentsAddCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	for _, file := range c.Files {
+		a, err := database.AttachFile(context.Background(), c.ID, file)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Attached %s to %s (attachment %d)\n", a.Filename, c.ID, a.ID)
+	}
+	return nil
+}
+
+func (c *AttachmentsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	attachments, err := database.GetAttachments(context.Background(), c.ID)
+	if err != nil {
+		return err
+	}
+	if len(attachments) == 0 {
+		fmt.Println("No attachments found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFILENAME\tTYPE\tSIZE\tPATH")
+	for _, a := range attachments {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", a.ID, a.Filename, a.ContentType, a.Size, database.AttachmentPath(&a))
+	}
+	return w.Flush()
+}
+
+func (c *AttachmentsOpenCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	a, err := database.GetAttachment(context.Background(), c.Attachment)
+	if err != nil {
+		return err
+	}
+	return commands.OpenFile(database.AttachmentPath(a))
+}
+
+func (c *AttachmentsRemoveCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.RemoveAttachment(context.Background(), c.Attachment); err != nil {
+		return err
+	}
+	fmt.Printf("Removed attachment %d\n", c.Attachment)
+	return nil
+}
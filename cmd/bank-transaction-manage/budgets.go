@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/shopspring/decimal"
+)
+
+type BudgetsCmd struct {
+	Set    BudgetsSetCmd    `cmd:"" help:"Set a monthly or annual budget for a category or tag."`
+	List   BudgetsListCmd   `cmd:"" help:"List budgets."`
+	Remove BudgetsRemoveCmd `cmd:"" help:"Remove a budget."`
+}
+
+type BudgetsSetCmd struct {
+	Amount   string `arg:"" help:"Most to spend each period, e.g. 600"`
+	Category string `help:"Category the budget is for" xor:"target" required:""`
+	Tag      string `help:"Tag the budget is for" xor:"target" required:""`
+	Period   string `help:"Period the budget resets over" default:"monthly" enum:"monthly,annual"`
+}
+
+type BudgetsListCmd struct{}
+
+type BudgetsRemoveCmd struct {
+	Budget int64 `arg:"" help:"Budget ID"`
+}
+
+func (c *BudgetsSetCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	amount, err := decimal.NewFromString(c.Amount)
+	if err != nil {
+		return fmt.Errorf("invalid amount %q: %w", c.Amount, err)
+	}
+	b, err := database.SetBudget(context.Background(), db.Budget{Category: c.Category, Tag: c.Tag, Period: c.Period, Amount: amount})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Set %s budget for %s to %s (budget %d)\n", b.Period, b.Name(), b.Amount.StringFixed(2), b.ID)
+	return nil
+}
+
+func (c *BudgetsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	budgets, err := database.GetBudgets(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(budgets) == 0 {
+		fmt.Println("No budgets found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tBUDGET\tPERIOD\tAMOUNT")
+	for _, b := range budgets {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", b.ID, b.Name(), b.Period, b.Amount.StringFixed(2))
+	}
+	return w.Flush()
+}
+
+func (c *BudgetsRemoveCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.DeleteBudget(context.Background(), c.Budget); err != nil {
+		return err
+	}
+	fmt.Printf("Removed budget %d\n", c.Budget)
+	return nil
+}
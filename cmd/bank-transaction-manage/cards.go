@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+type CardsCmd struct {
+	List   CardsListCmd   `cmd:"" help:"List all cards seen on transactions."`
+	Assign CardsAssignCmd `cmd:"" help:"Assign a cardholder, account or label to a card."`
+}
+
+type CardsListCmd struct{}
+
+type CardsAssignCmd struct {
+	Card       string  `arg:"" help:"Card token or last 4 digits"`
+	Cardholder *string `help:"Name of the person the card belongs to"`
+	Account    *string `help:"Account the card is attached to"`
+	Label      *string `help:"Label for the card (e.g. 'Supplementary Amex')"`
+}
+
+func (c *CardsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	cards, err := database.GetCards(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(cards) == 0 {
+		fmt.Println("No cards found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOKEN\tCARD\tBANK\tCARDHOLDER\tACCOUNT\tLABEL\tTRANSACTIONS")
+	for _, card := range cards {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n",
+			card.Token, card.MaskedNumber, card.Bank, card.Cardholder, card.Account, card.Label, card.TransactionCount)
+	}
+	return w.Flush()
+}
+
+func (c *CardsAssignCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.UpdateCard(context.Background(), c.Card, c.Cardholder, c.Account, c.Label); err != nil {
+		return err
+	}
+	fmt.Printf("Updated card %s\n", c.Card)
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+type DeductionsCmd struct {
+	Set        DeductionsSetCmd        `cmd:"" help:"Mark a transaction as deductible in a deduction category."`
+	Clear      DeductionsClearCmd      `cmd:"" help:"Mark a transaction as not deductible."`
+	Merchant   DeductionsMerchantCmd   `cmd:"" help:"Set the deduction category applied to a merchant's transactions."`
+	Categories DeductionsCategoriesCmd `cmd:"" help:"List the deduction categories."`
+}
+
+type DeductionsSetCmd struct {
+	ID   string `arg:"" help:"Transaction ID"`
+	Code string `arg:"" help:"Deduction category, e.g. D5"`
+}
+
+type DeductionsClearCmd struct {
+	ID string `arg:"" help:"Transaction ID"`
+}
+
+type DeductionsMerchantCmd struct {
+	Merchant string `arg:"" help:"Merchant ID, name or alias"`
+	Code     string `arg:"" optional:"" help:"Deduction category, e.g. D5, or empty to stop applying one"`
+}
+
+type DeductionsCategoriesCmd struct{}
+
+func (c *DeductionsSetCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.SetDeduction(context.Background(), c.ID, c.Code); err != nil {
+		return err
+	}
+	category, _ := types.DeductionCategoryByCode(c.Code)
+	fmt.Printf("Marked %s as deductible under %s %s\n", c.ID, category.Code, category.Name)
+	return nil
+}
+
+func (c *DeductionsClearCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.SetDeduction(context.Background(), c.ID, ""); err != nil {
+		return err
+	}
+	fmt.Printf("Marked %s as not deductible\n", c.ID)
+	return nil
+}
+
+func (c *DeductionsMerchantCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	m, err := database.FindMerchant(ctx, c.Merchant)
+	if err != nil {
+		return err
+	}
+	applied, err := database.SetMerchantDeduction(ctx, m.ID, c.Code)
+	if err != nil {
+		return err
+	}
+	if c.Code == "" {
+		fmt.Printf("Removed the deduction category from %s\n", m.Name)
+		return nil
+	}
+	category, _ := types.DeductionCategoryByCode(c.Code)
+	fmt.Printf("Set %s to %s %s, applied to %d transactions\n", m.Name, category.Code, category.Name, applied)
+	return nil
+}
+
+func (c *DeductionsCategoriesCmd) Run(cli *ManageCLI) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tNAME")
+	for _, category := range types.AllowedDeductionCategories {
+		fmt.Fprintf(w, "%s\t%s\n", category.Code, category.Name)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type FXCmd struct {
+	Import FXImportCmd `cmd:"" help:"Load mid-market exchange rates from a CSV file."`
+	Match  FXMatchCmd  `cmd:"" help:"Link international transaction fees to the foreign purchases they were charged for."`
+}
+
+type FXImportCmd struct {
+	File string `arg:"" help:"CSV file with date (YYYY-MM-DD), currency, rate and optional quote columns, where the rate is the quote currency (the base currency by default) for one unit of the currency" type:"existingfile"`
+}
+
+type FXMatchCmd struct {
+	Window int `help:"Maximum days between a foreign purchase and its fee" default:"3"`
+}
+
+func (c *FXImportCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	f, err := os.Open(c.File)
+	if err != nil {
+		return fmt.Errorf("failed to open rates file: %w", err)
+	}
+	defer f.Close()
+
+	rates, err := db.ParseFXRates(f)
+	if err != nil {
+		return err
+	}
+	if err := database.ImportFXRates(context.Background(), rates); err != nil {
+		return err
+	}
+	fmt.Printf("Loaded %d exchange rates\n", len(rates))
+	return nil
+}
+
+func (c *FXMatchCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	matches, err := database.RefreshFXFeeLinks(context.Background(), c.Window)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Linked %d international transaction fees\n", len(matches))
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+type LocationsCmd struct {
+	List    LocationsListCmd    `cmd:"" help:"List locations and the places they resolved to."`
+	Resolve LocationsResolveCmd `cmd:"" help:"Resolve every transaction's location against the gazetteer again."`
+}
+
+type LocationsListCmd struct {
+	Unresolved bool `help:"Only list locations that didn't resolve to a locality"`
+}
+
+type LocationsResolveCmd struct{}
+
+func (c *LocationsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	locations, err := database.GetLocations(context.Background(), c.Unresolved)
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		fmt.Println("No locations found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCATION\tLOCALITY\tSTATE\tPOSTCODE\tCOUNTRY\tTRANSACTIONS")
+	for _, l := range locations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n", l.Location, l.Place.Locality, l.Place.State, l.Place.Postcode, l.Place.Country, l.Count)
+	}
+	return w.Flush()
+}
+
+func (c *LocationsResolveCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	count, err := database.ResolveLocations(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Resolved %d locations\n", count)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/commands"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type ManageCLI struct {
+	commands.CommonConfig
+	Cards       CardsCmd       `cmd:"" help:"Manage cards and cardholders."`
+	Accounts    AccountsCmd    `cmd:"" help:"Set the currency each account is held in."`
+	Transfers   TransfersCmd   `cmd:"" help:"Match and link transfers between your own accounts."`
+	Refunds     RefundsCmd     `cmd:"" help:"Link refunds to the purchases they reverse."`
+	Splits      SplitsCmd      `cmd:"" help:"Split transactions across categories."`
+	Merchants   MerchantsCmd   `cmd:"" help:"Manage canonical merchants and their aliases."`
+	Locations   LocationsCmd   `cmd:"" help:"Review how transaction locations resolved to places."`
+	Tags        TagsCmd        `cmd:"" help:"Tag transactions and manage tags."`
+	Notes       NotesCmd       `cmd:"" help:"Write notes on transactions."`
+	Attachments AttachmentsCmd `cmd:"" help:"Attach files such as receipts to transactions."`
+	Budgets     BudgetsCmd     `cmd:"" help:"Set spending budgets for categories and tags."`
+	Deductions  DeductionsCmd  `cmd:"" help:"Mark transactions and merchants as tax deductible."`
+	Alerts      AlertsCmd      `cmd:"" help:"Review and dismiss alerts on unusual transactions."`
+	FX          FXCmd          `cmd:"" name:"fx" help:"Load exchange rates and link international transaction fees."`
+	Trips       TripsCmd       `cmd:"" help:"Detect, rename and tag trips."`
+}
+
+// openDatabase sets up logging and opens the transaction database
+func (cli *ManageCLI) openDatabase() (*log.Logger, *db.DB, error) {
+	logger := log.New(os.Stderr)
+	level, err := log.ParseLevel(cli.LogLevel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid log level: %w", err)
+	}
+	logger.SetLevel(level)
+
+	loc, err := time.LoadLocation(cli.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load timezone: %w", err)
+	}
+
+	database, err := db.New(cli.DataDir, logger, loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if err := database.SetBaseCurrency(cli.BaseCurrency); err != nil {
+		return nil, nil, err
+	}
+	return logger, database, nil
+}
+
+func main() {
+	cli := &ManageCLI{}
+	ctx := kong.Parse(cli,
+		kong.Name("bank-transaction-manage"),
+		kong.Description("Manage cards and other reference data for bank transactions"),
+		kong.UsageOnError(),
+	)
+	// Dispatch to the selected subcommand
+	err := ctx.Run(cli)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+type MerchantsCmd struct {
+	List    MerchantsListCmd    `cmd:"" help:"List canonical merchants."`
+	Show    MerchantsShowCmd    `cmd:"" help:"Show a merchant and its aliases."`
+	Update  MerchantsUpdateCmd  `cmd:"" help:"Rename a merchant or set its default category, website or notes."`
+	Merge   MerchantsMergeCmd   `cmd:"" help:"Merge duplicate merchants into one."`
+	Split   MerchantsSplitCmd   `cmd:"" help:"Move aliases wrongly resolved to a merchant onto a new merchant."`
+	Resolve MerchantsResolveCmd `cmd:"" help:"Resolve merchants for transactions stored before merchants existed."`
+}
+
+type MerchantsListCmd struct {
+	Query string `arg:"" optional:"" help:"Only list merchants whose name or an alias contains this"`
+}
+
+type MerchantsShowCmd struct {
+	Merchant string `arg:"" help:"Merchant ID, name or alias"`
+}
+
+type MerchantsUpdateCmd struct {
+	Merchant string  `arg:"" help:"Merchant ID, name or alias"`
+	Name     *string `help:"New canonical name"`
+	Category *string `help:"Category for transactions the classifier leaves uncategorised"`
+	Website  *string `help:"Merchant website"`
+	Notes    *string `help:"Notes about the merchant"`
+}
+
+type MerchantsMergeCmd struct {
+	Target  string   `arg:"" help:"Merchant to keep"`
+	Sources []string `arg:"" help:"Merchants to merge into it"`
+}
+
+type MerchantsSplitCmd struct {
+	Merchant string   `arg:"" help:"Merchant ID, name or alias"`
+	Aliases  []string `arg:"" help:"Aliases to move to the new merchant"`
+	Name     string   `help:"Name of the new merchant (default: the first alias)"`
+}
+
+type MerchantsResolveCmd struct{}
+
+func (c *MerchantsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	merchants, err := database.GetMerchants(context.Background(), c.Query)
+	if err != nil {
+		return err
+	}
+	if len(merchants) == 0 {
+		fmt.Println("No merchants found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tCATEGORY\tTRANSACTIONS\tALIASES")
+	for _, m := range merchants {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", m.ID, m.Name, m.DefaultCategory, m.TransactionCount, strings.Join(m.Aliases, ", "))
+	}
+	return w.Flush()
+}
+
+func (c *MerchantsShowCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	m, err := database.FindMerchant(context.Background(), c.Merchant)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (ID %d)\n", m.Name, m.ID)
+	fmt.Printf("  Transactions: %d\n", m.TransactionCount)
+	if m.DefaultCategory != "" {
+		fmt.Printf("  Default category: %s\n", m.DefaultCategory)
+	}
+	if m.DefaultDeduction != "" {
+		fmt.Printf("  Default deduction: %s\n", m.DefaultDeduction)
+	}
+	if m.Website != "" {
+		fmt.Printf("  Website: %s\n", m.Website)
+	}
+	if m.Notes != "" {
+		fmt.Printf("  Notes: %s\n", m.Notes)
+	}
+	fmt.Println("  Aliases:")
+	for _, alias := range m.Aliases {
+		fmt.Printf("    %s\n", alias)
+	}
+	return nil
+}
+
+func (c *MerchantsUpdateCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	m, err := database.FindMerchant(ctx, c.Merchant)
+	if err != nil {
+		return err
+	}
+	if err := database.UpdateMerchant(ctx, m.ID, c.Name, c.Category, c.Website, c.Notes); err != nil {
+		return err
+	}
+	fmt.Printf("Updated merchant %d\n", m.ID)
+	return nil
+}
+
+func (c *MerchantsMergeCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	target, err := database.FindMerchant(ctx, c.Target)
+	if err != nil {
+		return err
+	}
+	var sources []int64
+	for _, ref := range c.Sources {
+		source, err := database.FindMerchant(ctx, ref)
+		if err != nil {
+			return err
+		}
+		sources = append(sources, source.ID)
+	}
+	if err := database.MergeMerchants(ctx, target.ID, sources...); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d merchants into %s\n", len(sources), target.Name)
+	return nil
+}
+
+func (c *MerchantsSplitCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	m, err := database.FindMerchant(ctx, c.Merchant)
+	if err != nil {
+		return err
+	}
+	name := c.Name
+	if name == "" {
+		name = c.Aliases[0]
+	}
+	id, err := database.SplitMerchant(ctx, m.ID, c.Aliases, name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Split %d aliases from %s into %s (ID %d)\n", len(c.Aliases), m.Name, name, id)
+	return nil
+}
+
+func (c *MerchantsResolveCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	count, err := database.ResolveMerchants(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Resolved merchants for %d transactions\n", count)
+	return nil
+}
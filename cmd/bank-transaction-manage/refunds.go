@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+type RefundsCmd struct {
+	Match  RefundsMatchCmd  `cmd:"" help:"Link refunds to the purchases they reverse."`
+	List   RefundsListCmd   `cmd:"" help:"List linked refunds."`
+	Link   RefundsLinkCmd   `cmd:"" help:"Link a refund to the purchase it reverses."`
+	Unlink RefundsUnlinkCmd `cmd:"" help:"Unlink a refund so it isn't linked again."`
+}
+
+type RefundsMatchCmd struct {
+	Window int `help:"Maximum days between a purchase and its refund" default:"120"`
+}
+
+type RefundsListCmd struct{}
+
+type RefundsLinkCmd struct {
+	Refund   string `arg:"" help:"ID of the refund"`
+	Purchase string `arg:"" help:"ID of the purchase it reverses"`
+}
+
+type RefundsUnlinkCmd struct {
+	Refund string `arg:"" help:"ID of the refund"`
+}
+
+func (c *RefundsMatchCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	matches, err := database.RefreshRefundLinks(context.Background(), c.Window)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Linked %d refunds\n", len(matches))
+	return nil
+}
+
+func (c *RefundsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	matches, err := database.GetRefundLinks(ctx)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Println("No refunds linked")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AMOUNT\tREFUND\tPURCHASE\tFULL\tSOURCE")
+	for _, m := range matches {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", m.Amount.StringFixed(2),
+			describeTransaction(ctx, database, m.RefundID), describeTransaction(ctx, database, m.PurchaseID), m.Full, m.Source)
+	}
+	return w.Flush()
+}
+
+func (c *RefundsLinkCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.LinkRefund(context.Background(), c.Refund, c.Purchase); err != nil {
+		return err
+	}
+	fmt.Printf("Linked refund %s to purchase %s\n", c.Refund, c.Purchase)
+	return nil
+}
+
+func (c *RefundsUnlinkCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.UnlinkRefund(context.Background(), c.Refund); err != nil {
+		return err
+	}
+	fmt.Printf("Unlinked refund %s\n", c.Refund)
+	return nil
+}
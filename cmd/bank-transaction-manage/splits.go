@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+type SplitsCmd struct {
+	Show  SplitsShowCmd  `cmd:"" help:"Show the splits on a transaction."`
+	Set   SplitsSetCmd   `cmd:"" help:"Split a transaction across categories, replacing any existing splits."`
+	Clear SplitsClearCmd `cmd:"" help:"Remove the splits from a transaction."`
+}
+
+type SplitsShowCmd struct {
+	ID string `arg:"" help:"ID of the transaction"`
+}
+
+type SplitsSetCmd struct {
+	ID     string   `arg:"" help:"ID of the transaction"`
+	Splits []string `arg:"" help:"Splits as amount:category[:tags[:note]], which must sum to the transaction amount"`
+}
+
+type SplitsClearCmd struct {
+	ID string `arg:"" help:"ID of the transaction"`
+}
+
+func (c *SplitsShowCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	t, err := database.GetTransactionByID(context.Background(), c.ID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s %s (%s)\n", t.Date, t.Amount, t.Payee, t.Details.Category)
+	if len(t.Splits) == 0 {
+		fmt.Println("No splits")
+	}
+	for _, split := range t.Splits {
+		fmt.Printf("  %s\n", split)
+	}
+	return nil
+}
+
+func (c *SplitsSetCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var splits []types.Split
+	for _, arg := range c.Splits {
+		split, err := db.ParseSplit(arg)
+		if err != nil {
+			return err
+		}
+		splits = append(splits, split)
+	}
+	if err := database.SetSplits(context.Background(), c.ID, splits); err != nil {
+		return err
+	}
+	fmt.Printf("Split %s into %d parts\n", c.ID, len(splits))
+	return nil
+}
+
+func (c *SplitsClearCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.SetSplits(context.Background(), c.ID, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Removed splits from %s\n", c.ID)
+	return nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+type TagsCmd struct {
+	List   TagsListCmd   `cmd:"" help:"List tags and how many transactions have them."`
+	Add    TagsAddCmd    `cmd:"" help:"Add tags to a transaction."`
+	Remove TagsRemoveCmd `cmd:"" help:"Remove tags from a transaction."`
+	Rename TagsRenameCmd `cmd:"" help:"Rename a tag on every transaction."`
+	Merge  TagsMergeCmd  `cmd:"" help:"Merge tags into one."`
+}
+
+type TagsListCmd struct{}
+
+type TagsAddCmd struct {
+	ID   string   `arg:"" help:"Transaction ID"`
+	Tags []string `arg:"" help:"Tags to add"`
+}
+
+type TagsRemoveCmd struct {
+	ID   string   `arg:"" help:"Transaction ID"`
+	Tags []string `arg:"" help:"Tags to remove"`
+}
+
+type TagsRenameCmd struct {
+	From string `arg:"" help:"Tag to rename"`
+	To   string `arg:"" help:"New name"`
+}
+
+type TagsMergeCmd struct {
+	Target  string   `arg:"" help:"Tag to keep, created if it doesn't exist"`
+	Sources []string `arg:"" help:"Tags to merge into it"`
+}
+
+func (c *TagsListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	tags, err := database.GetTags(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		fmt.Println("No tags found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tTRANSACTIONS")
+	for _, tag := range tags {
+		fmt.Fprintf(w, "%s\t%d\n", tag.Name, tag.TransactionCount)
+	}
+	return w.Flush()
+}
+
+func (c *TagsAddCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.AddTags(context.Background(), c.ID, c.Tags...); err != nil {
+		return err
+	}
+	fmt.Printf("Tagged %s\n", c.ID)
+	return nil
+}
+
+func (c *TagsRemoveCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.RemoveTags(context.Background(), c.ID, c.Tags...); err != nil {
+		return err
+	}
+	fmt.Printf("Removed tags from %s\n", c.ID)
+	return nil
+}
+
+func (c *TagsRenameCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.RenameTag(context.Background(), c.From, c.To); err != nil {
+		return err
+	}
+	fmt.Printf("Renamed %s to %s\n", c.From, c.To)
+	return nil
+}
+
+func (c *TagsMergeCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.MergeTags(context.Background(), c.Target, c.Sources...); err != nil {
+		return err
+	}
+	fmt.Printf("Merged %d tags into %s\n", len(c.Sources), c.Target)
+	return nil
+}
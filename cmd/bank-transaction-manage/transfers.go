@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type TransfersCmd struct {
+	Match  TransfersMatchCmd  `cmd:"" help:"Match transfers between your own accounts."`
+	List   TransfersListCmd   `cmd:"" help:"List matched transfers."`
+	Link   TransfersLinkCmd   `cmd:"" help:"Link two transactions as the sides of a transfer."`
+	Unlink TransfersUnlinkCmd `cmd:"" help:"Unlink a transfer so it isn't matched again."`
+}
+
+type TransfersMatchCmd struct {
+	Window int `help:"Maximum days between the two sides of a transfer" default:"4"`
+}
+
+type TransfersListCmd struct{}
+
+type TransfersLinkCmd struct {
+	First  string `arg:"" help:"ID of one side of the transfer"`
+	Second string `arg:"" help:"ID of the other side of the transfer"`
+}
+
+type TransfersUnlinkCmd struct {
+	ID string `arg:"" help:"ID of either side of the transfer"`
+}
+
+func (c *TransfersMatchCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	matches, err := database.RefreshTransferMatches(context.Background(), c.Window)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Matched %d transfers\n", len(matches))
+	return nil
+}
+
+func (c *TransfersListCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	matches, err := database.GetTransferMatches(ctx)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		fmt.Println("No transfers matched")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AMOUNT\tFROM\tTO\tSOURCE")
+	for _, m := range matches {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", m.Amount.StringFixed(2),
+			describeTransaction(ctx, database, m.DebitID), describeTransaction(ctx, database, m.CreditID), m.Source)
+	}
+	return w.Flush()
+}
+
+// describeTransaction summarises a transaction as its date, bank and payee
+func describeTransaction(ctx context.Context, database *db.DB, id string) string {
+	t, err := database.GetTransactionByID(ctx, id)
+	if err != nil {
+		return id
+	}
+	return fmt.Sprintf("%s %s %s", t.Date, t.Bank, t.Payee)
+}
+
+func (c *TransfersLinkCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.LinkTransfer(context.Background(), c.First, c.Second); err != nil {
+		return err
+	}
+	fmt.Printf("Linked %s and %s as a transfer\n", c.First, c.Second)
+	return nil
+}
+
+func (c *TransfersUnlinkCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.UnlinkTransfer(context.Background(), c.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Unlinked transfer on %s\n", c.ID)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type TripsCmd struct {
+	Detect TripsDetectCmd `cmd:"" help:"Detect trips from spending away from home."`
+	Rename TripsRenameCmd `cmd:"" help:"Rename a trip."`
+	Tag    TripsTagCmd    `cmd:"" help:"Tag every transaction on a trip, bookings included."`
+}
+
+type TripsDetectCmd struct {
+	HomeCountry string `help:"Country you live in, as a name or ISO code" default:"AU" env:"HOME_COUNTRY"`
+	HomeState   string `help:"State you live in, so interstate spending is detected as trips too" env:"HOME_STATE"`
+	MaxGap      int    `help:"Maximum days between spending away before a trip is over" default:"3"`
+	Min         int    `help:"Minimum transactions away to count as a trip" default:"3"`
+	Window      int    `help:"Maximum days before a trip that travel bookings count towards it" default:"180"`
+}
+
+type TripsRenameCmd struct {
+	ID   string `arg:"" help:"Trip ID"`
+	Name string `arg:"" help:"New name for the trip"`
+}
+
+type TripsTagCmd struct {
+	ID   string   `arg:"" help:"Trip ID"`
+	Tags []string `arg:"" help:"Tags to add"`
+}
+
+func (c *TripsDetectCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	config := db.DefaultTripConfig(c.HomeCountry, c.HomeState)
+	config.MaxGap, config.MinTransactions, config.BookingWindow = c.MaxGap, c.Min, c.Window
+	trips, err := database.RefreshTrips(context.Background(), config)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Detected %d trips\n", len(trips))
+	return nil
+}
+
+func (c *TripsRenameCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	if err := database.RenameTrip(context.Background(), c.ID, c.Name); err != nil {
+		return err
+	}
+	fmt.Printf("Renamed trip %s to %s\n", c.ID, c.Name)
+	return nil
+}
+
+func (c *TripsTagCmd) Run(cli *ManageCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	tagged, err := database.TagTrip(context.Background(), c.ID, c.Tags...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Tagged %d transactions on trip %s\n", tagged, c.ID)
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type BudgetsCmd struct {
+	Format string `help:"Output format" default:"table" enum:"table,json"`
+}
+
+func (c *BudgetsCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	statuses, err := database.GetBudgetStatus(context.Background(), cli.now())
+	if err != nil {
+		return err
+	}
+
+	if c.Format == "json" {
+		if statuses == nil {
+			statuses = []db.BudgetStatus{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(statuses)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No budgets found, set one with bank-transaction-manage budgets set")
+		return nil
+	}
+
+	breached := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BUDGET\tPERIOD\tBUDGETED\tSPENT\tREMAINING\tPROJECTED\tSTATUS")
+	for _, s := range statuses {
+		status := s.Status
+		if s.Breached() {
+			breached++
+			status = "! " + status
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name(), periodLabel(s), s.Amount.StringFixed(2),
+			s.Spent.StringFixed(2), s.Remaining.StringFixed(2), s.Projected.StringFixed(2), status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if breached > 0 {
+		fmt.Printf("\n%d of %d budgets are over or on pace to go over\n", breached, len(statuses))
+	}
+	return nil
+}
+
+// periodLabel names the period a budget is being evaluated over, e.g. "Mar 2024" or "2024"
+func periodLabel(s db.BudgetStatus) string {
+	if s.Period == db.BudgetAnnual {
+		return s.Start.Format("2006")
+	}
+	return s.Start.Format("Jan 2006")
+}
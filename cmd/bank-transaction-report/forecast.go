@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/shopspring/decimal"
+)
+
+type ForecastCmd struct {
+	Balance    string `help:"Current balance to forecast from, e.g. 5230.10" required:""`
+	Days       int    `help:"Number of days to forecast" default:"90"`
+	LowBalance string `help:"Warn about days expected to end below this balance" default:"0"`
+	Lookback   int    `help:"Number of days of past spending to average discretionary spending over" default:"90"`
+	Bank       string `help:"Only forecast one bank's transactions and recurring payments"`
+	Format     string `help:"Output format" default:"table" enum:"table,json,csv"`
+}
+
+func (c *ForecastCmd) Run(cli *ReportCLI) error {
+	balance, err := decimal.NewFromString(c.Balance)
+	if err != nil {
+		return fmt.Errorf("invalid balance %q: %w", c.Balance, err)
+	}
+	lowBalance, err := decimal.NewFromString(c.LowBalance)
+	if err != nil {
+		return fmt.Errorf("invalid low balance %q: %w", c.LowBalance, err)
+	}
+
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	f, err := database.ForecastCashFlow(context.Background(), cli.now(), db.ForecastOptions{
+		Balance:      balance,
+		Days:         c.Days,
+		LowBalance:   lowBalance,
+		LookbackDays: c.Lookback,
+		Bank:         c.Bank,
+	})
+	if err != nil {
+		return err
+	}
+
+	switch c.Format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(f)
+	case "csv":
+		return writeForecastCSV(os.Stdout, f)
+	}
+
+	fmt.Printf("Forecast from %s to %s, starting from %s\n", f.Start.Format("2006-01-02"), f.End.Format("2006-01-02"), f.OpeningBalance.StringFixed(2))
+	fmt.Printf("Discretionary spending of %s a day, averaged over the last %d days\n\n", f.DailyDiscretionary.StringFixed(2), f.LookbackDays)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AFTER\tDATE\tBALANCE")
+	for _, days := range []int{30, 60, 90} {
+		if balance, ok := f.BalanceAfter(days); ok {
+			fmt.Fprintf(w, "%d days\t%s\t%s\n", days, f.Days[days-1].Date.Format("2006-01-02"), balance.StringFixed(2))
+		}
+	}
+	if len(f.Days) > 0 {
+		lowest := f.Lowest()
+		fmt.Fprintf(w, "Lowest\t%s\t%s\n", lowest.Date.Format("2006-01-02"), lowest.Balance.StringFixed(2))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if low := f.LowBalanceDays(); len(low) > 0 {
+		fmt.Printf("\nWarning: %d days are expected to end below %s, starting %s\n", len(low), f.LowBalance.StringFixed(2), low[0].Date.Format("2006-01-02"))
+	}
+
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tINCOME\tBILLS\tDISCRETIONARY\tBALANCE\t\tEXPECTED")
+	for _, day := range f.Days {
+		flag := ""
+		if day.Low {
+			flag = "LOW"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", day.Date.Format("2006-01-02"), day.Income.StringFixed(2), day.Bills.StringFixed(2),
+			day.Discretionary.StringFixed(2), day.Balance.StringFixed(2), flag, forecastPayments(day))
+	}
+	return w.Flush()
+}
+
+// forecastPayments lists the recurring payments expected on a day
+func forecastPayments(day db.ForecastDay) string {
+	payments := make([]string, len(day.Payments))
+	for i, p := range day.Payments {
+		payments[i] = p.String()
+	}
+	return strings.Join(payments, ", ")
+}
+
+func writeForecastCSV(out io.Writer, f *db.CashFlowForecast) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"date", "income", "bills", "discretionary", "balance", "low", "expected"}); err != nil {
+		return err
+	}
+	for _, day := range f.Days {
+		if err := w.Write([]string{
+			day.Date.Format("2006-01-02"),
+			day.Income.StringFixed(2),
+			day.Bills.StringFixed(2),
+			day.Discretionary.StringFixed(2),
+			day.Balance.StringFixed(2),
+			fmt.Sprint(day.Low),
+			forecastPayments(day),
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
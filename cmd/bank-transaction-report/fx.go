@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/shopspring/decimal"
+)
+
+type FXCmd struct {
+	Currency     string `help:"Only include spending in this currency, e.g. USD"`
+	Bank         string `help:"Only include one bank's transactions"`
+	Days         int    `help:"Only include the last N days"`
+	From         string `help:"Earliest date to include, as YYYY-MM-DD"`
+	To           string `help:"Latest date to include, as YYYY-MM-DD"`
+	Transactions bool   `help:"List each foreign purchase with its exchange rates"`
+	Format       string `help:"Output format" default:"table" enum:"table,csv,json"`
+}
+
+func (c *FXCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	opts := []db.TransactionQueryOption{db.FilterByForeignCurrency(c.Currency)}
+	if c.Bank != "" {
+		opts = append(opts, db.FilterByBank(c.Bank))
+	}
+	dates, err := cli.dateFilters(c.Days, c.From, c.To)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, dates...)
+
+	report, err := database.GetFXReport(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+
+	switch c.Format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "csv":
+		return writeFXCSV(os.Stdout, report)
+	}
+
+	if len(report.Currencies) == 0 {
+		fmt.Println("No foreign spending found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CURRENCY\tTRANSACTIONS\tFOREIGN\tSPENT\tFEES\tEFFECTIVE RATE\tMARKUP")
+	for _, spend := range report.Currencies {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", spend.Currency, spend.Count, spend.ForeignAmount.StringFixed(2), spend.Amount.StringFixed(2),
+			spend.Fees.StringFixed(2), spend.EffectiveRate.String(), markup(spend.MarkupPercent))
+	}
+	fmt.Fprintf(w, "Total\t\t\t%s\t%s\t\t\n", report.TotalAmount.StringFixed(2), report.TotalFees.StringFixed(2))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !c.Transactions {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tMERCHANT\tFOREIGN\tAMOUNT\tFEE\tIMPLIED\tEFFECTIVE\tMID-MARKET\tMARKUP")
+	for _, t := range report.Transactions {
+		mid := ""
+		if !t.MidMarketRate.IsZero() {
+			mid = t.MidMarketRate.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s %s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Date, t.Details.Merchant,
+			t.Details.ForeignAmount.Amount.StringFixed(2), t.Details.ForeignAmount.Currency, t.Amount,
+			t.Details.FXFee.StringFixed(2), t.ImpliedRate.String(), t.EffectiveRate.String(), mid, markup(t.MarkupPercent))
+	}
+	return w.Flush()
+}
+
+// markup formats a markup over the mid-market rate, blank when no rate was loaded
+func markup(percent decimal.Decimal) string {
+	if percent.IsZero() {
+		return ""
+	}
+	return percent.StringFixed(2) + "%"
+}
+
+// writeFXCSV writes one row per foreign purchase
+func writeFXCSV(out io.Writer, report *db.FXReport) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"date", "id", "merchant", "currency", "foreign_amount", "amount", "fee", "implied_rate", "effective_rate", "mid_market_rate", "markup_percent"}); err != nil {
+		return err
+	}
+	for _, t := range report.Transactions {
+		var mid, markup string
+		if !t.MidMarketRate.IsZero() {
+			mid, markup = t.MidMarketRate.String(), t.MarkupPercent.StringFixed(2)
+		}
+		if err := w.Write([]string{
+			t.Date,
+			t.ID,
+			t.Details.Merchant,
+			t.Details.ForeignAmount.Currency,
+			t.Details.ForeignAmount.Amount.StringFixed(2),
+			t.Amount.String(),
+			t.Details.FXFee.StringFixed(2),
+			t.ImpliedRate.String(),
+			t.EffectiveRate.String(),
+			mid,
+			markup,
+		}); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
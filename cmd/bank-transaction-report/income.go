@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type IncomeCmd struct {
+	Period  string `help:"Total income by month or Australian financial year" default:"monthly" enum:"monthly,financial-year"`
+	Periods int    `help:"Number of periods to total, most recent first" default:"3"`
+	Format  string `help:"Output format" default:"table" enum:"table,json"`
+}
+
+func (c *IncomeCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	now := cli.now()
+	sources, err := database.GetIncomeSources(ctx)
+	if err != nil {
+		return err
+	}
+	periods, err := database.IncomeReport(ctx, c.Period, c.Periods, now)
+	if err != nil {
+		return err
+	}
+
+	if c.Format == "json" {
+		type sourceStatus struct {
+			db.IncomeSource
+			Status string `json:"status"`
+		}
+		statuses := make([]sourceStatus, len(sources))
+		for i, s := range sources {
+			s.TransactionIDs = nil
+			statuses[i] = sourceStatus{s, s.Status(now)}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Sources []sourceStatus     `json:"sources"`
+			Periods []db.IncomeSummary `json:"periods"`
+		}{statuses, periods})
+	}
+
+	if len(sources) == 0 {
+		fmt.Println("No income found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tKIND\tPAY CYCLE\tUSUAL\tLAST\tLAST DATE\tNEXT DATE\tSTATUS")
+	for _, s := range sources {
+		cadence, usual, next := "-", "-", "-"
+		if s.Cadence != "" {
+			cadence, usual, next = s.Cadence, s.UsualAmount.StringFixed(2), s.NextDate.Format("2006-01-02")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.Name, s.Kind, cadence, usual,
+			s.LastAmount.StringFixed(2), s.LastDate.Format("2006-01-02"), next, s.Status(now))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, p := range periods {
+		fmt.Printf("\n%s\n", p.Period)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "SOURCE\tKIND\tDEPOSITS\tAMOUNT")
+		for _, s := range p.Sources {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", s.Name, s.Kind, s.Count, s.Amount.StringFixed(2))
+		}
+		fmt.Fprintf(w, "Total\t\t\t%s\n", p.Total.StringFixed(2))
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/commands"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type ReportCLI struct {
+	commands.CommonConfig
+	Subscriptions SubscriptionsCmd `cmd:"" help:"List recurring payments and subscriptions."`
+	Travel        TravelCmd        `cmd:"" help:"Show spending while travelling, by country and place."`
+	Trips         TripsCmd         `cmd:"" help:"List trips and what each cost, or show one trip's transactions."`
+	Tags          TagsCmd          `cmd:"" help:"Show totals for each tag."`
+	Receipts      ReceiptsCmd      `cmd:"" help:"List deductible transactions that are missing a receipt."`
+	Summary       SummaryCmd       `cmd:"" help:"Summarise income, expenses and top spending by month or year."`
+	Income        IncomeCmd        `cmd:"" help:"Show income by source with pay cycles, flagging late or different salary deposits."`
+	Budgets       BudgetsCmd       `cmd:"" help:"Show spending against budgets this month and year."`
+	Forecast      ForecastCmd      `cmd:"" help:"Forecast the balance day by day from recurring payments and average spending."`
+	Tax           TaxCmd           `cmd:"" help:"Total deductions, donations, interest and bank fees for an Australian financial year."`
+	FX            FXCmd            `cmd:"" name:"fx" help:"Show foreign spending by currency, with exchange rates and fees."`
+}
+
+// openDatabase sets up logging and opens the transaction database
+func (cli *ReportCLI) openDatabase() (*log.Logger, *db.DB, error) {
+	logger := log.New(os.Stderr)
+	level, err := log.ParseLevel(cli.LogLevel)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid log level: %w", err)
+	}
+	logger.SetLevel(level)
+
+	loc, err := time.LoadLocation(cli.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load timezone: %w", err)
+	}
+
+	database, err := db.New(cli.DataDir, logger, loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+	if err := database.SetBaseCurrency(cli.BaseCurrency); err != nil {
+		return nil, nil, err
+	}
+	return logger, database, nil
+}
+
+// dateFilters returns the query options for the --days, --from and --to flags shared by reports
+func (cli *ReportCLI) dateFilters(days int, fromDate, toDate string) ([]db.TransactionQueryOption, error) {
+	var opts []db.TransactionQueryOption
+	if days > 0 {
+		opts = append(opts, db.FilterByDays(days))
+	}
+	var from, to time.Time
+	var err error
+	if fromDate != "" {
+		if from, err = time.ParseInLocation("2006-01-02", fromDate, cli.now().Location()); err != nil {
+			return nil, fmt.Errorf("--from must be YYYY-MM-DD: %w", err)
+		}
+	}
+	if toDate != "" {
+		if to, err = time.ParseInLocation("2006-01-02", toDate, cli.now().Location()); err != nil {
+			return nil, fmt.Errorf("--to must be YYYY-MM-DD: %w", err)
+		}
+	}
+	if !from.IsZero() || !to.IsZero() {
+		opts = append(opts, db.FilterByDateRange(from, to))
+	}
+	return opts, nil
+}
+
+// now returns the current time in the configured timezone
+func (cli *ReportCLI) now() time.Time {
+	loc, err := time.LoadLocation(cli.Timezone)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Now().In(loc)
+}
+
+func main() {
+	cli := &ReportCLI{}
+	ctx := kong.Parse(cli,
+		kong.Name("bank-transaction-report"),
+		kong.Description("Reports over analyzed bank transactions"),
+		kong.UsageOnError(),
+	)
+	// Dispatch to the selected subcommand
+	err := ctx.Run(cli)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+type ReceiptsCmd struct {
+	Tag    []string `help:"Tags that mark a transaction as deductible" default:"deductible"`
+	Days   int      `help:"Only include the last N days"`
+	From   string   `help:"Earliest date to include, as YYYY-MM-DD"`
+	To     string   `help:"Latest date to include, as YYYY-MM-DD"`
+	Format string   `help:"Output format" default:"table" enum:"table,json"`
+}
+
+func (c *ReceiptsCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Deductible transactions with nothing attached to back them up
+	opts := []db.TransactionQueryOption{
+		db.FilterByAnyTag(c.Tag...),
+		db.FilterByMissingAttachment(),
+	}
+	dates, err := cli.dateFilters(c.Days, c.From, c.To)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, dates...)
+
+	transactions, err := database.GetTransactions(context.Background(), opts...)
+	if err != nil {
+		return err
+	}
+
+	if c.Format == "json" {
+		if transactions == nil {
+			transactions = []types.TransactionWithDetails{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(transactions)
+	}
+
+	if len(transactions) == 0 {
+		fmt.Println("Every deductible transaction has a receipt")
+		return nil
+	}
+
+	total := decimal.Zero
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tAMOUNT\tMERCHANT\tTAGS\tNOTES")
+	for _, t := range transactions {
+		amount, err := database.ToBaseCurrency(context.Background(), t.Amount, t.Date)
+		if err != nil {
+			return err
+		}
+		total = total.Add(amount)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Date, t.Amount, t.Details.Merchant, strings.Join(t.Details.Tags, ", "), t.Details.Notes)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n%d deductible transactions totalling %s %s are missing a receipt\n", len(transactions), total.StringFixed(2), database.BaseCurrency())
+	return nil
+}
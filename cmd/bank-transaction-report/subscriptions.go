@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/shopspring/decimal"
+)
+
+type SubscriptionsCmd struct {
+	Stopped   bool   `help:"Include series that have stopped"`
+	Income    bool   `help:"Include recurring income as well as payments"`
+	NoRefresh bool   `help:"List the stored series without detecting them again first"`
+	Format    string `help:"Output format" default:"table" enum:"table,json"`
+}
+
+func (c *SubscriptionsCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	if !c.NoRefresh {
+		if _, err := database.RefreshRecurringSeries(ctx); err != nil {
+			return err
+		}
+	}
+	series, err := database.GetRecurringSeries(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := cli.now()
+	var shown []db.RecurringSeries
+	for _, s := range series {
+		if (!c.Stopped && s.Stopped(now)) || (!c.Income && s.Amount.IsPositive()) {
+			continue
+		}
+		shown = append(shown, s)
+	}
+
+	if c.Format == "json" {
+		type subscription struct {
+			db.RecurringSeries
+			Status string `json:"status"`
+		}
+		out := make([]subscription, len(shown))
+		for i, s := range shown {
+			out[i] = subscription{RecurringSeries: s, Status: s.Status(now)}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+
+	if len(shown) == 0 {
+		fmt.Println("No recurring payments found")
+		return nil
+	}
+
+	monthly := decimal.Zero
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MERCHANT\tCADENCE\tAMOUNT\tLAST\tNEXT\tPAYMENTS\tSTATUS")
+	for _, s := range shown {
+		status := s.Status(now)
+		if s.PriceChanged() {
+			status = fmt.Sprintf("%s (was %s)", status, s.PreviousAmount.StringFixed(2))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n",
+			s.Merchant, s.Cadence, s.Amount.StringFixed(2),
+			s.LastDate.Format("2006-01-02"), s.NextDate.Format("2006-01-02"), s.TransactionCount, status)
+		if !s.Stopped(now) {
+			monthly = monthly.Add(s.MonthlyAmount())
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nActive recurring total per month: %s\n", monthly.StringFixed(2))
+	return nil
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/shopspring/decimal"
+)
+
+type SummaryCmd struct {
+	Period  string `help:"Summarise by month or year" default:"monthly" enum:"monthly,yearly"`
+	Periods int    `help:"Number of periods to summarise, most recent first" default:"1"`
+	Top     int    `help:"Number of top categories and merchants to show" default:"5"`
+	Format  string `help:"Output format" default:"table" enum:"table,markdown,json,csv"`
+}
+
+func (c *SummaryCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	summaries, err := database.SpendingReport(context.Background(), c.Period, c.Periods, c.Top, cli.now())
+	if err != nil {
+		return err
+	}
+
+	switch c.Format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaries)
+	case "csv":
+		return writeSummaryCSV(os.Stdout, summaries)
+	case "markdown":
+		writeSummaryMarkdown(os.Stdout, summaries)
+		return nil
+	}
+
+	for i, s := range summaries {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(s.Period)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		totals := summaryTotals(s)
+		fmt.Fprintln(w, strings.ToUpper(strings.Join(totals[0], "\t")))
+		for _, row := range totals[1:] {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		for _, section := range summarySpending(s) {
+			fmt.Println()
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "%s\tTRANSACTIONS\tSPENT\n", strings.ToUpper(section.title))
+			for _, t := range section.totals {
+				fmt.Fprintf(w, "%s\t%d\t%s\n", t.Name, t.Count, t.Amount.StringFixed(2))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spendingSection is a titled list of top spending
+type spendingSection struct {
+	title  string
+	totals []db.SpendingTotal
+}
+
+func summarySpending(s db.SpendingSummary) []spendingSection {
+	return []spendingSection{{"Top categories", s.TopCategories}, {"Top merchants", s.TopMerchants}}
+}
+
+// summaryTotals lays out income, expenses, net and savings rate with the changes from the
+// periods compared against, starting with a header row
+func summaryTotals(s db.SpendingSummary) [][]string {
+	changes := []*db.SummaryChange{s.PreviousPeriod, s.PreviousYear}
+	rows := [][]string{{"", "Amount"}}
+	for _, c := range changes {
+		if c != nil {
+			rows[0] = append(rows[0], "vs "+c.Period)
+		}
+	}
+
+	add := func(label string, amount decimal.Decimal, change func(c *db.SummaryChange) string) {
+		row := []string{label, amount.StringFixed(2)}
+		for _, c := range changes {
+			if c != nil {
+				row = append(row, change(c))
+			}
+		}
+		rows = append(rows, row)
+	}
+	add("Income", s.Income, func(c *db.SummaryChange) string { return signed(c.Income) })
+	add("Expenses", s.Expenses, func(c *db.SummaryChange) string {
+		if c.ExpensesPercent.IsZero() {
+			return signed(c.Expenses)
+		}
+		return fmt.Sprintf("%s (%s%%)", signed(c.Expenses), signedPercent(c.ExpensesPercent))
+	})
+	add("Net", s.Net, func(c *db.SummaryChange) string { return signed(c.Net) })
+	rows = append(rows, []string{"Savings rate", s.SavingsRate.StringFixed(1) + "%"})
+	return rows
+}
+
+// signed formats an amount with a leading + when it's positive
+func signed(d decimal.Decimal) string {
+	if d.IsPositive() {
+		return "+" + d.StringFixed(2)
+	}
+	return d.StringFixed(2)
+}
+
+func signedPercent(d decimal.Decimal) string {
+	if d.IsPositive() {
+		return "+" + d.StringFixed(1)
+	}
+	return d.StringFixed(1)
+}
+
+func writeSummaryMarkdown(w io.Writer, summaries []db.SpendingSummary) {
+	for i, s := range summaries {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "## %s\n\n", s.Period)
+		totals := summaryTotals(s)
+		header := totals[0]
+		writeMarkdownRow(w, header)
+		align := []string{"---"}
+		for range header[1:] {
+			align = append(align, "---:")
+		}
+		writeMarkdownRow(w, align)
+		for _, row := range totals[1:] {
+			for len(row) < len(header) {
+				row = append(row, "")
+			}
+			writeMarkdownRow(w, row)
+		}
+		for _, section := range summarySpending(s) {
+			fmt.Fprintf(w, "\n### %s\n\n", section.title)
+			writeMarkdownRow(w, []string{"Name", "Transactions", "Spent"})
+			writeMarkdownRow(w, []string{"---", "---:", "---:"})
+			for _, t := range section.totals {
+				writeMarkdownRow(w, []string{t.Name, strconv.Itoa(t.Count), t.Amount.StringFixed(2)})
+			}
+		}
+	}
+}
+
+func writeMarkdownRow(w io.Writer, cells []string) {
+	for i, cell := range cells {
+		cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+}
+
+// writeSummaryCSV writes one row per figure, so every period and section shares the same columns
+func writeSummaryCSV(out io.Writer, summaries []db.SpendingSummary) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"period", "section", "name", "transactions", "amount", "change_previous_period", "change_previous_year"}); err != nil {
+		return err
+	}
+	change := func(c *db.SummaryChange, value func(c *db.SummaryChange) decimal.Decimal) string {
+		if c == nil {
+			return ""
+		}
+		return value(c).StringFixed(2)
+	}
+	for _, s := range summaries {
+		figures := []struct {
+			name   string
+			amount decimal.Decimal
+			value  func(c *db.SummaryChange) decimal.Decimal
+		}{
+			{"income", s.Income, func(c *db.SummaryChange) decimal.Decimal { return c.Income }},
+			{"expenses", s.Expenses, func(c *db.SummaryChange) decimal.Decimal { return c.Expenses }},
+			{"net", s.Net, func(c *db.SummaryChange) decimal.Decimal { return c.Net }},
+		}
+		for _, f := range figures {
+			if err := w.Write([]string{s.Period, "totals", f.name, "", f.amount.StringFixed(2),
+				change(s.PreviousPeriod, f.value), change(s.PreviousYear, f.value)}); err != nil {
+				return err
+			}
+		}
+		if err := w.Write([]string{s.Period, "totals", "savings_rate", "", s.SavingsRate.StringFixed(1), "", ""}); err != nil {
+			return err
+		}
+		for _, section := range []struct {
+			name   string
+			totals []db.SpendingTotal
+		}{{"category", s.TopCategories}, {"merchant", s.TopMerchants}} {
+			for _, t := range section.totals {
+				if err := w.Write([]string{s.Period, section.name, t.Name, strconv.Itoa(t.Count), t.Amount.StringFixed(2), "", ""}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
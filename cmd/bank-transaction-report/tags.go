@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type TagsCmd struct {
+	Tag       []string `help:"Only report on these tags"`
+	Untagged  bool     `help:"Include a row for transactions without tags"`
+	Days      int      `help:"Only include the last N days"`
+	From      string   `help:"Earliest date to include, as YYYY-MM-DD"`
+	To        string   `help:"Latest date to include, as YYYY-MM-DD"`
+	Format    string   `help:"Output format" default:"table" enum:"table,json"`
+	Transfers bool     `help:"Include transfers between your own accounts"`
+}
+
+func (c *TagsCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	var opts []db.TransactionQueryOption
+	if !c.Transfers {
+		opts = append(opts, db.ExcludeInternalTransfers())
+	}
+	if len(c.Tag) > 0 {
+		opts = append(opts, db.FilterByAnyTag(c.Tag...))
+	}
+	dates, err := cli.dateFilters(c.Days, c.From, c.To)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, dates...)
+
+	rows, err := database.Aggregate(context.Background(), db.GroupByTag, opts...)
+	if err != nil {
+		return err
+	}
+
+	// A transaction with several tags counts towards each, so only the tags listed are kept
+	var totals []db.AggregateRow
+	for _, row := range rows {
+		if row.Key == "" && !c.Untagged {
+			continue
+		}
+		if len(c.Tag) > 0 && !containsFold(c.Tag, row.Key) {
+			continue
+		}
+		totals = append(totals, row)
+	}
+
+	if c.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if totals == nil {
+			totals = []db.AggregateRow{}
+		}
+		return enc.Encode(totals)
+	}
+
+	if len(totals) == 0 {
+		fmt.Println("No tagged transactions found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tTRANSACTIONS\tTOTAL")
+	for _, row := range totals {
+		tag := row.Key
+		if tag == "" {
+			tag = "(untagged)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", tag, row.Count, row.Total.StringFixed(2))
+	}
+	return w.Flush()
+}
+
+// containsFold reports whether values contains s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
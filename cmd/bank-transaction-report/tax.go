@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+type TaxCmd struct {
+	Year   int    `help:"Financial year, by the year it ends, e.g. 2024 for July 2023 to June 2024 (default: the current one)"`
+	Format string `help:"Output format" default:"table" enum:"table,csv,json"`
+}
+
+func (c *TaxCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	year := c.Year
+	if year == 0 {
+		year = db.FinancialYearOf(cli.now())
+	}
+	report, err := database.GetTaxReport(context.Background(), year)
+	if err != nil {
+		return err
+	}
+
+	switch c.Format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "csv":
+		return writeTaxCSV(os.Stdout, report)
+	}
+
+	fmt.Printf("Financial year %d-%02d (%s to %s)\n\n", year-1, year%100, report.Start.Format("2006-01-02"), report.End.Format("2006-01-02"))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CODE\tDEDUCTION\tTRANSACTIONS\tAMOUNT")
+	for _, d := range report.Deductions {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", d.Code, d.Name, d.Count, d.Amount.StringFixed(2))
+	}
+	fmt.Fprintf(w, "\tTotal deductions\t%d\t%s\n", len(report.Deductible), report.TotalDeductions.StringFixed(2))
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	sections := []struct {
+		title string
+		items []db.TaxItem
+		total string
+	}{
+		{"Missing a receipt or notes", report.Flagged(), ""},
+		{"Donations", report.Donations, report.TotalDonations.StringFixed(2)},
+		{"Interest earned", report.Interest, report.TotalInterest.StringFixed(2)},
+		{"Bank fees", report.BankFees, report.TotalBankFees.StringFixed(2)},
+	}
+	for _, section := range sections {
+		if len(section.items) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s\n", section.title)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDATE\tMERCHANT\tAMOUNT\tMISSING")
+		for _, item := range section.items {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.ID, item.Date, item.Details.Merchant, item.TaxAmount.StringFixed(2), strings.Join(taxFlags(item), ", "))
+		}
+		if section.total != "" {
+			fmt.Fprintf(w, "\t\tTotal\t%s\t\n", section.total)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taxFlags lists the evidence a deductible item is missing
+func taxFlags(item db.TaxItem) []string {
+	var flags []string
+	if item.MissingReceipt {
+		flags = append(flags, "receipt")
+	}
+	if item.MissingNotes {
+		flags = append(flags, "notes")
+	}
+	return flags
+}
+
+// writeTaxCSV writes one row per transaction, so an accountant can filter by section
+func writeTaxCSV(out io.Writer, report *db.TaxReport) error {
+	w := csv.NewWriter(out)
+	if err := w.Write([]string{"section", "date", "id", "merchant", "description", "deduction_code", "deduction", "amount", "notes", "attachments", "missing"}); err != nil {
+		return err
+	}
+	sections := []struct {
+		name  string
+		items []db.TaxItem
+	}{
+		{"deduction", report.Deductible},
+		{"interest", report.Interest},
+		{"bank_fee", report.BankFees},
+	}
+	for _, section := range sections {
+		for _, item := range section.items {
+			category, _ := types.DeductionCategoryByCode(item.Details.Deduction)
+			if err := w.Write([]string{
+				section.name,
+				item.Date,
+				item.ID,
+				item.Details.Merchant,
+				item.Payee,
+				category.Code,
+				category.Name,
+				item.TaxAmount.StringFixed(2),
+				item.Details.Notes,
+				strconv.Itoa(item.Details.AttachmentCount),
+				strings.Join(taxFlags(item), ";"),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
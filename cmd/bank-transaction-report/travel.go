@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
+	"github.com/shopspring/decimal"
+)
+
+type TravelCmd struct {
+	HomeCountry string `help:"Country you live in, as a name or ISO code" default:"AU"`
+	HomeState   string `help:"State you live in, to count interstate spending as travel too"`
+	Days        int    `help:"Only include the last N days"`
+	From        string `help:"Earliest date to include, as YYYY-MM-DD"`
+	To          string `help:"Latest date to include, as YYYY-MM-DD"`
+	Format      string `help:"Output format" default:"table" enum:"table,json"`
+}
+
+func (c *TravelCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	// Spending resolved to somewhere away from home, leaving out money moved between our own accounts
+	opts := []db.TransactionQueryOption{
+		db.FilterByAwayFrom(c.HomeCountry, c.HomeState),
+		db.FilterByAmount("", "-0.01"),
+		db.ExcludeInternalTransfers(),
+	}
+	dates, err := cli.dateFilters(c.Days, c.From, c.To)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, dates...)
+
+	ctx := context.Background()
+	countries, err := database.Aggregate(ctx, db.GroupByCountry, opts...)
+	if err != nil {
+		return err
+	}
+	places, err := database.Aggregate(ctx, db.GroupByLocality, opts...)
+	if err != nil {
+		return err
+	}
+
+	total := decimal.Zero
+	for _, row := range countries {
+		total = total.Add(row.Total)
+	}
+
+	if c.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			Countries []db.AggregateRow `json:"countries"`
+			Places    []db.AggregateRow `json:"places"`
+			Total     decimal.Decimal   `json:"total"`
+		}{countries, places, total})
+	}
+
+	if len(countries) == 0 {
+		fmt.Println("No spending away from home found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COUNTRY\tTRANSACTIONS\tSPENT")
+	for _, row := range countries {
+		fmt.Fprintf(w, "%s (%s)\t%d\t%s\n", gazetteer.CountryName(row.Key), row.Key, row.Count, row.Total.StringFixed(2))
+	}
+	fmt.Fprintln(w, "\t\t")
+	fmt.Fprintln(w, "PLACE\tTRANSACTIONS\tSPENT")
+	for _, row := range places {
+		place := row.Key
+		if place == "" {
+			place = "(unknown locality)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", place, row.Count, row.Total.StringFixed(2))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nTotal spent away from home: %s\n", total.StringFixed(2))
+	return nil
+}
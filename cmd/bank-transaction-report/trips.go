@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+type TripsCmd struct {
+	Trip   string `arg:"" optional:"" help:"Trip ID, name or destination to show the transactions of"`
+	Format string `help:"Output format" default:"table" enum:"table,json"`
+}
+
+func (c *TripsCmd) Run(cli *ReportCLI) error {
+	_, database, err := cli.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	ctx := context.Background()
+	if c.Trip != "" {
+		return c.showTrip(ctx, database)
+	}
+
+	trips, err := database.GetTrips(ctx)
+	if err != nil {
+		return err
+	}
+	if c.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(trips)
+	}
+	if len(trips) == 0 {
+		fmt.Println("No trips found, detect them with bank-transaction-manage trips detect")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tSTART\tEND\tDAYS\tTRANSACTIONS\tBOOKED\tCOST")
+	for _, t := range trips {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n", t.ID, t.Name, t.StartDate.Format("2006-01-02"),
+			t.EndDate.Format("2006-01-02"), t.Days(), t.TransactionCount, t.Booked.StringFixed(2), t.Cost.StringFixed(2))
+	}
+	return w.Flush()
+}
+
+// showTrip prints the trip matching the argument with its transactions, in the order they happened
+func (c *TripsCmd) showTrip(ctx context.Context, database *db.DB) error {
+	found, err := database.FindTrips(ctx, c.Trip)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("no trip matches %q", c.Trip)
+	}
+	if len(found) > 1 {
+		return fmt.Errorf("%d trips match %q, use the trip ID instead", len(found), c.Trip)
+	}
+	trip, err := database.GetTrip(ctx, found[0].ID)
+	if err != nil {
+		return err
+	}
+	transactions, err := database.GetTransactions(ctx, db.FilterByTrip(trip.ID))
+	if err != nil {
+		return err
+	}
+	// Transactions come most recent first, but a trip reads better in the order it happened
+	slices.Reverse(transactions)
+
+	if c.Format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			*db.Trip
+			Transactions []types.TransactionWithDetails `json:"transactions"`
+		}{trip, transactions})
+	}
+
+	fmt.Printf("%s: %s to %s (%d days)\n\n", trip.Name, trip.StartDate.Format("2006-01-02"), trip.EndDate.Format("2006-01-02"), trip.Days())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATE\tMERCHANT\tCATEGORY\tPLACE\tAMOUNT\t")
+	for _, t := range transactions {
+		booked := ""
+		if slices.Contains(trip.BookedIDs, t.ID) {
+			booked = "booked"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s %s\t%s\n", t.Date, t.Details.Merchant, t.Details.Category,
+			t.Details.Location, t.Amount.String(), t.Amount.Currency, booked)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nTotal cost: %s (%s booked beforehand)\n", trip.Cost.StringFixed(2), trip.Booked.StringFixed(2))
+	return nil
+}
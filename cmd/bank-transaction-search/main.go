@@ -26,6 +26,16 @@ type CLI struct {
 	Method    string  `help:"Search method to use" default:"hybrid" enum:"text,vector,hybrid"`
 	Threshold float32 `help:"Minimum similarity score for search results (0.0-1.0)" default:"0.5"`
 	OrderBy   string  `help:"Order results by" default:"relevance" enum:"relevance,date"`
+
+	Card       string `help:"Only include transactions on this card (card token or last 4 digits)"`
+	Cardholder string `help:"Only include transactions made by this cardholder"`
+	Country    string `help:"Only include transactions made in this country (name or ISO code)"`
+	State      string `help:"Only include transactions made in this state (name or abbreviation)"`
+	Locality   string `help:"Only include transactions made in this city or suburb"`
+
+	Tag        []string `help:"Only include transactions with any of these tags"`
+	AllTags    []string `help:"Only include transactions with all of these tags"`
+	ExcludeTag []string `help:"Leave out transactions with any of these tags"`
 }
 
 func (c *CLI) Run() error {
@@ -65,6 +75,39 @@ func (c *CLI) Run() error {
 	}
 }
 
+// filterOptions returns the search options for any database filters set on the command line
+func (c *CLI) filterOptions() []search.SearchOption {
+	var filters []db.TransactionQueryOption
+	if c.Card != "" {
+		filters = append(filters, db.FilterByCard(c.Card))
+	}
+	if c.Cardholder != "" {
+		filters = append(filters, db.FilterByCardholder(c.Cardholder))
+	}
+	if c.Country != "" {
+		filters = append(filters, db.FilterByCountry(c.Country))
+	}
+	if c.State != "" {
+		filters = append(filters, db.FilterByState(c.State))
+	}
+	if c.Locality != "" {
+		filters = append(filters, db.FilterByLocality(c.Locality))
+	}
+	if len(c.Tag) > 0 {
+		filters = append(filters, db.FilterByAnyTag(c.Tag...))
+	}
+	if len(c.AllTags) > 0 {
+		filters = append(filters, db.FilterByAllTags(c.AllTags...))
+	}
+	if len(c.ExcludeTag) > 0 {
+		filters = append(filters, db.ExcludeTags(c.ExcludeTag...))
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return []search.SearchOption{search.WithFilters(filters...)}
+}
+
 // setupCommonComponents initializes logger, timezone, and database
 func (c *CLI) setupCommonComponents() (*log.Logger, *time.Location, *db.DB, error) {
 	// Setup logger
@@ -88,6 +131,9 @@ func (c *CLI) setupCommonComponents() (*log.Logger, *time.Location, *db.DB, erro
 	if err != nil {
 		logger.Fatal("Failed to initialize database", "error", err)
 	}
+	if err := database.SetBaseCurrency(c.BaseCurrency); err != nil {
+		logger.Fatal("Invalid base currency", "error", err)
+	}
 
 	return logger, loc, database, nil
 }
@@ -128,6 +174,8 @@ func (c *CLI) performTextSearch(ctx context.Context, database *db.DB, logger *lo
 		options = append(options, search.WithLimit(c.Limit))
 	}
 
+	options = append(options, c.filterOptions()...)
+
 	results, totalCount, err := search.TextSearch(ctx, database, c.Query, options...)
 	if err != nil {
 		logger.Fatal("Failed to search transactions", "error", err)
@@ -177,6 +225,8 @@ func (c *CLI) performVectorSearch(ctx context.Context, embeddingProvider embeddi
 		options = append(options, search.WithVectorThreshold(c.Threshold))
 	}
 
+	options = append(options, c.filterOptions()...)
+
 	searchResults, err := search.VectorSearch(ctx, logger, database, embeddingProvider, vectorStorage, c.Query, options...)
 	if err != nil {
 		logger.Fatal("Failed to perform vector search", "error", err)
@@ -206,6 +256,14 @@ func (c *CLI) performVectorSearch(ctx context.Context, embeddingProvider embeddi
 
 // performHybridSearch performs a hybrid search and displays results
 func (c *CLI) performHybridSearch(ctx context.Context, embeddingProvider embeddings.EmbeddingProvider, vectorStorage embeddings.VectorStorage, database *db.DB, logger *log.Logger) error {
+	options := []search.SearchOption{
+		search.WithLimit(c.Limit),
+		search.WithDays(c.Days),
+		search.OrderByRelevance(),
+		search.WithVectorThreshold(c.Threshold),
+	}
+	options = append(options, c.filterOptions()...)
+
 	searchResults, err := search.HybridSearch(
 		ctx,
 		logger,
@@ -213,10 +271,7 @@ func (c *CLI) performHybridSearch(ctx context.Context, embeddingProvider embeddi
 		embeddingProvider,
 		vectorStorage,
 		c.Query,
-		search.WithLimit(c.Limit),
-		search.WithDays(c.Days),
-		search.OrderByRelevance(),
-		search.WithVectorThreshold(c.Threshold),
+		options...,
 	)
 	if err != nil {
 		logger.Fatal("Failed to perform hybrid search", "error", err)
@@ -260,23 +315,56 @@ func (c *CLI) performHybridSearch(ctx context.Context, embeddingProvider embeddi
 // printTransactionDetails prints the details of a transaction
 func printTransactionDetails(t types.TransactionWithDetails) {
 	fmt.Printf("  Type: %s\n", t.Details.Type)
+	if status := t.RefundStatus(); status != "" {
+		fmt.Printf("  Status: %s (%s)\n", status, t.Details.RefundedAmount.StringFixed(2))
+	}
+	if t.Details.RefundOfID != "" {
+		fmt.Printf("  Refund of: %s\n", t.Details.RefundOfID)
+	}
 	if t.Details.Merchant != "" {
 		fmt.Printf("  Merchant: %s\n", t.Details.Merchant)
 	}
 	if t.Details.Location != "" {
 		fmt.Printf("  Location: %s\n", t.Details.Location)
 	}
+	if !t.Details.Place.IsZero() {
+		fmt.Printf("  Place: %s\n", t.Details.Place)
+	}
 	if t.Details.Category != "" {
 		fmt.Printf("  Category: %s\n", t.Details.Category)
 	}
+	for _, split := range t.Splits {
+		fmt.Printf("  Split: %s\n", split)
+	}
+	if len(t.Details.Tags) > 0 {
+		fmt.Printf("  Tags: %s\n", strings.Join(t.Details.Tags, ", "))
+	}
+	if t.Details.Notes != "" {
+		fmt.Printf("  Notes: %s\n", t.Details.Notes)
+	}
+	if t.Details.AttachmentCount > 0 {
+		fmt.Printf("  Attachments: %d\n", t.Details.AttachmentCount)
+	}
 	if t.Details.Description != "" {
 		fmt.Printf("  Description: %s\n", t.Details.Description)
 	}
 	if t.Details.CardNumber != "" {
 		fmt.Printf("  Card Number: %s\n", t.Details.CardNumber)
 	}
+	if t.Details.Cardholder != "" {
+		fmt.Printf("  Cardholder: %s\n", t.Details.Cardholder)
+	}
 	if t.Details.ForeignAmount != nil {
 		fmt.Printf("  Foreign Amount: %s %s\n", t.Details.ForeignAmount.Amount, t.Details.ForeignAmount.Currency)
+		if rate, ok := t.ImpliedRate(); ok {
+			fmt.Printf("  Exchange Rate: %s\n", rate)
+		}
+		if rate, ok := t.EffectiveRate(); ok && t.Details.FXFee.IsPositive() {
+			fmt.Printf("  Effective Rate: %s (with %s fee)\n", rate, t.Details.FXFee.StringFixed(2))
+		}
+	}
+	if t.Details.FXFeeOfID != "" {
+		fmt.Printf("  Fee for: %s\n", t.Details.FXFeeOfID)
 	}
 	if t.Details.TransferDetails != nil {
 		if t.Details.TransferDetails.ToAccount != "" {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+type alertsDataMsg struct {
+	alerts []db.Alert
+}
+
+type alertDismissedMsg struct {
+	id int64
+}
+
+func (m model) fetchAlertsCmd() tea.Cmd {
+	return func() tea.Msg {
+		if m.db == nil {
+			return errorMsg{fmt.Errorf("database not initialized")}
+		}
+		alerts, err := m.db.GetAlerts(context.Background(), false)
+		if err != nil {
+			return errorMsg{fmt.Errorf("failed to get alerts: %w", err)}
+		}
+		return alertsDataMsg{alerts: alerts}
+	}
+}
+
+// dismissAlertCmd dismisses the selected alert
+func (m model) dismissAlertCmd() tea.Cmd {
+	if m.cursor >= len(m.alerts) {
+		return nil
+	}
+	id := m.alerts[m.cursor].ID
+	return func() tea.Msg {
+		if err := m.db.DismissAlert(context.Background(), id); err != nil {
+			return errorMsg{fmt.Errorf("failed to dismiss alert: %w", err)}
+		}
+		return alertDismissedMsg{id: id}
+	}
+}
+
+// removeAlert drops a dismissed alert from the view
+func (m model) removeAlert(id int64) model {
+	for i, a := range m.alerts {
+		if a.ID == id {
+			m.alerts = append(m.alerts[:i:i], m.alerts[i+1:]...)
+			break
+		}
+	}
+	m.cursor = max(min(m.cursor, len(m.alerts)-1), 0)
+	return m
+}
+
+func (m model) alertsView() string {
+	status := fmt.Sprintf("Alerts — %d to check, press x to dismiss one", len(m.alerts))
+
+	itemsPerPage := m.itemsPerPage()
+	start := max(m.cursor-itemsPerPage/2, 0)
+	end := min(start+itemsPerPage, len(m.alerts))
+	start = max(end-itemsPerPage, 0)
+
+	var b strings.Builder
+	if len(m.alerts) == 0 {
+		b.WriteString("No alerts. New transactions are checked for anything unusual when they're imported.")
+	}
+	for i := start; i < end; i++ {
+		a := m.alerts[i]
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		var date, amount string
+		if a.Transaction != nil {
+			date, amount = a.Transaction.Date, a.Transaction.Amount.String()
+		}
+		line := fmt.Sprintf("%s%-10s | %-14s | %10s | %s", cursor, date, a.Kind, amount, a.Message)
+		b.WriteString(overPaceStyle.Render(line) + "\n")
+	}
+
+	return m.layout([]string{status, "", b.String()})
+}
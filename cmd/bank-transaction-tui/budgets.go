@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	overBudgetStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+	overPaceStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+)
+
+// budgetBarWidth is the number of characters in a budget's progress bar
+const budgetBarWidth = 20
+
+type budgetsDataMsg struct {
+	statuses []db.BudgetStatus
+}
+
+func (m model) fetchBudgetsCmd() tea.Cmd {
+	return func() tea.Msg {
+		if m.db == nil {
+			return errorMsg{fmt.Errorf("database not initialized")}
+		}
+		statuses, err := m.db.GetBudgetStatus(context.Background(), time.Now())
+		if err != nil {
+			return errorMsg{fmt.Errorf("failed to get budgets: %w", err)}
+		}
+		return budgetsDataMsg{statuses: statuses}
+	}
+}
+
+func (m model) budgetsView() string {
+	var breached int
+	for _, s := range m.budgets {
+		if s.Breached() {
+			breached++
+		}
+	}
+	status := fmt.Sprintf("Budgets — %d on track, %d over or on pace to go over", len(m.budgets)-breached, breached)
+
+	itemsPerPage := m.itemsPerPage()
+	start := max(m.cursor-itemsPerPage/2, 0)
+	end := min(start+itemsPerPage, len(m.budgets))
+	start = max(end-itemsPerPage, 0)
+
+	var b strings.Builder
+	if len(m.budgets) == 0 {
+		b.WriteString("No budgets found. Set one with bank-transaction-manage budgets set.")
+	}
+	for i := start; i < end; i++ {
+		s := m.budgets[i]
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		line := fmt.Sprintf("%s%-25s | %-7s | %s %10s of %10s | %10s left | projected %10s | %s",
+			cursor, truncate(s.Name(), 25), s.Period, progressBar(s.Spent, s.Amount),
+			s.Spent.StringFixed(2), s.Amount.StringFixed(2), s.Remaining.StringFixed(2), s.Projected.StringFixed(2), s.Status)
+		switch s.Status {
+		case db.BudgetOverBudget:
+			line = overBudgetStyle.Render(line)
+		case db.BudgetOverPace:
+			line = overPaceStyle.Render(line)
+		}
+		b.WriteString(line + "\n")
+	}
+
+	return m.layout([]string{status, "", b.String()})
+}
+
+// progressBar draws how much of a budget has been spent, full once it's spent
+func progressBar(spent, amount decimal.Decimal) string {
+	filled := 0
+	if amount.IsPositive() && spent.IsPositive() {
+		filled = min(int(spent.Div(amount).Mul(decimal.NewFromInt(budgetBarWidth)).IntPart()), budgetBarWidth)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", budgetBarWidth-filled) + "]"
+}
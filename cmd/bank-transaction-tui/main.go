@@ -23,32 +23,48 @@ import (
 )
 
 type keyMap struct {
-	Up          key.Binding
-	Down        key.Binding
-	PageDown    key.Binding
-	PageUp      key.Binding
-	Quit        key.Binding
-	OrderToggle key.Binding
+	Up            key.Binding
+	Down          key.Binding
+	PageDown      key.Binding
+	PageUp        key.Binding
+	Quit          key.Binding
+	OrderToggle   key.Binding
+	Subscriptions key.Binding
+	Budgets       key.Binding
+	Alerts        key.Binding
+	Dismiss       key.Binding
+	Split         key.Binding
+	Notes         key.Binding
+	Attach        key.Binding
+	Open          key.Binding
 }
 
 func newKeyMap() keyMap {
 	return keyMap{
-		Up:          key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
-		Down:        key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
-		PageDown:    key.NewBinding(key.WithKeys("pgdown", "ctrl+f"), key.WithHelp("pgdn/ctrl+f", "page down")),
-		PageUp:      key.NewBinding(key.WithKeys("pgup", "ctrl+b"), key.WithHelp("pgup/ctrl+b", "page up")),
-		Quit:        key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
-		OrderToggle: key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "toggle order")),
+		Up:            key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "up")),
+		Down:          key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "down")),
+		PageDown:      key.NewBinding(key.WithKeys("pgdown", "ctrl+f"), key.WithHelp("pgdn/ctrl+f", "page down")),
+		PageUp:        key.NewBinding(key.WithKeys("pgup", "ctrl+b"), key.WithHelp("pgup/ctrl+b", "page up")),
+		Quit:          key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q", "quit")),
+		OrderToggle:   key.NewBinding(key.WithKeys("o"), key.WithHelp("o", "toggle order")),
+		Subscriptions: key.NewBinding(key.WithKeys("s"), key.WithHelp("s", "subscriptions")),
+		Budgets:       key.NewBinding(key.WithKeys("b"), key.WithHelp("b", "budgets")),
+		Alerts:        key.NewBinding(key.WithKeys("!"), key.WithHelp("!", "alerts")),
+		Dismiss:       key.NewBinding(key.WithKeys("x"), key.WithHelp("x", "dismiss alert")),
+		Split:         key.NewBinding(key.WithKeys("p"), key.WithHelp("p", "split")),
+		Notes:         key.NewBinding(key.WithKeys("n"), key.WithHelp("n", "notes")),
+		Attach:        key.NewBinding(key.WithKeys("a"), key.WithHelp("a", "attach")),
+		Open:          key.NewBinding(key.WithKeys("f"), key.WithHelp("f", "open files")),
 	}
 }
 
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Up, k.Down, k.PageUp, k.PageDown, k.Quit, k.OrderToggle}
+	return []key.Binding{k.Up, k.Down, k.PageUp, k.PageDown, k.Quit, k.OrderToggle, k.Subscriptions, k.Budgets, k.Alerts, k.Split, k.Notes, k.Attach, k.Open}
 }
 
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Up, k.Down, k.PageUp, k.PageDown, k.Quit, k.OrderToggle},
+		{k.Up, k.Down, k.PageUp, k.PageDown, k.Quit, k.OrderToggle, k.Subscriptions, k.Budgets, k.Alerts, k.Split, k.Notes, k.Attach, k.Open},
 	}
 }
 
@@ -80,6 +96,25 @@ type model struct {
 
 	spinner   spinner.Model
 	searching bool
+
+	// Subscriptions view state
+	view          view
+	subscriptions []db.RecurringSeries
+	budgets       []db.BudgetStatus
+	alerts        []db.Alert
+
+	// Split editor state
+	splitActive bool
+	splitInput  textinput.Model
+	splitErr    error
+
+	// Notes editor and attach prompt state
+	noteActive   bool
+	noteInput    textinput.Model
+	attachActive bool
+	attachInput  textinput.Model
+	inputErr     error
+	notice       string
 }
 
 type transactionDataMsg struct {
@@ -97,6 +132,18 @@ func initialModel(dbConn *db.DB, embeddingProvider embeddings.EmbeddingProvider,
 	ti.Placeholder = "Search..."
 	ti.CharLimit = 156
 	ti.Width = 40
+	si := textinput.New()
+	si.Placeholder = "-80.00:Groceries; -20.00:Home"
+	si.CharLimit = 512
+	si.Width = 60
+	ni := textinput.New()
+	ni.Placeholder = "client dinner, claimable"
+	ni.CharLimit = 1024
+	ni.Width = 60
+	ai := textinput.New()
+	ai.Placeholder = "~/Downloads/receipt.pdf"
+	ai.CharLimit = 1024
+	ai.Width = 60
 	sp := spinner.New()
 	sp.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 	return model{
@@ -109,6 +156,9 @@ func initialModel(dbConn *db.DB, embeddingProvider embeddings.EmbeddingProvider,
 		ready:             false,
 		searchActive:      false,
 		searchInput:       ti,
+		splitInput:        si,
+		noteInput:         ni,
+		attachInput:       ai,
 		embeddingProvider: embeddingProvider,
 		vectorStorage:     vectorStorage,
 		logger:            logger,
@@ -127,6 +177,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.width = msg.Width
 		m.height = msg.Height
 		m.searchInput.Width = m.width - 2
+		m.splitInput.Width = m.width - 2
+		m.noteInput.Width = m.width - 2
+		m.attachInput.Width = m.width - 2
 	case spinner.TickMsg:
 		var cmd tea.Cmd
 		m.spinner, cmd = m.spinner.Update(msg)
@@ -134,6 +187,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 	case tea.KeyMsg:
+		if m.splitActive {
+			return m.updateSplitEdit(msg)
+		}
+		if m.noteActive || m.attachActive {
+			return m.updateInput(msg)
+		}
+		m.notice = ""
 		if m.searchActive {
 			if msg.String() == "enter" {
 				query := m.searchInput.Value()
@@ -165,35 +225,50 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		case key.Matches(msg, m.keys.Quit):
 			m.quitting = true
 			return m, tea.Quit
+		case key.Matches(msg, m.keys.Subscriptions):
+			m.cursor = 0
+			if m.view == viewSubscriptions {
+				m.view = viewTransactions
+				return m, nil
+			}
+			m.view = viewSubscriptions
+			return m, m.fetchSubscriptionsCmd()
+		case key.Matches(msg, m.keys.Budgets):
+			m.cursor = 0
+			if m.view == viewBudgets {
+				m.view = viewTransactions
+				return m, nil
+			}
+			m.view = viewBudgets
+			return m, m.fetchBudgetsCmd()
+		case key.Matches(msg, m.keys.Alerts):
+			m.cursor = 0
+			if m.view == viewAlerts {
+				m.view = viewTransactions
+				return m, nil
+			}
+			m.view = viewAlerts
+			return m, m.fetchAlertsCmd()
+		case m.view == viewAlerts && key.Matches(msg, m.keys.Dismiss):
+			return m, m.dismissAlertCmd()
+		case m.view != viewTransactions:
+			// Only navigation applies to the subscriptions, budgets and alerts views
+			m = m.navigate(msg)
 		case msg.String() == "/":
 			m.searchActive = true
 			m.searchInput.SetValue("")
 			m.searchInput.Focus()
 			return m, nil
-		case key.Matches(msg, m.keys.Up):
-			if m.cursor > 0 {
-				m.cursor--
-			}
-		case key.Matches(msg, m.keys.Down):
-			if m.cursor < m.currentTransactionsCount()-1 {
-				m.cursor++
-			}
-		case key.Matches(msg, m.keys.PageDown):
-			if m.currentTransactionsCount() == 0 {
-				break
-			}
-			m.cursor += m.itemsPerPage()
-			if m.cursor > m.currentTransactionsCount()-1 {
-				m.cursor = m.currentTransactionsCount() - 1
-			}
-		case key.Matches(msg, m.keys.PageUp):
-			if m.currentTransactionsCount() == 0 {
-				break
-			}
-			m.cursor -= m.itemsPerPage()
-			if m.cursor < 0 {
-				m.cursor = 0
-			}
+		case key.Matches(msg, m.keys.Up, m.keys.Down, m.keys.PageUp, m.keys.PageDown):
+			m = m.navigate(msg)
+		case key.Matches(msg, m.keys.Split):
+			return m.startSplitEdit()
+		case key.Matches(msg, m.keys.Notes):
+			return m.startNoteEdit()
+		case key.Matches(msg, m.keys.Attach):
+			return m.startAttach()
+		case key.Matches(msg, m.keys.Open):
+			return m, m.openAttachmentsCmd()
 		case msg.String() == "o":
 			if m.searchQuery != "" {
 				m.searchOrderByRelevance = !m.searchOrderByRelevance
@@ -220,6 +295,32 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.searchActive = false
 		m.searchQuery = m.pendingSearchQuery
 		m.pendingSearchQuery = ""
+	case splitSavedMsg:
+		m = m.applySplits(msg)
+	case splitErrorMsg:
+		m.splitErr = msg.err
+	case noteSavedMsg:
+		m = m.applyNotes(msg)
+	case attachedMsg:
+		m = m.applyAttached(msg)
+	case inputErrorMsg:
+		m.inputErr = msg.err
+	case noticeMsg:
+		m.notice = msg.text
+	case subscriptionsDataMsg:
+		m.err = nil
+		m.subscriptions = msg.series
+		m.cursor = 0
+	case budgetsDataMsg:
+		m.err = nil
+		m.budgets = msg.statuses
+		m.cursor = 0
+	case alertsDataMsg:
+		m.err = nil
+		m.alerts = msg.alerts
+		m.cursor = 0
+	case alertDismissedMsg:
+		m = m.removeAlert(msg.id)
 	case errorMsg:
 		m.err = msg.err
 		m.searching = false
@@ -240,6 +341,51 @@ func (m model) currentTransactionsCount() int {
 	return len(m.currentTransactions())
 }
 
+// itemCount returns the number of rows in the current view
+func (m model) itemCount() int {
+	switch m.view {
+	case viewSubscriptions:
+		return len(m.subscriptions)
+	case viewBudgets:
+		return len(m.budgets)
+	case viewAlerts:
+		return len(m.alerts)
+	}
+	return m.currentTransactionsCount()
+}
+
+// navigate moves the cursor for the up, down and paging keys
+func (m model) navigate(msg tea.KeyMsg) model {
+	count := m.itemCount()
+	switch {
+	case key.Matches(msg, m.keys.Up):
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case key.Matches(msg, m.keys.Down):
+		if m.cursor < count-1 {
+			m.cursor++
+		}
+	case key.Matches(msg, m.keys.PageDown):
+		if count == 0 {
+			break
+		}
+		m.cursor += m.itemsPerPage()
+		if m.cursor > count-1 {
+			m.cursor = count - 1
+		}
+	case key.Matches(msg, m.keys.PageUp):
+		if count == 0 {
+			break
+		}
+		m.cursor -= m.itemsPerPage()
+		if m.cursor < 0 {
+			m.cursor = 0
+		}
+	}
+	return m
+}
+
 type searchDataMsg struct {
 	transactions []types.TransactionWithDetails
 	totalCount   int
@@ -298,6 +444,9 @@ func (m model) itemsPerPage() int {
 	if m.searchActive {
 		reserved++ // for the search bar
 	}
+	if m.splitActive || m.noteActive || m.attachActive {
+		reserved += 3 // for the editor prompt, input and error
+	}
 	page := m.height - reserved
 	if page < 1 {
 		return 1
@@ -316,6 +465,15 @@ func (m model) View() string {
 		return "\nLoading transactions...\n\nPress q to quit."
 	}
 
+	switch m.view {
+	case viewSubscriptions:
+		return m.subscriptionsView()
+	case viewBudgets:
+		return m.budgetsView()
+	case viewAlerts:
+		return m.alertsView()
+	}
+
 	var txs []types.TransactionWithDetails
 	var status string
 	if m.searchQuery != "" {
@@ -337,6 +495,9 @@ func (m model) View() string {
 		txs = m.transactions
 		status = fmt.Sprintf("Transaction %d of %d", m.cursor+1, m.totalTransactions)
 	}
+	if m.notice != "" {
+		status += " — " + m.notice
+	}
 
 	// Determine the window of transactions to display
 	itemsPerPage := m.itemsPerPage()
@@ -364,14 +525,37 @@ func (m model) View() string {
 			}
 			t := txs[i]
 			payee := t.Payee
-			maxPayeeLen := m.width - 20
+			status := t.RefundStatus()
+			var split string
+			if len(t.Splits) > 0 {
+				split = fmt.Sprintf("split %d", len(t.Splits))
+			}
+			var extras []string
+			if t.Details.Notes != "" {
+				extras = append(extras, "note")
+			}
+			if t.Details.AttachmentCount > 0 {
+				extras = append(extras, fmt.Sprintf("%d files", t.Details.AttachmentCount))
+			}
+			extra := strings.Join(extras, ", ")
+			maxPayeeLen := m.width - 20 - len(status) - len(split) - len(extra)
 			if maxPayeeLen < 10 {
 				maxPayeeLen = 10
 			}
 			if len(payee) > maxPayeeLen {
 				payee = payee[:maxPayeeLen-3] + "..."
 			}
-			b.WriteString(fmt.Sprintf("%s%s | %10s | %s\n", cursor, t.Date, t.Amount, payee))
+			line := fmt.Sprintf("%s%s | %10s | %s", cursor, t.Date, t.Amount, payee)
+			if status != "" {
+				line += " " + refundedStyle.Render("["+status+"]")
+			}
+			if split != "" {
+				line += " " + splitStyle.Render("["+split+"]")
+			}
+			if extra != "" {
+				line += " " + noteStyle.Render("["+extra+"]")
+			}
+			b.WriteString(line + "\n")
 		}
 	}
 
@@ -384,25 +568,28 @@ func (m model) View() string {
 		}
 	}
 
+	lines := []string{status, "", b.String()}
+	if m.searchActive {
+		lines = append(lines, searchBar)
+	}
+	if m.splitActive {
+		lines = append(lines, m.splitBar()...)
+	}
+	if m.noteActive || m.attachActive {
+		lines = append(lines, m.inputBar()...)
+	}
+	return m.layout(lines)
+}
+
+// layout joins the lines of a view with the help bar and pads it to the window height
+func (m model) layout(lines []string) string {
 	help := m.help.View(struct {
 		keyMap
 	}{
-		keyMap: keyMap{
-			Up:          m.keys.Up,
-			Down:        m.keys.Down,
-			PageUp:      m.keys.PageUp,
-			PageDown:    m.keys.PageDown,
-			OrderToggle: m.keys.OrderToggle,
-			Quit:        m.keys.Quit,
-		},
+		keyMap: m.keys,
 	})
 
-	lines := []string{status, "", b.String()}
-	if m.searchActive {
-		lines = append(lines, searchBar)
-	}
-	lines = append(lines, help)
-	output := strings.Join(lines, "\n")
+	output := strings.Join(append(lines, help), "\n")
 
 	lineCount := strings.Count(output, "\n") + 1
 	if lineCount < m.height {
@@ -453,6 +640,9 @@ func main() {
 	if err != nil {
 		logger.Fatal("Failed to initialize database", "error", err)
 	}
+	if err := dbConn.SetBaseCurrency(cli.BaseCurrency); err != nil {
+		logger.Fatal("Invalid base currency", "error", err)
+	}
 	defer func() {
 		if err := dbConn.Close(); err != nil {
 			logger.Error("Failed to close database", "error", err)
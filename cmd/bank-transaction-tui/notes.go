@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lox/bank-transaction-analyzer/internal/commands"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+var noteStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("180"))
+
+// noteSavedMsg reports the notes stored on a transaction
+type noteSavedMsg struct {
+	id    string
+	notes string
+}
+
+// attachedMsg reports a file attached to a transaction
+type attachedMsg struct {
+	id       string
+	filename string
+	count    int
+}
+
+// inputErrorMsg reports notes or a file that couldn't be stored, leaving the editor open
+type inputErrorMsg struct{ err error }
+
+// noticeMsg reports the outcome of an action in the status line
+type noticeMsg struct{ text string }
+
+// startNoteEdit opens the notes editor on the selected transaction, filled with its current notes
+func (m model) startNoteEdit() (model, tea.Cmd) {
+	txs := m.currentTransactions()
+	if m.cursor >= len(txs) {
+		return m, nil
+	}
+	m.noteActive = true
+	m.inputErr = nil
+	m.noteInput.SetValue(txs[m.cursor].Details.Notes)
+	m.noteInput.CursorEnd()
+	return m, m.noteInput.Focus()
+}
+
+// startAttach opens the prompt for a file to attach to the selected transaction
+func (m model) startAttach() (model, tea.Cmd) {
+	if m.cursor >= len(m.currentTransactions()) {
+		return m, nil
+	}
+	m.attachActive = true
+	m.inputErr = nil
+	m.attachInput.SetValue("")
+	return m, m.attachInput.Focus()
+}
+
+// updateInput handles keys while the notes editor or attach prompt is open
+func (m model) updateInput(msg tea.KeyMsg) (model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.noteActive = false
+		m.attachActive = false
+		m.inputErr = nil
+		return m, nil
+	case "enter":
+		id := m.currentTransactions()[m.cursor].ID
+		if m.noteActive {
+			return m, m.saveNotesCmd(id, m.noteInput.Value())
+		}
+		return m, m.attachCmd(id, m.attachInput.Value())
+	}
+	var cmd tea.Cmd
+	if m.noteActive {
+		m.noteInput, cmd = m.noteInput.Update(msg)
+	} else {
+		m.attachInput, cmd = m.attachInput.Update(msg)
+	}
+	return m, cmd
+}
+
+func (m model) saveNotesCmd(id, notes string) tea.Cmd {
+	return func() tea.Msg {
+		if err := m.db.SetNotes(context.Background(), id, notes); err != nil {
+			return inputErrorMsg{err}
+		}
+		return noteSavedMsg{id: id, notes: strings.TrimSpace(notes)}
+	}
+}
+
+func (m model) attachCmd(id, path string) tea.Cmd {
+	return func() tea.Msg {
+		path = strings.TrimSpace(path)
+		if home, err := os.UserHomeDir(); err == nil && strings.HasPrefix(path, "~/") {
+			path = filepath.Join(home, path[2:])
+		}
+		ctx := context.Background()
+		a, err := m.db.AttachFile(ctx, id, path)
+		if err != nil {
+			return inputErrorMsg{err}
+		}
+		// Attaching a file that's already attached is a no-op, so count what's attached now
+		attachments, err := m.db.GetAttachments(ctx, id)
+		if err != nil {
+			return inputErrorMsg{err}
+		}
+		return attachedMsg{id: id, filename: a.Filename, count: len(attachments)}
+	}
+}
+
+// openAttachmentsCmd opens every file attached to the selected transaction
+func (m model) openAttachmentsCmd() tea.Cmd {
+	txs := m.currentTransactions()
+	if m.cursor >= len(txs) {
+		return nil
+	}
+	id := txs[m.cursor].ID
+	return func() tea.Msg {
+		attachments, err := m.db.GetAttachments(context.Background(), id)
+		if err != nil {
+			return noticeMsg{err.Error()}
+		}
+		if len(attachments) == 0 {
+			return noticeMsg{"No attachments, press a to attach a file"}
+		}
+		for _, a := range attachments {
+			if err := commands.OpenFile(m.db.AttachmentPath(&a)); err != nil {
+				return noticeMsg{err.Error()}
+			}
+		}
+		return noticeMsg{fmt.Sprintf("Opened %d attachments", len(attachments))}
+	}
+}
+
+// applyNotes updates the notes on a transaction in the loaded lists
+func (m model) applyNotes(msg noteSavedMsg) model {
+	m.updateLoaded(msg.id, func(t *types.TransactionWithDetails) { t.Details.Notes = msg.notes })
+	m.noteActive = false
+	m.inputErr = nil
+	return m
+}
+
+// applyAttached updates the attachment count on a transaction in the loaded lists
+func (m model) applyAttached(msg attachedMsg) model {
+	m.updateLoaded(msg.id, func(t *types.TransactionWithDetails) { t.Details.AttachmentCount = msg.count })
+	m.attachActive = false
+	m.inputErr = nil
+	m.notice = "Attached " + msg.filename
+	return m
+}
+
+// updateLoaded applies a change to a transaction wherever it's loaded
+func (m model) updateLoaded(id string, update func(t *types.TransactionWithDetails)) {
+	for _, txs := range [][]types.TransactionWithDetails{m.transactions, m.searchResults} {
+		for i := range txs {
+			if txs[i].ID == id {
+				update(&txs[i])
+			}
+		}
+	}
+}
+
+// inputBar renders the notes editor or attach prompt for the selected transaction
+func (m model) inputBar() []string {
+	t := m.currentTransactions()[m.cursor]
+	var lines []string
+	if m.noteActive {
+		lines = []string{
+			fmt.Sprintf("Notes on %s %s (empty to remove, esc to cancel)", t.Amount, truncate(t.Payee, 30)),
+			m.noteInput.View(),
+		}
+	} else {
+		lines = []string{
+			fmt.Sprintf("Attach a file to %s %s (esc to cancel)", t.Amount, truncate(t.Payee, 30)),
+			m.attachInput.View(),
+		}
+	}
+	if m.inputErr != nil {
+		lines = append(lines, splitErrorStyle.Render(m.inputErr.Error()))
+	}
+	return lines
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+var (
+	splitStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("111"))
+	splitErrorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+)
+
+// splitSavedMsg reports the splits stored on a transaction
+type splitSavedMsg struct {
+	id     string
+	splits []types.Split
+}
+
+// splitErrorMsg reports splits that couldn't be parsed or stored, leaving the editor open
+type splitErrorMsg struct{ err error }
+
+// startSplitEdit opens the split editor on the selected transaction, filled with its current splits
+func (m model) startSplitEdit() (model, tea.Cmd) {
+	txs := m.currentTransactions()
+	if m.cursor >= len(txs) {
+		return m, nil
+	}
+	m.splitActive = true
+	m.splitErr = nil
+	m.splitInput.SetValue(db.FormatSplits(txs[m.cursor].Splits))
+	m.splitInput.CursorEnd()
+	return m, m.splitInput.Focus()
+}
+
+// updateSplitEdit handles keys while the split editor is open
+func (m model) updateSplitEdit(msg tea.KeyMsg) (model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.splitActive = false
+		m.splitErr = nil
+		return m, nil
+	case "enter":
+		return m, m.saveSplitsCmd(m.currentTransactions()[m.cursor].ID, m.splitInput.Value())
+	}
+	var cmd tea.Cmd
+	m.splitInput, cmd = m.splitInput.Update(msg)
+	return m, cmd
+}
+
+func (m model) saveSplitsCmd(id, value string) tea.Cmd {
+	return func() tea.Msg {
+		splits, err := db.ParseSplits(value)
+		if err != nil {
+			return splitErrorMsg{err}
+		}
+		if err := m.db.SetSplits(context.Background(), id, splits); err != nil {
+			return splitErrorMsg{err}
+		}
+		return splitSavedMsg{id: id, splits: splits}
+	}
+}
+
+// applySplits updates the splits on a transaction in the loaded lists
+func (m model) applySplits(msg splitSavedMsg) model {
+	for _, txs := range [][]types.TransactionWithDetails{m.transactions, m.searchResults} {
+		for i := range txs {
+			if txs[i].ID == msg.id {
+				txs[i].Splits = msg.splits
+			}
+		}
+	}
+	m.splitActive = false
+	m.splitErr = nil
+	return m
+}
+
+// splitBar renders the split editor for the selected transaction
+func (m model) splitBar() []string {
+	t := m.currentTransactions()[m.cursor]
+	lines := []string{
+		fmt.Sprintf("Split %s %s into amount:category[:tags[:note]]; ... (empty to remove, esc to cancel)", t.Amount, truncate(t.Payee, 30)),
+		m.splitInput.View(),
+	}
+	if m.splitErr != nil {
+		lines = append(lines, splitErrorStyle.Render(m.splitErr.Error()))
+	}
+	return lines
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+)
+
+// view is a screen of the TUI
+type view int
+
+const (
+	viewTransactions view = iota
+	viewSubscriptions
+	viewBudgets
+	viewAlerts
+)
+
+var (
+	stoppedStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	priceChangedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))
+	refundedStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("78"))
+)
+
+type subscriptionsDataMsg struct {
+	series []db.RecurringSeries
+}
+
+func (m model) fetchSubscriptionsCmd() tea.Cmd {
+	return func() tea.Msg {
+		if m.db == nil {
+			return errorMsg{fmt.Errorf("database not initialized")}
+		}
+		series, err := m.db.GetRecurringSeries(context.Background())
+		if err != nil {
+			return errorMsg{fmt.Errorf("failed to get subscriptions: %w", err)}
+		}
+		// Recurring income isn't a subscription
+		var payments []db.RecurringSeries
+		for _, s := range series {
+			if s.Amount.IsNegative() {
+				payments = append(payments, s)
+			}
+		}
+		return subscriptionsDataMsg{series: payments}
+	}
+}
+
+func (m model) subscriptionsView() string {
+	now := time.Now()
+	var active int
+	for _, s := range m.subscriptions {
+		if !s.Stopped(now) {
+			active++
+		}
+	}
+	status := fmt.Sprintf("Subscriptions — %d active, %d stopped", active, len(m.subscriptions)-active)
+
+	itemsPerPage := m.itemsPerPage()
+	start := max(m.cursor-itemsPerPage/2, 0)
+	end := min(start+itemsPerPage, len(m.subscriptions))
+	start = max(end-itemsPerPage, 0)
+
+	var b strings.Builder
+	if len(m.subscriptions) == 0 {
+		b.WriteString("No subscriptions found. Run bank-transaction-report subscriptions to detect them.")
+	}
+	for i := start; i < end; i++ {
+		s := m.subscriptions[i]
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		line := fmt.Sprintf("%s%-30s | %10s | %-11s | next %s | %s",
+			cursor, truncate(s.Merchant, 30), s.Amount.StringFixed(2), s.Cadence, s.NextDate.Format("02/01/2006"), s.Status(now))
+		switch {
+		case s.Stopped(now):
+			line = stoppedStyle.Render(line)
+		case s.PriceChanged():
+			line = priceChangedStyle.Render(line + fmt.Sprintf(" (was %s)", s.PreviousAmount.StringFixed(2)))
+		}
+		b.WriteString(line + "\n")
+	}
+
+	return m.layout([]string{status, "", b.String()})
+}
+
+// truncate shortens s to at most n characters, marking the cut with an ellipsis
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
@@ -3,10 +3,13 @@ package agent
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/charmbracelet/log"
 	openai "github.com/sashabaranov/go-openai"
 	"golang.org/x/exp/slices"
+	"golang.org/x/time/rate"
 )
 
 // ToolCallValidator is a function that validates and parses the tool call arguments.
@@ -18,35 +21,285 @@ type ShouldStopFunc func(toolCall openai.ToolCall) bool
 
 // Agent encapsulates OpenAI tool-calling logic.
 type Agent struct {
-	logger      *log.Logger
-	client      *openai.Client
-	model       string
-	maxAttempts int
+	logger *log.Logger
+	client *openai.Client
+	model  string
+
+	outputMode OutputMode
+	modelModes map[string]OutputMode
+	detected   sync.Map // model -> OutputMode detected in auto mode
+
+	fallbackModels []string
+	limiter        *rate.Limiter
+	retries        int
+	backoffBase    time.Duration
+	backoffMax     time.Duration
+	breakers       map[string]*circuitBreaker
+	sleep          func(ctx context.Context, d time.Duration) error
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+}
+
+// Result is the outcome of a successful RunLoop
+type Result struct {
+	// Value is the parsed result returned by the ToolCallValidator
+	Value any
+	// Model is the model that produced the result, which may be a fallback model
+	Model string
+	// Mode is the output mode the model was used with
+	Mode OutputMode
+}
+
+// Option configures an Agent
+type Option func(*Agent)
+
+// WithOutputMode sets the default output mode for all models
+func WithOutputMode(mode OutputMode) Option {
+	return func(a *Agent) {
+		a.outputMode = mode
+	}
+}
+
+// WithModelOutputMode sets the output mode for a specific model, overriding the default
+func WithModelOutputMode(model string, mode OutputMode) Option {
+	return func(a *Agent) {
+		a.modelModes[model] = mode
+	}
+}
+
+// WithFallbackModels sets the models to try, in order, when the primary model keeps failing
+func WithFallbackModels(models ...string) Option {
+	return func(a *Agent) {
+		a.fallbackModels = append(a.fallbackModels, models...)
+	}
+}
+
+// WithRateLimit limits requests to requestsPerSecond across all goroutines sharing the agent
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(a *Agent) {
+		if requestsPerSecond <= 0 {
+			a.limiter = nil
+			return
+		}
+		a.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), max(burst, 1))
+	}
+}
+
+// WithRetries sets how many times a failed request is retried before moving to the next model
+func WithRetries(retries int) Option {
+	return func(a *Agent) {
+		a.retries = retries
+	}
+}
+
+// WithBackoff sets the base and maximum delay for exponential backoff between retries
+func WithBackoff(base, maxDelay time.Duration) Option {
+	return func(a *Agent) {
+		a.backoffBase = base
+		a.backoffMax = maxDelay
+	}
+}
+
+// WithCircuitBreaker skips a model for cooldown after threshold consecutive failed requests.
+// A threshold of 0 disables the circuit breaker.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(a *Agent) {
+		a.breakerThreshold = threshold
+		a.breakerCooldown = cooldown
+	}
 }
 
 // NewAgent creates a new Agent for tool-calling.
-func NewAgent(logger *log.Logger, client *openai.Client, model string, maxAttempts int) *Agent {
-	return &Agent{
-		logger:      logger,
-		client:      client,
-		model:       model,
-		maxAttempts: maxAttempts,
+func NewAgent(logger *log.Logger, client *openai.Client, model string, opts ...Option) *Agent {
+	a := &Agent{
+		logger:           logger,
+		client:           client,
+		model:            model,
+		outputMode:       OutputModeAuto,
+		modelModes:       make(map[string]OutputMode),
+		retries:          defaultRetries,
+		backoffBase:      defaultBackoffBase,
+		backoffMax:       defaultBackoffMax,
+		breakerThreshold: defaultBreakerThreshold,
+		breakerCooldown:  defaultBreakerCooldown,
+		sleep:            sleepContext,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
+	a.breakers = make(map[string]*circuitBreaker)
+	for _, m := range a.models() {
+		a.breakers[m] = newCircuitBreaker(a.breakerThreshold, a.breakerCooldown)
+	}
+	return a
 }
 
 // NewOpenRouterAgent creates an Agent configured for OpenRouter's OpenAI-compatible API.
 // apiKey: your OpenRouter API key
 // model: the model name to use (e.g., "google/gemini-2.5-flash-preview")
-// maxAttempts: number of tool-calling retry attempts
-func NewOpenRouterAgent(logger *log.Logger, apiKey, model string, maxAttempts int) *Agent {
+func NewOpenRouterAgent(logger *log.Logger, apiKey, model string, opts ...Option) *Agent {
 	cfg := openai.DefaultConfig(apiKey)
 	cfg.BaseURL = "https://openrouter.ai/api/v1"
-	client := openai.NewClientWithConfig(cfg)
-	return NewAgent(logger, client, model, maxAttempts)
+	return NewAgent(logger, newClient(cfg), model, opts...)
+}
+
+// NewOpenAICompatibleAgent creates an Agent for any OpenAI-compatible API, such as
+// OpenAI, OpenRouter or a local Ollama, LM Studio or llama.cpp server.
+// The API key may be empty for local servers that don't check it.
+func NewOpenAICompatibleAgent(logger *log.Logger, baseURL, apiKey, model string, opts ...Option) *Agent {
+	cfg := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+	return NewAgent(logger, newClient(cfg), model, opts...)
+}
+
+// models returns the primary model followed by the fallback models
+func (a *Agent) models() []string {
+	models := []string{a.model}
+	for _, m := range a.fallbackModels {
+		if !slices.Contains(models, m) {
+			models = append(models, m)
+		}
+	}
+	return models
+}
+
+// configuredMode returns the output mode configured for a model
+func (a *Agent) configuredMode(model string) OutputMode {
+	if mode, ok := a.modelModes[model]; ok {
+		return mode
+	}
+	return a.outputMode
+}
+
+// currentMode returns the output mode to use for the next request to a model, resolving
+// auto to whatever has been detected for the model so far
+func (a *Agent) currentMode(model string) OutputMode {
+	mode := a.configuredMode(model)
+	if mode != OutputModeAuto {
+		return mode
+	}
+	if detected, ok := a.detected.Load(model); ok {
+		return detected.(OutputMode)
+	}
+	return OutputModeTools
+}
+
+// detectMode records the output mode that works for a model when running in auto mode
+func (a *Agent) detectMode(model string, mode OutputMode) {
+	if a.configuredMode(model) != OutputModeAuto {
+		return
+	}
+	if previous, loaded := a.detected.Swap(model, mode); !loaded || previous.(OutputMode) != mode {
+		a.logger.Info("Detected structured output mode for model", "model", model, "mode", mode)
+	}
+}
+
+// buildRequest creates a chat completion request for the given model and output mode
+func (a *Agent) buildRequest(model string, mode OutputMode, messages []openai.ChatCompletionMessage, tools []openai.Tool) openai.ChatCompletionRequest {
+	req := openai.ChatCompletionRequest{
+		Model:    model,
+		Messages: messages,
+	}
+	switch mode {
+	case OutputModeJSONSchema, OutputModeJSON:
+		// Without tools, describe them in a system message so the model knows what to produce
+		req.Messages = append(slices.Clone(messages), openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: jsonInstructions(tools),
+		})
+		if mode == OutputModeJSONSchema {
+			req.ResponseFormat = responseFormat(tools)
+		}
+	default:
+		req.Tools = tools
+		req.ToolChoice = "auto"
+	}
+	return req
+}
+
+// completion is a chat completion response along with the model and mode that produced it
+type completion struct {
+	resp  openai.ChatCompletionResponse
+	model string
+	mode  OutputMode
+}
+
+// complete sends a chat completion request to the first healthy model in the fallback chain.
+// Rate limited and transient failures are retried with backoff, and a model is abandoned
+// for the next one once its retries are exhausted.
+func (a *Agent) complete(ctx context.Context, messages []openai.ChatCompletionMessage, tools []openai.Tool) (*completion, error) {
+	var lastError error
+
+	for _, model := range a.models() {
+		breaker := a.breakers[model]
+		if !breaker.allow(time.Now()) {
+			a.logger.Debug("Circuit open, skipping model", "model", model)
+			lastError = fmt.Errorf("circuit open for model %s", model)
+			continue
+		}
+
+		mode := a.currentMode(model)
+		for retry := 0; ; {
+			if a.limiter != nil {
+				if err := a.limiter.Wait(ctx); err != nil {
+					return nil, err
+				}
+			}
+
+			hint := &retryHint{}
+			resp, err := a.client.CreateChatCompletion(
+				context.WithValue(ctx, retryHintKey{}, hint),
+				a.buildRequest(model, mode, messages, tools),
+			)
+			if err == nil {
+				breaker.success()
+				return &completion{resp: resp, model: model, mode: mode}, nil
+			}
+			lastError = err
+
+			// A model that rejects tools or response_format falls back to the next mode
+			// without using up a retry. The chain is finite, so this always terminates.
+			if a.configuredMode(model) == OutputModeAuto {
+				if next, ok := nextOutputMode(mode, err); ok {
+					a.logger.Debug("Model rejected output mode, falling back", "model", model, "mode", mode, "next", next, "error", err)
+					mode = next
+					a.detectMode(model, mode)
+					continue
+				}
+			}
+
+			if !isRetryable(err) || retry >= a.retries {
+				break
+			}
+			delay := a.backoffDelay(retry, hint.after)
+			a.logger.Debug("Request failed, retrying", "model", model, "retry", retry+1, "delay", delay, "error", err)
+			if err := a.sleep(ctx, delay); err != nil {
+				return nil, err
+			}
+			retry++
+		}
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if breaker.failure(time.Now()) {
+			a.logger.Warn("Circuit opened for model after repeated failures", "model", model, "cooldown", a.breakerCooldown)
+		}
+		a.logger.Warn("Model failed", "model", model, "error", lastError)
+	}
+
+	return nil, lastError
 }
 
 // RunLoop performs iterative tool-calling with error handling and a max loop count.
-// Returns the parsed result from the validator, or an error if all attempts fail.
+// Every tool call in a response is answered with a tool message paired by ToolCallID,
+// so the model can call helper tools from a ToolRegistry, in parallel, before making
+// its final call. API errors are retried inside each request, so loop attempts are
+// only spent on model turns. Returns the parsed result from the validator along with
+// the model that produced it, or an error if all attempts fail.
 func (a *Agent) RunLoop(
 	ctx context.Context,
 	initialMessages []openai.ChatCompletionMessage,
@@ -54,70 +307,136 @@ func (a *Agent) RunLoop(
 	validator ToolCallValidator,
 	shouldStop ShouldStopFunc,
 	maxLoop int,
-) (any, error) {
+	opts ...RunOption,
+) (*Result, error) {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var (
-		lastToolCall string
 		lastError    error
 		chatMessages = slices.Clone(initialMessages)
+		allTools     = append(slices.Clone(tools), o.registry.Tools()...)
 	)
 
 	for loop := 1; loop <= maxLoop; loop++ {
 		a.logger.Debug("Running agent loop", "loop", loop)
 
-		resp, err := a.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-			Model:      a.model,
-			Messages:   chatMessages,
-			Tools:      tools,
-			ToolChoice: "auto",
-		})
+		c, err := a.complete(ctx, chatMessages, allTools)
 		if err != nil {
-			lastError = err
-			continue
+			return nil, fmt.Errorf("chat completion failed: %w", err)
 		}
 
-		if len(resp.Choices) == 0 {
+		if len(c.resp.Choices) == 0 {
 			lastError = fmt.Errorf("no choices in response")
 			continue
 		}
 
-		message := resp.Choices[0].Message
-		if len(message.ToolCalls) == 0 {
-			lastError = fmt.Errorf("no tool calls in response")
-			continue
+		message := c.resp.Choices[0].Message
+		native := len(message.ToolCalls) > 0
+		toolCalls := message.ToolCalls
+		if !native {
+			// Models that ignore tools often answer with JSON in the content instead
+			toolCall, err := parseContentToolCall(message.Content, allTools)
+			if err != nil {
+				lastError = fmt.Errorf("no tool calls in response: %w", err)
+				chatMessages = append(chatMessages,
+					openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: message.Content},
+					openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: correction("", lastError)},
+				)
+				continue
+			}
+			if c.mode == OutputModeTools && a.configuredMode(c.model) == OutputModeAuto {
+				a.logger.Debug("Model answered with JSON content instead of a tool call", "model", c.model)
+				c.mode = OutputModeJSON
+				a.detectMode(c.model, c.mode)
+			}
+			toolCalls = []openai.ToolCall{toolCall}
 		}
 
-		toolCall := message.ToolCalls[0]
-		lastToolCall = toolCall.Function.Arguments
+		// Some providers omit tool call IDs, but every tool result must reference one
+		for i := range toolCalls {
+			if toolCalls[i].ID == "" {
+				toolCalls[i].ID = fmt.Sprintf("call_%d_%d", loop, i)
+			}
+		}
+
+		// Final tool calls are validated first, so a valid answer ends the loop without
+		// waiting for any helper tools called alongside it
+		results := make([]string, len(toolCalls))
+		var helperCalls []openai.ToolCall
+		var helperIndexes []int
+		for i, toolCall := range toolCalls {
+			if o.registry.Has(toolCall.Function.Name) {
+				helperCalls = append(helperCalls, toolCall)
+				helperIndexes = append(helperIndexes, i)
+				continue
+			}
 
-		parsed, err := validator(toolCall)
-		if err == nil {
-			a.logger.Debug("Tool call validated successfully", "toolCall", toolCall)
+			parsed, err := validator(toolCall)
+			if err != nil {
+				a.logger.Debug("Tool call validation failed", "toolCall", toolCall, "error", err)
+				lastError = err
+				results[i] = correction(toolCall.Function.Arguments, err)
+				continue
+			}
+			a.logger.Debug("Tool call validated successfully", "toolCall", toolCall, "model", c.model)
 			if shouldStop == nil || shouldStop(toolCall) {
-				return parsed, nil
+				return &Result{Value: parsed, Model: c.model, Mode: c.mode}, nil
+			}
+			results[i] = fmt.Sprintf("Tool result: %v", parsed)
+		}
+
+		if len(helperCalls) > 0 {
+			a.logger.Debug("Calling helper tools", "count", len(helperCalls))
+			for i, result := range o.registry.callAll(ctx, helperCalls) {
+				results[helperIndexes[i]] = result
+			}
+			if len(helperCalls) == len(toolCalls) {
+				lastError = fmt.Errorf("model called helper tools without a final answer")
 			}
-			// Add the tool result as a new message and continue the loop
-			chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleTool,
-				Content: fmt.Sprintf("Tool result: %v", parsed),
-				Name:    toolCall.Function.Name,
-			})
-			continue
 		}
-		a.logger.Debug("Tool call validation failed", "toolCall", toolCall, "error", err)
-		lastError = err
 
-		// On error, add the previous tool call and error as a new user message
-		msg := ""
-		if lastToolCall != "" {
-			msg += "Previous tool call arguments:\n" + lastToolCall + "\n"
+		chatMessages = append(chatMessages, toolResultMessages(message, toolCalls, results, native)...)
+	}
+
+	return nil, fmt.Errorf("failed to get valid tool call after %d attempts: %w", maxLoop, lastError)
+}
+
+// toolResultMessages pairs the assistant message that made the tool calls with their results.
+// Tool calls parsed from content are answered in a user message, since the request had no tools.
+func toolResultMessages(message openai.ChatCompletionMessage, toolCalls []openai.ToolCall, results []string, native bool) []openai.ChatCompletionMessage {
+	if !native {
+		return []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleAssistant, Content: message.Content},
+			{Role: openai.ChatMessageRoleUser, Content: fmt.Sprintf("Result of %s:\n%s", toolCalls[0].Function.Name, results[0])},
 		}
-		msg += "Error: " + lastError.Error() + "\n"
-		msg += "Please correct your response using only allowed values."
-		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
-			Content: msg,
+	}
+
+	messages := []openai.ChatCompletionMessage{{
+		Role:      openai.ChatMessageRoleAssistant,
+		Content:   message.Content,
+		ToolCalls: toolCalls,
+	}}
+	for i, toolCall := range toolCalls {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    results[i],
+			Name:       toolCall.Function.Name,
+			ToolCallID: toolCall.ID,
 		})
 	}
+	return messages
+}
 
-	return nil, fmt.Errorf("failed to get valid tool call after %d attempts: %w", maxLoop, lastError)
+// correction asks the model to fix its previous response
+func correction(previous string, err error) string {
+	msg := ""
+	if previous != "" {
+		msg += "Previous tool call arguments:\n" + previous + "\n"
+	}
+	msg += "Error: " + err.Error() + "\n"
+	msg += "Please correct your response using only allowed values."
+	return msg
 }
@@ -0,0 +1,463 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var echoTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        "echo",
+		Description: "Echo a message",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"message": map[string]any{"type": "string"},
+			},
+			"required": []string{"message"},
+		},
+	},
+}
+
+// fakeServer is an OpenAI-compatible endpoint that answers each request with the next handler
+type fakeServer struct {
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+	handlers []handler
+	sleeps   []time.Duration
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req openai.ChatCompletionRequest
+	_ = json.Unmarshal(body, &req)
+
+	s.mu.Lock()
+	n := len(s.requests)
+	s.requests = append(s.requests, req)
+	s.mu.Unlock()
+
+	if n >= len(s.handlers) {
+		http.Error(w, "unexpected request", http.StatusInternalServerError)
+		return
+	}
+	s.handlers[n](w, req)
+}
+
+type handler func(w http.ResponseWriter, req openai.ChatCompletionRequest)
+
+func newTestAgent(t *testing.T, handlers []handler, opts ...Option) (*Agent, *fakeServer) {
+	t.Helper()
+	fake := &fakeServer{handlers: handlers}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg := openai.DefaultConfig("test")
+	cfg.BaseURL = srv.URL
+	logger := log.New(io.Discard)
+	a := NewAgent(logger, newClient(cfg), "test-model", opts...)
+	a.sleep = func(ctx context.Context, d time.Duration) error {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		fake.sleeps = append(fake.sleeps, d)
+		return nil
+	}
+	return a, fake
+}
+
+func reply(message openai.ChatCompletionMessage) handler {
+	return func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		message.Role = openai.ChatMessageRoleAssistant
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{{Message: message}},
+		})
+	}
+}
+
+func replyError(status int, message string, headers ...string) handler {
+	return func(w http.ResponseWriter, req openai.ChatCompletionRequest) {
+		w.Header().Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{"message": message, "type": "invalid_request_error"},
+		})
+	}
+}
+
+func echoValidator(toolCall openai.ToolCall) (any, error) {
+	var args struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &args); err != nil {
+		return nil, err
+	}
+	return args.Message, nil
+}
+
+func runEcho(t *testing.T, a *Agent) (*Result, error) {
+	t.Helper()
+	return a.RunLoop(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Say hello"},
+	}, []openai.Tool{echoTool}, echoValidator, nil, 3)
+}
+
+func TestParseContentToolCall(t *testing.T) {
+	otherTool := openai.Tool{Type: openai.ToolTypeFunction, Function: &openai.FunctionDefinition{Name: "other"}}
+
+	tests := []struct {
+		name     string
+		content  string
+		tools    []openai.Tool
+		wantName string
+		wantArgs string
+		wantErr  bool
+	}{
+		{
+			name:     "bare_arguments",
+			content:  `{"message": "hello"}`,
+			tools:    []openai.Tool{echoTool},
+			wantName: "echo",
+			wantArgs: `{"message": "hello"}`,
+		},
+		{
+			name:     "markdown_fence",
+			content:  "Here you go:\n```json\n{\"message\": \"hello\"}\n```",
+			tools:    []openai.Tool{echoTool},
+			wantName: "echo",
+			wantArgs: `{"message": "hello"}`,
+		},
+		{
+			name:     "envelope",
+			content:  `{"name": "other", "arguments": {"x": 1}}`,
+			tools:    []openai.Tool{echoTool, otherTool},
+			wantName: "other",
+			wantArgs: `{"x": 1}`,
+		},
+		{
+			name:     "envelope_with_string_arguments",
+			content:  `{"name": "echo", "arguments": "{\"message\": \"hi\"}"}`,
+			tools:    []openai.Tool{echoTool},
+			wantName: "echo",
+			wantArgs: `{"message": "hi"}`,
+		},
+		{
+			name:    "multiple_tools_need_envelope",
+			content: `{"message": "hello"}`,
+			tools:   []openai.Tool{echoTool, otherTool},
+			wantErr: true,
+		},
+		{
+			name:    "no_json",
+			content: "I can't help with that",
+			tools:   []openai.Tool{echoTool},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			toolCall, err := parseContentToolCall(tc.content, tc.tools)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantName, toolCall.Function.Name)
+			assert.Equal(t, tc.wantArgs, toolCall.Function.Arguments)
+		})
+	}
+}
+
+func TestRunLoop_ToolCall(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{reply(openai.ChatCompletionMessage{
+		ToolCalls: []openai.ToolCall{{
+			ID:       "call_1",
+			Type:     openai.ToolTypeFunction,
+			Function: openai.FunctionCall{Name: "echo", Arguments: `{"message":"hello"}`},
+		}},
+	})})
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	assert.Equal(t, "test-model", result.Model)
+	assert.Equal(t, OutputModeTools, result.Mode)
+	assert.Len(t, fake.requests[0].Tools, 1)
+}
+
+func TestRunLoop_JSONContentWithoutToolCall(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		reply(openai.ChatCompletionMessage{Content: "```json\n{\"message\":\"hello\"}\n```"}),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"again"}`}),
+	})
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	assert.Len(t, fake.requests, 1, "content parsing should not use up another attempt")
+
+	// The model is remembered as a JSON model, so the next request skips tools
+	result, err = runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "again", result.Value)
+	assert.Empty(t, fake.requests[1].Tools)
+	assert.Nil(t, fake.requests[1].ResponseFormat)
+}
+
+func TestRunLoop_FallsBackWhenToolsUnsupported(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusBadRequest, "This model does not support tools"),
+		replyError(http.StatusBadRequest, "response_format json_schema is not supported"),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"hello"}`}),
+	})
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	require.Len(t, fake.requests, 3)
+
+	assert.NotEmpty(t, fake.requests[0].Tools)
+	assert.Empty(t, fake.requests[1].Tools)
+	require.NotNil(t, fake.requests[1].ResponseFormat)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONSchema, fake.requests[1].ResponseFormat.Type)
+	assert.Nil(t, fake.requests[2].ResponseFormat)
+}
+
+func TestRunLoop_ExplicitModeDoesNotFallBack(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusBadRequest, "This model does not support tools"),
+	}, WithOutputMode(OutputModeTools))
+
+	_, err := runEcho(t, a)
+	assert.Error(t, err)
+	assert.Len(t, fake.requests, 1)
+}
+
+func TestRunLoop_ModelOutputMode(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		reply(openai.ChatCompletionMessage{Content: `{"message":"hello"}`}),
+	}, WithModelOutputMode("test-model", OutputModeJSONSchema))
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	assert.Empty(t, fake.requests[0].Tools)
+	require.NotNil(t, fake.requests[0].ResponseFormat)
+	assert.Equal(t, "echo", fake.requests[0].ResponseFormat.JSONSchema.Name)
+}
+
+func TestRunLoop_RetriesHonourRetryAfter(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusTooManyRequests, "Rate limit exceeded", "Retry-After", "7"),
+		replyError(http.StatusServiceUnavailable, "Overloaded"),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"hello"}`}),
+	})
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	require.Len(t, fake.sleeps, 2)
+	assert.Equal(t, 7*time.Second, fake.sleeps[0])
+	assert.LessOrEqual(t, fake.sleeps[1], 2*defaultBackoffBase)
+}
+
+func TestRunLoop_ZeroBackoffRetriesImmediately(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusServiceUnavailable, "Overloaded"),
+		replyError(http.StatusServiceUnavailable, "Overloaded"),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"hello"}`}),
+	}, WithBackoff(time.Second, 0))
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	assert.Equal(t, []time.Duration{0, 0}, fake.sleeps)
+}
+
+func TestRunLoop_FallbackModel(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusInternalServerError, "Upstream error"),
+		replyError(http.StatusInternalServerError, "Upstream error"),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"hello"}`}),
+	}, WithFallbackModels("backup-model"), WithRetries(1))
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "backup-model", result.Model)
+	require.Len(t, fake.requests, 3)
+	assert.Equal(t, "test-model", fake.requests[1].Model)
+	assert.Equal(t, "backup-model", fake.requests[2].Model)
+}
+
+func TestRunLoop_CircuitBreakerSkipsFailingModel(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusInternalServerError, "Upstream error"),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"one"}`}),
+		reply(openai.ChatCompletionMessage{Content: `{"message":"two"}`}),
+	}, WithFallbackModels("backup-model"), WithRetries(0), WithCircuitBreaker(1, time.Hour))
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "backup-model", result.Model)
+
+	// The primary model's circuit is open, so the next run goes straight to the fallback
+	result, err = runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "two", result.Value)
+	assert.Equal(t, "backup-model", fake.requests[2].Model)
+}
+
+func TestRunLoop_DoesNotRetryClientErrors(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		replyError(http.StatusUnauthorized, "Invalid API key"),
+	})
+
+	_, err := runEcho(t, a)
+	assert.Error(t, err)
+	assert.Len(t, fake.requests, 1)
+	assert.Empty(t, fake.sleeps)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, maxRetryAfter, parseRetryAfter("86400", now))
+}
+
+func TestRunLoop_ParallelHelperToolCalls(t *testing.T) {
+	var mu sync.Mutex
+	var called []string
+	registry := NewToolRegistry()
+	for _, name := range []string{"lookup", "rules"} {
+		registry.Register(openai.FunctionDefinition{Name: name, Parameters: map[string]any{"type": "object"}},
+			func(ctx context.Context, arguments string) (string, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				called = append(called, name)
+				return name + " result", nil
+			})
+	}
+
+	a, fake := newTestAgent(t, []handler{
+		reply(openai.ChatCompletionMessage{
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_a", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup", Arguments: `{}`}},
+				{ID: "call_b", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "rules", Arguments: `{}`}},
+			},
+		}),
+		reply(openai.ChatCompletionMessage{
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_c", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "echo", Arguments: `{"message":"hello"}`}},
+			},
+		}),
+	})
+
+	result, err := a.RunLoop(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Say hello"},
+	}, []openai.Tool{echoTool}, echoValidator, nil, 3, WithToolRegistry(registry))
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result.Value)
+	assert.ElementsMatch(t, []string{"lookup", "rules"}, called)
+
+	// Both tools are offered, and the second request pairs the results with the assistant's calls
+	assert.Len(t, fake.requests[0].Tools, 3)
+	messages := fake.requests[1].Messages
+	require.Len(t, messages, 4)
+	assert.Equal(t, openai.ChatMessageRoleAssistant, messages[1].Role)
+	assert.Len(t, messages[1].ToolCalls, 2)
+	assert.Equal(t, openai.ChatMessageRoleTool, messages[2].Role)
+	assert.Equal(t, "call_a", messages[2].ToolCallID)
+	assert.Equal(t, "lookup result", messages[2].Content)
+	assert.Equal(t, "call_b", messages[3].ToolCallID)
+	assert.Equal(t, "rules result", messages[3].Content)
+}
+
+func TestRunLoop_InvalidToolCallAnsweredWithToolMessage(t *testing.T) {
+	a, fake := newTestAgent(t, []handler{
+		reply(openai.ChatCompletionMessage{
+			ToolCalls: []openai.ToolCall{
+				{Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "echo", Arguments: `not json`}},
+			},
+		}),
+		reply(openai.ChatCompletionMessage{
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "echo", Arguments: `{"message":"fixed"}`}},
+			},
+		}),
+	})
+
+	result, err := runEcho(t, a)
+	require.NoError(t, err)
+	assert.Equal(t, "fixed", result.Value)
+
+	messages := fake.requests[1].Messages
+	require.Len(t, messages, 3)
+	require.Len(t, messages[1].ToolCalls, 1)
+	assert.NotEmpty(t, messages[1].ToolCalls[0].ID, "missing tool call IDs are filled in")
+	assert.Equal(t, messages[1].ToolCalls[0].ID, messages[2].ToolCallID)
+	assert.Contains(t, messages[2].Content, "Please correct your response")
+}
+
+func TestChat_ToolCallThenReply(t *testing.T) {
+	registry := NewToolRegistry()
+	registry.Register(openai.FunctionDefinition{Name: "total", Parameters: map[string]any{"type": "object"}},
+		func(ctx context.Context, arguments string) (string, error) {
+			return "-42.00", nil
+		})
+
+	a, fake := newTestAgent(t, []handler{
+		reply(openai.ChatCompletionMessage{
+			ToolCalls: []openai.ToolCall{
+				{ID: "call_a", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "total", Arguments: `{}`}},
+			},
+		}),
+		reply(openai.ChatCompletionMessage{Content: "You spent $42.00."}),
+	})
+
+	result, err := a.Chat(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "How much did I spend?"},
+	}, registry, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "You spent $42.00.", result.Reply)
+	require.Len(t, result.ToolCalls, 1)
+	assert.Equal(t, "total", result.ToolCalls[0].Function.Name)
+
+	// The tool result is sent back, and the reply is kept for the next turn
+	messages := fake.requests[1].Messages
+	require.Len(t, messages, 3)
+	assert.Equal(t, "call_a", messages[2].ToolCallID)
+	assert.Equal(t, "-42.00", messages[2].Content)
+	require.Len(t, result.Messages, 4)
+	assert.Equal(t, "You spent $42.00.", result.Messages[3].Content)
+}
+
+func TestChat_ReplyTool(t *testing.T) {
+	a, _ := newTestAgent(t, []handler{
+		reply(openai.ChatCompletionMessage{Content: `{"name":"reply","arguments":{"text":"Hello"}}`}),
+	}, WithOutputMode(OutputModeJSON))
+
+	result, err := a.Chat(context.Background(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Hi"},
+	}, NewToolRegistry(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", result.Reply)
+	assert.Empty(t, result.ToolCalls)
+}
@@ -0,0 +1,112 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+	"golang.org/x/exp/slices"
+)
+
+// replyToolName is the tool models call to give their final answer when they can't answer in plain text,
+// which is the case in the JSON output modes
+const replyToolName = "reply"
+
+var replyTool = openai.Tool{
+	Type: openai.ToolTypeFunction,
+	Function: &openai.FunctionDefinition{
+		Name:        replyToolName,
+		Description: "Reply to the user with your final answer",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"text": map[string]any{
+					"type":        "string",
+					"description": "The answer to show the user",
+				},
+			},
+			"required": []string{"text"},
+		},
+	},
+}
+
+// ChatResult is the outcome of a conversational turn
+type ChatResult struct {
+	// Reply is the model's answer to the user
+	Reply string
+	// Messages is the conversation including this turn, to pass to the next Chat call
+	Messages []openai.ChatCompletionMessage
+	// Model is the model that gave the reply
+	Model string
+	// ToolCalls are the tool calls the model made during the turn
+	ToolCalls []openai.ToolCall
+}
+
+// Chat runs one conversational turn. The model may call tools from the registry, in
+// parallel and over several rounds, before answering in plain text. Returns the reply
+// along with the conversation to continue from.
+func (a *Agent) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, registry *ToolRegistry, maxTurns int) (*ChatResult, error) {
+	var (
+		chatMessages = slices.Clone(messages)
+		tools        = append(slices.Clone(registry.Tools()), replyTool)
+		madeCalls    []openai.ToolCall
+	)
+
+	for turn := 1; turn <= maxTurns; turn++ {
+		a.logger.Debug("Running chat turn", "turn", turn)
+
+		c, err := a.complete(ctx, chatMessages, tools)
+		if err != nil {
+			return nil, fmt.Errorf("chat completion failed: %w", err)
+		}
+		if len(c.resp.Choices) == 0 {
+			return nil, fmt.Errorf("no choices in response")
+		}
+
+		message := c.resp.Choices[0].Message
+		native := len(message.ToolCalls) > 0
+		toolCalls := message.ToolCalls
+		if !native {
+			toolCall, err := parseContentToolCall(message.Content, tools)
+			if err != nil {
+				// Anything that isn't a tool call is the answer
+				return a.chatReply(chatMessages, message.Content, c.model, madeCalls), nil
+			}
+			toolCalls = []openai.ToolCall{toolCall}
+		}
+
+		for i := range toolCalls {
+			if toolCalls[i].ID == "" {
+				toolCalls[i].ID = fmt.Sprintf("call_%d_%d", turn, i)
+			}
+			if toolCalls[i].Function.Name == replyToolName {
+				var args struct {
+					Text string `json:"text"`
+				}
+				if err := json.Unmarshal([]byte(toolCalls[i].Function.Arguments), &args); err == nil {
+					return a.chatReply(chatMessages, args.Text, c.model, madeCalls), nil
+				}
+			}
+		}
+		madeCalls = append(madeCalls, toolCalls...)
+
+		a.logger.Debug("Calling chat tools", "count", len(toolCalls))
+		results := registry.callAll(ctx, toolCalls)
+		chatMessages = append(chatMessages, toolResultMessages(message, toolCalls, results, native)...)
+	}
+
+	return nil, fmt.Errorf("no reply after %d turns", maxTurns)
+}
+
+func (a *Agent) chatReply(chatMessages []openai.ChatCompletionMessage, reply, model string, toolCalls []openai.ToolCall) *ChatResult {
+	return &ChatResult{
+		Reply: reply,
+		Messages: append(chatMessages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: reply,
+		}),
+		Model:     model,
+		ToolCalls: toolCalls,
+	}
+}
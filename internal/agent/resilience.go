@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Defaults for retries, backoff and the circuit breaker
+const (
+	defaultRetries          = 3
+	defaultBackoffBase      = time.Second
+	defaultBackoffMax       = 30 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = time.Minute
+
+	// maxRetryAfter caps how long a server can ask us to wait
+	maxRetryAfter = 5 * time.Minute
+)
+
+// retryHintKey is the context key for the retryHint filled in by retryAfterDoer
+type retryHintKey struct{}
+
+// retryHint carries the Retry-After delay of a response back to the caller
+type retryHint struct {
+	after time.Duration
+}
+
+// retryAfterDoer records the Retry-After header of responses, which go-openai doesn't expose on its errors
+type retryAfterDoer struct {
+	doer openai.HTTPDoer
+}
+
+func (d retryAfterDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(req)
+	if err != nil {
+		return resp, err
+	}
+	if hint, ok := req.Context().Value(retryHintKey{}).(*retryHint); ok {
+		hint.after = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return resp, nil
+}
+
+// newClient creates an OpenAI client that reports Retry-After headers to the agent
+func newClient(cfg openai.ClientConfig) *openai.Client {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{}
+	}
+	cfg.HTTPClient = retryAfterDoer{doer: cfg.HTTPClient}
+	return openai.NewClientWithConfig(cfg)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	var d time.Duration
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		d = time.Duration(secs * float64(time.Second))
+	} else if at, err := http.ParseTime(value); err == nil {
+		d = at.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	return min(d, maxRetryAfter)
+}
+
+// errorStatus returns the HTTP status code of an API error, or 0 if there isn't one
+func errorStatus(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
+
+// isRetryable reports whether a failed request is worth retrying against the same model
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch status := errorStatus(err); {
+	case status == 0:
+		// Network errors and malformed responses
+		return true
+	case status == http.StatusTooManyRequests, status == http.StatusRequestTimeout:
+		return true
+	default:
+		return status >= 500
+	}
+}
+
+// backoffDelay returns how long to wait before the given retry, preferring the server's Retry-After
+func (a *Agent) backoffDelay(retry int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	delay := a.backoffBase << retry
+	if delay <= 0 || delay > a.backoffMax {
+		delay = a.backoffMax
+	}
+	// Without a maximum there's no delay to jitter, so retry straight away
+	if delay <= 0 {
+		return 0
+	}
+	// Full jitter spreads retries from concurrent goroutines apart
+	return time.Duration(rand.Int64N(int64(delay)) + 1)
+}
+
+// sleepContext waits for d or until the context is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker stops sending requests to a model after repeated failures, until a cooldown has passed
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent. Once the cooldown has passed, requests are
+// let through again and a single further failure re-opens the breaker.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.threshold <= 0 || b.failures < b.threshold || !now.Before(b.openUntil)
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+// failure records a failed request, returning true if the breaker is now open
+func (b *circuitBreaker) failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.threshold > 0 && b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+		return true
+	}
+	return false
+}
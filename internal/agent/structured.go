@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OutputMode controls how the agent asks a model for structured output
+type OutputMode string
+
+const (
+	// OutputModeAuto starts with tool calls and falls back to JSON modes when a model doesn't support them
+	OutputModeAuto OutputMode = "auto"
+	// OutputModeTools uses native tool calling
+	OutputModeTools OutputMode = "tools"
+	// OutputModeJSONSchema uses response_format with a JSON schema built from the tool definitions
+	OutputModeJSONSchema OutputMode = "json_schema"
+	// OutputModeJSON asks for plain JSON in the message content
+	OutputModeJSON OutputMode = "json"
+)
+
+// ParseOutputMode parses an output mode name
+func ParseOutputMode(s string) (OutputMode, error) {
+	switch mode := OutputMode(s); mode {
+	case OutputModeAuto, OutputModeTools, OutputModeJSONSchema, OutputModeJSON:
+		return mode, nil
+	case "":
+		return OutputModeAuto, nil
+	default:
+		return "", fmt.Errorf("unknown output mode %q (expected auto, tools, json_schema or json)", s)
+	}
+}
+
+// contentToolCallID is the ID given to tool calls parsed from message content
+const contentToolCallID = "content"
+
+// rawSchema adapts a tool's parameter definition to the json.Marshaler expected by response_format
+type rawSchema struct {
+	v any
+}
+
+func (s rawSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.v)
+}
+
+// envelopeSchema is the schema used when the model must choose between several tools
+func envelopeSchema(tools []openai.Tool) map[string]any {
+	names := make([]string, 0, len(tools))
+	for _, t := range tools {
+		names = append(names, t.Function.Name)
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"name": map[string]any{
+				"type":        "string",
+				"enum":        names,
+				"description": "The function to call",
+			},
+			"arguments": map[string]any{
+				"type":        "object",
+				"description": "The arguments for the function",
+			},
+		},
+		"required": []string{"name", "arguments"},
+	}
+}
+
+// responseFormat builds a json_schema response format from the available tools
+func responseFormat(tools []openai.Tool) *openai.ChatCompletionResponseFormat {
+	if len(tools) == 1 {
+		f := tools[0].Function
+		return &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:        f.Name,
+				Description: f.Description,
+				Schema:      rawSchema{f.Parameters},
+				Strict:      f.Strict,
+			},
+		}
+	}
+	return &openai.ChatCompletionResponseFormat{
+		Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+		JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+			Name:   "function_call",
+			Schema: rawSchema{envelopeSchema(tools)},
+		},
+	}
+}
+
+// jsonInstructions describes the tools to a model that will answer with JSON content instead of tool calls
+func jsonInstructions(tools []openai.Tool) string {
+	var sb strings.Builder
+	if len(tools) == 1 {
+		f := tools[0].Function
+		schema, _ := json.Marshal(f.Parameters)
+		sb.WriteString("Respond with ONLY a JSON object, with no markdown and no commentary. ")
+		sb.WriteString(fmt.Sprintf("The object contains the arguments for the %s function (%s) and must match this JSON schema:\n", f.Name, f.Description))
+		sb.Write(schema)
+		return sb.String()
+	}
+
+	sb.WriteString("Respond with ONLY a JSON object of the form {\"name\": \"<function name>\", \"arguments\": {...}}, with no markdown and no commentary. ")
+	sb.WriteString("Call exactly one of these functions, with arguments matching its JSON schema:\n")
+	for _, t := range tools {
+		schema, _ := json.Marshal(t.Function.Parameters)
+		sb.WriteString(fmt.Sprintf("- %s: %s\n  %s\n", t.Function.Name, t.Function.Description, schema))
+	}
+	return sb.String()
+}
+
+// extractJSONObject finds the outermost JSON object in content, ignoring markdown fences and surrounding text
+func extractJSONObject(content string) (string, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return "", errors.New("no JSON object in response content")
+	}
+	obj := content[start : end+1]
+	if !json.Valid([]byte(obj)) {
+		return "", errors.New("invalid JSON object in response content")
+	}
+	return obj, nil
+}
+
+// parseContentToolCall turns JSON in a message's content into a tool call, so that
+// models without tool support can feed the same ToolCallValidator
+func parseContentToolCall(content string, tools []openai.Tool) (openai.ToolCall, error) {
+	if len(tools) == 0 {
+		return openai.ToolCall{}, errors.New("no tools available")
+	}
+
+	obj, err := extractJSONObject(content)
+	if err != nil {
+		return openai.ToolCall{}, err
+	}
+
+	// Accept the {"name": ..., "arguments": ...} envelope for any number of tools
+	var envelope struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal([]byte(obj), &envelope); err == nil && envelope.Name != "" && len(envelope.Arguments) > 0 {
+		for _, t := range tools {
+			if t.Function.Name != envelope.Name {
+				continue
+			}
+			args := string(envelope.Arguments)
+			// Some models encode arguments as a JSON string, as in native tool calls
+			var encoded string
+			if err := json.Unmarshal(envelope.Arguments, &encoded); err == nil {
+				args = encoded
+			}
+			return newContentToolCall(envelope.Name, args), nil
+		}
+	}
+
+	if len(tools) > 1 {
+		return openai.ToolCall{}, errors.New(`response content must be a JSON object of the form {"name": ..., "arguments": ...}`)
+	}
+	return newContentToolCall(tools[0].Function.Name, obj), nil
+}
+
+func newContentToolCall(name, arguments string) openai.ToolCall {
+	return openai.ToolCall{
+		ID:   contentToolCallID,
+		Type: openai.ToolTypeFunction,
+		Function: openai.FunctionCall{
+			Name:      name,
+			Arguments: arguments,
+		},
+	}
+}
+
+// isUnsupportedError reports whether err is a client error whose message mentions one of the keywords,
+// which is how providers reject tools or response_format for models that don't support them
+func isUnsupportedError(err error, keywords ...string) bool {
+	var (
+		status  int
+		message string
+	)
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		status, message = apiErr.HTTPStatusCode, apiErr.Message
+	case errors.As(err, &reqErr):
+		status, message = reqErr.HTTPStatusCode, string(reqErr.Body)
+	default:
+		return false
+	}
+	if status < 400 || status >= 500 || status == 429 {
+		return false
+	}
+	message = strings.ToLower(message)
+	for _, k := range keywords {
+		if strings.Contains(message, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOutputMode returns the mode to fall back to when a request fails because of the current mode
+func nextOutputMode(mode OutputMode, err error) (OutputMode, bool) {
+	switch mode {
+	case OutputModeTools:
+		if isUnsupportedError(err, "tool", "function") {
+			return OutputModeJSONSchema, true
+		}
+	case OutputModeJSONSchema:
+		if isUnsupportedError(err, "response_format", "json_schema", "structured", "schema") {
+			return OutputModeJSON, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,95 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+
+	openai "github.com/sashabaranov/go-openai"
+	"golang.org/x/sync/errgroup"
+)
+
+// ToolHandler runs a helper tool with the JSON arguments from a tool call and returns its result
+type ToolHandler func(ctx context.Context, arguments string) (string, error)
+
+// ToolRegistry holds helper tools the model can call before making its final tool call
+type ToolRegistry struct {
+	tools    []openai.Tool
+	handlers map[string]ToolHandler
+}
+
+// NewToolRegistry creates an empty ToolRegistry
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{handlers: make(map[string]ToolHandler)}
+}
+
+// Register adds a helper tool, replacing any existing tool with the same name
+func (r *ToolRegistry) Register(def openai.FunctionDefinition, handler ToolHandler) {
+	if _, exists := r.handlers[def.Name]; exists {
+		for i, t := range r.tools {
+			if t.Function.Name == def.Name {
+				r.tools = append(r.tools[:i], r.tools[i+1:]...)
+				break
+			}
+		}
+	}
+	r.tools = append(r.tools, openai.Tool{Type: openai.ToolTypeFunction, Function: &def})
+	r.handlers[def.Name] = handler
+}
+
+// Tools returns the tool definitions in the order they were registered
+func (r *ToolRegistry) Tools() []openai.Tool {
+	if r == nil {
+		return nil
+	}
+	return r.tools
+}
+
+// Has reports whether a helper tool with the given name is registered
+func (r *ToolRegistry) Has(name string) bool {
+	if r == nil {
+		return false
+	}
+	_, ok := r.handlers[name]
+	return ok
+}
+
+// Call runs a helper tool. Errors are returned as the result so the model can see and recover from them.
+func (r *ToolRegistry) Call(ctx context.Context, toolCall openai.ToolCall) string {
+	handler, ok := r.handlers[toolCall.Function.Name]
+	if !ok {
+		return fmt.Sprintf("Error: unknown tool %s", toolCall.Function.Name)
+	}
+	result, err := handler(ctx, toolCall.Function.Arguments)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	return result
+}
+
+// callAll runs helper tool calls concurrently, returning results in the same order as the calls
+func (r *ToolRegistry) callAll(ctx context.Context, toolCalls []openai.ToolCall) []string {
+	results := make([]string, len(toolCalls))
+	var g errgroup.Group
+	for i, tc := range toolCalls {
+		g.Go(func() error {
+			results[i] = r.Call(ctx, tc)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return results
+}
+
+// RunOption configures a single RunLoop
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	registry *ToolRegistry
+}
+
+// WithToolRegistry makes the helper tools in the registry available during the loop
+func WithToolRegistry(registry *ToolRegistry) RunOption {
+	return func(o *runOptions) {
+		o.registry = registry
+	}
+}
@@ -14,8 +14,10 @@ import (
 	"github.com/lox/bank-transaction-analyzer/internal/bank"
 	"github.com/lox/bank-transaction-analyzer/internal/db"
 	"github.com/lox/bank-transaction-analyzer/internal/embeddings"
+	"github.com/lox/bank-transaction-analyzer/internal/redact"
 	"github.com/lox/bank-transaction-analyzer/internal/types"
 	openai "github.com/sashabaranov/go-openai"
+	"golang.org/x/exp/slices"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -25,6 +27,17 @@ type Config struct {
 	Progress        bool
 	DryRun          bool
 	Limit           int
+
+	// NoRedact disables PII redaction of transaction text sent to the LLM
+	NoRedact bool
+	// StrictRedactionBanks lists banks that get strict redaction (names and long numbers)
+	StrictRedactionBanks []string
+	// HelperTools lets the LLM look up known merchants, similar transactions and bank rules before classifying
+	HelperTools bool
+	// Alerts checks newly stored transactions for anomalies, or is nil to skip them
+	Alerts *db.AlertConfig
+	// Trips are detected again after each import, or nil to leave them as they are
+	Trips *db.TripConfig
 }
 
 type Analyzer struct {
@@ -80,6 +93,12 @@ func (a *Analyzer) AnalyzeTransactions(ctx context.Context, transactions []types
 		progress = NewBarProgress(len(filteredTransactions))
 	}
 
+	// Redact sensitive values before transaction text is sent to the LLM
+	var redactor *redact.Redactor
+	if !config.NoRedact {
+		redactor = redact.New(slices.Contains(config.StrictRedactionBanks, bank.Name()))
+	}
+
 	// Initialize result slice with capacity for all newly processed transactions
 	analyzedTransactions := make([]types.TransactionWithDetails, 0, len(filteredTransactions))
 
@@ -97,7 +116,7 @@ func (a *Analyzer) AnalyzeTransactions(ctx context.Context, transactions []types
 
 			// Parse transaction details
 			analysisStart := time.Now()
-			details, err := a.analyzeTransaction(gCtx, t, config.OpenRouterModel, bank)
+			details, err := a.analyzeTransaction(gCtx, t, config.OpenRouterModel, bank, redactor, config.HelperTools)
 			if err != nil {
 				// If context was canceled, return immediately
 				if errors.Is(err, context.Canceled) {
@@ -163,6 +182,39 @@ func (a *Analyzer) AnalyzeTransactions(ctx context.Context, transactions []types
 		"total", len(filteredTransactions),
 		"skipped", len(transactions)-len(filteredTransactions))
 
+	// New transactions can complete transfers between accounts, refund earlier purchases, carry
+	// the international fee for a foreign purchase, and start, continue or change the price of
+	// recurring series
+	if !config.DryRun && len(analyzedTransactions) > 0 {
+		if _, err := a.db.RefreshTransferMatches(ctx, db.DefaultTransferWindow); err != nil {
+			return nil, fmt.Errorf("error matching transfers: %w", err)
+		}
+		if _, err := a.db.RefreshRefundLinks(ctx, db.DefaultRefundWindow); err != nil {
+			return nil, fmt.Errorf("error linking refunds: %w", err)
+		}
+		if _, err := a.db.RefreshFXFeeLinks(ctx, db.DefaultFXFeeWindow); err != nil {
+			return nil, fmt.Errorf("error linking international transaction fees: %w", err)
+		}
+		if _, err := a.db.RefreshRecurringSeries(ctx); err != nil {
+			return nil, fmt.Errorf("error refreshing recurring series: %w", err)
+		}
+		if config.Trips != nil {
+			if _, err := a.db.RefreshTrips(ctx, *config.Trips); err != nil {
+				return nil, fmt.Errorf("error refreshing trips: %w", err)
+			}
+		}
+		// Anomalies are checked last, so transfers between our own accounts are already matched
+		if config.Alerts != nil {
+			ids := make([]string, len(analyzedTransactions))
+			for i, t := range analyzedTransactions {
+				ids[i] = db.GenerateTransactionID(t.Transaction)
+			}
+			if _, err := a.db.DetectAlerts(ctx, ids, *config.Alerts); err != nil {
+				return nil, fmt.Errorf("error detecting alerts: %w", err)
+			}
+		}
+	}
+
 	return analyzedTransactions, nil
 }
 
@@ -240,8 +292,10 @@ func buildCategoryGuidelines() string {
 	return sb.String()
 }
 
-// analyzeTransaction uses an LLM to extract structured information from a transaction
-func (a *Analyzer) analyzeTransaction(ctx context.Context, t types.Transaction, model string, bank bank.Bank) (*types.TransactionDetails, error) {
+// analyzeTransaction uses an LLM to extract structured information from a transaction.
+// If a redactor is provided, sensitive values are replaced with placeholders in the prompt
+// and restored into the parsed details once the tool call returns.
+func (a *Analyzer) analyzeTransaction(ctx context.Context, t types.Transaction, model string, bank bank.Bank, redactor *redact.Redactor, helperTools bool) (*types.TransactionDetails, error) {
 	startTime := time.Now()
 	a.logger.Debug("Analyzing transaction",
 		"payee", t.Payee,
@@ -249,6 +303,16 @@ func (a *Analyzer) analyzeTransaction(ctx context.Context, t types.Transaction,
 		"date", t.Date,
 		"model", model)
 
+	payee := t.Payee
+	var redaction *redact.Redaction
+	if redactor != nil {
+		redaction = redactor.Redact(t.Payee)
+		payee = redaction.Text
+		a.logger.Debug("Redacted transaction text",
+			"redacted_values", redaction.Len(),
+			"strict", redactor.Strict())
+	}
+
 	promptBase := fmt.Sprintf(`Extract and classify transaction details from the following bank transaction.
 
 Transaction: %s
@@ -300,8 +364,8 @@ IMPORTANT RULES:
    - Keep descriptions concise but informative
 7. Card number extraction:
    - If a card number is present in the format "Card XXXX...XXXX", extract it
-   - Store the full card number in the card_number field
-   - Do not mask or truncate the card number
+   - Store the card number exactly as it appears in the card_number field, which may be a placeholder like <CARD_1> (see rule 12)
+   - Do not mask, truncate or otherwise change the card number or its placeholder
 8. Transfer details processing:
    - For transfer transactions, carefully extract account numbers, removing any non-essential characters
    - The to_account field should only contain the account number, not dates, amounts, or transaction details
@@ -316,6 +380,11 @@ IMPORTANT RULES:
 %s
 11. Transaction category classification:
 %s
+12. Redacted values:
+   - Sensitive values may be replaced with placeholders like <CARD_1>, <ACCOUNT_1>, <PHONE_1>, <NAME_1> or <NUMBER_1>
+   - Copy placeholders verbatim into the matching fields (e.g. card_number, to_account, reference, merchant)
+   - Never guess or invent the value behind a placeholder
+   - A <NAME_n> placeholder after "Transfer to" or "From" is a person or business receiving or sending money
 
 EXAMPLES:
 
@@ -405,7 +474,7 @@ Correct response:
 }
 
 The classify_transaction function requires these fields: type, merchant, category, description, and search_body.`,
-		t.Payee, t.Amount, t.Date, bank.AdditionalPromptRules(), buildTypeGuidelines(), buildCategoryGuidelines())
+		payee, t.Amount, t.Date, bank.AdditionalPromptRules(), buildTypeGuidelines(), buildCategoryGuidelines())
 
 	chatMessages := []openai.ChatCompletionMessage{
 		{
@@ -418,7 +487,7 @@ The classify_transaction function requires these fields: type, merchant, categor
 		},
 	}
 
-	params := map[string]any{
+	properties := map[string]any{
 		"type": map[string]any{
 			"type":        "string",
 			"enum":        getTypeNames(types.AllowedTypes),
@@ -483,13 +552,17 @@ The classify_transaction function requires these fields: type, merchant, categor
 			"description": "Additional details for transfer transactions",
 		},
 	}
-	params["required"] = []string{"type", "merchant", "category", "description", "search_body"}
+	params := map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   []string{"type", "merchant", "category", "description", "search_body"},
+	}
 
+	// Strict schemas require every property to be required, which doesn't hold for the optional fields
 	f := openai.FunctionDefinition{
 		Name:        "classify_transaction",
 		Description: "Classify and extract details from bank transaction data",
 		Parameters:  params,
-		Strict:      true,
 	}
 
 	parseTransactionTool := openai.Tool{
@@ -525,18 +598,36 @@ The classify_transaction function requires these fields: type, merchant, categor
 		return toolCall.Function.Name == "classify_transaction"
 	}
 
+	maxLoop := 3
+	var runOpts []agent.RunOption
+	if helperTools {
+		chatMessages = append(chatMessages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: "If you are unsure about the merchant, type or category, you may first call lookup_known_merchant, find_similar_transactions or get_bank_rules, several at once if needed. Always finish by calling classify_transaction.",
+		})
+		runOpts = append(runOpts, agent.WithToolRegistry(a.helperTools(bank, redaction)))
+		maxLoop = 5
+	}
+
 	result, err := a.agent.RunLoop(
 		ctx,
 		chatMessages,
 		[]openai.Tool{parseTransactionTool},
 		validator,
 		shouldStop,
-		3,
+		maxLoop,
+		runOpts...,
 	)
 	if err != nil {
 		return nil, err
 	}
-	details := result.(*types.TransactionDetails)
+	details := result.Value.(*types.TransactionDetails)
+	details.Model = result.Model
+
+	// Put the real values back now that the LLM has classified the redacted text
+	if redaction != nil {
+		redaction.RestoreDetails(details)
+	}
 
 	a.logger.Debug("Successfully parsed transaction details",
 		"payee", t.Payee,
@@ -558,12 +649,24 @@ func (a *Analyzer) storeTransaction(ctx context.Context, t types.Transaction, de
 		return fmt.Errorf("failed to store transaction: %w", err)
 	}
 
+	// Splits from the bank export that don't add up are dropped rather than failing the import
+	if len(t.Splits) > 0 {
+		if err := a.db.SetSplits(ctx, db.GenerateTransactionID(t), t.Splits); err != nil {
+			a.logger.Warn("Failed to store transaction splits", "error", err, "payee", t.Payee)
+		}
+	}
+
 	// Create a TransactionWithDetails and update embedding
 	tx := types.TransactionWithDetails{
 		Transaction: t,
 		Details:     *details,
 	}
 
+	// Notes written since the transaction was first imported are kept, so they're embedded too
+	if stored, err := a.db.GetTransactionByID(ctx, db.GenerateTransactionID(t)); err == nil {
+		tx.Details.Notes = stored.Details.Notes
+	}
+
 	err = a.UpdateEmbedding(ctx, &tx)
 	if err != nil {
 		a.logger.Warn("Failed to update embedding during transaction storage", "error", err)
@@ -577,10 +680,14 @@ func (a *Analyzer) storeTransaction(ctx context.Context, t types.Transaction, de
 	return nil
 }
 
-// UpdateEmbedding updates the embedding for a single transaction
+// UpdateEmbedding updates the embedding for a single transaction from its search body and notes
 func (a *Analyzer) UpdateEmbedding(ctx context.Context, tx *types.TransactionWithDetails) error {
-	// Generate transaction ID
-	txID := db.GenerateTransactionID(tx.Transaction)
+	// Stored transactions have their ID, which can't always be generated again from the amount
+	txID := tx.ID
+	if txID == "" {
+		txID = db.GenerateTransactionID(tx.Transaction)
+	}
+	text := tx.Details.EmbeddingText()
 
 	// Check if embedding exists in vector storage with content hash
 	exists, metadata, err := a.vectors.HasEmbedding(ctx, txID)
@@ -590,7 +697,7 @@ func (a *Analyzer) UpdateEmbedding(ctx context.Context, tx *types.TransactionWit
 
 	// If embedding exists, check if it's up to date
 	if exists {
-		if metadata.MatchContent(tx.Details.SearchBody) {
+		if metadata.MatchContent(text) {
 			a.logger.Debug("Embedding already exists and is up to date",
 				"id", txID,
 				"payee", tx.Payee,
@@ -601,7 +708,7 @@ func (a *Analyzer) UpdateEmbedding(ctx context.Context, tx *types.TransactionWit
 				"id", txID,
 				"payee", tx.Payee,
 				"merchant", tx.Details.Merchant,
-				"content", tx.Details.SearchBody,
+				"content", text,
 				"metadata", metadata)
 		}
 
@@ -613,14 +720,14 @@ func (a *Analyzer) UpdateEmbedding(ctx context.Context, tx *types.TransactionWit
 	}
 
 	// Generate embedding
-	embedding, err := a.embeddings.GenerateEmbedding(ctx, tx.Details.SearchBody)
+	embedding, err := a.embeddings.GenerateEmbedding(ctx, text)
 	if err != nil {
 		return fmt.Errorf("failed to generate embedding: %w", err)
 	}
 
 	// Store embedding
-	err = a.vectors.StoreEmbedding(ctx, txID, tx.Details.SearchBody, embedding, embeddings.EmbeddingMetadata{
-		ContentHash: embeddings.Hash(tx.Details.SearchBody),
+	err = a.vectors.StoreEmbedding(ctx, txID, text, embedding, embeddings.EmbeddingMetadata{
+		ContentHash: embeddings.Hash(text),
 		ModelName:   a.embeddings.GetEmbeddingModelName(),
 		Length:      len(embedding),
 		LastUpdated: time.Now(),
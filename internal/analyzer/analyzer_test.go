@@ -2,8 +2,14 @@ package analyzer
 
 import (
 	"context"
+	"io"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/bank/ing"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
 	"github.com/lox/bank-transaction-analyzer/internal/embeddings"
 	"github.com/lox/bank-transaction-analyzer/internal/types"
 	"github.com/shopspring/decimal"
@@ -18,21 +24,59 @@ func (m *MockEmbeddingProvider) GenerateEmbedding(ctx context.Context, text stri
 	return []float32{0.1, 0.2, 0.3}, nil
 }
 
+func (m *MockEmbeddingProvider) GetEmbeddingModelName() string {
+	return "mock"
+}
+
 // MockVectorStorage is a mock implementation of VectorStorage
 type MockVectorStorage struct{}
 
-func (m *MockVectorStorage) StoreEmbedding(ctx context.Context, id string, content string, embedding []float32) error {
+func (m *MockVectorStorage) StoreEmbedding(ctx context.Context, id string, text string, embedding []float32, metadata embeddings.EmbeddingMetadata) error {
 	return nil
 }
 
-func (m *MockVectorStorage) HasEmbedding(ctx context.Context, id string, content string) (bool, error) {
-	return false, nil
+func (m *MockVectorStorage) HasEmbedding(ctx context.Context, id string) (bool, embeddings.EmbeddingMetadata, error) {
+	return false, embeddings.EmbeddingMetadata{}, nil
 }
 
 func (m *MockVectorStorage) Query(ctx context.Context, embedding []float32, threshold float32) ([]embeddings.VectorResult, error) {
 	return []embeddings.VectorResult{}, nil
 }
 
+func (m *MockVectorStorage) RemoveEmbedding(ctx context.Context, id string) error {
+	return nil
+}
+
+func (m *MockVectorStorage) Close() error {
+	return nil
+}
+
+func TestStoreTransactionKeepsQIFSplits(t *testing.T) {
+	database, err := db.New(t.TempDir(), log.New(io.Discard), time.UTC)
+	require.NoError(t, err)
+	defer database.Close()
+
+	// Split categories come from the app that exported the QIF, not the analyzer's categories
+	statement := "!Type:Bank\nD02/03/2024\nT-150.00\nPCOSTCO WHOLESALE\n" +
+		"SHousehold:Cleaning\nEPaper towels\n$-45.00\nSFood:Groceries\n$-105.00\n^\n"
+	ctx := context.Background()
+	transactions, err := ing.New().ParseTransactions(ctx, strings.NewReader(statement))
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+
+	a := NewAnalyzer(nil, log.New(io.Discard), database, &MockEmbeddingProvider{}, &MockVectorStorage{})
+	details := &types.TransactionDetails{Type: "purchase", Merchant: "Costco", Category: "Groceries", SearchBody: "costco"}
+	require.NoError(t, a.storeTransaction(ctx, transactions[0], details))
+
+	stored, err := database.GetTransactionByID(ctx, db.GenerateTransactionID(transactions[0]))
+	require.NoError(t, err)
+	require.Len(t, stored.Splits, 2)
+	assert.Equal(t, "Other", stored.Splits[0].Category)
+	assert.Equal(t, "Household:Cleaning: Paper towels", stored.Splits[0].Note)
+	assert.Equal(t, "Groceries", stored.Splits[1].Category)
+	assert.Equal(t, "Food:Groceries", stored.Splits[1].Note)
+}
+
 func TestValidateTransactionDetails(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -172,3 +216,9 @@ func TestValidateTransactionDetails(t *testing.T) {
 		})
 	}
 }
+
+func TestFTSQuery(t *testing.T) {
+	assert.Equal(t, `"SQ" OR "MARIOS" OR "PIZZA"`, ftsQuery("SQ *MARIOS PIZZA"))
+	assert.Equal(t, `"AMAZON" OR "COM" OR "AU"`, ftsQuery(`AMAZON.COM.AU "`))
+	assert.Equal(t, "", ftsQuery("* - x"))
+}
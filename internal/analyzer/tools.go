@@ -0,0 +1,153 @@
+package analyzer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/lox/bank-transaction-analyzer/internal/agent"
+	"github.com/lox/bank-transaction-analyzer/internal/bank"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/redact"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// maxHelperResults caps how many rows a helper tool returns to the LLM
+const maxHelperResults = 5
+
+// helperTools builds the tools the classifier can call before classify_transaction.
+// Arguments are restored and results redacted with the transaction's redaction, so
+// stored transactions don't leak values the prompt kept from the LLM.
+func (a *Analyzer) helperTools(bank bank.Bank, redaction *redact.Redaction) *agent.ToolRegistry {
+	restore := func(s string) string {
+		if redaction == nil {
+			return s
+		}
+		return redaction.Restore(s)
+	}
+	apply := func(s string) string {
+		if redaction == nil {
+			return s
+		}
+		return redaction.Apply(s)
+	}
+
+	registry := agent.NewToolRegistry()
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "lookup_known_merchant",
+		Description: "Look up how previous transactions from a merchant were classified",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"name": map[string]any{
+					"type":        "string",
+					"description": "The merchant name, or part of it",
+				},
+			},
+			"required": []string{"name"},
+		},
+	}, func(ctx context.Context, arguments string) (string, error) {
+		var args struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		if strings.TrimSpace(args.Name) == "" {
+			return "", fmt.Errorf("name is required")
+		}
+		classifications, err := a.db.GetMerchantClassifications(ctx, restore(args.Name), maxHelperResults)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, c := range classifications {
+			// Transfers are named after people, which the LLM shouldn't learn from a lookup
+			if c.Type == "transfer" {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("- %s: type=%s category=%s (%d transactions)\n",
+				apply(c.Merchant), c.Type, c.Category, c.Count))
+		}
+		if sb.Len() == 0 {
+			return "No known merchant matches " + args.Name, nil
+		}
+		return sb.String(), nil
+	})
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "find_similar_transactions",
+		Description: "Find previously classified transactions with similar text",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{
+					"type":        "string",
+					"description": "Keywords from the transaction, such as the merchant name",
+				},
+			},
+			"required": []string{"query"},
+		},
+	}, func(ctx context.Context, arguments string) (string, error) {
+		var args struct {
+			Query string `json:"query"`
+		}
+		if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		query := ftsQuery(restore(args.Query))
+		if query == "" {
+			return "", fmt.Errorf("query must contain at least one word")
+		}
+		results, _, err := a.db.SearchTransactionsByText(ctx, query, db.OrderByRelevance, db.WithLimit(maxHelperResults))
+		if err != nil {
+			return "", err
+		}
+		if len(results) == 0 {
+			return "No similar transactions found", nil
+		}
+		var sb strings.Builder
+		for _, r := range results {
+			// Transfers are named after people, so only their classification is shared
+			merchant := apply(r.Details.Merchant)
+			if r.Details.Type == "transfer" {
+				merchant = "(transfer)"
+			}
+			sb.WriteString(fmt.Sprintf("- %s => merchant=%s type=%s category=%s\n",
+				apply(r.Payee), merchant, r.Details.Type, r.Details.Category))
+		}
+		return sb.String(), nil
+	})
+
+	registry.Register(openai.FunctionDefinition{
+		Name:        "get_bank_rules",
+		Description: "Get the bank-specific rules and the allowed transaction types and categories",
+		Parameters: map[string]any{
+			"type":       "object",
+			"properties": map[string]any{},
+		},
+	}, func(ctx context.Context, arguments string) (string, error) {
+		return fmt.Sprintf("Bank: %s\n\nBANK-SPECIFIC RULES:\n%s\n\nTRANSACTION TYPES:\n%s\nCATEGORIES:\n%s",
+			bank.Name(), bank.AdditionalPromptRules(), buildTypeGuidelines(), buildCategoryGuidelines()), nil
+	})
+
+	return registry
+}
+
+// ftsQuery turns free text into an FTS5 query that matches any of its words
+func ftsQuery(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var terms []string
+	for _, w := range words {
+		if len(w) < 2 {
+			continue
+		}
+		terms = append(terms, `"`+w+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
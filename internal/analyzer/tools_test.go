@@ -0,0 +1,63 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/bank/ing"
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/lox/bank-transaction-analyzer/internal/redact"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHelperToolsConcurrent calls the helpers that share a transaction's redaction at the same
+// time, as the agent does when the model asks for several tools at once. Run with -race.
+func TestHelperToolsConcurrent(t *testing.T) {
+	database, err := db.New(t.TempDir(), log.New(io.Discard), time.UTC)
+	require.NoError(t, err)
+	defer database.Close()
+
+	ctx := context.Background()
+	for i := range 3 {
+		transaction := types.Transaction{
+			Date:   fmt.Sprintf("0%d/04/2024", i+1),
+			Amount: types.MustParseMoney("-12.50", types.DefaultCurrency),
+			Payee:  fmt.Sprintf("Woolworths card 4622 1234 5678 %04d", i),
+			Bank:   "ing-australia",
+		}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: "Woolworths 1234 5678 9012 3456", Category: "Groceries", SearchBody: "woolworths"}
+		require.NoError(t, database.Store(ctx, transaction, details))
+	}
+
+	a := NewAnalyzer(nil, log.New(io.Discard), database, nil, nil)
+	redaction := redact.New(false).Redact("Woolworths card 4622 1234 5678 9999 transfer to Jane Citizen")
+	registry := a.helperTools(ing.New(), redaction)
+
+	calls := []openai.ToolCall{
+		{ID: "1", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "lookup_known_merchant", Arguments: `{"name":"Woolworths"}`}},
+		{ID: "2", Type: openai.ToolTypeFunction, Function: openai.FunctionCall{Name: "find_similar_transactions", Arguments: `{"query":"Woolworths <NAME_1>"}`}},
+	}
+	var wg sync.WaitGroup
+	results := make([]string, 20)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = registry.Call(ctx, calls[i%len(calls)])
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		assert.Contains(t, result, "Woolworths")
+		assert.NotContains(t, result, "1234 5678")
+	}
+}
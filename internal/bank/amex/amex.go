@@ -2,6 +2,7 @@ package amex
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	"github.com/lox/bank-transaction-analyzer/internal/bank"
@@ -33,11 +34,21 @@ func (a *Amex) ParseTransactions(ctx context.Context, r io.Reader) ([]types.Tran
 	// Convert QIF transactions to our internal type
 	transactions := make([]types.Transaction, len(qifTransactions))
 	for idx, t := range qifTransactions {
+		amount, err := bank.QIFAmount(t.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d on %s: %w", idx+1, t.Date, err)
+		}
+		splits, err := bank.QIFSplits(t.Splits)
+		if err != nil {
+			return nil, err
+		}
 		transactions[idx] = types.Transaction{
-			Date:   t.Date,
-			Amount: t.Amount,
-			Payee:  t.Payee,
-			Bank:   a.Name(),
+			Date:       t.Date,
+			Amount:     amount,
+			AmountText: t.Amount,
+			Payee:      t.Payee,
+			Bank:       a.Name(),
+			Splits:     splits,
 		}
 	}
 
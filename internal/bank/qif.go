@@ -0,0 +1,70 @@
+package bank
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/qif"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+// QIFAmount parses a QIF amount, which may have thousands separators, in the default currency
+func QIFAmount(s string) (types.Money, error) {
+	return types.ParseMoney(s, types.DefaultCurrency)
+}
+
+// QIFSplits converts the split lines of a QIF transaction into transaction splits. Categories from
+// the exporting app are mapped to the closest allowed category, keeping the original in the note.
+func QIFSplits(splits []qif.Split) ([]types.Split, error) {
+	var result []types.Split
+	for _, s := range splits {
+		amount, err := QIFAmount(s.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("invalid split amount %q: %w", s.Amount, err)
+		}
+		split := types.Split{Amount: amount.Amount, Category: qifCategory(s.Category), Note: s.Memo}
+		if original := strings.TrimSpace(s.Category); original != "" && original != split.Category {
+			split.Note = strings.TrimSuffix(original+": "+s.Memo, ": ")
+		}
+		result = append(result, split)
+	}
+	return result, nil
+}
+
+// qifCategory maps a category from a QIF export, such as "Food:Groceries" or "Bank Charges", to
+// the closest allowed category. Each level of the category is tried from the most specific, first
+// by name and then by a word in common, and anything unmatched is Other.
+func qifCategory(category string) string {
+	levels := strings.Split(category, ":")
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, c := range types.AllowedCategories {
+			if strings.EqualFold(strings.TrimSpace(levels[i]), c.Name) {
+				return c.Name
+			}
+		}
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		for _, c := range types.AllowedCategories {
+			if sharesWord(levels[i], c.Name) {
+				return c.Name
+			}
+		}
+	}
+	return "Other"
+}
+
+// sharesWord reports whether a and b have a word in common, counting "transport" and
+// "transportation" as the same word
+func sharesWord(a, b string) bool {
+	for _, x := range strings.Fields(strings.ToLower(a)) {
+		for _, y := range strings.Fields(strings.ToLower(b)) {
+			if len(x) < 4 || len(y) < 4 {
+				continue
+			}
+			if strings.HasPrefix(x, y) || strings.HasPrefix(y, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package commands
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/agent"
+)
+
+// AgentConfig contains common flag definitions for how commands call the LLM
+type AgentConfig struct {
+	// OutputMode is how structured output is requested from the model
+	OutputMode string `help:"How to get structured output from the model (auto detects per model)" default:"auto" enum:"auto,tools,json_schema,json" env:"OUTPUT_MODE"`
+	// ModelOutputModes overrides the output mode for specific models
+	ModelOutputModes map[string]string `help:"Output mode overrides per model (e.g. qwen3:8b=json)" env:"MODEL_OUTPUT_MODES"`
+	// FallbackModels are tried in order when the primary model keeps failing
+	FallbackModels []string `help:"Models to try, in order, when the primary model keeps failing" sep:"," env:"OPENROUTER_FALLBACK_MODELS"`
+	// RateLimit is the maximum number of LLM requests per second
+	RateLimit float64 `help:"Maximum LLM requests per second across all workers (0 = unlimited)" default:"5" env:"RATE_LIMIT"`
+	// RateBurst is the number of requests allowed in a burst above the rate limit
+	RateBurst int `help:"Number of LLM requests allowed in a burst above the rate limit" default:"5"`
+	// MaxRetries is the number of retries per model for failed requests
+	MaxRetries int `help:"Retries per model for rate limited or failed LLM requests" default:"3"`
+	// MaxBackoff is the maximum delay between retries
+	MaxBackoff time.Duration `help:"Maximum delay between retries, unless the server asks for longer with Retry-After" default:"30s"`
+}
+
+// AgentOptions returns the agent options for the configured output modes and resilience settings
+func (c AgentConfig) AgentOptions() ([]agent.Option, error) {
+	mode, err := agent.ParseOutputMode(c.OutputMode)
+	if err != nil {
+		return nil, err
+	}
+	if c.MaxBackoff <= 0 {
+		return nil, fmt.Errorf("max backoff must be positive, got %s", c.MaxBackoff)
+	}
+	opts := []agent.Option{
+		agent.WithOutputMode(mode),
+		agent.WithFallbackModels(c.FallbackModels...),
+		agent.WithRateLimit(c.RateLimit, c.RateBurst),
+		agent.WithRetries(c.MaxRetries),
+		agent.WithBackoff(time.Second, c.MaxBackoff),
+	}
+	for model, m := range c.ModelOutputModes {
+		mode, err := agent.ParseOutputMode(m)
+		if err != nil {
+			return nil, fmt.Errorf("model %s: %w", model, err)
+		}
+		opts = append(opts, agent.WithModelOutputMode(model, mode))
+	}
+	return opts, nil
+}
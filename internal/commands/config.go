@@ -34,6 +34,8 @@ type CommonConfig struct {
 	DataDir string `help:"Path to data directory" default:"./data"`
 	// Timezone is the timezone to use for transaction dates
 	Timezone string `help:"Timezone to use for transaction dates" required:"" default:"Australia/Melbourne"`
+	// BaseCurrency is the currency aggregates and reports are converted to
+	BaseCurrency string `help:"Currency to convert totals to, using loaded exchange rates" default:"AUD" env:"BASE_CURRENCY"`
 	// LogLevel is the logging level to use
 	LogLevel string `help:"Log level (debug, info, warn, error)" default:"warn" enum:"debug,info,warn,error"`
 }
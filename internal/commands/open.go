@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+// OpenFile opens a file in the system's default application for its type, without waiting
+// for the application to exit
+func OpenFile(path string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", path)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", path)
+	default:
+		cmd = exec.Command("xdg-open", path)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return cmd.Process.Release()
+}
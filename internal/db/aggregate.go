@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Fields transactions can be grouped by in Aggregate
+const (
+	GroupByCategory = "category"
+	GroupByMerchant = "merchant"
+	GroupByType     = "type"
+	GroupByBank     = "bank"
+	GroupByAccount  = "account"
+	GroupByDay      = "day"
+	GroupByWeek     = "week"
+	GroupByMonth    = "month"
+	GroupByQuarter  = "quarter"
+	GroupByYear     = "year"
+	GroupByCountry  = "country"
+	GroupByState    = "state"
+	GroupByLocality = "locality"
+	GroupByTag      = "tag"
+)
+
+// GroupBys lists every group Aggregate supports
+var GroupBys = []string{
+	GroupByCategory, GroupByMerchant, GroupByType, GroupByBank, GroupByAccount,
+	GroupByDay, GroupByWeek, GroupByMonth, GroupByQuarter, GroupByYear,
+	GroupByCountry, GroupByState, GroupByLocality, GroupByTag,
+}
+
+// periodGroups are the groups over dates, which are ordered chronologically
+var periodGroups = map[string]bool{
+	GroupByDay: true, GroupByWeek: true, GroupByMonth: true, GroupByQuarter: true, GroupByYear: true,
+}
+
+// IsPeriodGroup reports whether groupBy groups over dates
+func IsPeriodGroup(groupBy string) bool {
+	return periodGroups[groupBy]
+}
+
+// refundedCategory is the category of the purchase a refund reverses, so refunds net against
+// the original category rather than wherever the refund was classified
+const refundedCategory = `(SELECT p.details_category FROM transaction_links l JOIN transactions p ON p.id = l.linked_id
+	WHERE l.kind = 'refund' AND l.source != 'rejected' AND l.transaction_id = t.id)`
+
+// groupByColumns maps each group to the SQL expression it groups on
+var groupByColumns = map[string]string{
+	GroupByCategory: "COALESCE(s.category, " + refundedCategory + ", t.details_category, '')",
+	GroupByMerchant: canonicalMerchant,
+	GroupByType:     "t.type",
+	GroupByBank:     "t.bank",
+	GroupByAccount:  accountColumn,
+	// Dates are stored with the timezone's offset, which date() would convert to UTC, so days and
+	// weeks are taken from the local date like months and years
+	GroupByDay: "substr(t.date, 1, 10)",
+	// Weeks start on Monday and are keyed by their first day
+	GroupByWeek:    "date(substr(t.date, 1, 10), 'weekday 0', '-6 days')",
+	GroupByMonth:   "substr(t.date, 1, 7)",
+	GroupByQuarter: "substr(t.date, 1, 4) || '-Q' || ((CAST(substr(t.date, 6, 2) AS INTEGER) + 2) / 3)",
+	GroupByYear:    "substr(t.date, 1, 4)",
+	GroupByCountry: "COALESCE(t.country, '')",
+	// States are qualified by their country as in ISO 3166-2, since WA is in Australia and the US
+	GroupByState:    "COALESCE(t.country || '-' || t.state, '')",
+	GroupByLocality: "COALESCE(t.locality || COALESCE(' ' || t.state, '') || ', ' || t.country, '')",
+	GroupByTag:      "COALESCE(tg.name, '')",
+}
+
+// amountColumn is the amount counted towards a group, the split's amount for split transactions
+const amountColumn = "COALESCE(s.amount_minor, t.amount_minor)"
+
+// AggregateRow summarises the transactions in one group. Debits and Credits split the total
+// into money out, as a negative amount, and money in.
+type AggregateRow struct {
+	Key     string          `json:"key"`
+	Count   int             `json:"count"`
+	Total   decimal.Decimal `json:"total"`
+	Average decimal.Decimal `json:"average"`
+	Min     decimal.Decimal `json:"min"`
+	Max     decimal.Decimal `json:"max"`
+	Debits  decimal.Decimal `json:"debits"`
+	Credits decimal.Decimal `json:"credits"`
+}
+
+// Aggregate totals the transactions matching the filters, grouped by groupBy. Split transactions
+// count each split towards its own category, and the minimum and maximum are of the amounts
+// counted, so of splits rather than whole transactions. Periods are ordered chronologically,
+// other groups by the size of their total. Grouped by tag, a transaction counts towards each
+// of its tags. Amounts are converted to the base currency at the rate on each transaction's date,
+// and it's an error if a rate hasn't been loaded.
+func (d *DB) Aggregate(ctx context.Context, groupBy string, options ...TransactionQueryOption) ([]AggregateRow, error) {
+	column, ok := groupByColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown group by %q", groupBy)
+	}
+
+	opts := TransactionQueryOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	query := `SELECT ` + column + ` AS key, t.id AS id, t.currency AS currency, substr(t.date, 1, 10) AS day,
+			` + d.baseAmountSQL(amountColumn) + ` AS amount
+		FROM transactions t
+		LEFT JOIN transaction_splits s ON s.transaction_id = t.id`
+	if groupBy == GroupByTag {
+		query += `
+		LEFT JOIN transaction_tags tt ON tt.transaction_id = t.id
+		LEFT JOIN tags tg ON tg.id = tt.tag_id`
+	}
+	where, params := BuildTransactionWhereClause(opts, false)
+	// Only the splits in the category count towards it, not the whole transaction
+	if opts.Category != "" {
+		where = append(where, "(s.transaction_id IS NULL OR s.category = ?)")
+		params = append(params, opts.Category)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// Amounts without a rate are NULL, and the first of them is kept to explain the error
+	query = `SELECT key, COUNT(DISTINCT id), SUM(amount) AS total, MIN(amount), MAX(amount),
+			SUM(MIN(amount, 0)), SUM(MAX(amount, 0)),
+			MIN(CASE WHEN amount IS NULL THEN currency || ' ' || day END)
+		FROM (` + query + `) GROUP BY key`
+	if periodGroups[groupBy] {
+		query += " ORDER BY key ASC"
+	} else {
+		query += " ORDER BY ABS(total) DESC, key ASC"
+	}
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+	}
+
+	d.logger.Debug("Executing aggregate query", "query", query, "params", params)
+	rows, err := d.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var results []AggregateRow
+	for rows.Next() {
+		var row AggregateRow
+		var total, minimum, maximum, debits, credits sql.NullInt64
+		var missing sql.NullString
+		if err := rows.Scan(&row.Key, &row.Count, &total, &minimum, &maximum, &debits, &credits, &missing); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate row: %w", err)
+		}
+		if missing.Valid {
+			currency, day, _ := strings.Cut(missing.String, " ")
+			return nil, missingRateError(currency, d.baseCurrency, day)
+		}
+		row.Total = d.fromBaseMinorUnits(total.Int64)
+		row.Min = d.fromBaseMinorUnits(minimum.Int64)
+		row.Max = d.fromBaseMinorUnits(maximum.Int64)
+		row.Debits = d.fromBaseMinorUnits(debits.Int64)
+		row.Credits = d.fromBaseMinorUnits(credits.Int64)
+		if row.Count > 0 {
+			row.Average = row.Total.Div(decimal.NewFromInt(int64(row.Count))).Round(types.MinorUnitDigits(d.baseCurrency))
+		}
+		results = append(results, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating aggregate rows: %w", err)
+	}
+
+	return results, nil
+}
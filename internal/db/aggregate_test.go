@@ -0,0 +1,229 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestAggregate(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	transactions := []struct {
+		date     string
+		amount   string
+		merchant string
+		category string
+	}{
+		{"03/01/2024", "-12.50", "Cafe", "Food & Dining"},
+		{"17/01/2024", "-7.50", "Cafe", "Food & Dining"},
+		{"20/01/2024", "-80.25", "Woolworths", "Groceries"},
+		{"05/02/2024", "-100.00", "Woolworths", "Groceries"},
+		{"10/03/2024", "-30.00", "Cafe", "Food & Dining"},
+	}
+	for _, tx := range transactions {
+		transaction := types.Transaction{Date: tx.date, Amount: money(tx.amount), Payee: tx.merchant + " " + tx.date, Bank: "ing"}
+		details := &types.TransactionDetails{
+			Type:       "purchase",
+			Merchant:   tx.merchant,
+			Category:   tx.category,
+			SearchBody: tx.merchant,
+		}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)
+
+	rows, err := db.Aggregate(ctx, GroupByCategory, FilterByDateRange(from, to))
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 categories, got %d", len(rows))
+	}
+	if rows[0].Key != "Groceries" || rows[0].Count != 2 || rows[0].Total.StringFixed(2) != "-180.25" {
+		t.Errorf("unexpected first row: %+v", rows[0])
+	}
+	if rows[1].Key != "Food & Dining" || rows[1].Count != 2 || rows[1].Total.StringFixed(2) != "-20.00" {
+		t.Errorf("unexpected second row: %+v", rows[1])
+	}
+
+	rows, err = db.Aggregate(ctx, GroupByMonth, FilterByMerchant("cafe"))
+	if err != nil {
+		t.Fatalf("failed to aggregate by month: %v", err)
+	}
+	var months []string
+	for _, r := range rows {
+		months = append(months, r.Key)
+	}
+	if len(months) != 2 || months[0] != "2024-01" || months[1] != "2024-03" {
+		t.Errorf("expected cafe spending in 2024-01 and 2024-03, got %v", months)
+	}
+
+	if _, err := db.Aggregate(ctx, "payee"); err == nil {
+		t.Error("expected an error for an unknown group by")
+	}
+}
+
+func TestAggregatePeriodsAndStatistics(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	transactions := []struct {
+		date    string
+		amount  string
+		payee   string
+		txType  string
+		account string
+	}{
+		{"01/01/2024", "-10.00", "Cafe", "purchase", ""},
+		{"07/01/2024", "-30.00", "Cafe", "purchase", ""},
+		{"08/01/2024", "-50.00", "Cafe", "purchase", "Joint"},
+		{"31/03/2024", "2000.00", "Salary", "deposit", ""},
+		{"01/04/2024", "-20.00", "Cafe", "purchase", "Joint"},
+		{"15/02/2025", "-5.00", "Cafe", "purchase", ""},
+	}
+	for _, tx := range transactions {
+		transaction := types.Transaction{Date: tx.date, Amount: money(tx.amount), Payee: tx.payee + " " + tx.date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: tx.txType, Merchant: tx.payee, Category: "Other", SearchBody: tx.payee}
+		if tx.account != "" {
+			transaction.Bank = "amex"
+			details.CardNumber = "376000000001005"
+		}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+	joint := "Joint"
+	if err := db.UpdateCard(ctx, "1005", nil, &joint, nil); err != nil {
+		t.Fatalf("failed to update card: %v", err)
+	}
+
+	keys := func(groupBy string) []string {
+		rows, err := db.Aggregate(ctx, groupBy)
+		if err != nil {
+			t.Fatalf("failed to aggregate by %s: %v", groupBy, err)
+		}
+		var keys []string
+		for _, r := range rows {
+			keys = append(keys, fmt.Sprintf("%s=%s", r.Key, r.Total.StringFixed(2)))
+		}
+		return keys
+	}
+	expected := map[string]string{
+		GroupByDay:     "2024-01-01=-10.00 2024-01-07=-30.00 2024-01-08=-50.00 2024-03-31=2000.00 2024-04-01=-20.00 2025-02-15=-5.00",
+		GroupByWeek:    "2024-01-01=-40.00 2024-01-08=-50.00 2024-03-25=2000.00 2024-04-01=-20.00 2025-02-10=-5.00",
+		GroupByQuarter: "2024-Q1=1910.00 2024-Q2=-20.00 2025-Q1=-5.00",
+		GroupByYear:    "2024=1890.00 2025=-5.00",
+		GroupByAccount: "ing=1955.00 Joint=-70.00",
+	}
+	for groupBy, want := range expected {
+		if got := strings.Join(keys(groupBy), " "); got != want {
+			t.Errorf("grouped by %s: expected %s, got %s", groupBy, want, got)
+		}
+	}
+
+	rows, err := db.Aggregate(ctx, GroupByYear, FilterByDateRange(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 12, 31, 0, 0, 0, 0, time.UTC)))
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("expected 1 year, got %d", len(rows))
+	}
+	r := rows[0]
+	if r.Count != 5 || r.Total.StringFixed(2) != "1890.00" || r.Average.StringFixed(2) != "378.00" ||
+		r.Min.StringFixed(2) != "-50.00" || r.Max.StringFixed(2) != "2000.00" ||
+		r.Debits.StringFixed(2) != "-110.00" || r.Credits.StringFixed(2) != "2000.00" {
+		t.Errorf("unexpected statistics: %+v", r)
+	}
+}
+
+func TestAggregateTotalsAreExact(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// Ten cents at a time adds up to floating point error, unless amounts are whole cents
+	for i := 0; i < 100; i++ {
+		transaction := types.Transaction{Date: "01/03/2024", Amount: money("0.10"), Payee: fmt.Sprintf("Interest %d", i), Bank: "ing"}
+		details := &types.TransactionDetails{Type: "interest", Merchant: "ING", Category: "Other", SearchBody: "interest"}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+	transaction := types.Transaction{Date: "02/03/2024", Amount: money("-1,234.57"), Payee: "Rent", Bank: "ing"}
+	details := &types.TransactionDetails{Type: "transfer", Merchant: "Landlord", Category: "Other", SearchBody: "rent"}
+	if err := db.Store(ctx, transaction, details); err != nil {
+		t.Fatalf("failed to store transaction: %v", err)
+	}
+
+	rows, err := db.Aggregate(ctx, GroupByCategory)
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Total.String() != "-1224.57" || rows[0].Credits.String() != "10" || rows[0].Debits.String() != "-1234.57" {
+		t.Errorf("expected exact totals, got %+v", rows)
+	}
+
+	stored, err := db.GetTransactionByID(ctx, GenerateTransactionID(transaction))
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if stored.Amount.String() != "-1234.57" || stored.Amount.Currency != types.DefaultCurrency {
+		t.Errorf("expected -1234.57 %s, got %s %s", types.DefaultCurrency, stored.Amount, stored.Amount.Currency)
+	}
+}
+
+func TestAggregateDaysInLocalTime(t *testing.T) {
+	loc, err := time.LoadLocation("Australia/Melbourne")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	db, err := New(t.TempDir(), log.New(io.Discard), loc)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	// A Friday and the Monday after it, both ahead of UTC in Melbourne
+	for _, date := range []string{"01/03/2024", "04/03/2024"} {
+		transaction := types.Transaction{Date: date, Amount: money("-10.00"), Payee: "Cafe " + date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: "Cafe", Category: "Food & Dining", SearchBody: "cafe"}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	expected := map[string]string{
+		GroupByDay:  "2024-03-01 2024-03-04",
+		GroupByWeek: "2024-02-26 2024-03-04",
+	}
+	for groupBy, want := range expected {
+		rows, err := db.Aggregate(ctx, groupBy)
+		if err != nil {
+			t.Fatalf("failed to aggregate by %s: %v", groupBy, err)
+		}
+		var keys []string
+		for _, r := range rows {
+			keys = append(keys, r.Key)
+		}
+		if got := strings.Join(keys, " "); got != want {
+			t.Errorf("grouped by %s: expected %s, got %s", groupBy, want, got)
+		}
+	}
+}
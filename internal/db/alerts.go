@@ -0,0 +1,371 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Alert kinds
+const (
+	AlertDuplicate     = "duplicate"
+	AlertUnusualAmount = "unusual_amount"
+	AlertNewMerchant   = "new_merchant"
+	AlertForeign       = "foreign"
+	AlertNewFee        = "new_fee"
+)
+
+// Alert sensitivities, from the fewest alerts to the most
+const (
+	AlertSensitivityLow    = "low"
+	AlertSensitivityMedium = "medium"
+	AlertSensitivityHigh   = "high"
+)
+
+// Alert is something unusual about a newly imported transaction
+type Alert struct {
+	ID            int64  `json:"id"`
+	TransactionID string `json:"transaction_id"`
+	Kind          string `json:"kind"`
+	Message       string `json:"message"`
+	// RelatedID is the earlier transaction a duplicate repeats
+	RelatedID string    `json:"related_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Dismissed bool      `json:"dismissed,omitempty"`
+	// Transaction is the transaction alerted on, populated from storage
+	Transaction *types.TransactionWithDetails `json:"transaction,omitempty"`
+}
+
+// AlertConfig sets how unusual a transaction must be to alert on
+type AlertConfig struct {
+	// DuplicateWindow is how many days apart the same amount can be charged at a merchant to
+	// look like a duplicate
+	DuplicateWindow int
+	// UnusualFactor is how many times a merchant's median charge an amount must be to be
+	// unusual, once there are at least MinHistory earlier charges to compare with
+	UnusualFactor decimal.Decimal
+	MinHistory    int
+	// UnusualMinDifference keeps small amounts from being unusual, like a $12 order at a $4 cafe
+	UnusualMinDifference decimal.Decimal
+	// NewMerchantThreshold is the smallest first-ever charge at a merchant to alert on
+	NewMerchantThreshold decimal.Decimal
+	// HomeCountry is the country you live in, as a name or ISO code. Spending resolved to
+	// anywhere else is foreign, and it's left unchecked when empty.
+	HomeCountry string
+	// TravelWindow is how many days either side of foreign spending other spending away from
+	// home shows you're travelling
+	TravelWindow int
+}
+
+// AlertConfigFor returns the alert settings for a sensitivity
+func AlertConfigFor(sensitivity, homeCountry string) (AlertConfig, error) {
+	switch sensitivity {
+	case AlertSensitivityLow:
+		return AlertConfig{
+			DuplicateWindow:      1,
+			UnusualFactor:        decimal.NewFromInt(5),
+			MinHistory:           5,
+			UnusualMinDifference: decimal.NewFromInt(100),
+			NewMerchantThreshold: decimal.NewFromInt(1000),
+			HomeCountry:          homeCountry,
+			TravelWindow:         7,
+		}, nil
+	case AlertSensitivityMedium:
+		return AlertConfig{
+			DuplicateWindow:      3,
+			UnusualFactor:        decimal.NewFromInt(3),
+			MinHistory:           3,
+			UnusualMinDifference: decimal.NewFromInt(50),
+			NewMerchantThreshold: decimal.NewFromInt(500),
+			HomeCountry:          homeCountry,
+			TravelWindow:         3,
+		}, nil
+	case AlertSensitivityHigh:
+		return AlertConfig{
+			DuplicateWindow:      7,
+			UnusualFactor:        decimal.NewFromInt(2),
+			MinHistory:           2,
+			UnusualMinDifference: decimal.NewFromInt(20),
+			NewMerchantThreshold: decimal.NewFromInt(100),
+			HomeCountry:          homeCountry,
+			TravelWindow:         1,
+		}, nil
+	default:
+		return AlertConfig{}, fmt.Errorf("alert sensitivity must be %s, %s or %s, got %q",
+			AlertSensitivityLow, AlertSensitivityMedium, AlertSensitivityHigh, sensitivity)
+	}
+}
+
+// alertCandidate is a transaction considered by the anomaly detectors
+type alertCandidate struct {
+	t        types.TransactionWithDetails
+	date     time.Time
+	amount   decimal.Decimal
+	merchant string
+	away     bool
+	isNew    bool
+}
+
+// merchantKey identifies a transaction's merchant, by its canonical merchant when it resolved to one
+func merchantKey(t types.TransactionWithDetails) string {
+	if t.Details.MerchantID != 0 {
+		return fmt.Sprintf("#%d", t.Details.MerchantID)
+	}
+	return NormalizeMerchant(t.Details.Merchant)
+}
+
+// feeKey identifies the kind of fee a bank charged from its payee text, ignoring anything
+// with digits in it such as dates, amounts and references
+func feeKey(t types.TransactionWithDetails) string {
+	var kept []string
+	for _, w := range strings.Fields(strings.ToLower(t.Payee)) {
+		if strings.IndexFunc(w, unicode.IsDigit) == -1 {
+			kept = append(kept, w)
+		}
+	}
+	return t.Bank + ":" + strings.Join(kept, " ")
+}
+
+// DetectAnomalies checks the transactions in newIDs against the rest for duplicate charges, amounts
+// far above a merchant's usual ones, large first charges at a merchant, foreign spending with
+// nothing else away from home around it, and fees that haven't been charged before. First
+// charges and fees are only alerted on once there's earlier history to compare with, so a
+// first import doesn't flag everything. Transfers between your own accounts are skipped.
+func DetectAnomalies(transactions []types.TransactionWithDetails, newIDs []string, location *time.Location, config AlertConfig) []Alert {
+	isNew := make(map[string]bool, len(newIDs))
+	for _, id := range newIDs {
+		isNew[id] = true
+	}
+	home := countryCode(config.HomeCountry)
+
+	var candidates []alertCandidate
+	for _, t := range transactions {
+		date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+		if err != nil {
+			continue
+		}
+		amount := t.Amount.Amount
+		candidates = append(candidates, alertCandidate{
+			t:        t,
+			date:     date,
+			amount:   amount,
+			merchant: merchantKey(t),
+			away:     home != "" && t.Details.Place.Country != "" && countryCode(t.Details.Place.Country) != home,
+			isNew:    isNew[t.ID],
+		})
+	}
+	// Oldest first, so each transaction is compared with the ones before it
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if !candidates[i].date.Equal(candidates[j].date) {
+			return candidates[i].date.Before(candidates[j].date)
+		}
+		return candidates[i].t.ID < candidates[j].t.ID
+	})
+
+	var alerts []Alert
+	for i, c := range candidates {
+		if !c.isNew || !c.amount.IsNegative() || c.t.Details.TransferMatchID != "" {
+			continue
+		}
+		earlier := candidates[:i]
+		add := func(kind, related, message string, args ...any) {
+			alerts = append(alerts, Alert{TransactionID: c.t.ID, Kind: kind, RelatedID: related, Message: fmt.Sprintf(message, args...)})
+		}
+		amount := c.amount.Abs()
+		merchant := c.t.Details.Merchant
+
+		var history bool
+		for _, e := range earlier {
+			if !e.isNew {
+				history = true
+				break
+			}
+		}
+
+		if c.merchant != "" && c.t.Details.Type != "transfer" {
+			for j := len(earlier) - 1; j >= 0; j-- {
+				e := earlier[j]
+				if c.date.Sub(e.date).Hours()/24 > float64(config.DuplicateWindow) {
+					break
+				}
+				if e.merchant == c.merchant && e.amount.Equal(c.amount) && e.t.Details.TransferMatchID == "" {
+					add(AlertDuplicate, e.t.ID, "%s charged %s again, the same as on %s", merchant, amount.StringFixed(2), e.t.Date)
+					break
+				}
+			}
+		}
+
+		var charges []decimal.Decimal
+		seen := false
+		for _, e := range earlier {
+			if c.merchant != "" && e.merchant == c.merchant {
+				seen = true
+				if e.amount.IsNegative() {
+					charges = append(charges, e.amount.Abs())
+				}
+			}
+		}
+		if c.merchant != "" && len(charges) >= config.MinHistory && len(charges) > 0 {
+			usual := median(charges)
+			if amount.GreaterThan(usual.Mul(config.UnusualFactor)) && amount.Sub(usual).GreaterThanOrEqual(config.UnusualMinDifference) {
+				add(AlertUnusualAmount, "", "%s charged %s, %s times the usual %s", merchant, amount.StringFixed(2), amount.Div(usual).StringFixed(1), usual.StringFixed(2))
+			}
+		}
+		if c.merchant != "" && history && !seen && !nonPurchaseTypes[c.t.Details.Type] && amount.GreaterThanOrEqual(config.NewMerchantThreshold) {
+			add(AlertNewMerchant, "", "First charge at %s, for %s", merchant, amount.StringFixed(2))
+		}
+
+		if c.away {
+			travelling := false
+			for _, o := range candidates {
+				if o.t.ID != c.t.ID && o.away && o.date.Sub(c.date).Abs().Hours()/24 <= float64(config.TravelWindow) {
+					travelling = true
+					break
+				}
+			}
+			if !travelling {
+				add(AlertForeign, "", "%s charged %s in %s, with no other spending away from home around then", merchant, amount.StringFixed(2), gazetteer.CountryName(countryCode(c.t.Details.Place.Country)))
+			}
+		}
+
+		if c.t.Details.Type == "fee" && history {
+			key := feeKey(c.t)
+			charged := false
+			for _, e := range earlier {
+				if e.t.Details.Type == "fee" && feeKey(e.t) == key {
+					charged = true
+					break
+				}
+			}
+			if !charged {
+				add(AlertNewFee, "", "%s charged a fee of %s that it hasn't charged before: %s", c.t.Bank, amount.StringFixed(2), c.t.Payee)
+			}
+		}
+	}
+	return alerts
+}
+
+// median returns the middle amount, or the mean of the two middle amounts
+func median(amounts []decimal.Decimal) decimal.Decimal {
+	sorted := append([]decimal.Decimal(nil), amounts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].LessThan(sorted[j]) })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return sorted[mid-1].Add(sorted[mid]).Div(decimal.NewFromInt(2))
+	}
+	return sorted[mid]
+}
+
+// DetectAlerts checks newly stored transactions for anomalies against everything stored, and
+// stores an alert for each one found. Alerts already stored, including dismissed ones, are
+// kept as they are. It returns the alerts for the transactions.
+func (d *DB) DetectAlerts(ctx context.Context, ids []string, config AlertConfig) ([]Alert, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	transactions, err := d.GetTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	alerts := DetectAnomalies(transactions, ids, d.timezone, config)
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, a := range alerts {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO alerts (transaction_id, kind, message, related_id) VALUES (?, ?, ?, ?)
+		`, a.TransactionID, a.Kind, a.Message, nullIfEmpty(a.RelatedID)); err != nil {
+			return nil, fmt.Errorf("failed to store alert: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit alerts: %w", err)
+	}
+
+	d.logger.Info("Detected alerts", "count", len(alerts))
+	return d.GetTransactionAlerts(ctx, ids)
+}
+
+// GetTransactionAlerts returns the alerts for the given transactions, dismissed ones included
+func (d *DB) GetTransactionAlerts(ctx context.Context, ids []string) ([]Alert, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return d.queryAlerts(ctx, "a.transaction_id IN ("+placeholders(len(ids))+")", stringParams(ids)...)
+}
+
+// GetAlerts returns alerts for the most recent transactions first, leaving out dismissed ones
+// unless includeDismissed is set
+func (d *DB) GetAlerts(ctx context.Context, includeDismissed bool) ([]Alert, error) {
+	if includeDismissed {
+		return d.queryAlerts(ctx, "1 = 1")
+	}
+	return d.queryAlerts(ctx, "a.dismissed_at IS NULL")
+}
+
+// DismissAlert marks an alert as dealt with, hiding it from the alerts shown by default
+func (d *DB) DismissAlert(ctx context.Context, id int64) error {
+	result, err := d.db.ExecContext(ctx, `UPDATE alerts SET dismissed_at = CURRENT_TIMESTAMP WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to dismiss alert: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("alert %d not found", id)
+	}
+	return nil
+}
+
+// queryAlerts returns the alerts matching a condition on the alerts table, with their transactions
+func (d *DB) queryAlerts(ctx context.Context, where string, params ...any) ([]Alert, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT a.id, a.transaction_id, a.kind, a.message, COALESCE(a.related_id, ''), a.created_at, a.dismissed_at IS NOT NULL
+		FROM alerts a
+		LEFT JOIN transactions t ON t.id = a.transaction_id
+		WHERE `+where+`
+		ORDER BY t.date DESC, a.id DESC
+	`, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []Alert
+	var ids []string
+	for rows.Next() {
+		var a Alert
+		if err := rows.Scan(&a.ID, &a.TransactionID, &a.Kind, &a.Message, &a.RelatedID, &a.CreatedAt, &a.Dismissed); err != nil {
+			return nil, fmt.Errorf("failed to scan alert: %w", err)
+		}
+		alerts = append(alerts, a)
+		ids = append(ids, a.TransactionID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating alerts: %w", err)
+	}
+	if len(alerts) == 0 {
+		return nil, nil
+	}
+
+	transactions, err := d.GetTransactions(ctx, FilterByIDs(ids...))
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]*types.TransactionWithDetails, len(transactions))
+	for i := range transactions {
+		byID[transactions[i].ID] = &transactions[i]
+	}
+	for i := range alerts {
+		alerts[i].Transaction = byID[alerts[i].TransactionID]
+	}
+	return alerts, nil
+}
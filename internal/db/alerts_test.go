@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	transactions := []types.TransactionWithDetails{
+		// History from earlier imports
+		testTransaction("cafe-1", "01/03/2024", "-5.00", "purchase", "Cafe", inCountry("AU")),
+		testTransaction("cafe-2", "08/03/2024", "-6.00", "purchase", "Cafe", inCountry("AU")),
+		testTransaction("cafe-3", "15/03/2024", "-5.50", "purchase", "Cafe", inCountry("AU")),
+		testTransaction("power-1", "01/03/2024", "-150.00", "purchase", "AGL", inCountry("AU")),
+		testTransaction("power-2", "01/04/2024", "-160.00", "purchase", "AGL", inCountry("AU")),
+		testTransaction("power-3", "01/05/2024", "-155.00", "purchase", "AGL", inCountry("AU")),
+		testTransaction("atm-fee-1", "20/03/2024", "-3.00", "fee", "ING"),
+		testTransaction("bali-1", "10/04/2024", "-40.00", "purchase", "Warung", inCountry("ID")),
+		// Newly imported
+		testTransaction("netflix", "02/06/2024", "-22.99", "purchase", "Netflix"),
+		testTransaction("netflix-again", "03/06/2024", "-22.99", "purchase", "Netflix"),
+		testTransaction("cafe-4", "04/06/2024", "-12.00", "purchase", "Cafe", inCountry("AU")),
+		testTransaction("power-4", "01/06/2024", "-720.00", "purchase", "AGL", inCountry("AU")),
+		testTransaction("tv", "05/06/2024", "-1999.00", "purchase", "JB Hi-Fi", inCountry("AU")),
+		testTransaction("london", "06/06/2024", "-85.00", "purchase", "Harrods", inCountry("GB")),
+		testTransaction("bali-2", "11/04/2024", "-30.00", "purchase", "Beach Club", inCountry("ID")),
+		testTransaction("fx-fee", "07/06/2024", "-2.50", "fee", "ING"),
+		testTransaction("atm-fee-2", "08/06/2024", "-3.00", "fee", "ING"),
+		testTransaction("salary", "09/06/2024", "5000.00", "deposit", "Employer"),
+	}
+	transactions[15].Payee = "INTERNATIONAL TRANSACTION FEE"
+	transactions[6].Payee = "ATM FEE 20/03"
+	transactions[16].Payee = "ATM FEE 08/06"
+
+	config, err := AlertConfigFor(AlertSensitivityMedium, "Australia")
+	if err != nil {
+		t.Fatalf("failed to get alert config: %v", err)
+	}
+	newIDs := []string{"netflix", "netflix-again", "cafe-4", "power-4", "tv", "london", "bali-2", "fx-fee", "atm-fee-2", "salary"}
+	alerts := DetectAnomalies(transactions, newIDs, time.UTC, config)
+
+	got := make(map[string]string)
+	for _, a := range alerts {
+		if kind, ok := got[a.TransactionID]; ok {
+			t.Errorf("expected one alert for %s, got %s and %s", a.TransactionID, kind, a.Kind)
+		}
+		got[a.TransactionID] = a.Kind
+	}
+	// The cafe charge is more than usual but not three times as much, Netflix is below the new
+	// merchant threshold, and the Bali spending is alongside other spending there
+	want := map[string]string{
+		"netflix-again": AlertDuplicate,
+		"power-4":       AlertUnusualAmount,
+		"tv":            AlertNewMerchant,
+		"london":        AlertForeign,
+		"fx-fee":        AlertNewFee,
+	}
+	if len(got) != len(want) {
+		t.Errorf("expected %d alerts, got %d: %+v", len(want), len(got), alerts)
+	}
+	for id, kind := range want {
+		if got[id] != kind {
+			t.Errorf("expected a %s alert for %s, got %q", kind, id, got[id])
+		}
+	}
+	for _, a := range alerts {
+		if a.Kind == AlertDuplicate && a.RelatedID != "netflix" {
+			t.Errorf("expected the duplicate to relate to the first charge, got %q", a.RelatedID)
+		}
+	}
+
+	// Without earlier history, a first import only alerts on what it can compare within itself
+	var firstImport []string
+	for _, tx := range transactions {
+		firstImport = append(firstImport, tx.ID)
+	}
+	for _, a := range DetectAnomalies(transactions, firstImport, time.UTC, config) {
+		if a.Kind == AlertNewMerchant || a.Kind == AlertNewFee {
+			t.Errorf("expected no %s alerts on a first import, got one for %s", a.Kind, a.TransactionID)
+		}
+	}
+
+	if _, err := AlertConfigFor("extreme", ""); err == nil {
+		t.Error("expected an error for an unknown sensitivity")
+	}
+}
+
+func TestDetectAlerts(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	store := func(date, amount, merchant string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant + " " + date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Category: "Shopping", SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	store("01/05/2024", "-20.00", "Kmart")
+	first := store("01/06/2024", "-49.95", "Amazon")
+	second := store("02/06/2024", "-49.95", "Amazon")
+
+	config, err := AlertConfigFor(AlertSensitivityMedium, "AU")
+	if err != nil {
+		t.Fatalf("failed to get alert config: %v", err)
+	}
+	alerts, err := db.DetectAlerts(ctx, []string{first, second}, config)
+	if err != nil {
+		t.Fatalf("failed to detect alerts: %v", err)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != AlertDuplicate || alerts[0].TransactionID != second {
+		t.Fatalf("expected a duplicate alert for the second charge, got %+v", alerts)
+	}
+	if alerts[0].Transaction == nil || alerts[0].Transaction.Details.Merchant != "Amazon" {
+		t.Errorf("expected the alert to include its transaction, got %+v", alerts[0].Transaction)
+	}
+
+	if err := db.DismissAlert(ctx, alerts[0].ID); err != nil {
+		t.Fatalf("failed to dismiss alert: %v", err)
+	}
+	// Detecting again keeps the dismissed alert rather than raising it again
+	if _, err := db.DetectAlerts(ctx, []string{second}, config); err != nil {
+		t.Fatalf("failed to detect alerts: %v", err)
+	}
+	active, err := db.GetAlerts(ctx, false)
+	if err != nil {
+		t.Fatalf("failed to get alerts: %v", err)
+	}
+	if len(active) != 0 {
+		t.Errorf("expected no active alerts, got %+v", active)
+	}
+	all, err := db.GetAlerts(ctx, true)
+	if err != nil {
+		t.Fatalf("failed to get alerts: %v", err)
+	}
+	if len(all) != 1 || !all[0].Dismissed {
+		t.Errorf("expected the dismissed alert, got %+v", all)
+	}
+	if err := db.DismissAlert(ctx, 999); err == nil {
+		t.Error("expected an error dismissing a missing alert")
+	}
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// attachmentsDir is the directory in the data directory attached files are stored in
+const attachmentsDir = "attachments"
+
+// Attachment is a file such as a receipt attached to a transaction. The file is stored once
+// by the SHA-256 hash of its content and its extension, however many transactions it's
+// attached to.
+type Attachment struct {
+	ID            int64     `json:"id"`
+	TransactionID string    `json:"transaction_id"`
+	Hash          string    `json:"hash"`
+	Filename      string    `json:"filename"`
+	ContentType   string    `json:"content_type"`
+	Size          int64     `json:"size"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// AttachFile copies a file into the attachment store and attaches it to a transaction.
+// Attaching the same content to a transaction again returns the existing attachment.
+func (d *DB) AttachFile(ctx context.Context, id, path string) (*Attachment, error) {
+	if _, err := d.GetTransactionByID(ctx, id); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	filename := filepath.Base(path)
+	stored := d.attachmentPath(hash, filename)
+	if _, err := os.Stat(stored); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(stored), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create attachment directory: %w", err)
+		}
+		// Write to a temporary file first so a failed copy never leaves a partial file behind
+		tmp := stored + ".tmp"
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to store attachment: %w", err)
+		}
+		if err := os.Rename(tmp, stored); err != nil {
+			return nil, fmt.Errorf("failed to store attachment: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to check attachment: %w", err)
+	}
+
+	_, err = d.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO attachments (transaction_id, hash, filename, content_type, size) VALUES (?, ?, ?, ?, ?)
+	`, id, hash, filename, contentType(filename, data), len(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach file: %w", err)
+	}
+
+	var attachmentID int64
+	if err := d.db.QueryRowContext(ctx, `SELECT id FROM attachments WHERE transaction_id = ? AND hash = ?`, id, hash).Scan(&attachmentID); err != nil {
+		return nil, fmt.Errorf("failed to find attachment: %w", err)
+	}
+	return d.GetAttachment(ctx, attachmentID)
+}
+
+// contentType detects the type of a file from its extension, falling back to its content
+func contentType(filename string, data []byte) string {
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); t != "" {
+		return t
+	}
+	return http.DetectContentType(data)
+}
+
+// attachmentPath is where a file is stored, named by its hash and keeping its extension so it
+// opens in the right application. Files are spread across directories by the first two
+// characters of the hash.
+func (d *DB) attachmentPath(hash, filename string) string {
+	return filepath.Join(d.attachmentsDir, hash[:2], hash+strings.ToLower(filepath.Ext(filename)))
+}
+
+// AttachmentPath returns the path of the stored file for an attachment
+func (d *DB) AttachmentPath(a *Attachment) string {
+	return d.attachmentPath(a.Hash, a.Filename)
+}
+
+const attachmentColumns = `id, transaction_id, hash, filename, content_type, size, created_at`
+
+func scanAttachment(row rowScanner) (*Attachment, error) {
+	var a Attachment
+	if err := row.Scan(&a.ID, &a.TransactionID, &a.Hash, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetAttachment returns an attachment by ID
+func (d *DB) GetAttachment(ctx context.Context, attachmentID int64) (*Attachment, error) {
+	a, err := scanAttachment(d.db.QueryRowContext(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE id = ?`, attachmentID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("attachment %d not found", attachmentID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	return a, nil
+}
+
+// GetAttachments returns the files attached to a transaction, oldest first
+func (d *DB) GetAttachments(ctx context.Context, id string) ([]Attachment, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT `+attachmentColumns+` FROM attachments WHERE transaction_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, *a)
+	}
+	return attachments, rows.Err()
+}
+
+// RemoveAttachment detaches a file from its transaction, deleting the stored file once no
+// transaction has it attached
+func (d *DB) RemoveAttachment(ctx context.Context, attachmentID int64) error {
+	a, err := d.GetAttachment(ctx, attachmentID)
+	if err != nil {
+		return err
+	}
+	if _, err := d.db.ExecContext(ctx, `DELETE FROM attachments WHERE id = ?`, attachmentID); err != nil {
+		return fmt.Errorf("failed to remove attachment: %w", err)
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT filename FROM attachments WHERE hash = ?`, a.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to query attachments: %w", err)
+	}
+	defer rows.Close()
+	path := d.AttachmentPath(a)
+	for rows.Next() {
+		var filename string
+		if err := rows.Scan(&filename); err != nil {
+			return fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		if d.attachmentPath(a.Hash, filename) == path {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating attachments: %w", err)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete attachment file: %w", err)
+	}
+	return nil
+}
+
+// SetNotes replaces the notes on a transaction, an empty string removes them. Notes are
+// searched along with the search body.
+func (d *DB) SetNotes(ctx context.Context, id, notes string) error {
+	result, err := d.db.ExecContext(ctx, `UPDATE transactions SET notes = ? WHERE id = ?`, nullIfEmpty(strings.TrimSpace(notes)), id)
+	if err != nil {
+		return fmt.Errorf("failed to set notes: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("transaction with ID %s not found", id)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestNotes(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	transaction := types.Transaction{Date: "01/03/2024", Amount: money("-120.00"), Payee: "Restaurant", Bank: "amex"}
+	details := &types.TransactionDetails{Type: "purchase", Merchant: "Restaurant", Category: "Food & Dining", SearchBody: "Restaurant dinner"}
+	if err := db.Store(ctx, transaction, details); err != nil {
+		t.Fatalf("failed to store transaction: %v", err)
+	}
+	id := GenerateTransactionID(transaction)
+
+	if err := db.SetNotes(ctx, id, "client dinner, claimable"); err != nil {
+		t.Fatalf("failed to set notes: %v", err)
+	}
+	if err := db.SetNotes(ctx, "missing", "notes"); err == nil {
+		t.Error("expected an error setting notes on a missing transaction")
+	}
+
+	// Notes are kept when the transaction is stored again
+	if err := db.Store(ctx, transaction, details); err != nil {
+		t.Fatalf("failed to store transaction: %v", err)
+	}
+	tx, err := db.GetTransactionByID(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.Notes != "client dinner, claimable" {
+		t.Errorf("expected notes to be kept, got %q", tx.Details.Notes)
+	}
+	if got := tx.Details.EmbeddingText(); got != "Restaurant dinner client dinner, claimable" {
+		t.Errorf("unexpected embedding text %q", got)
+	}
+
+	// Notes are searched along with the search body
+	results, _, err := db.SearchTransactionsByText(ctx, "claimable", OrderByRelevance)
+	if err != nil {
+		t.Fatalf("failed to search: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != id {
+		t.Errorf("expected to find the transaction by its notes, got %d results", len(results))
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	store := func(date, amount, merchant string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant, Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Category: "Shopping", SearchBody: merchant, Tags: []string{"deductible"}}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	laptop := store("01/03/2024", "-2000.00", "Apple")
+	desk := store("02/03/2024", "-400.00", "Officeworks")
+	store("03/03/2024", "-50.00", "Officeworks")
+
+	receipt := filepath.Join(t.TempDir(), "receipt.pdf")
+	if err := os.WriteFile(receipt, []byte("%PDF-1.4 receipt"), 0600); err != nil {
+		t.Fatalf("failed to write receipt: %v", err)
+	}
+
+	a, err := db.AttachFile(ctx, laptop, receipt)
+	if err != nil {
+		t.Fatalf("failed to attach file: %v", err)
+	}
+	if a.Filename != "receipt.pdf" || a.ContentType != "application/pdf" || a.Size != 16 {
+		t.Errorf("unexpected attachment %+v", a)
+	}
+	data, err := os.ReadFile(db.AttachmentPath(a))
+	if err != nil || string(data) != "%PDF-1.4 receipt" {
+		t.Fatalf("expected the stored file to have the receipt's content, got %q: %v", data, err)
+	}
+
+	// The same content is stored once, and attaching it twice to a transaction is a no-op
+	again, err := db.AttachFile(ctx, laptop, receipt)
+	if err != nil {
+		t.Fatalf("failed to attach file: %v", err)
+	}
+	if again.ID != a.ID {
+		t.Errorf("expected the existing attachment %d, got %d", a.ID, again.ID)
+	}
+	shared, err := db.AttachFile(ctx, desk, receipt)
+	if err != nil {
+		t.Fatalf("failed to attach file: %v", err)
+	}
+	if db.AttachmentPath(shared) != db.AttachmentPath(a) {
+		t.Error("expected identical files to share storage")
+	}
+
+	attachments, err := db.GetAttachments(ctx, laptop)
+	if err != nil {
+		t.Fatalf("failed to get attachments: %v", err)
+	}
+	if len(attachments) != 1 {
+		t.Errorf("expected 1 attachment, got %d", len(attachments))
+	}
+	tx, err := db.GetTransactionByID(ctx, laptop)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.AttachmentCount != 1 {
+		t.Errorf("expected an attachment count of 1, got %d", tx.Details.AttachmentCount)
+	}
+
+	ids, err := db.GetTransactionIDs(ctx, FilterByAnyTag("deductible"), FilterByMissingAttachment())
+	if err != nil {
+		t.Fatalf("failed to get transaction ids: %v", err)
+	}
+	if len(ids) != 1 {
+		t.Errorf("expected 1 deductible transaction missing a receipt, got %d", len(ids))
+	}
+
+	// The file is only deleted once nothing has it attached
+	if err := db.RemoveAttachment(ctx, a.ID); err != nil {
+		t.Fatalf("failed to remove attachment: %v", err)
+	}
+	if _, err := os.Stat(db.AttachmentPath(a)); err != nil {
+		t.Errorf("expected the file to remain while attached elsewhere: %v", err)
+	}
+	if err := db.RemoveAttachment(ctx, shared.ID); err != nil {
+		t.Fatalf("failed to remove attachment: %v", err)
+	}
+	if _, err := os.Stat(db.AttachmentPath(a)); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be deleted, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Budget periods
+const (
+	BudgetMonthly = "monthly"
+	BudgetAnnual  = "annual"
+)
+
+// Budget statuses
+const (
+	BudgetOnTrack    = "on track"
+	BudgetOverPace   = "over pace"
+	BudgetOverBudget = "over budget"
+)
+
+// Budget is a limit on spending in a category or on a tag over each calendar month or year
+type Budget struct {
+	ID       int64           `json:"id"`
+	Category string          `json:"category,omitempty"`
+	Tag      string          `json:"tag,omitempty"`
+	Period   string          `json:"period"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+// Name is the category or tag the budget is for, tags prefixed with #
+func (b Budget) Name() string {
+	if b.Tag != "" {
+		return "#" + b.Tag
+	}
+	return b.Category
+}
+
+// PeriodAt returns the first day of the budget's period containing now and the first day of
+// the next period
+func (b Budget) PeriodAt(now time.Time) (time.Time, time.Time) {
+	if b.Period == BudgetAnnual {
+		start := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+		return start, start.AddDate(1, 0, 0)
+	}
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// BudgetStatus is the spending against a budget in its current period
+type BudgetStatus struct {
+	Budget
+	Start     time.Time       `json:"start"`
+	End       time.Time       `json:"end"`
+	Spent     decimal.Decimal `json:"spent"`
+	Remaining decimal.Decimal `json:"remaining"`
+	// Projected is what will have been spent by the end of the period at the current pace
+	Projected decimal.Decimal `json:"projected"`
+	Status    string          `json:"status"`
+}
+
+// Breached reports whether the budget is overspent or on pace to be
+func (s BudgetStatus) Breached() bool {
+	return s.Status != BudgetOnTrack
+}
+
+// SetBudget creates a budget for a category or tag, or replaces the amount of the existing
+// budget for it over the same period
+func (d *DB) SetBudget(ctx context.Context, b Budget) (*Budget, error) {
+	b.Category = strings.TrimSpace(b.Category)
+	b.Tag = strings.TrimSpace(b.Tag)
+	if (b.Category == "") == (b.Tag == "") {
+		return nil, errors.New("a budget needs either a category or a tag")
+	}
+	if b.Category != "" {
+		if _, ok := types.AllowedCategoriesMap[b.Category]; !ok {
+			return nil, fmt.Errorf("unknown category %q", b.Category)
+		}
+	}
+	if b.Period != BudgetMonthly && b.Period != BudgetAnnual {
+		return nil, fmt.Errorf("budget period must be %s or %s, got %q", BudgetMonthly, BudgetAnnual, b.Period)
+	}
+	if !b.Amount.IsPositive() {
+		return nil, errors.New("budget amount must be positive")
+	}
+
+	_, err := d.db.ExecContext(ctx, `
+		INSERT INTO budgets (category, tag, period, amount_minor) VALUES (?, ?, ?, ?)
+		ON CONFLICT (category, tag, period) DO UPDATE SET amount_minor = excluded.amount_minor
+	`, b.Category, b.Tag, b.Period, types.NewMoney(b.Amount, d.baseCurrency).MinorUnits())
+	if err != nil {
+		return nil, fmt.Errorf("failed to set budget: %w", err)
+	}
+	if err := d.db.QueryRowContext(ctx, `SELECT id FROM budgets WHERE category = ? AND tag = ? AND period = ?`,
+		b.Category, b.Tag, b.Period).Scan(&b.ID); err != nil {
+		return nil, fmt.Errorf("failed to find budget: %w", err)
+	}
+	return &b, nil
+}
+
+// GetBudgets returns all budgets, category budgets first
+func (d *DB) GetBudgets(ctx context.Context) ([]Budget, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, category, tag, period, amount_minor FROM budgets ORDER BY tag != '', category, tag, period DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query budgets: %w", err)
+	}
+	defer rows.Close()
+
+	var budgets []Budget
+	for rows.Next() {
+		var b Budget
+		var amount int64
+		if err := rows.Scan(&b.ID, &b.Category, &b.Tag, &b.Period, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan budget: %w", err)
+		}
+		b.Amount = d.fromBaseMinorUnits(amount)
+		budgets = append(budgets, b)
+	}
+	return budgets, rows.Err()
+}
+
+// DeleteBudget removes a budget
+func (d *DB) DeleteBudget(ctx context.Context, id int64) error {
+	result, err := d.db.ExecContext(ctx, `DELETE FROM budgets WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("budget %d not found", id)
+	}
+	return nil
+}
+
+// GetBudgetStatus evaluates every budget over its period containing now. Spending is net of
+// refunds and excludes internal transfers, and split transactions count each split towards
+// its own category.
+func (d *DB) GetBudgetStatus(ctx context.Context, now time.Time) ([]BudgetStatus, error) {
+	budgets, err := d.GetBudgets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now = now.In(d.timezone)
+
+	// Totals are shared by the budgets over the same period, so each is only aggregated once
+	totals := make(map[string][]AggregateRow)
+	var statuses []BudgetStatus
+	for _, b := range budgets {
+		start, end := b.PeriodAt(now)
+		groupBy := GroupByCategory
+		if b.Tag != "" {
+			groupBy = GroupByTag
+		}
+		key := b.Period + ":" + groupBy
+		rows, ok := totals[key]
+		if !ok {
+			rows, err = d.Aggregate(ctx, groupBy, FilterByDateRange(start, end.AddDate(0, 0, -1)), ExcludeInternalTransfers())
+			if err != nil {
+				return nil, err
+			}
+			totals[key] = rows
+		}
+
+		spent := decimal.Zero
+		for _, row := range rows {
+			if strings.EqualFold(row.Key, b.Category+b.Tag) {
+				spent = spent.Sub(row.Total)
+			}
+		}
+		statuses = append(statuses, evaluateBudget(b, start, end, spent, now))
+	}
+	return statuses, nil
+}
+
+// evaluateBudget projects spending to the end of the period from the days elapsed so far,
+// counting today as elapsed
+func evaluateBudget(b Budget, start, end time.Time, spent decimal.Decimal, now time.Time) BudgetStatus {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	days := math.Round(end.Sub(start).Hours() / 24)
+	elapsed := math.Round(today.Sub(start).Hours()/24) + 1
+	projected := spent
+	if elapsed < days {
+		projected = spent.Mul(decimal.NewFromFloat(days)).Div(decimal.NewFromFloat(elapsed)).Round(2)
+	}
+
+	s := BudgetStatus{
+		Budget:    b,
+		Start:     start,
+		End:       end,
+		Spent:     spent,
+		Remaining: b.Amount.Sub(spent),
+		Projected: projected,
+		Status:    BudgetOnTrack,
+	}
+	switch {
+	case spent.GreaterThan(b.Amount):
+		s.Status = BudgetOverBudget
+	case projected.GreaterThan(b.Amount):
+		s.Status = BudgetOverPace
+	}
+	return s
+}
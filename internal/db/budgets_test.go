@@ -0,0 +1,106 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestBudgets(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	transactions := []struct {
+		date     string
+		amount   string
+		merchant string
+		category string
+		tags     []string
+	}{
+		{"02/03/2024", "-150.00", "Woolworths", "Groceries", nil},
+		{"09/03/2024", "-120.00", "Coles", "Groceries", nil},
+		{"10/03/2024", "-40.00", "Cafe", "Food & Dining", []string{"holiday"}},
+		{"25/02/2024", "-500.00", "Woolworths", "Groceries", nil},
+		{"15/01/2024", "-900.00", "Qantas", "Travel", []string{"Holiday"}},
+	}
+	for _, tx := range transactions {
+		transaction := types.Transaction{Date: tx.date, Amount: money(tx.amount), Payee: tx.merchant + " " + tx.date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: tx.merchant, Category: tx.category, SearchBody: tx.merchant, Tags: tx.tags}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	if _, err := db.SetBudget(ctx, Budget{Category: "Groceries", Period: BudgetMonthly, Amount: decimal.NewFromInt(400)}); err != nil {
+		t.Fatalf("failed to set budget: %v", err)
+	}
+	// Setting a budget again replaces its amount
+	groceries, err := db.SetBudget(ctx, Budget{Category: "Groceries", Period: BudgetMonthly, Amount: decimal.NewFromInt(500)})
+	if err != nil {
+		t.Fatalf("failed to set budget: %v", err)
+	}
+	if _, err := db.SetBudget(ctx, Budget{Category: "Food & Dining", Period: BudgetMonthly, Amount: decimal.NewFromInt(300)}); err != nil {
+		t.Fatalf("failed to set budget: %v", err)
+	}
+	if _, err := db.SetBudget(ctx, Budget{Tag: "holiday", Period: BudgetAnnual, Amount: decimal.NewFromInt(800)}); err != nil {
+		t.Fatalf("failed to set budget: %v", err)
+	}
+	if _, err := db.SetBudget(ctx, Budget{Category: "Not A Category", Period: BudgetMonthly, Amount: decimal.NewFromInt(10)}); err == nil {
+		t.Error("expected an error for an unknown category")
+	}
+	if _, err := db.SetBudget(ctx, Budget{Category: "Groceries", Tag: "holiday", Period: BudgetMonthly, Amount: decimal.NewFromInt(10)}); err == nil {
+		t.Error("expected an error for a budget with both a category and a tag")
+	}
+
+	budgets, err := db.GetBudgets(ctx)
+	if err != nil {
+		t.Fatalf("failed to get budgets: %v", err)
+	}
+	if len(budgets) != 3 {
+		t.Fatalf("expected 3 budgets, got %d", len(budgets))
+	}
+
+	// Ten days into a 31 day month
+	statuses, err := db.GetBudgetStatus(ctx, time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to get budget status: %v", err)
+	}
+	byName := make(map[string]BudgetStatus)
+	for _, s := range statuses {
+		byName[s.Name()] = s
+	}
+
+	expected := []struct {
+		name      string
+		spent     string
+		remaining string
+		projected string
+		status    string
+	}{
+		{"Groceries", "270", "230", "837", BudgetOverPace},
+		{"Food & Dining", "40", "260", "124", BudgetOnTrack},
+		{"#holiday", "940", "-140", "4914.86", BudgetOverBudget},
+	}
+	for _, e := range expected {
+		s, ok := byName[e.name]
+		if !ok {
+			t.Errorf("missing status for %s", e.name)
+			continue
+		}
+		if s.Spent.String() != e.spent || s.Remaining.String() != e.remaining || s.Projected.String() != e.projected || s.Status != e.status {
+			t.Errorf("%s: expected spent %s, remaining %s, projected %s, %s, got %s, %s, %s, %s",
+				e.name, e.spent, e.remaining, e.projected, e.status, s.Spent, s.Remaining, s.Projected, s.Status)
+		}
+	}
+
+	if err := db.DeleteBudget(ctx, groceries.ID); err != nil {
+		t.Fatalf("failed to delete budget: %v", err)
+	}
+	if err := db.DeleteBudget(ctx, groceries.ID); err == nil {
+		t.Error("expected an error deleting a missing budget")
+	}
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// cardKeyFile is the name of the file in the data directory holding the card tokenization key
+const cardKeyFile = "card.key"
+
+// Card represents a card seen on transactions and who it belongs to
+type Card struct {
+	Token            string `json:"token"`
+	MaskedNumber     string `json:"masked_number"`
+	Bank             string `json:"bank"`
+	Cardholder       string `json:"cardholder,omitempty"`
+	Account          string `json:"account,omitempty"`
+	Label            string `json:"label,omitempty"`
+	TransactionCount int    `json:"transaction_count"`
+}
+
+// loadOrCreateCardKey reads the card tokenization key, generating a new random key if none exists
+func loadOrCreateCardKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid card key in %s: %w", path, err)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate card key: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write card key: %w", err)
+	}
+	return key, nil
+}
+
+// normalizeCardNumber strips separators so "1234 5678" and "1234-5678" tokenize the same
+func normalizeCardNumber(card string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToUpper(card) {
+		if unicode.IsDigit(c) || c == 'X' || c == '*' || c == '.' {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// MaskCardNumber masks a card number down to its last 4 digits (e.g. "...5678")
+func MaskCardNumber(card string) string {
+	var digits []rune
+	for _, c := range card {
+		if unicode.IsDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits) > 4 {
+		digits = digits[len(digits)-4:]
+	}
+	return "..." + string(digits)
+}
+
+// CardToken returns a stable keyed hash of a card number, so the same card can be
+// matched across transactions without storing the number itself
+func (d *DB) CardToken(card string) string {
+	mac := hmac.New(sha256.New, d.cardKey)
+	mac.Write([]byte(normalizeCardNumber(card)))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// ensureCard records a card if it hasn't been seen before
+func (d *DB) ensureCard(ctx context.Context, token, maskedNumber, bank string) error {
+	_, err := d.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO cards (token, masked_number, bank) VALUES (?, ?, ?)
+	`, token, maskedNumber, bank)
+	if err != nil {
+		return fmt.Errorf("failed to store card: %w", err)
+	}
+	return nil
+}
+
+// tokenizeCardNumbers masks plaintext card numbers stored before tokenization was introduced
+func (d *DB) tokenizeCardNumbers(ctx context.Context) error {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, card_number, bank FROM transactions
+		WHERE card_token IS NULL AND card_number IS NOT NULL AND card_number != ''
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to query card numbers: %w", err)
+	}
+
+	type plaintextCard struct {
+		id, number, bank string
+	}
+	var cards []plaintextCard
+	for rows.Next() {
+		var c plaintextCard
+		if err := rows.Scan(&c.id, &c.number, &c.bank); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan card number: %w", err)
+		}
+		cards = append(cards, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating card numbers: %w", err)
+	}
+
+	if len(cards) > 0 {
+		d.logger.Info("Tokenizing stored card numbers", "count", len(cards))
+	}
+
+	for _, c := range cards {
+		token := d.CardToken(c.number)
+		masked := MaskCardNumber(c.number)
+		if err := d.ensureCard(ctx, token, masked, c.bank); err != nil {
+			return err
+		}
+		if _, err := d.db.ExecContext(ctx, `
+			UPDATE transactions SET card_number = ?, card_token = ? WHERE id = ?
+		`, masked, token, c.id); err != nil {
+			return fmt.Errorf("failed to tokenize card number: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetCards returns all known cards with their transaction counts
+func (d *DB) GetCards(ctx context.Context) ([]Card, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT c.token, c.masked_number, c.bank,
+			COALESCE(c.cardholder, ''), COALESCE(c.account, ''), COALESCE(c.label, ''),
+			(SELECT COUNT(*) FROM transactions t WHERE t.card_token = c.token)
+		FROM cards c
+		ORDER BY c.bank, c.masked_number
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cards: %w", err)
+	}
+	defer rows.Close()
+
+	var cards []Card
+	for rows.Next() {
+		var c Card
+		if err := rows.Scan(&c.Token, &c.MaskedNumber, &c.Bank, &c.Cardholder, &c.Account, &c.Label, &c.TransactionCount); err != nil {
+			return nil, fmt.Errorf("failed to scan card row: %w", err)
+		}
+		cards = append(cards, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cards: %w", err)
+	}
+
+	return cards, nil
+}
+
+// GetCard returns a card by token, masked number or last 4 digits
+func (d *DB) GetCard(ctx context.Context, card string) (*Card, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT c.token, c.masked_number, c.bank,
+			COALESCE(c.cardholder, ''), COALESCE(c.account, ''), COALESCE(c.label, ''),
+			(SELECT COUNT(*) FROM transactions t WHERE t.card_token = c.token)
+		FROM cards c
+		WHERE c.token = ? OR c.masked_number = ? OR substr(c.masked_number, -4) = ?
+	`, card, card, card)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query card: %w", err)
+	}
+	defer rows.Close()
+
+	var matches []Card
+	for rows.Next() {
+		var c Card
+		if err := rows.Scan(&c.Token, &c.MaskedNumber, &c.Bank, &c.Cardholder, &c.Account, &c.Label, &c.TransactionCount); err != nil {
+			return nil, fmt.Errorf("failed to scan card row: %w", err)
+		}
+		matches = append(matches, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cards: %w", err)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("card %s not found", card)
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, fmt.Errorf("card %s is ambiguous (%d matches), use the card token", card, len(matches))
+	}
+}
+
+// UpdateCard sets the cardholder, account and label for a card. Nil values are left unchanged.
+func (d *DB) UpdateCard(ctx context.Context, card string, cardholder, account, label *string) error {
+	c, err := d.GetCard(ctx, card)
+	if err != nil {
+		return err
+	}
+
+	set := []string{}
+	params := []any{}
+	if cardholder != nil {
+		set = append(set, "cardholder = ?")
+		params = append(params, nullIfEmpty(*cardholder))
+	}
+	if account != nil {
+		set = append(set, "account = ?")
+		params = append(params, nullIfEmpty(*account))
+	}
+	if label != nil {
+		set = append(set, "label = ?")
+		params = append(params, nullIfEmpty(*label))
+	}
+	if len(set) == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+
+	params = append(params, c.Token)
+	_, err = d.db.ExecContext(ctx, "UPDATE cards SET "+strings.Join(set, ", ")+" WHERE token = ?", params...)
+	if err != nil {
+		return fmt.Errorf("failed to update card: %w", err)
+	}
+	return nil
+}
+
+// placeholders returns a comma-separated list of n SQL placeholders
+func placeholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
+
+// stringParams converts strings to query parameters
+func stringParams(values []string) []any {
+	params := make([]any, len(values))
+	for i, v := range values {
+		params[i] = v
+	}
+	return params
+}
+
+// nullIfEmpty converts an empty string to a SQL NULL
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// accountColumn is the account a transaction belongs to, the account assigned to the card used
+// or the bank when there isn't one
+const accountColumn = "COALESCE((SELECT c.account FROM cards c WHERE c.token = t.card_token), t.bank)"
+
+// Account is an account transactions are grouped into and the currency it's held in
+type Account struct {
+	Name             string `json:"name"`
+	Currency         string `json:"currency"`
+	TransactionCount int    `json:"transaction_count"`
+}
+
+// ValidateCurrency checks a currency is a 3-letter code, returning it in upper case
+func ValidateCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if len(currency) != 3 || strings.Trim(currency, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("currency must be a 3-letter code, got %q", currency)
+	}
+	return currency, nil
+}
+
+// SetBaseCurrency sets the currency aggregates and reports are converted to
+func (d *DB) SetBaseCurrency(currency string) error {
+	currency, err := ValidateCurrency(currency)
+	if err != nil {
+		return err
+	}
+	d.baseCurrency = currency
+	return nil
+}
+
+// BaseCurrency returns the currency aggregates and reports are converted to
+func (d *DB) BaseCurrency() string {
+	return d.baseCurrency
+}
+
+// GetAccounts returns the accounts seen on transactions or given a currency, with the currency
+// each is held in
+func (d *DB) GetAccounts(ctx context.Context) ([]Account, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		WITH seen AS (
+			SELECT `+accountColumn+` AS name, COUNT(*) AS count FROM transactions t GROUP BY name
+		)
+		SELECT s.name, COALESCE(a.currency, ?), s.count FROM seen s LEFT JOIN accounts a ON a.name = s.name COLLATE NOCASE
+		UNION ALL
+		SELECT a.name, a.currency, 0 FROM accounts a WHERE NOT EXISTS (SELECT 1 FROM seen s WHERE s.name = a.name COLLATE NOCASE)
+		ORDER BY 1
+	`, types.DefaultCurrency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []Account
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.Name, &a.Currency, &a.TransactionCount); err != nil {
+			return nil, fmt.Errorf("failed to scan account: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating accounts: %w", err)
+	}
+	return accounts, nil
+}
+
+// SetAccountCurrency sets the currency an account is held in. Transactions already imported into
+// the account are moved to the currency, keeping their amounts, and later imports use it.
+// It returns how many transactions changed currency.
+func (d *DB) SetAccountCurrency(ctx context.Context, account, currency string) (int, error) {
+	currency, err := ValidateCurrency(currency)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO accounts (name, currency) VALUES (?, ?)
+		ON CONFLICT (name) DO UPDATE SET currency = excluded.currency
+	`, account, currency); err != nil {
+		return 0, fmt.Errorf("failed to set account currency: %w", err)
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT t.id, t.amount_minor, t.currency FROM transactions t
+		WHERE `+accountColumn+` = ? COLLATE NOCASE AND t.currency != ?
+	`, account, currency)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query account transactions: %w", err)
+	}
+	type move struct {
+		id     string
+		amount types.Money
+	}
+	var moves []move
+	for rows.Next() {
+		var m move
+		var units int64
+		var from string
+		if err := rows.Scan(&m.id, &units, &from); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		m.amount = types.MoneyFromMinorUnits(units, from)
+		moves = append(moves, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating account transactions: %w", err)
+	}
+
+	for _, m := range moves {
+		moved := types.NewMoney(m.amount.Amount, currency)
+		if _, err := tx.ExecContext(ctx, `UPDATE transactions SET amount_minor = ?, currency = ? WHERE id = ?`,
+			moved.MinorUnits(), currency, m.id); err != nil {
+			return 0, fmt.Errorf("failed to update transaction %s: %w", m.id, err)
+		}
+		// Splits are in the transaction's currency, so need rescaling when its minor unit differs
+		if digits := types.MinorUnitDigits(currency) - types.MinorUnitDigits(m.amount.Currency); digits != 0 {
+			if _, err := tx.ExecContext(ctx, `
+				UPDATE transaction_splits SET amount_minor = CAST(ROUND(amount_minor * ?) AS INTEGER) WHERE transaction_id = ?
+			`, decimal.New(1, digits).InexactFloat64(), m.id); err != nil {
+				return 0, fmt.Errorf("failed to update splits on %s: %w", m.id, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit account currency: %w", err)
+	}
+	return len(moves), nil
+}
+
+// accountCurrency returns the currency of the account a new transaction is imported into
+func (d *DB) accountCurrency(ctx context.Context, bank string, cardToken sql.NullString) (string, error) {
+	var currency string
+	err := d.db.QueryRowContext(ctx, `
+		SELECT currency FROM accounts
+		WHERE name = COALESCE((SELECT account FROM cards WHERE token = ?), ?)
+	`, cardToken, bank).Scan(&currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.DefaultCurrency, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get account currency: %w", err)
+	}
+	return currency, nil
+}
+
+// ExchangeRate returns what one unit of a currency cost in the quote currency on date, from the
+// most recent stored rate up to a week before. Rates stored the other way around are inverted.
+func (d *DB) ExchangeRate(ctx context.Context, currency, quote string, date time.Time) (decimal.Decimal, bool, error) {
+	currency, quote = strings.ToUpper(currency), strings.ToUpper(quote)
+	if currency == quote {
+		return decimal.NewFromInt(1), true, nil
+	}
+	var rate string
+	var inverse bool
+	err := d.db.QueryRowContext(ctx, `
+		SELECT CAST(rate AS TEXT), currency = ? FROM fx_rates
+		WHERE ((currency = ? AND quote = ?) OR (currency = ? AND quote = ?)) AND date <= ? AND date >= ?
+		ORDER BY date DESC, currency = ? LIMIT 1
+	`, quote, currency, quote, quote, currency,
+		date.Format("2006-01-02"), date.AddDate(0, 0, -fxRateMaxAge).Format("2006-01-02"), quote).Scan(&rate, &inverse)
+	if errors.Is(err, sql.ErrNoRows) {
+		return decimal.Zero, false, nil
+	}
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("failed to get exchange rate: %w", err)
+	}
+	r, err := decimal.NewFromString(rate)
+	if err != nil {
+		return decimal.Zero, false, fmt.Errorf("invalid stored exchange rate %q: %w", rate, err)
+	}
+	if inverse {
+		r = decimal.NewFromInt(1).DivRound(r, 8)
+	}
+	return r, true, nil
+}
+
+// ToBaseCurrency converts an amount to the base currency at the rate on the transaction date
+func (d *DB) ToBaseCurrency(ctx context.Context, amount types.Money, date string) (decimal.Decimal, error) {
+	currency := currencyOrDefault(amount.Currency)
+	if currency == d.baseCurrency {
+		return amount.Amount, nil
+	}
+	day, err := time.ParseInLocation("02/01/2006", date, d.timezone)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid transaction date %q: %w", date, err)
+	}
+	rate, ok, err := d.ExchangeRate(ctx, currency, d.baseCurrency, day)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	if !ok {
+		return decimal.Zero, missingRateError(currency, d.baseCurrency, day.Format("2006-01-02"))
+	}
+	return amount.Amount.Mul(rate).Round(types.MinorUnitDigits(d.baseCurrency)), nil
+}
+
+// missingRateError explains that an amount can't be converted without loading a rate
+func missingRateError(currency, quote, date string) error {
+	return fmt.Errorf("no %s to %s exchange rate on or in the week before %s, load rates with \"bank-transaction-manage fx import\"", currency, quote, date)
+}
+
+// baseAmountSQL converts a column of minor units in the transaction's currency to minor units of
+// the base currency, at the most recent rate up to a week before the transaction. It's NULL
+// when there's no rate.
+func (d *DB) baseAmountSQL(column string) string {
+	// The base currency is validated as 3 letters, so it's safe to quote
+	base := "'" + d.baseCurrency + "'"
+	baseDigits := types.MinorUnitDigits(d.baseCurrency)
+	scale := fmt.Sprintf(`CASE WHEN t.currency IN (%s) THEN %s WHEN t.currency IN (%s) THEN %s ELSE %s END`,
+		quotedList(types.CurrenciesWithMinorUnitDigits(0)), decimal.New(1, baseDigits).String(),
+		quotedList(types.CurrenciesWithMinorUnitDigits(3)), decimal.New(1, baseDigits-3).String(),
+		decimal.New(1, baseDigits-2).String())
+	day := "substr(t.date, 1, 10)"
+	window := fmt.Sprintf("r.date <= %s AND r.date >= date(%s, '-%d days')", day, day, fxRateMaxAge)
+	rate := `COALESCE(
+		(SELECT CAST(r.rate AS REAL) FROM fx_rates r WHERE r.currency = t.currency AND r.quote = ` + base + ` AND ` + window + ` ORDER BY r.date DESC LIMIT 1),
+		(SELECT 1.0 / CAST(r.rate AS REAL) FROM fx_rates r WHERE r.currency = ` + base + ` AND r.quote = t.currency AND ` + window + ` ORDER BY r.date DESC LIMIT 1))`
+	return `CASE WHEN t.currency = ` + base + ` THEN ` + column + `
+		ELSE CAST(ROUND(` + column + ` * ` + rate + ` * ` + scale + `) AS INTEGER) END`
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestMultiCurrencyAggregate(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	if _, err := db.SetAccountCurrency(ctx, "wise", "usd"); err != nil {
+		t.Fatalf("failed to set account currency: %v", err)
+	}
+	store := func(bank, date, amount string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: bank + " " + date, Bank: bank}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: "Shop", Category: "Shopping", SearchBody: "shop"}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	usd := store("wise", "02/05/2024", "-10.00")
+	store("ing", "02/05/2024", "-30.00")
+
+	tx, err := db.GetTransactionByID(ctx, usd)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Amount.String() != "-10.00" || tx.Amount.Currency != "USD" {
+		t.Errorf("expected -10.00 USD, got %s %s", tx.Amount, tx.Amount.Currency)
+	}
+
+	if _, err := db.Aggregate(ctx, GroupByAccount); err == nil || !strings.Contains(err.Error(), "no USD to AUD exchange rate") {
+		t.Fatalf("expected an error without a USD rate, got %v", err)
+	}
+
+	if err := db.ImportFXRates(ctx, []FXRate{
+		{Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), Currency: "USD", Rate: decimal.RequireFromString("1.50")},
+	}); err != nil {
+		t.Fatalf("failed to import rates: %v", err)
+	}
+
+	totals := func() string {
+		rows, err := db.Aggregate(ctx, GroupByAccount)
+		if err != nil {
+			t.Fatalf("failed to aggregate: %v", err)
+		}
+		var totals []string
+		for _, r := range rows {
+			totals = append(totals, fmt.Sprintf("%s=%s", r.Key, r.Total.StringFixed(2)))
+		}
+		return strings.Join(totals, " ")
+	}
+	if got := totals(); got != "ing=-30.00 wise=-15.00" {
+		t.Errorf("expected totals in AUD, got %s", got)
+	}
+
+	// The same rate converts the other way when reporting in USD
+	if err := db.SetBaseCurrency("usd"); err != nil {
+		t.Fatalf("failed to set base currency: %v", err)
+	}
+	if got := totals(); got != "ing=-20.00 wise=-10.00" {
+		t.Errorf("expected totals in USD, got %s", got)
+	}
+	if err := db.SetBaseCurrency("dollars"); err == nil {
+		t.Error("expected an error for an invalid base currency")
+	}
+}
+
+func TestSetAccountCurrencyMovesTransactions(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	transaction := types.Transaction{Date: "01/04/2024", Amount: money("-1500.00"), Payee: "Ramen", Bank: "jp-bank"}
+	details := &types.TransactionDetails{Type: "purchase", Merchant: "Ramen", Category: "Food & Dining", SearchBody: "ramen"}
+	if err := db.Store(ctx, transaction, details); err != nil {
+		t.Fatalf("failed to store transaction: %v", err)
+	}
+	id := GenerateTransactionID(transaction)
+	if err := db.SetSplits(ctx, id, []types.Split{
+		{Amount: decimal.RequireFromString("-1000"), Category: "Food & Dining"},
+		{Amount: decimal.RequireFromString("-500"), Category: "Entertainment"},
+	}); err != nil {
+		t.Fatalf("failed to set splits: %v", err)
+	}
+
+	moved, err := db.SetAccountCurrency(ctx, "JP-Bank", "JPY")
+	if err != nil {
+		t.Fatalf("failed to set account currency: %v", err)
+	}
+	if moved != 1 {
+		t.Errorf("expected 1 transaction moved, got %d", moved)
+	}
+
+	tx, err := db.GetTransactionByID(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Amount.String() != "-1500" || tx.Amount.Currency != "JPY" || tx.Amount.MinorUnits() != -1500 {
+		t.Errorf("expected -1500 JPY, got %s %s", tx.Amount, tx.Amount.Currency)
+	}
+	if len(tx.Splits) != 2 || !tx.Splits[0].Amount.Equal(decimal.NewFromInt(-1000)) {
+		t.Errorf("expected splits to keep their amounts, got %+v", tx.Splits)
+	}
+
+	accounts, err := db.GetAccounts(ctx)
+	if err != nil {
+		t.Fatalf("failed to get accounts: %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].Currency != "JPY" || accounts[0].TransactionCount != 1 {
+		t.Errorf("unexpected accounts: %+v", accounts)
+	}
+}
@@ -3,22 +3,25 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/ncruces/go-sqlite3/driver"
 	_ "github.com/ncruces/go-sqlite3/embed"
 
-	"github.com/shopspring/decimal"
-
 	"crypto/sha256"
 	"encoding/hex"
 
 	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
 	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
 )
 
 const (
@@ -31,7 +34,9 @@ var schema = `
 CREATE TABLE IF NOT EXISTS transactions (
 	id TEXT PRIMARY KEY,
 	date DATE NOT NULL,
-	amount DECIMAL(15,2) NOT NULL,
+	-- Amounts are whole numbers of the currency's minor units, such as cents
+	amount_minor INTEGER NOT NULL,
+	currency TEXT NOT NULL DEFAULT 'AUD',
 	payee TEXT NOT NULL,
 	bank TEXT NOT NULL,
 	-- Transaction details
@@ -43,35 +48,209 @@ CREATE TABLE IF NOT EXISTS transactions (
 	card_number TEXT,
 	search_body TEXT,
 	-- Foreign amount details
-	foreign_amount DECIMAL(15,2),
+	foreign_amount_minor INTEGER,
 	foreign_currency TEXT,
 	-- Transfer details
 	transfer_to_account TEXT,
 	transfer_from_account TEXT,
 	transfer_reference TEXT,
+	-- Keyed hash of the card number, card_number only holds the masked number
+	card_token TEXT,
+	-- Model that classified the transaction
+	model TEXT,
+	-- Recurring series the transaction belongs to, if any
+	recurring_series_id TEXT,
+	-- Canonical merchant the classified merchant resolved to
+	merchant_id INTEGER,
+	-- Location resolved against the gazetteer, country as an ISO 3166-1 alpha-2 code
+	locality TEXT,
+	state TEXT,
+	postcode TEXT,
+	country TEXT,
+	-- Notes written about the transaction, kept when it's imported again
+	notes TEXT,
+	-- Tax deduction category code such as D5, or empty once marked as not deductible
+	deduction TEXT
+);
+
+-- Canonical merchants, which the merchant names on transactions resolve to through their aliases
+CREATE TABLE IF NOT EXISTS merchants (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	default_category TEXT,
+	-- Deduction category applied to the merchant's transactions unless set on the transaction
+	default_deduction TEXT,
+	website TEXT,
+	notes TEXT,
+	-- Embedding of the name, for resolving names that don't match an alias
+	embedding BLOB,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Merchant names seen on transactions, keyed by their normalized form
+CREATE TABLE IF NOT EXISTS merchant_aliases (
+	alias_key TEXT PRIMARY KEY,
+	alias TEXT NOT NULL,
+	merchant_id INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_merchant_aliases_merchant ON merchant_aliases(merchant_id);
+
+-- Recurring payments detected from transaction history, rebuilt by RefreshRecurringSeries
+CREATE TABLE IF NOT EXISTS recurring_series (
+	id TEXT PRIMARY KEY,
+	merchant TEXT NOT NULL,
+	bank TEXT NOT NULL,
+	type TEXT NOT NULL,
+	category TEXT,
+	cadence TEXT NOT NULL,
+	amount_minor INTEGER NOT NULL,
+	previous_amount_minor INTEGER,
+	-- Dates as YYYY-MM-DD
+	first_date TEXT NOT NULL,
+	last_date TEXT NOT NULL,
+	next_date TEXT NOT NULL,
+	transaction_count INTEGER NOT NULL
+);
+
+-- Cards seen on transactions, mapped to a cardholder and account
+CREATE TABLE IF NOT EXISTS cards (
+	token TEXT PRIMARY KEY,
+	masked_number TEXT NOT NULL,
+	bank TEXT NOT NULL,
+	cardholder TEXT,
+	account TEXT,
+	label TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Links between related transactions, such as the two sides of a transfer
+CREATE TABLE IF NOT EXISTS transaction_links (
+	transaction_id TEXT NOT NULL,
+	linked_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	source TEXT NOT NULL DEFAULT 'auto',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (transaction_id, linked_id, kind)
+);
+CREATE INDEX IF NOT EXISTS idx_transaction_links_linked ON transaction_links(linked_id, kind);
+
+-- Tags, linked to transactions through transaction_tags
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS transaction_tags (
+	transaction_id TEXT NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (transaction_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_transaction_tags_tag ON transaction_tags(tag_id);
+
+-- Files such as receipts attached to transactions, stored by content hash under the data directory
+CREATE TABLE IF NOT EXISTS attachments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id TEXT NOT NULL,
+	hash TEXT NOT NULL,
+	filename TEXT NOT NULL,
+	content_type TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (transaction_id, hash)
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_transaction ON attachments(transaction_id);
+
+-- Spending limits per category or tag, for each month or year
+CREATE TABLE IF NOT EXISTS budgets (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	category TEXT NOT NULL DEFAULT '',
+	tag TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+	period TEXT NOT NULL,
+	amount_minor INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (category, tag, period)
+);
+
+-- Exchange rates loaded from a file, as the quote currency paid for one unit of a currency
+CREATE TABLE IF NOT EXISTS fx_rates (
+	date TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	quote TEXT NOT NULL DEFAULT 'AUD',
+	rate DECIMAL(18,8) NOT NULL,
+	PRIMARY KEY (date, currency, quote)
+);
+
+-- Runs of spending away from home. Names are kept when trips are detected again.
+CREATE TABLE IF NOT EXISTS trips (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	destination TEXT NOT NULL,
+	-- ISO codes of the countries spent in, comma separated
+	countries TEXT NOT NULL DEFAULT '',
+	-- Dates as YYYY-MM-DD
+	start_date TEXT NOT NULL,
+	end_date TEXT NOT NULL
+);
+
+-- The transactions spent on each trip, including travel booked before it
+CREATE TABLE IF NOT EXISTS trip_transactions (
+	transaction_id TEXT PRIMARY KEY,
+	trip_id TEXT NOT NULL,
+	prebooked INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_transactions_trip ON trip_transactions(trip_id);
+
+-- The currency each account is held in, for accounts that aren't in the default currency
+CREATE TABLE IF NOT EXISTS accounts (
+	name TEXT PRIMARY KEY COLLATE NOCASE,
+	currency TEXT NOT NULL
+);
+
+-- Unusual transactions found when they were imported, one per transaction and kind
+CREATE TABLE IF NOT EXISTS alerts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	transaction_id TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	message TEXT NOT NULL,
+	related_id TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	dismissed_at DATETIME,
+	UNIQUE (transaction_id, kind)
+);
+
+-- Allocations of a transaction across categories, which must sum to the transaction amount
+CREATE TABLE IF NOT EXISTS transaction_splits (
+	transaction_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	amount_minor INTEGER NOT NULL,
+	category TEXT NOT NULL,
 	-- Tags (comma-separated)
-	tags TEXT
+	tags TEXT,
+	note TEXT,
+	PRIMARY KEY (transaction_id, position)
 );
 
--- Create virtual table for full-text search
+-- Create virtual table for full-text search over the search body and notes
 CREATE VIRTUAL TABLE IF NOT EXISTS transactions_fts USING fts5(
 	search_body,
+	notes,
 	content='transactions',
 	content_rowid='rowid'
 );
 
 -- Create trigger to keep FTS table in sync
 CREATE TRIGGER IF NOT EXISTS transactions_ai AFTER INSERT ON transactions BEGIN
-	INSERT INTO transactions_fts(rowid, search_body) VALUES (new.rowid, new.search_body);
+	INSERT INTO transactions_fts(rowid, search_body, notes) VALUES (new.rowid, new.search_body, new.notes);
 END;
 
 CREATE TRIGGER IF NOT EXISTS transactions_ad AFTER DELETE ON transactions BEGIN
-	DELETE FROM transactions_fts WHERE rowid = old.rowid;
+	INSERT INTO transactions_fts(transactions_fts, rowid, search_body, notes) VALUES ('delete', old.rowid, old.search_body, old.notes);
 END;
 
 CREATE TRIGGER IF NOT EXISTS transactions_au AFTER UPDATE ON transactions BEGIN
-	DELETE FROM transactions_fts WHERE rowid = old.rowid;
-	INSERT INTO transactions_fts(rowid, search_body) VALUES (new.rowid, new.search_body);
+	INSERT INTO transactions_fts(transactions_fts, rowid, search_body, notes) VALUES ('delete', old.rowid, old.search_body, old.notes);
+	INSERT INTO transactions_fts(rowid, search_body, notes) VALUES (new.rowid, new.search_body, new.notes);
 END;
 
 -- Create indexes for faster lookups
@@ -80,8 +259,13 @@ CREATE INDEX IF NOT EXISTS idx_transactions_date ON transactions(date);
 CREATE INDEX IF NOT EXISTS idx_transactions_type ON transactions(type);
 CREATE INDEX IF NOT EXISTS idx_transactions_merchant ON transactions(merchant);
 CREATE INDEX IF NOT EXISTS idx_transactions_category ON transactions(details_category);
-CREATE INDEX IF NOT EXISTS idx_transactions_amount ON transactions(amount);
+CREATE INDEX IF NOT EXISTS idx_transactions_amount ON transactions(amount_minor);
 CREATE INDEX IF NOT EXISTS idx_transactions_bank ON transactions(bank);
+CREATE INDEX IF NOT EXISTS idx_transactions_card_token ON transactions(card_token);
+CREATE INDEX IF NOT EXISTS idx_transactions_recurring_series ON transactions(recurring_series_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_merchant_id ON transactions(merchant_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_country ON transactions(country, state);
+CREATE INDEX IF NOT EXISTS idx_transactions_deduction ON transactions(deduction);
 
 CREATE TABLE IF NOT EXISTS migrations (
     id INTEGER PRIMARY KEY
@@ -93,6 +277,17 @@ type DB struct {
 	db       *sql.DB
 	logger   *log.Logger
 	timezone *time.Location
+	cardKey  []byte
+
+	// baseCurrency is the currency aggregates and reports are converted to
+	baseCurrency string
+
+	// attachmentsDir holds attached files, named by the hash of their content
+	attachmentsDir string
+
+	// merchantMu serializes merchant resolution, merchantEmbedder is optional
+	merchantMu       sync.Mutex
+	merchantEmbedder MerchantEmbedder
 }
 
 // New creates a new database connection
@@ -118,10 +313,21 @@ func New(dataDir string, logger *log.Logger, timezone *time.Location) (*DB, erro
 		return nil, fmt.Errorf("failed to set database pragmas: %v", err)
 	}
 
+	// Load the key used to tokenize card numbers
+	cardKey, err := loadOrCreateCardKey(filepath.Join(dataDir, cardKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load card key: %v", err)
+	}
+
 	d := &DB{
 		db:       db,
 		logger:   logger,
 		timezone: timezone,
+		cardKey:  cardKey,
+
+		baseCurrency: types.DefaultCurrency,
+
+		attachmentsDir: filepath.Join(dataDir, attachmentsDir),
 	}
 
 	// Initialize database schema and apply migrations
@@ -170,6 +376,11 @@ func (d *DB) Init(ctx context.Context) error {
 		}
 	}
 
+	// Mask any card numbers stored before cards were tokenized
+	if err := d.tokenizeCardNumbers(ctx); err != nil {
+		return fmt.Errorf("failed to tokenize card numbers: %v", err)
+	}
+
 	return nil
 }
 
@@ -185,27 +396,63 @@ func (d *DB) Store(ctx context.Context, t types.Transaction, details *types.Tran
 		return fmt.Errorf("failed to parse transaction date: %v", dateErr)
 	}
 
+	// Never store the card number in plaintext, only the masked number and a keyed token
+	cardNumber, cardToken := details.CardNumber, sql.NullString{}
+	if cardNumber != "" {
+		cardNumber = MaskCardNumber(details.CardNumber)
+		cardToken = sql.NullString{String: d.CardToken(details.CardNumber), Valid: true}
+		if err := d.ensureCard(ctx, cardToken.String, cardNumber, t.Bank); err != nil {
+			return err
+		}
+	}
+
+	// Resolve the classified merchant to its canonical merchant
+	merchantID, defaultCategory, err := d.resolveMerchant(ctx, details.Merchant, details.Location)
+	if err != nil {
+		return err
+	}
+	category := applyDefaultCategory(details, defaultCategory)
+	place := gazetteer.Parse(details.Location)
+
+	// Bank exports don't say what currency they're in, so it comes from the account
+	amount := t.Amount
+	if amount.Currency == "" || amount.Currency == types.DefaultCurrency {
+		currency, err := d.accountCurrency(ctx, t.Bank, cardToken)
+		if err != nil {
+			return err
+		}
+		amount = types.NewMoney(amount.Amount, currency)
+	}
+
 	// Insert or replace transaction
-	_, err := d.db.ExecContext(ctx, `
+	_, err = d.db.ExecContext(ctx, `
 		INSERT OR REPLACE INTO transactions (
-			id, date, amount, payee, bank,
+			id, date, amount_minor, currency, payee, bank,
 			type, merchant, location, details_category, description, card_number, search_body,
-			foreign_amount, foreign_currency,
+			foreign_amount_minor, foreign_currency,
 			transfer_to_account, transfer_from_account, transfer_reference,
-			tags
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			card_token, model, merchant_id,
+			locality, state, postcode, country,
+			notes, deduction
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?,
+			COALESCE(?, (SELECT notes FROM transactions WHERE id = ?)),
+			COALESCE(?, (SELECT deduction FROM transactions WHERE id = ?), (SELECT default_deduction FROM merchants WHERE id = ?)))
 	`,
-		id, date, t.Amount, t.Payee, t.Bank,
-		details.Type, details.Merchant, details.Location, details.Category, details.Description, details.CardNumber, details.SearchBody,
+		id, date, amount.MinorUnits(), amount.Currency, t.Payee, t.Bank,
+		details.Type, details.Merchant, details.Location, category, details.Description, cardNumber, details.SearchBody,
 		getForeignAmount(details), getForeignCurrency(details),
 		getTransferToAccount(details), getTransferFromAccount(details), getTransferReference(details),
-		details.Tags,
+		cardToken, nullIfEmpty(details.Model), sql.NullInt64{Int64: merchantID, Valid: merchantID != 0},
+		nullIfEmpty(place.Locality), nullIfEmpty(place.State), nullIfEmpty(place.Postcode), nullIfEmpty(place.Country),
+		nullIfEmpty(details.Notes), id,
+		nullIfEmpty(details.Deduction), id, merchantID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to store transaction: %v", err)
 	}
 
-	return nil
+	// Tags are kept in their own table, so any added since the transaction was first stored remain
+	return addTags(ctx, d.db, id, details.Tags)
 }
 
 // Get retrieves transaction details from the database
@@ -214,23 +461,28 @@ func (d *DB) Get(ctx context.Context, t types.Transaction) (*types.TransactionDe
 
 	var details types.TransactionDetails
 	var date time.Time
-	var amount decimal.Decimal
+	var amount int64
 	var bank string
-	var foreignAmount sql.NullFloat64
+	var foreignAmount sql.NullInt64
 	var foreignCurrency sql.NullString
 	var transferToAccount sql.NullString
 	var transferFromAccount sql.NullString
 	var transferReference sql.NullString
+	var cardToken sql.NullString
+	var cardholder sql.NullString
+	var model sql.NullString
 
 	err := d.db.QueryRowContext(ctx, `
-		SELECT date, amount, bank, type, merchant, location, details_category, description, card_number, search_body,
-			foreign_amount, foreign_currency,
-			transfer_to_account, transfer_from_account, transfer_reference
+		SELECT date, amount_minor, bank, type, merchant, location, details_category, description, card_number, search_body,
+			foreign_amount_minor, foreign_currency,
+			transfer_to_account, transfer_from_account, transfer_reference,
+			card_token, (SELECT c.cardholder FROM cards c WHERE c.token = card_token), model
 		FROM transactions WHERE id = ?
 	`, id).Scan(
 		&date, &amount, &bank, &details.Type, &details.Merchant, &details.Location, &details.Category, &details.Description, &details.CardNumber, &details.SearchBody,
 		&foreignAmount, &foreignCurrency,
 		&transferToAccount, &transferFromAccount, &transferReference,
+		&cardToken, &cardholder, &model,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -238,13 +490,14 @@ func (d *DB) Get(ctx context.Context, t types.Transaction) (*types.TransactionDe
 		}
 		return nil, fmt.Errorf("failed to get transaction: %v", err)
 	}
+	details.CardToken = cardToken.String
+	details.Cardholder = cardholder.String
+	details.Model = model.String
 
 	// Set foreign amount if present
 	if foreignAmount.Valid && foreignCurrency.Valid {
-		details.ForeignAmount = &types.ForeignAmountDetails{
-			Amount:   decimal.NewFromFloat(foreignAmount.Float64),
-			Currency: foreignCurrency.String,
-		}
+		foreign := types.MoneyFromMinorUnits(foreignAmount.Int64, foreignCurrency.String)
+		details.ForeignAmount = &foreign
 	}
 
 	// Set transfer details if present
@@ -259,26 +512,49 @@ func (d *DB) Get(ctx context.Context, t types.Transaction) (*types.TransactionDe
 	return &details, nil
 }
 
-// GenerateTransactionID creates a unique ID for a transaction based on payee, amount, and date
+// GenerateTransactionID creates a unique ID for a transaction based on payee, amount, and date.
+// The amount is hashed as the bank export wrote it, falling back to its minor unit without the
+// currency. Transactions read from the database should use their stored ID instead.
 func GenerateTransactionID(t types.Transaction) string {
+	amount := t.AmountText
+	if amount == "" {
+		amount = t.Amount.String()
+	}
 	// Create a hash of the transaction details
 	h := sha256.New()
-	h.Write([]byte(fmt.Sprintf("%s|%s|%s|%s", t.Payee, t.Amount, t.Date, t.Bank)))
+	h.Write([]byte(fmt.Sprintf("%s|%s|%s|%s", t.Payee, amount, t.Date, t.Bank)))
 	return hex.EncodeToString(h.Sum(nil))[:8]
 }
 
+// fromMinorUnits converts a stored amount in the default currency, such as a sum of amounts, to a decimal
+func fromMinorUnits(units int64) decimal.Decimal {
+	return types.MoneyFromMinorUnits(units, types.DefaultCurrency).Amount
+}
+
+// fromBaseMinorUnits converts a whole number of the base currency's minor units to an amount
+func (d *DB) fromBaseMinorUnits(units int64) decimal.Decimal {
+	return types.MoneyFromMinorUnits(units, d.baseCurrency).Amount
+}
+
+// currencyOrDefault returns the currency an amount is stored in, the default when it isn't set
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return types.DefaultCurrency
+	}
+	return strings.ToUpper(currency)
+}
+
 // Helper functions to safely extract values from transaction details
-func getForeignAmount(details *types.TransactionDetails) sql.NullFloat64 {
+func getForeignAmount(details *types.TransactionDetails) sql.NullInt64 {
 	if details.ForeignAmount != nil {
-		amount, _ := details.ForeignAmount.Amount.Float64()
-		return sql.NullFloat64{Float64: amount, Valid: true}
+		return sql.NullInt64{Int64: details.ForeignAmount.MinorUnits(), Valid: true}
 	}
-	return sql.NullFloat64{}
+	return sql.NullInt64{}
 }
 
 func getForeignCurrency(details *types.TransactionDetails) sql.NullString {
 	if details.ForeignAmount != nil {
-		return sql.NullString{String: details.ForeignAmount.Currency, Valid: true}
+		return sql.NullString{String: strings.ToUpper(details.ForeignAmount.Currency), Valid: true}
 	}
 	return sql.NullString{}
 }
@@ -356,48 +632,19 @@ func (d *DB) Close() error {
 
 // GetTransactionByID retrieves a transaction by its ID
 func (d *DB) GetTransactionByID(ctx context.Context, id string) (*types.TransactionWithDetails, error) {
-	query := `
-		SELECT t.date, t.amount, t.payee, t.bank,
-			t.type, t.merchant, t.location, t.details_category, t.description, t.card_number,
-			t.foreign_amount, t.foreign_currency,
-			t.transfer_to_account, t.transfer_from_account, t.transfer_reference
+	query := `SELECT ` + transactionColumns + `
 		FROM transactions t
 		WHERE t.id = ?
 	`
 
 	var t types.TransactionWithDetails
-	row := d.db.QueryRowContext(ctx, query, id)
-
-	var date time.Time
-	var amount decimal.Decimal
-	var foreignAmount sql.NullFloat64
-	var foreignCurrency sql.NullString
-	var transferToAccount sql.NullString
-	var transferFromAccount sql.NullString
-	var transferReference sql.NullString
-
-	if err := row.Scan(
-		&date, &amount, &t.Payee, &t.Bank,
-		&t.Details.Type, &t.Details.Merchant, &t.Details.Location, &t.Details.Category, &t.Details.Description, &t.Details.CardNumber,
-		&foreignAmount, &foreignCurrency,
-		&transferToAccount, &transferFromAccount, &transferReference,
-	); err != nil {
-		if err == sql.ErrNoRows {
+	if err := scanTransactionRow(d.db.QueryRowContext(ctx, query, id), &t); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
 			return nil, fmt.Errorf("transaction with ID %s not found", id)
 		}
-		return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		return nil, err
 	}
 
-	// Format date and amount as strings
-	t.Date = date.Format("02/01/2006")
-	t.Amount = amount.String()
-
-	// Set foreign amount if present
-	SetForeignAmount(&t, foreignAmount, foreignCurrency)
-
-	// Set transfer details if present
-	SetTransferDetails(&t, transferToAccount, transferFromAccount, transferReference)
-
 	return &t, nil
 }
 
@@ -414,6 +661,27 @@ type TransactionQueryOptions struct {
 	MaxAmount    string
 	AbsMinAmount string // For absolute value filtering
 	AbsMaxAmount string // For absolute value filtering
+	Card         string // Card token, masked number or last 4 digits
+	Cardholder   string
+	IDs          []string
+	Merchant     string
+	Locality     string
+	State        string // State name or abbreviation
+	Country      string // Country name or ISO code
+	AwayFrom     *gazetteer.Place
+	AnyTags      []string // Tagged with at least one of these
+	AllTags      []string // Tagged with every one of these
+	ExcludeTags  []string // Tagged with none of these
+	FromDate     string   // Inclusive, as YYYY-MM-DD
+	ToDate       string   // Inclusive, as YYYY-MM-DD
+
+	ExcludeInternalTransfers bool
+	MissingAttachment        bool // No files attached, such as deductible expenses missing a receipt
+	Deductible               bool // Has a deduction category
+	ExcludeRecurring         bool // Not part of a detected recurring series
+	Foreign                  bool // Has a foreign amount
+	ForeignCurrency          string
+	TripID                   string // Spent on or booked for the trip
 }
 
 // TransactionQueryOption is a function that modifies TransactionQueryOptions
@@ -447,6 +715,141 @@ func FilterByBank(bank string) TransactionQueryOption {
 	}
 }
 
+// FilterByCard filters by card, matching the card token, masked card number or last 4 digits
+func FilterByCard(card string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Card = card
+	}
+}
+
+// FilterByCardholder filters by the cardholder assigned to the card used
+func FilterByCardholder(cardholder string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Cardholder = cardholder
+	}
+}
+
+// FilterByIDs restricts results to the given transaction IDs
+func FilterByIDs(ids ...string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.IDs = ids
+	}
+}
+
+// FilterByMerchant filters by merchant name, ignoring case
+func FilterByMerchant(merchant string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Merchant = merchant
+	}
+}
+
+// FilterByLocality filters by the resolved locality, ignoring case
+func FilterByLocality(locality string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Locality = locality
+	}
+}
+
+// FilterByState filters by the resolved state, given as a name or abbreviation
+func FilterByState(state string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.State = state
+	}
+}
+
+// FilterByCountry filters by the resolved country, given as a name or ISO code
+func FilterByCountry(country string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Country = country
+	}
+}
+
+// FilterByAwayFrom restricts results to transactions resolved to somewhere outside the home
+// country, or outside the home state when one is given, for seeing spending while travelling
+func FilterByAwayFrom(country, state string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.AwayFrom = &gazetteer.Place{Country: country, State: state}
+	}
+}
+
+// FilterByAnyTag restricts results to transactions with at least one of the tags
+func FilterByAnyTag(tags ...string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.AnyTags = tags
+	}
+}
+
+// FilterByAllTags restricts results to transactions with every one of the tags
+func FilterByAllTags(tags ...string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.AllTags = tags
+	}
+}
+
+// ExcludeTags leaves out transactions with any of the tags
+func ExcludeTags(tags ...string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.ExcludeTags = tags
+	}
+}
+
+// FilterByDateRange restricts results to transactions between from and to, inclusive.
+// A zero time leaves that end of the range open.
+func FilterByDateRange(from, to time.Time) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		if !from.IsZero() {
+			opts.FromDate = from.Format("2006-01-02")
+		}
+		if !to.IsZero() {
+			opts.ToDate = to.Format("2006-01-02")
+		}
+	}
+}
+
+// ExcludeInternalTransfers leaves out both sides of transfers between our own accounts
+func ExcludeInternalTransfers() TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.ExcludeInternalTransfers = true
+	}
+}
+
+// FilterByMissingAttachment restricts results to transactions with no files attached
+func FilterByMissingAttachment() TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.MissingAttachment = true
+	}
+}
+
+// FilterByDeductible restricts results to transactions with a deduction category
+func FilterByDeductible() TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Deductible = true
+	}
+}
+
+// ExcludeRecurring leaves out transactions in detected recurring series, such as salary and bills
+func ExcludeRecurring() TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.ExcludeRecurring = true
+	}
+}
+
+// FilterByForeignCurrency restricts results to transactions with a foreign amount, in the given
+// currency unless it's empty
+func FilterByForeignCurrency(currency string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.Foreign = true
+		opts.ForeignCurrency = strings.ToUpper(currency)
+	}
+}
+
+// FilterByTrip restricts results to the transactions spent on or booked for a trip
+func FilterByTrip(id string) TransactionQueryOption {
+	return func(opts *TransactionQueryOptions) {
+		opts.TripID = id
+	}
+}
+
 // FilterByAmount sets both minimum and maximum amount filters
 func FilterByAmount(minAmount, maxAmount string) TransactionQueryOption {
 	return func(opts *TransactionQueryOptions) {
@@ -477,32 +880,44 @@ func WithOffset(offset int) TransactionQueryOption {
 	}
 }
 
+// minorUnitsParam converts an amount filter to the minor units amounts are stored in. Amounts
+// that don't parse are passed through, and match nothing.
+func minorUnitsParam(amount string) any {
+	m, err := types.ParseMoney(amount, types.DefaultCurrency)
+	if err != nil {
+		return amount
+	}
+	return m.MinorUnits()
+}
+
 // Helper to add amount filters to where/params
 func addAmountFilters(opts TransactionQueryOptions, where []string, params []any) ([]string, []any) {
+	absMin, absMax := minorUnitsParam(opts.AbsMinAmount), minorUnitsParam(opts.AbsMaxAmount)
+	minAmount, maxAmount := minorUnitsParam(opts.MinAmount), minorUnitsParam(opts.MaxAmount)
 	if opts.AbsMinAmount != "" && opts.AbsMaxAmount != "" {
 		if opts.AbsMinAmount == opts.AbsMaxAmount {
-			where = append(where, "(t.amount = ? OR t.amount = -?)")
-			params = append(params, opts.AbsMinAmount, opts.AbsMinAmount)
+			where = append(where, "(t.amount_minor = ? OR t.amount_minor = -?)")
+			params = append(params, absMin, absMin)
 		} else {
-			where = append(where, "(t.amount >= ? OR t.amount <= -?)")
-			where = append(where, "(t.amount <= ? AND t.amount >= -?)")
-			params = append(params, opts.AbsMinAmount, opts.AbsMinAmount, opts.AbsMaxAmount, opts.AbsMaxAmount)
+			where = append(where, "(t.amount_minor >= ? OR t.amount_minor <= -?)")
+			where = append(where, "(t.amount_minor <= ? AND t.amount_minor >= -?)")
+			params = append(params, absMin, absMin, absMax, absMax)
 		}
 	} else if opts.AbsMinAmount != "" {
-		where = append(where, "(t.amount >= ? OR t.amount <= -?)")
-		params = append(params, opts.AbsMinAmount, opts.AbsMinAmount)
+		where = append(where, "(t.amount_minor >= ? OR t.amount_minor <= -?)")
+		params = append(params, absMin, absMin)
 	} else if opts.AbsMaxAmount != "" {
-		where = append(where, "(t.amount <= ? AND t.amount >= -?)")
-		params = append(params, opts.AbsMaxAmount, opts.AbsMaxAmount)
+		where = append(where, "(t.amount_minor <= ? AND t.amount_minor >= -?)")
+		params = append(params, absMax, absMax)
 	} else if opts.MinAmount != "" && opts.MaxAmount != "" {
-		where = append(where, "t.amount BETWEEN ? AND ?")
-		params = append(params, opts.MinAmount, opts.MaxAmount)
+		where = append(where, "t.amount_minor BETWEEN ? AND ?")
+		params = append(params, minAmount, maxAmount)
 	} else if opts.MinAmount != "" {
-		where = append(where, "t.amount >= ?")
-		params = append(params, opts.MinAmount)
+		where = append(where, "t.amount_minor >= ?")
+		params = append(params, minAmount)
 	} else if opts.MaxAmount != "" {
-		where = append(where, "t.amount <= ?")
-		params = append(params, opts.MaxAmount)
+		where = append(where, "t.amount_minor <= ?")
+		params = append(params, maxAmount)
 	}
 	return where, params
 }
@@ -513,15 +928,18 @@ func BuildTransactionWhereClause(opts TransactionQueryOptions, withFTS bool) ([]
 	var params []any
 	if withFTS {
 		// FTS query string should be passed as the first param by the caller
-		where = append(where, "fts.search_body MATCH ?")
+		where = append(where, "transactions_fts MATCH ?")
 	}
 	if opts.Days > 0 {
 		where = append(where, "t.date >= date('now', ? )")
 		params = append(params, fmt.Sprintf("%d days", -opts.Days))
 	}
 	if opts.Category != "" {
-		where = append(where, "t.details_category = ?")
-		params = append(params, opts.Category)
+		// Split transactions match on their splits' categories instead of their own
+		where = append(where, `CASE WHEN EXISTS (SELECT 1 FROM transaction_splits sp WHERE sp.transaction_id = t.id)
+			THEN EXISTS (SELECT 1 FROM transaction_splits sp WHERE sp.transaction_id = t.id AND sp.category = ?)
+			ELSE t.details_category = ? END`)
+		params = append(params, opts.Category, opts.Category)
 	}
 	if opts.Type != "" {
 		where = append(where, "t.type = ?")
@@ -531,6 +949,97 @@ func BuildTransactionWhereClause(opts TransactionQueryOptions, withFTS bool) ([]
 		where = append(where, "t.bank = ?")
 		params = append(params, opts.Bank)
 	}
+	if opts.Card != "" {
+		where = append(where, "(t.card_token = ? OR t.card_number = ? OR substr(t.card_number, -4) = ?)")
+		params = append(params, opts.Card, opts.Card, opts.Card)
+	}
+	if opts.Cardholder != "" {
+		where = append(where, "t.card_token IN (SELECT token FROM cards WHERE cardholder = ? COLLATE NOCASE)")
+		params = append(params, opts.Cardholder)
+	}
+	// Merchants match by their canonical name or any of their aliases
+	if opts.Merchant != "" {
+		where = append(where, `(t.merchant = ? COLLATE NOCASE
+			OR t.merchant_id IN (SELECT id FROM merchants WHERE name = ? COLLATE NOCASE)
+			OR t.merchant_id IN (SELECT merchant_id FROM merchant_aliases WHERE alias = ? COLLATE NOCASE OR alias_key = ?)
+			OR t.merchant_id IN (SELECT merchant_id FROM transactions WHERE merchant = ? COLLATE NOCASE))`)
+		params = append(params, opts.Merchant, opts.Merchant, opts.Merchant, NormalizeMerchant(opts.Merchant), opts.Merchant)
+	}
+	if opts.Locality != "" {
+		where = append(where, "t.locality = ? COLLATE NOCASE")
+		params = append(params, opts.Locality)
+	}
+	if opts.State != "" {
+		where = append(where, "t.state = ?")
+		params = append(params, stateCode(opts.State))
+	}
+	if opts.Country != "" {
+		where = append(where, "t.country = ?")
+		params = append(params, countryCode(opts.Country))
+	}
+	// Transactions without a resolved place can't be said to be away
+	if opts.AwayFrom != nil {
+		where = append(where, "t.country IS NOT NULL AND (t.country != ? OR (? != '' AND t.state IS NOT NULL AND t.state != ?))")
+		state := stateCode(opts.AwayFrom.State)
+		params = append(params, countryCode(opts.AwayFrom.Country), state, state)
+	}
+	// Tag names match ignoring case, through the tags table's collation
+	if len(opts.AnyTags) > 0 {
+		where = append(where, `t.id IN (SELECT tt.transaction_id FROM transaction_tags tt
+			JOIN tags tg ON tg.id = tt.tag_id WHERE tg.name IN (`+placeholders(len(opts.AnyTags))+`))`)
+		params = append(params, stringParams(opts.AnyTags)...)
+	}
+	if len(opts.AllTags) > 0 {
+		tags := ParseTags(strings.Join(opts.AllTags, ","))
+		where = append(where, `(SELECT COUNT(*) FROM transaction_tags tt
+			JOIN tags tg ON tg.id = tt.tag_id WHERE tt.transaction_id = t.id AND tg.name IN (`+placeholders(len(tags))+`)) = ?`)
+		params = append(params, stringParams(tags)...)
+		params = append(params, len(tags))
+	}
+	if len(opts.ExcludeTags) > 0 {
+		where = append(where, `t.id NOT IN (SELECT tt.transaction_id FROM transaction_tags tt
+			JOIN tags tg ON tg.id = tt.tag_id WHERE tg.name IN (`+placeholders(len(opts.ExcludeTags))+`))`)
+		params = append(params, stringParams(opts.ExcludeTags)...)
+	}
+	// Dates are stored with their local offset, so compare the local date part
+	if opts.FromDate != "" {
+		where = append(where, "substr(t.date, 1, 10) >= ?")
+		params = append(params, opts.FromDate)
+	}
+	if opts.ToDate != "" {
+		where = append(where, "substr(t.date, 1, 10) <= ?")
+		params = append(params, opts.ToDate)
+	}
+	if opts.ExcludeInternalTransfers {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM transaction_links l
+			WHERE l.kind = 'transfer' AND l.source != 'rejected' AND (l.transaction_id = t.id OR l.linked_id = t.id))`)
+	}
+	if opts.MissingAttachment {
+		where = append(where, `NOT EXISTS (SELECT 1 FROM attachments a WHERE a.transaction_id = t.id)`)
+	}
+	if opts.Deductible {
+		where = append(where, "COALESCE(t.deduction, '') != ''")
+	}
+	if opts.ExcludeRecurring {
+		where = append(where, "t.recurring_series_id IS NULL")
+	}
+	if opts.Foreign {
+		where = append(where, "t.foreign_amount_minor IS NOT NULL AND t.foreign_currency IS NOT NULL")
+	}
+	if opts.ForeignCurrency != "" {
+		where = append(where, "t.foreign_currency = ?")
+		params = append(params, opts.ForeignCurrency)
+	}
+	if opts.TripID != "" {
+		where = append(where, "t.id IN (SELECT transaction_id FROM trip_transactions WHERE trip_id = ?)")
+		params = append(params, opts.TripID)
+	}
+	if opts.IDs != nil {
+		where = append(where, "t.id IN ("+placeholders(len(opts.IDs))+")")
+		for _, id := range opts.IDs {
+			params = append(params, id)
+		}
+	}
 	where, params = addAmountFilters(opts, where, params)
 	return where, params
 }
@@ -544,12 +1053,7 @@ func (d *DB) GetTransactions(ctx context.Context, options ...TransactionQueryOpt
 		opt(&opts)
 	}
 
-	query := `
-		SELECT t.date, t.amount, t.payee, t.bank,
-			t.type, t.merchant, t.location, t.details_category, t.description, t.card_number,
-			t.search_body,
-			t.foreign_amount, t.foreign_currency,
-			t.transfer_to_account, t.transfer_from_account, t.transfer_reference
+	query := `SELECT ` + transactionColumns + `
 		FROM transactions t
 	`
 	where, params := BuildTransactionWhereClause(opts, false)
@@ -583,6 +1087,46 @@ func (d *DB) GetTransactions(ctx context.Context, options ...TransactionQueryOpt
 	return transactions, nil
 }
 
+// GetTransactionIDs returns the IDs of transactions matching the given filters
+func (d *DB) GetTransactionIDs(ctx context.Context, options ...TransactionQueryOption) ([]string, error) {
+	opts := TransactionQueryOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	query := `SELECT t.id FROM transactions t`
+	where, params := BuildTransactionWhereClause(opts, false)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY t.date DESC"
+	if opts.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", opts.Limit)
+		if opts.Offset > 0 {
+			query += fmt.Sprintf(" OFFSET %d", opts.Offset)
+		}
+	}
+
+	rows, err := d.db.QueryContext(ctx, query, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transaction ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transaction ids: %w", err)
+	}
+	return ids, nil
+}
+
 // SearchTransactionsByText performs a full-text search on transactions using a query and TransactionQueryOptions
 func (d *DB) SearchTransactionsByText(ctx context.Context, query string, orderBy string, opts ...TransactionQueryOption) ([]types.TransactionSearchResult, int, error) {
 	options := TransactionQueryOptions{}
@@ -613,11 +1157,7 @@ func (d *DB) SearchTransactionsByText(ctx context.Context, query string, orderBy
 		orderClause = "ORDER BY t.date DESC"
 	}
 	searchQuery := `
-		SELECT
-			t.date, t.amount, t.payee, t.bank,
-			t.type, t.merchant, t.location, t.details_category, t.description, t.card_number,
-			t.foreign_amount, t.foreign_currency,
-			t.transfer_to_account, t.transfer_from_account, t.transfer_reference,
+		SELECT ` + transactionColumns + `,
 			bm25(transactions_fts) as text_score
 		FROM transactions t
 		JOIN transactions_fts fts ON t.rowid = fts.rowid
@@ -633,27 +1173,9 @@ func (d *DB) SearchTransactionsByText(ctx context.Context, query string, orderBy
 	for rows.Next() {
 		var t types.TransactionWithDetails
 		var textScore float64
-		var date time.Time
-		var amount decimal.Decimal
-		var foreignAmount sql.NullFloat64
-		var foreignCurrency sql.NullString
-		var transferToAccount sql.NullString
-		var transferFromAccount sql.NullString
-		var transferReference sql.NullString
-		if err := rows.Scan(
-			&date, &amount, &t.Payee, &t.Bank,
-			&t.Details.Type, &t.Details.Merchant, &t.Details.Location, &t.Details.Category, &t.Details.Description, &t.Details.CardNumber,
-			&foreignAmount, &foreignCurrency,
-			&transferToAccount, &transferFromAccount, &transferReference,
-			&textScore,
-		); err != nil {
-			return nil, 0, fmt.Errorf("failed to scan transaction: %w", err)
+		if err := scanTransactionRow(rows, &t, &textScore); err != nil {
+			return nil, 0, err
 		}
-		// Format date and amount as strings
-		t.Date = date.Format("02/01/2006")
-		t.Amount = amount.String()
-		SetForeignAmount(&t, foreignAmount, foreignCurrency)
-		SetTransferDetails(&t, transferToAccount, transferFromAccount, transferReference)
 		result := types.TransactionSearchResult{
 			TransactionWithDetails: t,
 			Scores: types.SearchScore{
@@ -718,6 +1240,53 @@ func (d *DB) GetCategories(ctx context.Context, days int) ([]CategoryCount, erro
 	return categories, nil
 }
 
+// MerchantClassification is how previous transactions from a merchant were classified
+type MerchantClassification struct {
+	Merchant string `json:"merchant"`
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Count    int    `json:"count"`
+}
+
+// GetMerchantClassifications returns the most common classifications of previous
+// transactions whose merchant or canonical merchant matches name, ignoring case.
+// Merchants are reported by their canonical name.
+func (d *DB) GetMerchantClassifications(ctx context.Context, name string, limit int) ([]MerchantClassification, error) {
+	pattern := "%" + escapeLike(name) + "%"
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT `+canonicalMerchant+` AS canonical, t.type, COALESCE(t.details_category, ''), COUNT(*) as count
+		FROM transactions t
+		WHERE t.merchant LIKE ? ESCAPE '\'
+			OR t.merchant_id IN (SELECT id FROM merchants WHERE name LIKE ? ESCAPE '\')
+		GROUP BY canonical, t.type, t.details_category
+		ORDER BY count DESC, canonical ASC
+		LIMIT ?
+	`, pattern, pattern, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merchant classifications: %w", err)
+	}
+	defer rows.Close()
+
+	var classifications []MerchantClassification
+	for rows.Next() {
+		var c MerchantClassification
+		if err := rows.Scan(&c.Merchant, &c.Type, &c.Category, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan merchant classification: %w", err)
+		}
+		classifications = append(classifications, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating merchant classifications: %w", err)
+	}
+
+	return classifications, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s, for use with ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
 // GetCategoriesWithBank returns all unique categories and their counts from the last N days, optionally filtered by bank
 func (d *DB) GetCategoriesWithBank(ctx context.Context, days int, bank string) ([]CategoryCount, error) {
 	if bank == "" {
@@ -756,31 +1325,120 @@ func (d *DB) GetCategoriesWithBank(ctx context.Context, days int, bank string) (
 	return categories, nil
 }
 
-// scanTransactionRow scans a transaction row into a TransactionWithDetails struct
-func scanTransactionRow(rows *sql.Rows, t *types.TransactionWithDetails) error {
+// transactionColumns are the columns selected for a transaction, in the order read by scanTransactionRow
+const transactionColumns = `
+	t.id, t.date, t.amount_minor, t.currency, t.payee, t.bank,
+	t.type, ` + canonicalMerchant + `, t.location, t.details_category, t.description, t.card_number,
+	t.search_body,
+	t.foreign_amount_minor, t.foreign_currency,
+	t.transfer_to_account, t.transfer_from_account, t.transfer_reference,
+	t.card_token, (SELECT c.cardholder FROM cards c WHERE c.token = t.card_token),
+	t.model, t.recurring_series_id,
+	(SELECT CASE WHEN l.transaction_id = t.id THEN l.linked_id ELSE l.transaction_id END
+		FROM transaction_links l
+		WHERE l.kind = 'transfer' AND l.source != 'rejected' AND (l.transaction_id = t.id OR l.linked_id = t.id)),
+	(SELECT l.linked_id FROM transaction_links l
+		WHERE l.kind = 'refund' AND l.source != 'rejected' AND l.transaction_id = t.id),
+	(SELECT SUM(r.amount_minor) FROM transaction_links l JOIN transactions r ON r.id = l.transaction_id
+		WHERE l.kind = 'refund' AND l.source != 'rejected' AND l.linked_id = t.id),
+	` + splitsColumn + `,
+	t.merchant_id,
+	COALESCE(t.locality, ''), COALESCE(t.state, ''), COALESCE(t.postcode, ''), COALESCE(t.country, ''),
+	` + tagsColumn + `,
+	t.notes, (SELECT COUNT(*) FROM attachments a WHERE a.transaction_id = t.id),
+	COALESCE(t.deduction, ''),
+	(SELECT l.linked_id FROM transaction_links l
+		WHERE l.kind = 'fx_fee' AND l.source != 'rejected' AND l.transaction_id = t.id),
+	(SELECT SUM(ABS(f.amount_minor)) FROM transaction_links l JOIN transactions f ON f.id = l.transaction_id
+		WHERE l.kind = 'fx_fee' AND l.source != 'rejected' AND l.linked_id = t.id),
+	(SELECT tt.trip_id FROM trip_transactions tt WHERE tt.transaction_id = t.id)`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTransactionRow scans a row selected with transactionColumns into a TransactionWithDetails struct.
+// Any extra destinations are scanned from the columns that follow transactionColumns.
+func scanTransactionRow(row rowScanner, t *types.TransactionWithDetails, extra ...any) error {
 	var date time.Time
-	var amount decimal.Decimal
-	var searchBody string
-	var foreignAmount sql.NullFloat64
+	var amount int64
+	var currency string
+	var searchBody sql.NullString
+	var foreignAmount sql.NullInt64
 	var foreignCurrency sql.NullString
 	var transferToAccount sql.NullString
 	var transferFromAccount sql.NullString
 	var transferReference sql.NullString
-
-	if err := rows.Scan(
-		&date, &amount, &t.Payee, &t.Bank,
+	var cardToken sql.NullString
+	var cardholder sql.NullString
+	var model sql.NullString
+	var recurringSeriesID sql.NullString
+	var transferMatchID sql.NullString
+	var refundOfID sql.NullString
+	var refundedAmount sql.NullInt64
+	var splits sql.NullString
+	var merchantID sql.NullInt64
+	var tags sql.NullString
+	var notes sql.NullString
+	var fxFeeOfID sql.NullString
+	var fxFee sql.NullInt64
+	var tripID sql.NullString
+
+	dest := []any{
+		&t.ID, &date, &amount, &currency, &t.Payee, &t.Bank,
 		&t.Details.Type, &t.Details.Merchant, &t.Details.Location, &t.Details.Category, &t.Details.Description, &t.Details.CardNumber,
 		&searchBody,
 		&foreignAmount, &foreignCurrency,
 		&transferToAccount, &transferFromAccount, &transferReference,
-	); err != nil {
+		&cardToken, &cardholder,
+		&model, &recurringSeriesID, &transferMatchID,
+		&refundOfID, &refundedAmount, &splits, &merchantID,
+		&t.Details.Place.Locality, &t.Details.Place.State, &t.Details.Place.Postcode, &t.Details.Place.Country,
+		&tags, &notes, &t.Details.AttachmentCount,
+		&t.Details.Deduction,
+		&fxFeeOfID, &fxFee,
+		&tripID,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
 		return fmt.Errorf("failed to scan transaction: %w", err)
 	}
 
-	// Format date and amount as strings
+	// Format the date as it's written in bank exports
 	t.Date = date.Format("02/01/2006")
-	t.Amount = amount.String()
-	t.Details.SearchBody = searchBody
+	t.Amount = types.MoneyFromMinorUnits(amount, currency)
+	t.Details.SearchBody = searchBody.String
+	t.Details.CardToken = cardToken.String
+	t.Details.Cardholder = cardholder.String
+	t.Details.Model = model.String
+	t.Details.RecurringSeriesID = recurringSeriesID.String
+	t.Details.TransferMatchID = transferMatchID.String
+	t.Details.RefundOfID = refundOfID.String
+	t.Details.MerchantID = merchantID.Int64
+	t.Details.Notes = notes.String
+	if refundedAmount.Valid {
+		t.Details.RefundedAmount = types.MoneyFromMinorUnits(refundedAmount.Int64, currency).Amount
+	}
+	t.Details.FXFeeOfID = fxFeeOfID.String
+	t.Details.TripID = tripID.String
+	if fxFee.Valid {
+		t.Details.FXFee = types.MoneyFromMinorUnits(fxFee.Int64, currency).Amount
+	}
+	var err error
+	if t.Details.Tags, err = decodeTags(tags); err != nil {
+		return err
+	}
+	if splits.Valid && splits.String != "[]" {
+		if err := json.Unmarshal([]byte(splits.String), &t.Splits); err != nil {
+			return fmt.Errorf("failed to decode splits: %w", err)
+		}
+		for i := range t.Splits {
+			t.Splits[i].Amount = types.MoneyFromMinorUnits(t.Splits[i].Amount.IntPart(), currency).Amount
+		}
+	}
 
 	// Set foreign amount if present
 	SetForeignAmount(t, foreignAmount, foreignCurrency)
@@ -792,12 +1450,10 @@ func scanTransactionRow(rows *sql.Rows, t *types.TransactionWithDetails) error {
 }
 
 // SetForeignAmount sets the foreign amount details on a transaction if present
-func SetForeignAmount(t *types.TransactionWithDetails, amount sql.NullFloat64, currency sql.NullString) {
+func SetForeignAmount(t *types.TransactionWithDetails, amount sql.NullInt64, currency sql.NullString) {
 	if amount.Valid && currency.Valid {
-		t.Details.ForeignAmount = &types.ForeignAmountDetails{
-			Amount:   decimal.NewFromFloat(amount.Float64),
-			Currency: currency.String,
-		}
+		foreign := types.MoneyFromMinorUnits(amount.Int64, currency.String)
+		t.Details.ForeignAmount = &foreign
 	}
 }
 
@@ -826,14 +1482,23 @@ func (d *DB) CountTransactions(ctx context.Context, days int) (int, error) {
 	return count, nil
 }
 
-// UpdateTransaction updates merchant, type, details_category, and tags for a transaction by ID
+// UpdateTransaction updates merchant, type and details_category for a transaction by ID, and adds
+// the comma-separated tags to it
 func (d *DB) UpdateTransaction(ctx context.Context, id string, merchant, txType, category, tags *string) error {
 	query := "UPDATE transactions SET "
 	params := []interface{}{}
 	set := []string{}
 	if merchant != nil {
-		set = append(set, "merchant = ?")
-		params = append(params, *merchant)
+		var location string
+		if err := d.db.QueryRowContext(ctx, `SELECT COALESCE(location, '') FROM transactions WHERE id = ?`, id).Scan(&location); err != nil {
+			return fmt.Errorf("failed to get transaction %s: %w", id, err)
+		}
+		merchantID, _, err := d.resolveMerchant(ctx, *merchant, location)
+		if err != nil {
+			return err
+		}
+		set = append(set, "merchant = ?", "merchant_id = ?")
+		params = append(params, *merchant, sql.NullInt64{Int64: merchantID, Valid: merchantID != 0})
 	}
 	if txType != nil {
 		set = append(set, "type = ?")
@@ -843,18 +1508,18 @@ func (d *DB) UpdateTransaction(ctx context.Context, id string, merchant, txType,
 		set = append(set, "details_category = ?")
 		params = append(params, *category)
 	}
-	if tags != nil {
-		set = append(set, "tags = ?")
-		params = append(params, *tags)
-	}
-	if len(set) == 0 {
+	if len(set) == 0 && tags == nil {
 		return fmt.Errorf("no fields to update")
 	}
-	query += strings.Join(set, ", ") + " WHERE id = ?"
-	params = append(params, id)
-	_, err := d.db.ExecContext(ctx, query, params...)
-	if err != nil {
-		return fmt.Errorf("failed to update transaction: %w", err)
+	if len(set) > 0 {
+		query += strings.Join(set, ", ") + " WHERE id = ?"
+		params = append(params, id)
+		if _, err := d.db.ExecContext(ctx, query, params...); err != nil {
+			return fmt.Errorf("failed to update transaction: %w", err)
+		}
+	}
+	if tags != nil {
+		return d.AddTags(ctx, id, ParseTags(*tags)...)
 	}
 	return nil
 }
@@ -865,12 +1530,7 @@ type TransactionIterator struct {
 }
 
 func (d *DB) IterateTransactions(ctx context.Context) *TransactionIterator {
-	query := `
-		SELECT t.date, t.amount, t.payee, t.bank,
-			t.type, t.merchant, t.location, t.details_category, t.description, t.card_number,
-			t.search_body,
-			t.foreign_amount, t.foreign_currency,
-			t.transfer_to_account, t.transfer_from_account, t.transfer_reference
+	query := `SELECT ` + transactionColumns + `
 		FROM transactions t
 		ORDER BY t.date DESC
 	`
@@ -10,6 +10,7 @@ import (
 
 	"github.com/charmbracelet/log"
 	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
 )
 
 func setupTestDB(t *testing.T) (*DB, func()) {
@@ -42,6 +43,48 @@ func setupTestDB(t *testing.T) (*DB, func()) {
 	}
 }
 
+// money parses a test transaction amount in the default currency
+func money(amount string) types.Money {
+	return types.MustParseMoney(amount, types.DefaultCurrency)
+}
+
+// testTransaction builds a transaction for tests of the functions that match and detect patterns
+// in transactions passed to them. The payee is the merchant followed by the date and the bank is
+// ing, unless options change them.
+func testTransaction(id, date, amount, txType, merchant string, opts ...func(*types.TransactionWithDetails)) types.TransactionWithDetails {
+	t := types.TransactionWithDetails{
+		ID:          id,
+		Transaction: types.Transaction{Date: date, Amount: money(amount), Payee: merchant + " " + date, Bank: "ing"},
+		Details:     types.TransactionDetails{Type: txType, Merchant: merchant},
+	}
+	for _, opt := range opts {
+		opt(&t)
+	}
+	return t
+}
+
+// onBank sets the bank a test transaction was made at
+func onBank(bank string) func(*types.TransactionWithDetails) {
+	return func(t *types.TransactionWithDetails) { t.Bank = bank }
+}
+
+// inCountry sets the country a test transaction was made in
+func inCountry(country string) func(*types.TransactionWithDetails) {
+	return func(t *types.TransactionWithDetails) { t.Details.Place.Country = country }
+}
+
+// withTransfer sets the transfer details of a test transaction
+func withTransfer(transfer *types.TransferDetails) func(*types.TransactionWithDetails) {
+	return func(t *types.TransactionWithDetails) { t.Details.TransferDetails = transfer }
+}
+
+// withForeignAmount sets the foreign amount a test transaction was converted from
+func withForeignAmount(amount, currency string) func(*types.TransactionWithDetails) {
+	return func(t *types.TransactionWithDetails) {
+		t.Details.ForeignAmount = &types.ForeignAmountDetails{Amount: decimal.RequireFromString(amount), Currency: currency}
+	}
+}
+
 func TestStoreAndGetTransaction(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
@@ -51,7 +94,7 @@ func TestStoreAndGetTransaction(t *testing.T) {
 	// Create a test transaction
 	transaction := types.Transaction{
 		Date:   "01/01/2023",
-		Amount: "100.00",
+		Amount: money("100.00"),
 		Payee:  "Test Payee",
 		Bank:   "Test Bank",
 	}
@@ -62,8 +105,9 @@ func TestStoreAndGetTransaction(t *testing.T) {
 		Location:    "Test Location",
 		Category:    "Test Category",
 		Description: "Test Description",
-		CardNumber:  "1234",
+		CardNumber:  "1234...5678",
 		SearchBody:  "Test Merchant Test Location Test Description",
+		Model:       "test/model",
 	}
 
 	// Store transaction
@@ -94,8 +138,14 @@ func TestStoreAndGetTransaction(t *testing.T) {
 	if retrievedDetails.Description != details.Description {
 		t.Errorf("expected description %s, got %s", details.Description, retrievedDetails.Description)
 	}
-	if retrievedDetails.CardNumber != details.CardNumber {
-		t.Errorf("expected card number %s, got %s", details.CardNumber, retrievedDetails.CardNumber)
+	if retrievedDetails.CardNumber != "...5678" {
+		t.Errorf("expected masked card number ...5678, got %s", retrievedDetails.CardNumber)
+	}
+	if retrievedDetails.CardToken != db.CardToken(details.CardNumber) {
+		t.Errorf("expected card token %s, got %s", db.CardToken(details.CardNumber), retrievedDetails.CardToken)
+	}
+	if retrievedDetails.Model != details.Model {
+		t.Errorf("expected model %s, got %s", details.Model, retrievedDetails.Model)
 	}
 }
 
@@ -108,7 +158,7 @@ func TestSearchTransactions(t *testing.T) {
 	// Create a test transaction with today's date
 	transaction := types.Transaction{
 		Date:   time.Now().Format("02/01/2006"),
-		Amount: "100.00",
+		Amount: money("100.00"),
 		Payee:  "Coffee Shop",
 		Bank:   "Test Bank",
 	}
@@ -158,7 +208,7 @@ func TestHasTransaction(t *testing.T) {
 	// Create a test transaction
 	transaction := types.Transaction{
 		Date:   "01/01/2023",
-		Amount: "100.00",
+		Amount: money("100.00"),
 		Payee:  "Test Store",
 		Bank:   "Test Bank",
 	}
@@ -201,13 +251,13 @@ func TestTransactionIDConsistency(t *testing.T) {
 	// Create two identical transactions
 	t1 := types.Transaction{
 		Date:   "01/01/2023",
-		Amount: "100.00",
+		Amount: money("100.00"),
 		Payee:  "Test Store",
 		Bank:   "Test Bank",
 	}
 	t2 := types.Transaction{
 		Date:   "01/01/2023",
-		Amount: "100.00",
+		Amount: money("100.00"),
 		Payee:  "Test Store",
 		Bank:   "Test Bank",
 	}
@@ -224,7 +274,7 @@ func TestTransactionIDConsistency(t *testing.T) {
 	// Create a slightly different transaction
 	t3 := types.Transaction{
 		Date:   "01/01/2023",
-		Amount: "100.00",
+		Amount: money("100.00"),
 		Payee:  "Test Store",
 		Bank:   "Different Bank", // Only difference is the bank
 	}
@@ -248,19 +298,19 @@ func TestFilterExistingTransactions(t *testing.T) {
 	transactions := []types.Transaction{
 		{
 			Date:   "01/01/2023",
-			Amount: "100.00",
+			Amount: money("100.00"),
 			Payee:  "Test Store 1",
 			Bank:   "Test Bank",
 		},
 		{
 			Date:   "02/01/2023",
-			Amount: "200.00",
+			Amount: money("200.00"),
 			Payee:  "Test Store 2",
 			Bank:   "Test Bank",
 		},
 		{
 			Date:   "03/01/2023",
-			Amount: "300.00",
+			Amount: money("300.00"),
 			Payee:  "Test Store 3",
 			Bank:   "Test Bank",
 		},
@@ -309,7 +359,7 @@ func TestGetTransactionsWithPagination(t *testing.T) {
 		date := time.Now().AddDate(0, 0, -i)
 		transaction := types.Transaction{
 			Date:   date.Format("02/01/2006"),
-			Amount: fmt.Sprintf("%d.00", 100+i), // Different amounts to verify ordering
+			Amount: money(fmt.Sprintf("%d.00", 100+i)), // Different amounts to verify ordering
 			Payee:  fmt.Sprintf("Test Store %d", i),
 			Bank:   "Test Bank",
 		}
@@ -427,7 +477,7 @@ func TestFilterByAbsoluteAmount(t *testing.T) {
 		date := time.Now().Format("02/01/2006")
 		transaction := types.Transaction{
 			Date:   date,
-			Amount: tt.amount,
+			Amount: money(tt.amount),
 			Payee:  tt.payee,
 			Bank:   "Test Bank",
 		}
@@ -455,7 +505,7 @@ func TestFilterByAbsoluteAmount(t *testing.T) {
 	}
 
 	// Directly query the database to see how amounts are stored
-	rows, err := db.db.QueryContext(ctx, "SELECT payee, amount, typeof(amount) FROM transactions")
+	rows, err := db.db.QueryContext(ctx, "SELECT payee, amount_minor, typeof(amount_minor) FROM transactions")
 	if err != nil {
 		t.Fatalf("Failed to query transactions: %v", err)
 	}
@@ -468,6 +518,9 @@ func TestFilterByAbsoluteAmount(t *testing.T) {
 			t.Fatalf("Failed to scan row: %v", err)
 		}
 		t.Logf("Payee: %s, Amount: %s, Type: %s", payee, amount, typeofAmount)
+		if typeofAmount != "integer" {
+			t.Errorf("expected %s to be stored as whole cents, got %s %s", payee, typeofAmount, amount)
+		}
 	}
 
 	// Test absolute value filtering
@@ -522,3 +575,120 @@ func TestFilterByAbsoluteAmount(t *testing.T) {
 		})
 	}
 }
+
+func TestFilterByCardholder(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	date := time.Now().Format("02/01/2006")
+
+	cards := []struct {
+		payee string
+		card  string
+	}{
+		{"Woolworths", "3712 345678 91005"},
+		{"Coles", "3712 345678 92004"},
+		{"Bunnings", "3712 345678 92004"},
+	}
+	for _, c := range cards {
+		transaction := types.Transaction{Date: date, Amount: money("-10.00"), Payee: c.payee, Bank: "amex"}
+		details := &types.TransactionDetails{
+			Type:       "purchase",
+			Merchant:   c.payee,
+			Category:   "Groceries",
+			CardNumber: c.card,
+			SearchBody: c.payee,
+		}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	// The raw card number must never be stored
+	var plaintext int
+	if err := db.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM transactions WHERE card_number LIKE '3712%'").Scan(&plaintext); err != nil {
+		t.Fatalf("failed to query card numbers: %v", err)
+	}
+	if plaintext != 0 {
+		t.Errorf("expected no plaintext card numbers, found %d", plaintext)
+	}
+
+	allCards, err := db.GetCards(ctx)
+	if err != nil {
+		t.Fatalf("failed to get cards: %v", err)
+	}
+	if len(allCards) != 2 {
+		t.Fatalf("expected 2 cards, got %d", len(allCards))
+	}
+
+	sam := "Sam"
+	if err := db.UpdateCard(ctx, "2004", &sam, nil, nil); err != nil {
+		t.Fatalf("failed to update card: %v", err)
+	}
+
+	transactions, err := db.GetTransactions(ctx, FilterByCardholder("sam"))
+	if err != nil {
+		t.Fatalf("failed to get transactions: %v", err)
+	}
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 transactions for Sam, got %d", len(transactions))
+	}
+	for _, tx := range transactions {
+		if tx.Details.Cardholder != "Sam" {
+			t.Errorf("expected cardholder Sam, got %q", tx.Details.Cardholder)
+		}
+	}
+
+	transactions, err = db.GetTransactions(ctx, FilterByCard("1005"))
+	if err != nil {
+		t.Fatalf("failed to get transactions: %v", err)
+	}
+	if len(transactions) != 1 || transactions[0].Payee != "Woolworths" {
+		t.Errorf("expected only the Woolworths transaction for card 1005, got %d", len(transactions))
+	}
+}
+
+func TestGetMerchantClassifications(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	date := time.Now().Format("02/01/2006")
+
+	stored := []struct {
+		payee, merchant, category string
+	}{
+		{"WOOLWORTHS 1234", "Woolworths", "Groceries"},
+		{"WOOLWORTHS 5678", "Woolworths", "Groceries"},
+		{"WOOLWORTHS METRO", "Woolworths Metro", "Groceries"},
+		{"100%_FOODS", "100%_Foods", "Food & Dining"},
+	}
+	for _, s := range stored {
+		transaction := types.Transaction{Date: date, Amount: money("-10.00"), Payee: s.payee, Bank: "ing"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: s.merchant, Category: s.category, SearchBody: s.merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	classifications, err := db.GetMerchantClassifications(ctx, "woolworths", 5)
+	if err != nil {
+		t.Fatalf("failed to get merchant classifications: %v", err)
+	}
+	if len(classifications) != 2 {
+		t.Fatalf("expected 2 classifications, got %d", len(classifications))
+	}
+	if classifications[0].Merchant != "Woolworths" || classifications[0].Count != 2 {
+		t.Errorf("expected Woolworths with 2 transactions first, got %+v", classifications[0])
+	}
+
+	// LIKE wildcards in the name are matched literally
+	classifications, err = db.GetMerchantClassifications(ctx, "0%_F", 5)
+	if err != nil {
+		t.Fatalf("failed to get merchant classifications: %v", err)
+	}
+	if len(classifications) != 1 || classifications[0].Merchant != "100%_Foods" {
+		t.Errorf("expected only 100%%_Foods, got %+v", classifications)
+	}
+}
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Forecast defaults
+const (
+	DefaultForecastDays     = 90
+	DefaultForecastLookback = 90
+)
+
+// ForecastOptions sets what a cash flow forecast starts from and how far it looks
+type ForecastOptions struct {
+	// Balance is the balance now, which isn't in bank exports so has to be given
+	Balance decimal.Decimal
+	// Days is how many days ahead to forecast, DefaultForecastDays when zero
+	Days int
+	// LowBalance flags days that end with less than this
+	LowBalance decimal.Decimal
+	// LookbackDays is how many days of spending the discretionary average is taken over,
+	// DefaultForecastLookback when zero
+	LookbackDays int
+	// Bank limits the forecast to one bank's transactions and recurring series, when set
+	Bank string
+}
+
+// ForecastPayment is a payment or deposit from a recurring series expected on a day
+type ForecastPayment struct {
+	SeriesID string          `json:"series_id"`
+	Merchant string          `json:"merchant"`
+	Cadence  string          `json:"cadence"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+// String summarises a forecast payment, such as "Netflix -22.99 (monthly)"
+func (p ForecastPayment) String() string {
+	return fmt.Sprintf("%s %s (%s)", p.Merchant, p.Amount.StringFixed(2), p.Cadence)
+}
+
+// ForecastDay is what's expected to come in and go out on a day, and the balance at its end
+type ForecastDay struct {
+	Date   time.Time       `json:"date"`
+	Income decimal.Decimal `json:"income"`
+	// Bills and Discretionary are what's expected to go out, as positive amounts
+	Bills         decimal.Decimal   `json:"bills"`
+	Discretionary decimal.Decimal   `json:"discretionary"`
+	Balance       decimal.Decimal   `json:"balance"`
+	Low           bool              `json:"low,omitempty"`
+	Payments      []ForecastPayment `json:"payments,omitempty"`
+}
+
+// CashFlowForecast projects the balance day by day from recurring series and average spending
+type CashFlowForecast struct {
+	Start          time.Time       `json:"start"`
+	End            time.Time       `json:"end"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	LowBalance     decimal.Decimal `json:"low_balance"`
+	LookbackDays   int             `json:"lookback_days"`
+	// Discretionary is the spending outside recurring series over the lookback period by
+	// category, which is spread evenly over the forecast as DailyDiscretionary
+	Discretionary      []SpendingTotal `json:"discretionary"`
+	DailyDiscretionary decimal.Decimal `json:"daily_discretionary"`
+	Days               []ForecastDay   `json:"days"`
+}
+
+// LowBalanceDays returns the days expected to end below the low balance
+func (f CashFlowForecast) LowBalanceDays() []ForecastDay {
+	var low []ForecastDay
+	for _, day := range f.Days {
+		if day.Low {
+			low = append(low, day)
+		}
+	}
+	return low
+}
+
+// Lowest returns the day with the lowest expected balance, the earliest if several tie
+func (f CashFlowForecast) Lowest() ForecastDay {
+	var lowest ForecastDay
+	for i, day := range f.Days {
+		if i == 0 || day.Balance.LessThan(lowest.Balance) {
+			lowest = day
+		}
+	}
+	return lowest
+}
+
+// BalanceAfter returns the balance expected after the given number of days, if the forecast
+// goes that far
+func (f CashFlowForecast) BalanceAfter(days int) (decimal.Decimal, bool) {
+	if days < 1 || days > len(f.Days) {
+		return decimal.Zero, false
+	}
+	return f.Days[days-1].Balance, true
+}
+
+// ForecastCashFlow projects the balance for each day after now. Active recurring series, such as
+// salary, rent and subscriptions, are expected on their next dates and every cadence after, with
+// overdue payments expected on the first day. Other spending is averaged over the lookback period
+// by category and spent evenly each day. Transfers between your own accounts are left out.
+func (d *DB) ForecastCashFlow(ctx context.Context, now time.Time, opts ForecastOptions) (*CashFlowForecast, error) {
+	if opts.Days <= 0 {
+		opts.Days = DefaultForecastDays
+	}
+	if opts.LookbackDays <= 0 {
+		opts.LookbackDays = DefaultForecastLookback
+	}
+	now = now.In(d.timezone)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	f := &CashFlowForecast{
+		Start:          today.AddDate(0, 0, 1),
+		End:            today.AddDate(0, 0, opts.Days),
+		OpeningBalance: opts.Balance,
+		LowBalance:     opts.LowBalance,
+		LookbackDays:   opts.LookbackDays,
+	}
+
+	// Spending outside recurring series, net of refunds, by category
+	aggregateOpts := []TransactionQueryOption{
+		FilterByDateRange(today.AddDate(0, 0, 1-opts.LookbackDays), today),
+		ExcludeInternalTransfers(),
+		ExcludeRecurring(),
+	}
+	if opts.Bank != "" {
+		aggregateOpts = append(aggregateOpts, FilterByBank(opts.Bank))
+	}
+	byCategory, err := d.Aggregate(ctx, GroupByCategory, aggregateOpts...)
+	if err != nil {
+		return nil, err
+	}
+	spent := decimal.Zero
+	for _, row := range byCategory {
+		if row.Total.IsNegative() {
+			f.Discretionary = append(f.Discretionary, SpendingTotal{Name: row.Key, Count: row.Count, Amount: row.Total.Neg()})
+			spent = spent.Add(row.Total.Neg())
+		}
+	}
+	f.Discretionary = topSpending(f.Discretionary, 0)
+	f.DailyDiscretionary = spent.Div(decimal.NewFromInt(int64(opts.LookbackDays))).Round(2)
+
+	series, err := d.GetRecurringSeries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	payments := make(map[string][]ForecastPayment)
+	for _, s := range series {
+		if s.Stopped(now) || (opts.Bank != "" && s.Bank != opts.Bank) {
+			continue
+		}
+		c, ok := cadenceByName(s.Cadence)
+		if !ok {
+			continue
+		}
+		for date := s.NextDate; !date.After(f.End); date = c.next(date) {
+			day := date
+			if day.Before(f.Start) {
+				day = f.Start
+			}
+			key := day.Format("2006-01-02")
+			payments[key] = append(payments[key], ForecastPayment{SeriesID: s.ID, Merchant: s.Merchant, Cadence: s.Cadence, Amount: s.Amount})
+		}
+	}
+
+	balance := opts.Balance
+	for date := f.Start; !date.After(f.End); date = date.AddDate(0, 0, 1) {
+		day := ForecastDay{Date: date, Discretionary: f.DailyDiscretionary, Payments: payments[date.Format("2006-01-02")]}
+		sort.SliceStable(day.Payments, func(i, j int) bool { return day.Payments[i].Amount.GreaterThan(day.Payments[j].Amount) })
+		for _, p := range day.Payments {
+			if p.Amount.IsPositive() {
+				day.Income = day.Income.Add(p.Amount)
+			} else {
+				day.Bills = day.Bills.Sub(p.Amount)
+			}
+		}
+		balance = balance.Add(day.Income).Sub(day.Bills).Sub(day.Discretionary)
+		day.Balance = balance
+		day.Low = balance.LessThan(opts.LowBalance)
+		f.Days = append(f.Days, day)
+	}
+
+	d.logger.Debug("Forecast cash flow", "days", len(f.Days), "series", len(series), "daily_discretionary", f.DailyDiscretionary)
+	return f, nil
+}
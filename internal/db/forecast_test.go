@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestForecastCashFlow(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	store := func(date, amount, txType, merchant, category string) {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant + " " + date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: txType, Merchant: merchant, Category: category, SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+	for _, month := range []string{"01", "02", "03", "04"} {
+		store("15/"+month+"/2024", "3000.00", "deposit", "Employer", "Income")
+		store("01/"+month+"/2024", "-2000.00", "purchase", "Real Estate Agent", "Home")
+	}
+	// Spending outside recurring series averages 10.00 a day over the last 30 days
+	store("05/04/2024", "-90.00", "purchase", "Woolworths", "Groceries")
+	store("09/04/2024", "-110.00", "purchase", "Woolworths", "Groceries")
+	store("19/04/2024", "-100.00", "purchase", "Coles", "Groceries")
+	store("01/01/2024", "-500.00", "purchase", "Myer", "Shopping") // Before the lookback
+	if _, err := db.RefreshRecurringSeries(ctx); err != nil {
+		t.Fatalf("failed to refresh recurring series: %v", err)
+	}
+
+	now := time.Date(2024, 4, 20, 12, 0, 0, 0, time.UTC)
+	f, err := db.ForecastCashFlow(ctx, now, ForecastOptions{
+		Balance:      decimal.NewFromInt(1000),
+		Days:         30,
+		LowBalance:   decimal.NewFromInt(500),
+		LookbackDays: 30,
+	})
+	if err != nil {
+		t.Fatalf("failed to forecast cash flow: %v", err)
+	}
+
+	if len(f.Days) != 30 || f.Start.Format("2006-01-02") != "2024-04-21" || f.End.Format("2006-01-02") != "2024-05-20" {
+		t.Fatalf("expected 30 days from 2024-04-21, got %d from %s to %s", len(f.Days), f.Start, f.End)
+	}
+	if f.DailyDiscretionary.StringFixed(2) != "10.00" {
+		t.Errorf("expected daily discretionary spending of 10.00, got %s", f.DailyDiscretionary)
+	}
+	if len(f.Discretionary) != 1 || f.Discretionary[0].Name != "Groceries" {
+		t.Errorf("expected only groceries to be discretionary, got %+v", f.Discretionary)
+	}
+
+	rent := f.Days[10]
+	if rent.Date.Format("2006-01-02") != "2024-05-01" || rent.Bills.StringFixed(2) != "2000.00" || len(rent.Payments) != 1 {
+		t.Errorf("expected rent on 2024-05-01, got %+v", rent)
+	}
+	if rent.Balance.StringFixed(2) != "-1110.00" || !rent.Low {
+		t.Errorf("expected a low balance of -1110.00 after rent, got %s", rent.Balance)
+	}
+	salary := f.Days[24]
+	if salary.Date.Format("2006-01-02") != "2024-05-15" || salary.Income.StringFixed(2) != "3000.00" || salary.Low {
+		t.Errorf("expected salary on 2024-05-15, got %+v", salary)
+	}
+	if balance, ok := f.BalanceAfter(30); !ok || balance.StringFixed(2) != "1700.00" {
+		t.Errorf("expected a balance of 1700.00 after 30 days, got %s", balance)
+	}
+	if _, ok := f.BalanceAfter(60); ok {
+		t.Error("expected no balance beyond the forecast")
+	}
+	if low := f.LowBalanceDays(); len(low) != 14 {
+		t.Errorf("expected 14 low balance days, got %d", len(low))
+	}
+	if lowest := f.Lowest(); lowest.Date.Format("2006-01-02") != "2024-05-14" || lowest.Balance.StringFixed(2) != "-1240.00" {
+		t.Errorf("expected the lowest balance of -1240.00 on 2024-05-14, got %s on %s", lowest.Balance, lowest.Date)
+	}
+}
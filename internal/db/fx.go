@@ -0,0 +1,351 @@
+package db
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultFXFeeWindow is how many days after a foreign purchase its international transaction fee can appear
+const DefaultFXFeeWindow = 3
+
+// fxRateMaxAge is how many days a loaded exchange rate is used for, covering weekends and holidays
+const fxRateMaxAge = 7
+
+// typicalFXFee is the usual international transaction fee as a fraction of the purchase, used to
+// choose between foreign purchases on the same day
+var typicalFXFee = decimal.NewFromFloat(0.03)
+
+// fxFeePhrases appear in the bank text of international transaction fees
+var fxFeePhrases = []string{
+	"international transaction fee",
+	"foreign transaction fee",
+	"foreign currency fee",
+	"currency conversion fee",
+	"overseas transaction fee",
+}
+
+// IsFXFee reports whether a transaction is an international transaction fee charged separately
+// from the purchase, like ING's "International Transaction Fee" rows
+func IsFXFee(t types.TransactionWithDetails) bool {
+	text := strings.ToLower(t.Payee + " " + t.Details.Description)
+	for _, phrase := range fxFeePhrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// FXFeeMatch links an international transaction fee to the foreign purchase it was charged for
+type FXFeeMatch struct {
+	FeeID      string          `json:"fee_id"`
+	PurchaseID string          `json:"purchase_id"`
+	Fee        decimal.Decimal `json:"fee"`
+}
+
+// MatchFXFees links each international transaction fee to a foreign purchase at the same bank up
+// to window days before it. Purchases on the same day are preferred, then ones the fee is the
+// usual percentage of, then the same card. Each purchase takes at most one fee.
+func MatchFXFees(transactions []types.TransactionWithDetails, location *time.Location, window int) []FXFeeMatch {
+	type candidate struct {
+		t      types.TransactionWithDetails
+		date   time.Time
+		amount decimal.Decimal
+	}
+	var fees, purchases []candidate
+	for _, t := range transactions {
+		date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+		if err != nil {
+			continue
+		}
+		amount := t.Amount.Amount
+		if !amount.IsNegative() {
+			continue
+		}
+		c := candidate{t: t, date: date, amount: amount.Abs()}
+		switch {
+		case IsFXFee(t):
+			fees = append(fees, c)
+		case t.Details.ForeignAmount != nil:
+			purchases = append(purchases, c)
+		}
+	}
+	sort.Slice(fees, func(i, j int) bool {
+		if !fees[i].date.Equal(fees[j].date) {
+			return fees[i].date.Before(fees[j].date)
+		}
+		return fees[i].t.ID < fees[j].t.ID
+	})
+
+	used := make(map[string]bool)
+	var matches []FXFeeMatch
+	for _, f := range fees {
+		var best *candidate
+		var bestScore float64
+		for i := range purchases {
+			p := &purchases[i]
+			if used[p.t.ID] || p.t.Bank != f.t.Bank || p.amount.IsZero() {
+				continue
+			}
+			days := f.date.Sub(p.date).Hours() / 24
+			if days < 0 || days > float64(window) {
+				continue
+			}
+			ratio, _ := f.amount.Div(p.amount).Sub(typicalFXFee).Abs().Float64()
+			score := -days - math.Min(ratio*100, 0.9)
+			if f.t.Details.CardToken != "" && f.t.Details.CardToken == p.t.Details.CardToken {
+				score += 0.05
+			}
+			if best == nil || score > bestScore {
+				best, bestScore = p, score
+			}
+		}
+		if best == nil {
+			continue
+		}
+		used[best.t.ID] = true
+		matches = append(matches, FXFeeMatch{FeeID: f.t.ID, PurchaseID: best.t.ID, Fee: f.amount})
+	}
+	return matches
+}
+
+// RefreshFXFeeLinks links international transaction fees to the foreign purchases they were
+// charged for, replacing the automatic links
+func (d *DB) RefreshFXFeeLinks(ctx context.Context, window int) ([]FXFeeMatch, error) {
+	transactions, err := d.GetTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	matches := MatchFXFees(transactions, d.timezone, window)
+
+	pairs := make([][2]string, len(matches))
+	for i, m := range matches {
+		pairs[i] = [2]string{m.FeeID, m.PurchaseID}
+	}
+	if err := d.replaceAutoLinks(ctx, LinkKindFXFee, pairs); err != nil {
+		return nil, err
+	}
+
+	d.logger.Info("Refreshed international transaction fee links", "count", len(matches))
+	return matches, nil
+}
+
+// FXRate is the mid-market rate for a currency on a day, as the quote currency for one unit of it
+type FXRate struct {
+	Date     time.Time `json:"date"`
+	Currency string    `json:"currency"`
+	// Quote is the currency the rate is in, the base currency when it's empty
+	Quote string          `json:"quote,omitempty"`
+	Rate  decimal.Decimal `json:"rate"`
+}
+
+// ParseFXRates reads exchange rates from CSV with date (YYYY-MM-DD), currency and rate columns,
+// and optionally a quote column, named in a header row in any order. Rates are the quote currency
+// for one unit of the currency, so a USD rate of 1.52 quoted in AUD means 1 USD cost 1.52 AUD.
+func ParseFXRates(r io.Reader) ([]FXRate, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates header: %w", err)
+	}
+	columns := map[string]int{"date": -1, "currency": -1, "rate": -1}
+	quoteColumn := -1
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; ok {
+			columns[name] = i
+		}
+		if name == "quote" {
+			quoteColumn = i
+		}
+	}
+	for name, i := range columns {
+		if i < 0 {
+			return nil, fmt.Errorf("rates file has no %s column", name)
+		}
+	}
+
+	var rates []FXRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rates: %w", err)
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(record[columns["date"]]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: date must be YYYY-MM-DD: %w", line, err)
+		}
+		rate, err := decimal.NewFromString(strings.TrimSpace(record[columns["rate"]]))
+		if err != nil || !rate.IsPositive() {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[columns["rate"]])
+		}
+		currency, err := ValidateCurrency(record[columns["currency"]])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		var quote string
+		if quoteColumn >= 0 && strings.TrimSpace(record[quoteColumn]) != "" {
+			if quote, err = ValidateCurrency(record[quoteColumn]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		rates = append(rates, FXRate{Date: date, Currency: currency, Quote: quote, Rate: rate})
+	}
+	return rates, nil
+}
+
+// ImportFXRates stores exchange rates, replacing any already stored for the same day and currencies.
+// Rates without a quote currency are in the base currency.
+func (d *DB) ImportFXRates(ctx context.Context, rates []FXRate) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, r := range rates {
+		quote := r.Quote
+		if quote == "" {
+			quote = d.baseCurrency
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT OR REPLACE INTO fx_rates (date, currency, quote, rate) VALUES (?, ?, ?, ?)`,
+			r.Date.Format("2006-01-02"), r.Currency, quote, r.Rate.String()); err != nil {
+			return fmt.Errorf("failed to store exchange rate: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit exchange rates: %w", err)
+	}
+	return nil
+}
+
+// FXTransaction is a foreign purchase with the rates it was converted at
+type FXTransaction struct {
+	types.TransactionWithDetails
+	ImpliedRate   decimal.Decimal `json:"implied_rate"`
+	EffectiveRate decimal.Decimal `json:"effective_rate"`
+	// MidMarketRate and MarkupPercent are zero without a loaded rate for the day. The markup is
+	// how much more was paid, fees included, than at the mid-market rate.
+	MidMarketRate decimal.Decimal `json:"mid_market_rate,omitzero"`
+	MarkupPercent decimal.Decimal `json:"markup_percent,omitzero"`
+}
+
+// CurrencySpend is the foreign spending in one currency
+type CurrencySpend struct {
+	Currency      string          `json:"currency"`
+	Count         int             `json:"count"`
+	ForeignAmount decimal.Decimal `json:"foreign_amount"`
+	// Amount and Fees are what was paid in the base currency, as positive amounts
+	Amount        decimal.Decimal `json:"amount"`
+	Fees          decimal.Decimal `json:"fees"`
+	EffectiveRate decimal.Decimal `json:"effective_rate"`
+	// MarkupPercent is how much more was paid than at mid-market rates, over the purchases with a
+	// loaded rate
+	MarkupPercent decimal.Decimal `json:"markup_percent,omitzero"`
+}
+
+// FXReport is foreign spending by original currency
+type FXReport struct {
+	Currencies   []CurrencySpend `json:"currencies"`
+	Transactions []FXTransaction `json:"transactions"`
+	TotalAmount  decimal.Decimal `json:"total_amount"`
+	TotalFees    decimal.Decimal `json:"total_fees"`
+}
+
+// GetFXReport totals foreign purchases by their original currency, with the rate each was
+// converted at with and without its international transaction fee, compared with mid-market
+// rates where they've been loaded
+func (d *DB) GetFXReport(ctx context.Context, options ...TransactionQueryOption) (*FXReport, error) {
+	transactions, err := d.GetTransactions(ctx, append([]TransactionQueryOption{FilterByForeignCurrency("")}, options...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	hundred := decimal.NewFromInt(100)
+	report := &FXReport{}
+	currencies := make(map[string]*CurrencySpend)
+	// What was paid and would have been at mid-market, for the purchases with a loaded rate
+	paidWithRate := make(map[string]decimal.Decimal)
+	midMarketCost := make(map[string]decimal.Decimal)
+	for _, t := range transactions {
+		implied, ok := t.ImpliedRate()
+		if !ok {
+			continue
+		}
+		amount := t.Amount.Amount
+		if !amount.IsNegative() {
+			continue
+		}
+		effective, _ := t.EffectiveRate()
+		fx := FXTransaction{TransactionWithDetails: t, ImpliedRate: implied, EffectiveRate: effective}
+		paid := amount.Abs().Add(t.Details.FXFee)
+		foreign := t.Details.ForeignAmount.Amount.Abs()
+		currency := t.Details.ForeignAmount.Currency
+
+		date, err := time.ParseInLocation("02/01/2006", t.Date, d.timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q on transaction %s: %w", t.Date, t.ID, err)
+		}
+		// Purchases are compared with the mid-market rate in the currency they were billed in, and
+		// totalled in the base currency
+		mid, found, err := d.ExchangeRate(ctx, currency, t.Amount.Currency, date)
+		if err != nil {
+			return nil, err
+		}
+		baseAmount, err := d.ToBaseCurrency(ctx, types.NewMoney(amount.Abs(), t.Amount.Currency), t.Date)
+		if err != nil {
+			return nil, err
+		}
+		baseFee, err := d.ToBaseCurrency(ctx, types.NewMoney(t.Details.FXFee, t.Amount.Currency), t.Date)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			cost := foreign.Mul(mid)
+			fx.MidMarketRate = mid
+			fx.MarkupPercent = paid.Sub(cost).Div(cost).Mul(hundred).Round(2)
+			basePaid := baseAmount.Add(baseFee)
+			paidWithRate[currency] = paidWithRate[currency].Add(basePaid)
+			midMarketCost[currency] = midMarketCost[currency].Add(basePaid.Mul(cost).Div(paid))
+		}
+		report.Transactions = append(report.Transactions, fx)
+
+		if currencies[currency] == nil {
+			currencies[currency] = &CurrencySpend{Currency: currency}
+		}
+		c := currencies[currency]
+		c.Count++
+		c.ForeignAmount = c.ForeignAmount.Add(foreign)
+		c.Amount = c.Amount.Add(baseAmount)
+		c.Fees = c.Fees.Add(baseFee)
+		report.TotalAmount = report.TotalAmount.Add(baseAmount)
+		report.TotalFees = report.TotalFees.Add(baseFee)
+	}
+
+	for currency, c := range currencies {
+		if c.ForeignAmount.IsPositive() {
+			c.EffectiveRate = c.Amount.Add(c.Fees).Div(c.ForeignAmount).Round(6)
+		}
+		if cost := midMarketCost[currency]; cost.IsPositive() {
+			c.MarkupPercent = paidWithRate[currency].Sub(cost).Div(cost).Mul(hundred).Round(2)
+		}
+		report.Currencies = append(report.Currencies, *c)
+	}
+	sort.Slice(report.Currencies, func(i, j int) bool {
+		return report.Currencies[i].Amount.GreaterThan(report.Currencies[j].Amount)
+	})
+	return report, nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestMatchFXFees(t *testing.T) {
+	transactions := []types.TransactionWithDetails{
+		// Two purchases on the same day take the fee that's closest to 3% of them
+		testTransaction("hotel", "01/05/2024", "-300.00", "purchase", "hotel", onBank("ing-australia"), withForeignAmount("200.00", "USD")),
+		testTransaction("coffee", "01/05/2024", "-6.00", "purchase", "coffee", onBank("ing-australia"), withForeignAmount("4.00", "USD")),
+		testTransaction("fee-hotel", "01/05/2024", "-9.00", "purchase", "fee-hotel", onBank("ing-australia")),
+		testTransaction("fee-coffee", "01/05/2024", "-0.18", "purchase", "fee-coffee", onBank("ing-australia")),
+		// A fee a day later still links, but not to another bank's purchase or after the window
+		testTransaction("dinner", "03/05/2024", "-90.00", "purchase", "dinner", onBank("ing-australia"), withForeignAmount("60.00", "USD")),
+		testTransaction("amex-dinner", "04/05/2024", "-90.00", "purchase", "amex-dinner", onBank("amex"), withForeignAmount("60.00", "USD")),
+		testTransaction("fee-dinner", "04/05/2024", "-2.70", "purchase", "fee-dinner", onBank("ing-australia")),
+		testTransaction("museum", "01/06/2024", "-30.00", "purchase", "museum", onBank("ing-australia"), withForeignAmount("20.00", "USD")),
+		testTransaction("fee-late", "10/06/2024", "-0.90", "purchase", "fee-late", onBank("ing-australia")),
+	}
+	for i := range transactions {
+		if strings.HasPrefix(transactions[i].ID, "fee") {
+			transactions[i].Payee = "International Transaction Fee"
+		}
+	}
+
+	matches := MatchFXFees(transactions, time.UTC, DefaultFXFeeWindow)
+
+	got := make(map[string]string)
+	for _, m := range matches {
+		got[m.FeeID] = m.PurchaseID
+	}
+	want := map[string]string{
+		"fee-hotel":  "hotel",
+		"fee-coffee": "coffee",
+		"fee-dinner": "dinner",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d matches, got %d: %+v", len(want), len(got), matches)
+	}
+	for fee, purchase := range want {
+		if got[fee] != purchase {
+			t.Errorf("expected %s to link to %s, got %q", fee, purchase, got[fee])
+		}
+	}
+}
+
+func TestParseFXRates(t *testing.T) {
+	rates, err := ParseFXRates(strings.NewReader("currency,date,rate\nusd,2024-05-01,1.5200\nEUR, 2024-05-01, 1.6400\n"))
+	if err != nil {
+		t.Fatalf("failed to parse rates: %v", err)
+	}
+	if len(rates) != 2 || rates[0].Currency != "USD" || rates[0].Rate.String() != "1.52" || rates[1].Date.Format("2006-01-02") != "2024-05-01" {
+		t.Errorf("unexpected rates: %+v", rates)
+	}
+
+	if rates, err = ParseFXRates(strings.NewReader("date,currency,quote,rate\n2024-05-01,AUD,usd,0.66\n2024-05-01,EUR,,1.64\n")); err != nil {
+		t.Fatalf("failed to parse rates: %v", err)
+	}
+	if rates[0].Quote != "USD" || rates[1].Quote != "" {
+		t.Errorf("expected a USD quote and then none, got %+v", rates)
+	}
+
+	for _, bad := range []string{"date,rate\n", "date,currency,rate\n01/05/2024,USD,1.52\n", "date,currency,rate\n2024-05-01,USD,-1\n", "date,currency,quote,rate\n2024-05-01,USD,AU,1.52\n"} {
+		if _, err := ParseFXRates(strings.NewReader(bad)); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestGetFXReport(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, payee string, foreign *types.ForeignAmountDetails) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: payee, Bank: "ing-australia"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: payee, Category: "Travel", SearchBody: payee, ForeignAmount: foreign}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	hotel := store("01/05/2024", "-300.00", "HILTON NEW YORK", &types.ForeignAmountDetails{Amount: decimal.NewFromInt(200), Currency: "USD"})
+	fee := store("01/05/2024", "-9.00", "International Transaction Fee", nil)
+	store("02/05/2024", "-160.00", "HOTEL PARIS", &types.ForeignAmountDetails{Amount: decimal.NewFromInt(100), Currency: "EUR"})
+
+	matches, err := db.RefreshFXFeeLinks(ctx, DefaultFXFeeWindow)
+	if err != nil {
+		t.Fatalf("failed to refresh fee links: %v", err)
+	}
+	if len(matches) != 1 || matches[0].FeeID != fee || matches[0].PurchaseID != hotel {
+		t.Fatalf("expected the fee to link to the hotel, got %+v", matches)
+	}
+
+	tx, err := db.GetTransactionByID(ctx, hotel)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if rate, _ := tx.ImpliedRate(); rate.String() != "1.5" {
+		t.Errorf("expected an implied rate of 1.5, got %s", rate)
+	}
+	if rate, _ := tx.EffectiveRate(); rate.String() != "1.545" {
+		t.Errorf("expected an effective rate of 1.545, got %s", rate)
+	}
+
+	// A rate from the day before covers the hotel, but nothing covers Paris
+	if err := db.ImportFXRates(ctx, []FXRate{
+		{Date: time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC), Currency: "USD", Rate: decimal.RequireFromString("1.50")},
+		{Date: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), Currency: "EUR", Rate: decimal.RequireFromString("1.60")},
+	}); err != nil {
+		t.Fatalf("failed to import rates: %v", err)
+	}
+
+	report, err := db.GetFXReport(ctx)
+	if err != nil {
+		t.Fatalf("failed to get fx report: %v", err)
+	}
+	if len(report.Currencies) != 2 || report.Currencies[0].Currency != "USD" {
+		t.Fatalf("expected USD then EUR, got %+v", report.Currencies)
+	}
+	usd := report.Currencies[0]
+	if usd.Amount.StringFixed(2) != "300.00" || usd.Fees.StringFixed(2) != "9.00" || usd.EffectiveRate.String() != "1.545" || usd.MarkupPercent.String() != "3" {
+		t.Errorf("unexpected USD spending: %+v", usd)
+	}
+	if eur := report.Currencies[1]; !eur.MarkupPercent.IsZero() || eur.EffectiveRate.String() != "1.6" {
+		t.Errorf("unexpected EUR spending: %+v", eur)
+	}
+	if report.TotalAmount.StringFixed(2) != "460.00" || report.TotalFees.StringFixed(2) != "9.00" {
+		t.Errorf("unexpected totals: %s %s", report.TotalAmount, report.TotalFees)
+	}
+
+	if report, err = db.GetFXReport(ctx, FilterByForeignCurrency("eur")); err != nil {
+		t.Fatalf("failed to get fx report: %v", err)
+	}
+	if len(report.Transactions) != 1 || report.Transactions[0].Details.ForeignAmount.Currency != "EUR" {
+		t.Errorf("expected only the EUR transaction, got %+v", report.Transactions)
+	}
+}
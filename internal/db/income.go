@@ -0,0 +1,327 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Kinds of income source
+const (
+	IncomeSalary     = "salary"
+	IncomeInterest   = "interest"
+	IncomeGovernment = "government"
+	IncomeSide       = "side"
+)
+
+// IncomeFinancialYear reports income by Australian financial year, alongside SummaryMonthly
+const IncomeFinancialYear = "financial-year"
+
+// incomeTypes are the transaction types that count as income. Refunds and transfers are money
+// coming back or moving around rather than being earned.
+var incomeTypes = map[string]bool{"deposit": true, "interest": true, "credit": true}
+
+// salaryWords and governmentWords identify sources by the words in their merchant or description
+var (
+	salaryWords     = map[string]bool{"salary": true, "payroll": true, "wages": true, "wage": true, "pay": true}
+	governmentWords = map[string]bool{"ato": true, "taxation": true, "centrelink": true, "medicare": true, "government": true, "gov": true}
+)
+
+// incomeLateDays is how many days a pay cycle deposit can be after the expected day, allowing
+// for weekends and public holidays, before it's late
+const incomeLateDays = 2
+
+// incomeAmountTolerance is how much a deposit can differ from the usual amount before it's
+// flagged as different
+var incomeAmountTolerance = decimal.NewFromFloat(0.05)
+
+// IncomeSource is an employer, bank or anyone else money is received from, with its pay cycle
+// when deposits arrive at a regular cadence. Amounts are in the base currency.
+type IncomeSource struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Cadence is the pay cycle, empty when deposits are irregular
+	Cadence string `json:"cadence,omitempty"`
+	// UsualAmount is the median deposit in the pay cycle
+	UsualAmount decimal.Decimal `json:"usual_amount,omitzero"`
+	LastAmount  decimal.Decimal `json:"last_amount"`
+	LastDate    time.Time       `json:"last_date"`
+	// NextDate is when the next deposit in the pay cycle is expected
+	NextDate time.Time `json:"next_date,omitzero"`
+	// DaysLate is how many days after the expected day the last deposit in the pay cycle arrived
+	DaysLate         int             `json:"days_late,omitempty"`
+	Total            decimal.Decimal `json:"total"`
+	TransactionCount int             `json:"transaction_count"`
+	TransactionIDs   []string        `json:"transaction_ids,omitempty"`
+}
+
+// Status summarises a source's pay cycle as regular, late, different, stopped or irregular
+func (s IncomeSource) Status(now time.Time) string {
+	c, ok := cadenceByName(s.Cadence)
+	if !ok {
+		return "irregular"
+	}
+	switch {
+	case now.After(s.NextDate.AddDate(0, 0, c.grace)):
+		return "stopped"
+	case now.After(s.NextDate.AddDate(0, 0, incomeLateDays)) || s.DaysLate > incomeLateDays:
+		return "late"
+	case s.Different():
+		return "different"
+	default:
+		return "regular"
+	}
+}
+
+// Different reports whether the last deposit differs from the usual amount by more than 5%
+func (s IncomeSource) Different() bool {
+	if s.Cadence == "" || !s.UsualAmount.IsPositive() {
+		return false
+	}
+	return s.LastAmount.Sub(s.UsualAmount).Abs().GreaterThan(s.UsualAmount.Mul(incomeAmountTolerance))
+}
+
+// isIncome reports whether a transaction is money received, rather than a refund, a transfer
+// between our own accounts or a reversed fee
+func isIncome(t types.TransactionWithDetails) bool {
+	if !t.Amount.IsPositive() || t.Details.TransferMatchID != "" || t.Details.RefundOfID != "" {
+		return false
+	}
+	return incomeTypes[t.Details.Type] || hasWord(t, salaryWords)
+}
+
+// hasWord reports whether the merchant or description contains one of words
+func hasWord(t types.TransactionWithDetails, words map[string]bool) bool {
+	for _, w := range strings.Fields(NormalizeMerchant(t.Details.Merchant + " " + t.Details.Description)) {
+		if words[w] {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectIncome groups income by the merchant it came from and works out what kind of source each
+// is. Pay cycles are found with the recurring series logic, and a source with a weekly,
+// fortnightly or monthly cycle of deposits is a salary unless it's interest or from government.
+// Transactions that aren't income are ignored, and amounts are taken as they are, so they should
+// all be in one currency.
+func DetectIncome(transactions []types.TransactionWithDetails, location *time.Location) []IncomeSource {
+	groups := make(map[string][]types.TransactionWithDetails)
+	for _, t := range transactions {
+		key := NormalizeMerchant(t.Details.Merchant)
+		if key == "" || !isIncome(t) {
+			continue
+		}
+		groups[key] = append(groups[key], t)
+	}
+
+	var sources []IncomeSource
+	for key, members := range groups {
+		s := IncomeSource{ID: key, TransactionCount: len(members)}
+		amounts := make(map[string]decimal.Decimal, len(members))
+		dates := make(map[string]time.Time, len(members))
+		kinds := make(map[string]bool)
+		for _, t := range members {
+			date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+			if err != nil {
+				continue
+			}
+			amounts[t.ID], dates[t.ID] = t.Amount.Amount, date
+			s.Total = s.Total.Add(t.Amount.Amount)
+			s.TransactionIDs = append(s.TransactionIDs, t.ID)
+			if !date.Before(s.LastDate) {
+				s.Name, s.LastDate, s.LastAmount = t.Details.Merchant, date, t.Amount.Amount
+			}
+			switch {
+			case t.Details.Type == "interest":
+				kinds[IncomeInterest] = true
+			case hasWord(t, governmentWords):
+				kinds[IncomeGovernment] = true
+			case hasWord(t, salaryWords):
+				kinds[IncomeSalary] = true
+			}
+		}
+
+		// The pay cycle is the longest recurring series, most recent first when they're as long
+		var cycle *RecurringSeries
+		for _, series := range DetectRecurring(members, location) {
+			if cycle == nil || series.TransactionCount > cycle.TransactionCount ||
+				(series.TransactionCount == cycle.TransactionCount && series.LastDate.After(cycle.LastDate)) {
+				cycle = &series
+			}
+		}
+		if cycle != nil {
+			c, _ := cadenceByName(cycle.Cadence)
+			var cycleAmounts []decimal.Decimal
+			for _, id := range cycle.TransactionIDs {
+				cycleAmounts = append(cycleAmounts, amounts[id])
+			}
+			s.Cadence = cycle.Cadence
+			s.UsualAmount = median(cycleAmounts)
+			s.NextDate = cycle.NextDate
+			// The last deposit is compared with the day the one before it said to expect
+			previous := dates[cycle.TransactionIDs[len(cycle.TransactionIDs)-2]]
+			s.DaysLate = max(int(cycle.LastDate.Sub(c.next(previous)).Hours()/24+0.5), 0)
+			if cycle.Cadence == CadenceWeekly || cycle.Cadence == CadenceFortnightly || cycle.Cadence == CadenceMonthly {
+				kinds[IncomeSalary] = true
+			}
+		}
+
+		switch {
+		case kinds[IncomeInterest]:
+			s.Kind = IncomeInterest
+		case kinds[IncomeGovernment]:
+			s.Kind = IncomeGovernment
+		case kinds[IncomeSalary]:
+			s.Kind = IncomeSalary
+		default:
+			s.Kind = IncomeSide
+		}
+		sources = append(sources, s)
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		if !sources[i].Total.Equal(sources[j].Total) {
+			return sources[i].Total.GreaterThan(sources[j].Total)
+		}
+		return sources[i].ID < sources[j].ID
+	})
+	return sources
+}
+
+// IncomeTotal is what was received from a source over a period
+type IncomeTotal struct {
+	Source string          `json:"source"`
+	Name   string          `json:"name"`
+	Kind   string          `json:"kind"`
+	Count  int             `json:"count"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// IncomeSummary is the gross income received over a period by source, largest first. Amounts
+// are as deposited, so salaries are after any tax withheld by the employer.
+type IncomeSummary struct {
+	Period  string          `json:"period"`
+	Start   time.Time       `json:"start"`
+	End     time.Time       `json:"end"`
+	Sources []IncomeTotal   `json:"sources"`
+	Total   decimal.Decimal `json:"total"`
+}
+
+// IncomePeriodAt returns the month or financial year containing now, as its key and first and
+// last days
+func IncomePeriodAt(period string, now time.Time) (string, time.Time, time.Time, error) {
+	switch period {
+	case SummaryMonthly:
+		return SummaryPeriodAt(period, now)
+	case IncomeFinancialYear:
+		year := FinancialYearOf(now)
+		start, end := FinancialYear(year, now.Location())
+		return fmt.Sprintf("FY%d", year), start, end, nil
+	default:
+		return "", time.Time{}, time.Time{}, fmt.Errorf("income period must be %s or %s, got %q", SummaryMonthly, IncomeFinancialYear, period)
+	}
+}
+
+// incomeTransactions returns the transactions that are income, with amounts in the base currency
+func (d *DB) incomeTransactions(ctx context.Context) ([]types.TransactionWithDetails, error) {
+	transactions, err := d.GetTransactions(ctx, ExcludeInternalTransfers())
+	if err != nil {
+		return nil, err
+	}
+	var income []types.TransactionWithDetails
+	for _, t := range transactions {
+		if !isIncome(t) {
+			continue
+		}
+		amount, err := d.ToBaseCurrency(ctx, t.Amount, t.Date)
+		if err != nil {
+			return nil, err
+		}
+		t.Amount = types.NewMoney(amount, d.baseCurrency)
+		income = append(income, t)
+	}
+	return income, nil
+}
+
+// GetIncomeSources identifies where income comes from, with pay cycles, largest total first.
+// Transfers between your own accounts and refunds aren't income.
+func (d *DB) GetIncomeSources(ctx context.Context) ([]IncomeSource, error) {
+	transactions, err := d.incomeTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return DetectIncome(transactions, d.timezone), nil
+}
+
+// IncomeReport totals income by source for the last count months or financial years up to and
+// including the one containing now, most recent first
+func (d *DB) IncomeReport(ctx context.Context, period string, count int, now time.Time) ([]IncomeSummary, error) {
+	if _, _, _, err := IncomePeriodAt(period, now); err != nil {
+		return nil, err
+	}
+	now = now.In(d.timezone)
+	if count < 1 {
+		count = 1
+	}
+
+	transactions, err := d.incomeTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sources := make(map[string]IncomeSource)
+	for _, s := range DetectIncome(transactions, d.timezone) {
+		for _, id := range s.TransactionIDs {
+			sources[id] = s
+		}
+	}
+
+	var summaries []IncomeSummary
+	for i := 0; i < count; i++ {
+		// Step back from the 1st, since month arithmetic from the 31st can skip a month
+		at := time.Date(now.Year(), now.Month()-time.Month(i), 1, 0, 0, 0, 0, now.Location())
+		if period == IncomeFinancialYear {
+			at = now.AddDate(-i, 0, 0)
+		}
+		key, start, end, err := IncomePeriodAt(period, at)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := IncomeSummary{Period: key, Start: start, End: end}
+		totals := make(map[string]*IncomeTotal)
+		for _, t := range transactions {
+			source, ok := sources[t.ID]
+			if !ok {
+				continue
+			}
+			date, err := time.ParseInLocation("02/01/2006", t.Date, d.timezone)
+			if err != nil || date.Before(start) || date.After(end) {
+				continue
+			}
+			if totals[source.ID] == nil {
+				totals[source.ID] = &IncomeTotal{Source: source.ID, Name: source.Name, Kind: source.Kind}
+			}
+			totals[source.ID].Count++
+			totals[source.ID].Amount = totals[source.ID].Amount.Add(t.Amount.Amount)
+			summary.Total = summary.Total.Add(t.Amount.Amount)
+		}
+		for _, total := range totals {
+			summary.Sources = append(summary.Sources, *total)
+		}
+		sort.Slice(summary.Sources, func(i, j int) bool {
+			if !summary.Sources[i].Amount.Equal(summary.Sources[j].Amount) {
+				return summary.Sources[i].Amount.GreaterThan(summary.Sources[j].Amount)
+			}
+			return summary.Sources[i].Source < summary.Sources[j].Source
+		})
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
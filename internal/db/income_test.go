@@ -0,0 +1,136 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestDetectIncome(t *testing.T) {
+	refund := testTransaction("r1", "10/03/2024", "100.00", "refund", "JB Hi-Fi")
+	transfer := testTransaction("t1", "11/03/2024", "500.00", "deposit", "Savings")
+	transfer.Details.TransferMatchID = "t2"
+	ato := testTransaction("a1", "12/02/2024", "850.00", "deposit", "Australian Taxation Office")
+	transactions := []types.TransactionWithDetails{
+		// Fortnightly salary, with the last deposit late and higher than usual
+		testTransaction("s1", "05/01/2024", "3000.00", "deposit", "Acme Pty Ltd"),
+		testTransaction("s2", "19/01/2024", "3000.00", "deposit", "ACME PTY LTD"),
+		testTransaction("s3", "02/02/2024", "3000.00", "deposit", "Acme Pty Ltd"),
+		testTransaction("s4", "16/02/2024", "3000.00", "deposit", "Acme Pty Ltd"),
+		testTransaction("s5", "01/03/2024", "3000.00", "deposit", "Acme Pty Ltd"),
+		testTransaction("s6", "20/03/2024", "3200.00", "deposit", "Acme Pty Ltd"),
+		// Monthly interest
+		testTransaction("i1", "31/01/2024", "0.50", "interest", "ING"),
+		testTransaction("i2", "29/02/2024", "0.52", "interest", "ING"),
+		testTransaction("i3", "31/03/2024", "0.55", "interest", "ING"),
+		// Irregular side income
+		testTransaction("m1", "08/01/2024", "120.00", "deposit", "Airtasker"),
+		testTransaction("m2", "27/02/2024", "45.00", "deposit", "Airtasker"),
+		ato,
+		// Refunds, transfers between our own accounts and spending aren't income
+		refund,
+		transfer,
+		testTransaction("p1", "13/03/2024", "-50.00", "purchase", "Acme Pty Ltd"),
+	}
+
+	sources := DetectIncome(transactions, time.UTC)
+	if len(sources) != 4 {
+		t.Fatalf("expected 4 income sources, got %d: %+v", len(sources), sources)
+	}
+	byID := make(map[string]IncomeSource)
+	for _, s := range sources {
+		byID[s.ID] = s
+	}
+
+	salary := byID["acme"]
+	if sources[0].ID != "acme" || salary.Kind != IncomeSalary || salary.Cadence != CadenceFortnightly {
+		t.Fatalf("expected a fortnightly salary first, got %+v", sources[0])
+	}
+	if salary.Total.StringFixed(2) != "18200.00" || salary.TransactionCount != 6 {
+		t.Errorf("expected 6 deposits totalling 18200.00, got %d totalling %s", salary.TransactionCount, salary.Total)
+	}
+	if !salary.UsualAmount.Equal(money("3000").Amount) || !salary.LastAmount.Equal(money("3200").Amount) || !salary.Different() {
+		t.Errorf("expected the last deposit to differ from the usual 3000, got usual %s last %s", salary.UsualAmount, salary.LastAmount)
+	}
+	if salary.DaysLate != 5 {
+		t.Errorf("expected the last deposit 5 days late, got %d", salary.DaysLate)
+	}
+	if status := salary.Status(time.Date(2024, 3, 22, 0, 0, 0, 0, time.UTC)); status != "late" {
+		t.Errorf("expected a late status, got %s", status)
+	}
+	// The next deposit is due on 3 April, so it's overdue three days later
+	salary.DaysLate = 0
+	if status := salary.Status(time.Date(2024, 4, 6, 0, 0, 0, 0, time.UTC)); status != "late" {
+		t.Errorf("expected an overdue deposit to be late, got %s", status)
+	}
+	if status := salary.Status(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)); status != "stopped" {
+		t.Errorf("expected a stopped status, got %s", status)
+	}
+
+	if s := byID["ing"]; s.Kind != IncomeInterest || s.Cadence != CadenceMonthly {
+		t.Errorf("expected monthly interest, got %+v", s)
+	}
+	if s := byID["australian taxation office"]; s.Kind != IncomeGovernment || s.Status(time.Now()) != "irregular" {
+		t.Errorf("expected an irregular government source, got %+v", s)
+	}
+	if s := byID["airtasker"]; s.Kind != IncomeSide || s.Total.StringFixed(2) != "165.00" {
+		t.Errorf("expected 165.00 of side income, got %+v", s)
+	}
+}
+
+func TestIncomeReport(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, merchant, kind string) {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant + " " + date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: kind, Merchant: merchant, Description: merchant, SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+	store("15/05/2024", "5000.00", "Acme Payroll", "deposit")
+	store("15/06/2024", "5000.00", "Acme Payroll", "deposit")
+	store("15/07/2024", "5000.00", "Acme Payroll", "deposit")
+	store("30/06/2024", "1.00", "ING", "interest")
+	store("20/06/2024", "80.00", "Kmart", "refund")
+
+	now := time.Date(2024, 8, 1, 0, 0, 0, 0, time.UTC)
+	years, err := db.IncomeReport(ctx, IncomeFinancialYear, 2, now)
+	if err != nil {
+		t.Fatalf("failed to get income report: %v", err)
+	}
+	if len(years) != 2 || years[0].Period != "FY2025" || years[1].Period != "FY2024" {
+		t.Fatalf("expected FY2025 and FY2024, got %+v", years)
+	}
+	if years[0].Total.StringFixed(2) != "5000.00" || years[1].Total.StringFixed(2) != "10001.00" {
+		t.Errorf("expected totals of 5000.00 and 10001.00, got %s and %s", years[0].Total, years[1].Total)
+	}
+	if got := years[1].Sources; len(got) != 2 || got[0].Kind != IncomeSalary || got[0].Count != 2 || got[1].Kind != IncomeInterest {
+		t.Errorf("expected salary then interest in FY2024, got %+v", got)
+	}
+
+	months, err := db.IncomeReport(ctx, SummaryMonthly, 2, now)
+	if err != nil {
+		t.Fatalf("failed to get income report: %v", err)
+	}
+	if months[0].Period != "2024-08" || !months[0].Total.IsZero() || months[1].Period != "2024-07" || months[1].Total.StringFixed(2) != "5000.00" {
+		t.Errorf("unexpected monthly income: %+v", months)
+	}
+
+	sources, err := db.GetIncomeSources(ctx)
+	if err != nil {
+		t.Fatalf("failed to get income sources: %v", err)
+	}
+	if len(sources) != 2 || sources[0].Name != "Acme Payroll" || sources[0].Cadence != CadenceMonthly || sources[0].Status(now) != "regular" {
+		t.Errorf("unexpected income sources: %+v", sources)
+	}
+
+	if _, err := db.IncomeReport(ctx, "weekly", 1, now); err == nil {
+		t.Error("expected an error for an unknown period")
+	}
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Kinds of link between two transactions
+const (
+	// LinkKindTransfer pairs the debit and credit sides of a transfer between our own accounts
+	LinkKindTransfer = "transfer"
+	// LinkKindRefund links a refund to the purchase it reverses
+	LinkKindRefund = "refund"
+	// LinkKindFXFee links an international transaction fee to the foreign purchase it was charged for
+	LinkKindFXFee = "fx_fee"
+)
+
+// Sources of a link between two transactions
+const (
+	LinkSourceAuto     = "auto"     // Found by a matcher, replaced when matching runs again
+	LinkSourceManual   = "manual"   // Linked by hand, kept when matching runs again
+	LinkSourceRejected = "rejected" // Unlinked by hand, so matching won't link the pair again
+)
+
+// replaceAutoLinks replaces the automatic links of a kind with the given transaction and linked ID pairs
+func (d *DB) replaceAutoLinks(ctx context.Context, kind string, pairs [][2]string) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM transaction_links WHERE kind = ? AND source = ?`, kind, LinkSourceAuto); err != nil {
+		return fmt.Errorf("failed to clear %s links: %w", kind, err)
+	}
+	for _, p := range pairs {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO transaction_links (transaction_id, linked_id, kind, source) VALUES (?, ?, ?, ?)
+		`, p[0], p[1], kind, LinkSourceAuto); err != nil {
+			return fmt.Errorf("failed to store %s link: %w", kind, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %s links: %w", kind, err)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
+)
+
+// LocationCount is a distinct location as classified, the place it resolved to and how many
+// transactions have it
+type LocationCount struct {
+	Location string          `json:"location"`
+	Place    gazetteer.Place `json:"place"`
+	Count    int             `json:"count"`
+}
+
+// ResolveLocations resolves the location of every stored transaction against the gazetteer again,
+// so changes to the bundled place data apply to existing transactions. It returns how many
+// distinct locations resolved to a place.
+func (d *DB) ResolveLocations(ctx context.Context) (int, error) {
+	return resolveLocations(ctx, d.db)
+}
+
+// resolveLocations parses each distinct location once and stores the place on every transaction
+// that has it
+func resolveLocations(ctx context.Context, db *sql.DB) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT location FROM transactions WHERE location IS NOT NULL AND location != ''`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query locations: %w", err)
+	}
+	var locations []string
+	for rows.Next() {
+		var location string
+		if err := rows.Scan(&location); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, location)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating locations: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var resolved int
+	for _, location := range locations {
+		place := gazetteer.Parse(location)
+		if !place.IsZero() {
+			resolved++
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE transactions SET locality = ?, state = ?, postcode = ?, country = ? WHERE location = ?
+		`, nullIfEmpty(place.Locality), nullIfEmpty(place.State), nullIfEmpty(place.Postcode), nullIfEmpty(place.Country), location); err != nil {
+			return 0, fmt.Errorf("failed to store place: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit places: %w", err)
+	}
+	return resolved, nil
+}
+
+// GetLocations returns each distinct location with the place it resolved to, most common first,
+// optionally only those that didn't resolve to a locality
+func (d *DB) GetLocations(ctx context.Context, unresolved bool) ([]LocationCount, error) {
+	query := `
+		SELECT location, COALESCE(locality, ''), COALESCE(state, ''), COALESCE(postcode, ''), COALESCE(country, ''), COUNT(*) AS count
+		FROM transactions
+		WHERE location IS NOT NULL AND location != ''`
+	if unresolved {
+		query += ` AND locality IS NULL`
+	}
+	query += ` GROUP BY location ORDER BY count DESC, location`
+
+	rows, err := d.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query locations: %w", err)
+	}
+	defer rows.Close()
+
+	var locations []LocationCount
+	for rows.Next() {
+		var l LocationCount
+		if err := rows.Scan(&l.Location, &l.Place.Locality, &l.Place.State, &l.Place.Postcode, &l.Place.Country, &l.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan location: %w", err)
+		}
+		locations = append(locations, l)
+	}
+	return locations, rows.Err()
+}
+
+// stateCode normalizes a state filter to the abbreviation stored on transactions
+func stateCode(state string) string {
+	if code := gazetteer.StateCode(state); code != "" {
+		return code
+	}
+	return strings.ToUpper(state)
+}
+
+// countryCode normalizes a country filter to the ISO code stored on transactions
+func countryCode(country string) string {
+	if code := gazetteer.CountryCode(country); code != "" {
+		return code
+	}
+	return strings.ToUpper(country)
+}
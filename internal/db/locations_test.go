@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestLocations(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, merchant, location string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant, Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Location: location, Category: "Food & Dining", SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	bondi := store("01/03/2024", "-12.00", "Cafe", "Bondi Junction NSW 2022")
+	store("02/03/2024", "-30.00", "Restaurant", "Richmond VIC")
+	store("03/03/2024", "-45.00", "Ramen", "Tokyo JP")
+	store("04/03/2024", "-15.00", "Sushi", "Kyoto Japan")
+	store("05/03/2024", "-9.99", "Streaming", "Online")
+
+	tx, err := db.GetTransactionByID(ctx, bondi)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	want := gazetteer.Place{Locality: "Bondi Junction", State: "NSW", Postcode: "2022", Country: "AU"}
+	if tx.Details.Place != want {
+		t.Errorf("expected %+v, got %+v", want, tx.Details.Place)
+	}
+
+	count := func(opts ...TransactionQueryOption) int {
+		ids, err := db.GetTransactionIDs(ctx, opts...)
+		if err != nil {
+			t.Fatalf("failed to get transaction ids: %v", err)
+		}
+		return len(ids)
+	}
+	if n := count(FilterByCountry("Japan")); n != 2 {
+		t.Errorf("expected 2 transactions in Japan, got %d", n)
+	}
+	if n := count(FilterByState("New South Wales")); n != 1 {
+		t.Errorf("expected 1 transaction in NSW, got %d", n)
+	}
+	if n := count(FilterByLocality("richmond")); n != 1 {
+		t.Errorf("expected 1 transaction in Richmond, got %d", n)
+	}
+	if n := count(FilterByAwayFrom("AU", "")); n != 2 {
+		t.Errorf("expected 2 transactions outside Australia, got %d", n)
+	}
+	if n := count(FilterByAwayFrom("AU", "VIC")); n != 3 {
+		t.Errorf("expected 3 transactions outside Victoria, got %d", n)
+	}
+
+	rows, err := db.Aggregate(ctx, GroupByState, FilterByCountry("AU"))
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Key != "AU-VIC" || rows[1].Key != "AU-NSW" {
+		t.Errorf("expected totals for AU-VIC and AU-NSW, got %+v", rows)
+	}
+	rows, err = db.Aggregate(ctx, GroupByLocality, FilterByCountry("JP"))
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Key != "Tokyo, JP" || rows[1].Key != "Kyoto, JP" {
+		t.Errorf("expected totals for Tokyo and Kyoto, got %+v", rows)
+	}
+
+	// Locations stored before places were are resolved again
+	if _, err := db.db.ExecContext(ctx, `UPDATE transactions SET locality = NULL, state = NULL, postcode = NULL, country = NULL`); err != nil {
+		t.Fatalf("failed to clear places: %v", err)
+	}
+	unresolved, err := db.GetLocations(ctx, true)
+	if err != nil {
+		t.Fatalf("failed to get locations: %v", err)
+	}
+	if len(unresolved) != 5 {
+		t.Errorf("expected 5 unresolved locations, got %+v", unresolved)
+	}
+	resolved, err := db.ResolveLocations(ctx)
+	if err != nil {
+		t.Fatalf("failed to resolve locations: %v", err)
+	}
+	if resolved != 4 {
+		t.Errorf("expected 4 locations to resolve, got %d", resolved)
+	}
+	if n := count(FilterByCountry("AU")); n != 2 {
+		t.Errorf("expected 2 transactions in Australia after resolving, got %d", n)
+	}
+}
@@ -0,0 +1,605 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+// canonicalMerchant selects the canonical name of a transaction's merchant, falling back to the
+// classified name when it hasn't been resolved
+const canonicalMerchant = `COALESCE((SELECT m.name FROM merchants m WHERE m.id = t.merchant_id), t.merchant)`
+
+const (
+	// merchantEditThreshold is the edit similarity above which two merchant keys are the same merchant
+	merchantEditThreshold = 0.85
+	// merchantEmbeddingThreshold is the cosine similarity above which two merchant names are the same merchant
+	merchantEmbeddingThreshold = 0.92
+	// minFuzzyKeyLength is the shortest key matched by edit similarity, since short names differ by
+	// only a letter or two
+	minFuzzyKeyLength = 6
+)
+
+// MerchantEmbedder generates an embedding for a merchant name
+type MerchantEmbedder func(ctx context.Context, text string) ([]float32, error)
+
+// Merchant is a canonical merchant and the names it's known by
+type Merchant struct {
+	ID               int64    `json:"id"`
+	Name             string   `json:"name"`
+	DefaultCategory  string   `json:"default_category,omitempty"`
+	DefaultDeduction string   `json:"default_deduction,omitempty"`
+	Website          string   `json:"website,omitempty"`
+	Notes            string   `json:"notes,omitempty"`
+	Aliases          []string `json:"aliases,omitempty"`
+	TransactionCount int      `json:"transaction_count"`
+}
+
+// SetMerchantEmbedder enables resolving merchant names by embedding similarity when they don't
+// match an existing alias closely enough
+func (d *DB) SetMerchantEmbedder(embedder MerchantEmbedder) {
+	d.merchantEmbedder = embedder
+}
+
+// MerchantKey reduces a merchant name to the key its aliases are stored under. Trailing words
+// from the transaction's location are dropped, so "McDonalds Richmond" in Richmond keys as "mcdonalds".
+func MerchantKey(merchant, location string) string {
+	words := strings.Fields(NormalizeMerchant(merchant))
+	locationWords := make(map[string]bool)
+	for _, w := range strings.Fields(NormalizeMerchant(location)) {
+		// Numbers in a location are more likely store numbers than place names
+		if strings.IndexFunc(w, func(r rune) bool { return !unicode.IsLetter(r) }) == -1 {
+			locationWords[w] = true
+		}
+	}
+	// A merchant named only for its location keeps its full name
+	for len(words) > 1 && locationWords[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+	return strings.Join(words, " ")
+}
+
+// merchantSimilarity scores how alike two merchant keys are from 0 to 1, ignoring spaces so
+// "mcdonald s" and "mcdonalds" are identical
+func merchantSimilarity(a, b string) float64 {
+	a, b = strings.ReplaceAll(a, " ", ""), strings.ReplaceAll(b, " ", "")
+	if a == b {
+		return 1
+	}
+	longest := max(len(a), len(b))
+	if min(len(a), len(b)) < minFuzzyKeyLength {
+		return 0
+	}
+	return 1 - float64(levenshtein(a, b))/float64(longest)
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// resolveMerchant finds or creates the canonical merchant for a classified merchant name, trying
+// an exact alias, then a close alias, then embedding similarity. It returns the merchant ID, or
+// zero for an empty name, and the merchant's default category.
+func (d *DB) resolveMerchant(ctx context.Context, name, location string) (int64, string, error) {
+	key := MerchantKey(name, location)
+	if key == "" {
+		return 0, "", nil
+	}
+
+	// Transactions are stored concurrently, so resolve one name at a time to avoid duplicates
+	d.merchantMu.Lock()
+	defer d.merchantMu.Unlock()
+
+	var id int64
+	err := d.db.QueryRowContext(ctx, `SELECT merchant_id FROM merchant_aliases WHERE alias_key = ?`, key).Scan(&id)
+	if err == nil {
+		return id, d.merchantDefaultCategory(ctx, id), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", fmt.Errorf("failed to look up merchant alias: %w", err)
+	}
+
+	if id, err = d.matchMerchantAlias(ctx, key); err != nil {
+		return 0, "", err
+	}
+	var embedding []float32
+	if id == 0 && d.merchantEmbedder != nil {
+		if id, embedding, err = d.matchMerchantEmbedding(ctx, name); err != nil {
+			return 0, "", err
+		}
+	}
+	if id == 0 {
+		if id, err = d.createMerchant(ctx, strings.TrimSpace(name), embedding); err != nil {
+			return 0, "", err
+		}
+	}
+	if _, err := d.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO merchant_aliases (alias_key, alias, merchant_id) VALUES (?, ?, ?)
+	`, key, strings.TrimSpace(name), id); err != nil {
+		return 0, "", fmt.Errorf("failed to store merchant alias: %w", err)
+	}
+	return id, d.merchantDefaultCategory(ctx, id), nil
+}
+
+// matchMerchantAlias returns the merchant with the alias most similar to key, or zero if none is
+// similar enough
+func (d *DB) matchMerchantAlias(ctx context.Context, key string) (int64, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT alias_key, merchant_id FROM merchant_aliases`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query merchant aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var best int64
+	bestScore := merchantEditThreshold
+	for rows.Next() {
+		var alias string
+		var id int64
+		if err := rows.Scan(&alias, &id); err != nil {
+			return 0, fmt.Errorf("failed to scan merchant alias: %w", err)
+		}
+		if score := merchantSimilarity(key, alias); score >= bestScore {
+			best, bestScore = id, score
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating merchant aliases: %w", err)
+	}
+	return best, nil
+}
+
+// matchMerchantEmbedding returns the merchant whose name embedding is most similar to name, or
+// zero if none is similar enough, along with the embedding of name
+func (d *DB) matchMerchantEmbedding(ctx context.Context, name string) (int64, []float32, error) {
+	embedding, err := d.merchantEmbedder(ctx, name)
+	if err != nil {
+		// Resolution still works without embeddings, it just finds fewer matches
+		d.logger.Warn("Failed to embed merchant name", "merchant", name, "error", err)
+		return 0, nil, nil
+	}
+
+	rows, err := d.db.QueryContext(ctx, `SELECT id, embedding FROM merchants WHERE embedding IS NOT NULL`)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query merchant embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var best int64
+	bestScore := merchantEmbeddingThreshold
+	for rows.Next() {
+		var id int64
+		var blob []byte
+		if err := rows.Scan(&id, &blob); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan merchant embedding: %w", err)
+		}
+		if score := cosineSimilarity(embedding, decodeEmbedding(blob)); score >= bestScore {
+			best, bestScore = id, score
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("error iterating merchant embeddings: %w", err)
+	}
+	return best, embedding, nil
+}
+
+// createMerchant adds a merchant, or returns the existing one with the same name
+func (d *DB) createMerchant(ctx context.Context, name string, embedding []float32) (int64, error) {
+	var blob []byte
+	if embedding != nil {
+		blob = encodeEmbedding(embedding)
+	}
+	if _, err := d.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO merchants (name, embedding) VALUES (?, ?)
+	`, name, blob); err != nil {
+		return 0, fmt.Errorf("failed to create merchant: %w", err)
+	}
+	var id int64
+	if err := d.db.QueryRowContext(ctx, `SELECT id FROM merchants WHERE name = ?`, name).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to get merchant: %w", err)
+	}
+	return id, nil
+}
+
+// merchantDefaultCategory returns a merchant's default category, or empty if it has none
+func (d *DB) merchantDefaultCategory(ctx context.Context, id int64) string {
+	var category sql.NullString
+	_ = d.db.QueryRowContext(ctx, `SELECT default_category FROM merchants WHERE id = ?`, id).Scan(&category)
+	return category.String
+}
+
+// encodeEmbedding packs an embedding as little-endian float32s
+func encodeEmbedding(embedding []float32) []byte {
+	b := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(v))
+	}
+	return b
+}
+
+// decodeEmbedding unpacks an embedding packed by encodeEmbedding
+func decodeEmbedding(b []byte) []float32 {
+	embedding := make([]float32, len(b)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return embedding
+}
+
+// cosineSimilarity returns the cosine similarity of two embeddings, or zero if their sizes differ
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// ResolveMerchants resolves the merchants of transactions stored before they had a canonical
+// merchant, returning how many were resolved
+func (d *DB) ResolveMerchants(ctx context.Context) (int, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, merchant, COALESCE(location, '')
+		FROM transactions WHERE merchant_id IS NULL AND merchant != ''
+		ORDER BY date
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query unresolved transactions: %w", err)
+	}
+	type unresolved struct{ id, merchant, location string }
+	var pending []unresolved
+	for rows.Next() {
+		var u unresolved
+		if err := rows.Scan(&u.id, &u.merchant, &u.location); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		pending = append(pending, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating transactions: %w", err)
+	}
+
+	var resolved int
+	for _, u := range pending {
+		id, _, err := d.resolveMerchant(ctx, u.merchant, u.location)
+		if err != nil {
+			return resolved, err
+		}
+		if id == 0 {
+			continue
+		}
+		if _, err := d.db.ExecContext(ctx, `UPDATE transactions SET merchant_id = ? WHERE id = ?`, id, u.id); err != nil {
+			return resolved, fmt.Errorf("failed to set merchant: %w", err)
+		}
+		resolved++
+	}
+	return resolved, nil
+}
+
+// GetMerchants returns canonical merchants with their aliases and transaction counts, optionally
+// only those whose name or an alias contains query
+func (d *DB) GetMerchants(ctx context.Context, query string) ([]Merchant, error) {
+	sqlQuery := `
+		SELECT m.id, m.name, COALESCE(m.default_category, ''), COALESCE(m.default_deduction, ''), COALESCE(m.website, ''), COALESCE(m.notes, ''),
+			(SELECT COUNT(*) FROM transactions t WHERE t.merchant_id = m.id) AS count
+		FROM merchants m`
+	var params []any
+	if query != "" {
+		pattern := "%" + escapeLike(query) + "%"
+		sqlQuery += ` WHERE m.name LIKE ? ESCAPE '\' OR EXISTS (SELECT 1 FROM merchant_aliases a
+			WHERE a.merchant_id = m.id AND a.alias LIKE ? ESCAPE '\')`
+		params = append(params, pattern, pattern)
+	}
+	sqlQuery += ` ORDER BY count DESC, m.name`
+
+	rows, err := d.db.QueryContext(ctx, sqlQuery, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merchants: %w", err)
+	}
+	var merchants []Merchant
+	for rows.Next() {
+		var m Merchant
+		if err := rows.Scan(&m.ID, &m.Name, &m.DefaultCategory, &m.DefaultDeduction, &m.Website, &m.Notes, &m.TransactionCount); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan merchant: %w", err)
+		}
+		merchants = append(merchants, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating merchants: %w", err)
+	}
+
+	for i := range merchants {
+		if merchants[i].Aliases, err = d.merchantAliases(ctx, merchants[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return merchants, nil
+}
+
+// merchantAliases returns the names a merchant has been seen as
+func (d *DB) merchantAliases(ctx context.Context, id int64) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT alias FROM merchant_aliases WHERE merchant_id = ? ORDER BY alias`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merchant aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var aliases []string
+	for rows.Next() {
+		var alias string
+		if err := rows.Scan(&alias); err != nil {
+			return nil, fmt.Errorf("failed to scan merchant alias: %w", err)
+		}
+		aliases = append(aliases, alias)
+	}
+	return aliases, rows.Err()
+}
+
+// FindMerchant looks up a merchant by ID, canonical name or alias
+func (d *DB) FindMerchant(ctx context.Context, ref string) (*Merchant, error) {
+	var id int64
+	err := d.db.QueryRowContext(ctx, `
+		SELECT id FROM merchants WHERE name = ? COLLATE NOCASE
+		UNION ALL
+		SELECT merchant_id FROM merchant_aliases WHERE alias = ? COLLATE NOCASE OR alias_key = ?
+		LIMIT 1
+	`, ref, ref, NormalizeMerchant(ref)).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Fall back to the numeric ID, after names so a merchant named with digits is still found
+		if n, convErr := strconv.ParseInt(ref, 10, 64); convErr == nil {
+			id, err = n, d.db.QueryRowContext(ctx, `SELECT id FROM merchants WHERE id = ?`, n).Scan(&id)
+		}
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("merchant %q not found", ref)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merchant: %w", err)
+	}
+
+	m := Merchant{ID: id}
+	if err := d.db.QueryRowContext(ctx, `
+		SELECT name, COALESCE(default_category, ''), COALESCE(default_deduction, ''), COALESCE(website, ''), COALESCE(notes, ''),
+			(SELECT COUNT(*) FROM transactions t WHERE t.merchant_id = merchants.id)
+		FROM merchants WHERE id = ?
+	`, id).Scan(&m.Name, &m.DefaultCategory, &m.DefaultDeduction, &m.Website, &m.Notes, &m.TransactionCount); err != nil {
+		return nil, fmt.Errorf("failed to get merchant: %w", err)
+	}
+	if m.Aliases, err = d.merchantAliases(ctx, id); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// UpdateMerchant updates the name, default category, website or notes of a merchant. Nil fields
+// are left unchanged.
+func (d *DB) UpdateMerchant(ctx context.Context, id int64, name, category, website, notes *string) error {
+	var set []string
+	var params []any
+	if name != nil {
+		set = append(set, "name = ?")
+		params = append(params, *name)
+	}
+	if category != nil {
+		set = append(set, "default_category = ?")
+		params = append(params, nullIfEmpty(*category))
+	}
+	if website != nil {
+		set = append(set, "website = ?")
+		params = append(params, nullIfEmpty(*website))
+	}
+	if notes != nil {
+		set = append(set, "notes = ?")
+		params = append(params, nullIfEmpty(*notes))
+	}
+	if len(set) == 0 {
+		return fmt.Errorf("no fields to update")
+	}
+	params = append(params, id)
+	res, err := d.db.ExecContext(ctx, "UPDATE merchants SET "+strings.Join(set, ", ")+" WHERE id = ?", params...)
+	if err != nil {
+		return fmt.Errorf("failed to update merchant: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("merchant %d not found", id)
+	}
+	if name != nil {
+		// The new name resolves to the merchant too
+		if _, err := d.db.ExecContext(ctx, `
+			INSERT OR IGNORE INTO merchant_aliases (alias_key, alias, merchant_id) VALUES (?, ?, ?)
+		`, NormalizeMerchant(*name), *name, id); err != nil {
+			return fmt.Errorf("failed to store merchant alias: %w", err)
+		}
+	}
+	return nil
+}
+
+// MergeMerchants folds the source merchants into the target, moving their aliases and
+// transactions. Details missing on the target are taken from the sources.
+func (d *DB) MergeMerchants(ctx context.Context, target int64, sources ...int64) error {
+	d.merchantMu.Lock()
+	defer d.merchantMu.Unlock()
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, source := range sources {
+		if source == target {
+			return fmt.Errorf("can't merge merchant %d into itself", source)
+		}
+		res, err := tx.ExecContext(ctx, `
+			UPDATE merchants SET
+				default_category = COALESCE(default_category, (SELECT default_category FROM merchants WHERE id = ?)),
+				default_deduction = COALESCE(default_deduction, (SELECT default_deduction FROM merchants WHERE id = ?)),
+				website = COALESCE(website, (SELECT website FROM merchants WHERE id = ?)),
+				notes = COALESCE(notes, (SELECT notes FROM merchants WHERE id = ?))
+			WHERE id = ? AND EXISTS (SELECT 1 FROM merchants WHERE id = ?)
+		`, source, source, source, source, target, source)
+		if err != nil {
+			return fmt.Errorf("failed to merge merchant details: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return fmt.Errorf("merchants %d and %d must both exist to merge", target, source)
+		}
+		for _, stmt := range []string{
+			`UPDATE merchant_aliases SET merchant_id = ? WHERE merchant_id = ?`,
+			`UPDATE transactions SET merchant_id = ? WHERE merchant_id = ?`,
+		} {
+			if _, err := tx.ExecContext(ctx, stmt, target, source); err != nil {
+				return fmt.Errorf("failed to move merchant references: %w", err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM merchants WHERE id = ?`, source); err != nil {
+			return fmt.Errorf("failed to delete merged merchant: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SplitMerchant moves aliases wrongly resolved to a merchant onto a new merchant called name,
+// along with the transactions seen under those aliases. It returns the new merchant's ID.
+func (d *DB) SplitMerchant(ctx context.Context, id int64, aliases []string, name string) (int64, error) {
+	if len(aliases) == 0 {
+		return 0, fmt.Errorf("no aliases to split")
+	}
+	d.merchantMu.Lock()
+	defer d.merchantMu.Unlock()
+
+	keys := make(map[string]bool)
+	for _, alias := range aliases {
+		found, err := d.merchantAliasKeys(ctx, id, alias)
+		if err != nil {
+			return 0, err
+		}
+		if len(found) == 0 {
+			return 0, fmt.Errorf("%q is not an alias of merchant %d", alias, id)
+		}
+		for _, key := range found {
+			keys[key] = true
+		}
+	}
+
+	// Find the transactions seen under the moved aliases before changing anything
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, merchant, COALESCE(location, '') FROM transactions WHERE merchant_id = ?
+	`, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query merchant transactions: %w", err)
+	}
+	var moved []string
+	for rows.Next() {
+		var txID, merchant, location string
+		if err := rows.Scan(&txID, &merchant, &location); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+		if keys[MerchantKey(merchant, location)] {
+			moved = append(moved, txID)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating transactions: %w", err)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO merchants (name) VALUES (?)`, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create merchant %q: %w", name, err)
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get merchant id: %w", err)
+	}
+	for key := range keys {
+		if _, err := tx.ExecContext(ctx, `UPDATE merchant_aliases SET merchant_id = ? WHERE alias_key = ?`, newID, key); err != nil {
+			return 0, fmt.Errorf("failed to move merchant alias: %w", err)
+		}
+	}
+	for _, txID := range moved {
+		if _, err := tx.ExecContext(ctx, `UPDATE transactions SET merchant_id = ? WHERE id = ?`, newID, txID); err != nil {
+			return 0, fmt.Errorf("failed to move transaction: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit merchant split: %w", err)
+	}
+	return newID, nil
+}
+
+// merchantAliasKeys returns the keys of a merchant's aliases matching alias by name or key
+func (d *DB) merchantAliasKeys(ctx context.Context, id int64, alias string) ([]string, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT alias_key FROM merchant_aliases
+		WHERE merchant_id = ? AND (alias = ? COLLATE NOCASE OR alias_key = ?)
+	`, id, strings.TrimSpace(alias), NormalizeMerchant(alias))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merchant aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to scan merchant alias: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// applyDefaultCategory returns the merchant's default category for transactions the classifier
+// couldn't categorise, and the classified category otherwise
+func applyDefaultCategory(details *types.TransactionDetails, defaultCategory string) string {
+	if defaultCategory != "" && (details.Category == "" || strings.EqualFold(details.Category, types.TransactionCategoryOther)) {
+		return defaultCategory
+	}
+	return details.Category
+}
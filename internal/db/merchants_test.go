@@ -0,0 +1,202 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestMerchantKey(t *testing.T) {
+	tests := []struct {
+		merchant string
+		location string
+		want     string
+	}{
+		{"McDonald's", "", "mcdonald s"},
+		{"MCDONALDS RICHMOND", "Richmond, VIC", "mcdonalds"},
+		{"Richmond Hill Cafe", "Richmond", "richmond hill cafe"},
+		{"Richmond", "Richmond", "richmond"},
+		{"Store 7", "Location 7", "store 7"},
+	}
+	for _, tt := range tests {
+		if got := MerchantKey(tt.merchant, tt.location); got != tt.want {
+			t.Errorf("MerchantKey(%q, %q) = %q, want %q", tt.merchant, tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestMerchantSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		similar bool
+	}{
+		{"mcdonald s", "mcdonalds", true},
+		{"woolworths", "woolworth", true},
+		{"woolworths", "coles", false},
+		{"bp", "bpx", false},
+	}
+	for _, tt := range tests {
+		got := merchantSimilarity(tt.a, tt.b) >= merchantEditThreshold
+		if got != tt.similar {
+			t.Errorf("merchantSimilarity(%q, %q) = %.2f, expected similar=%v", tt.a, tt.b, merchantSimilarity(tt.a, tt.b), tt.similar)
+		}
+	}
+}
+
+func TestResolveMerchants(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, payee, merchant, location, category string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: payee, Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Location: location, Category: category, SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	store("01/03/2024", "-12.50", "MCDONALDS 123", "McDonald's", "", "Food & Dining")
+	store("02/03/2024", "-8.00", "MCDONALDS", "MCDONALDS", "", "Food & Dining")
+	richmond := store("03/03/2024", "-9.20", "MCDONALDS RICHMOND", "McDonalds Richmond", "Richmond", "Food & Dining")
+	store("04/03/2024", "-50.00", "WOOLWORTHS 1234", "Woolworths", "", "Groceries")
+
+	merchants, err := db.GetMerchants(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to get merchants: %v", err)
+	}
+	if len(merchants) != 2 {
+		t.Fatalf("expected 2 merchants, got %+v", merchants)
+	}
+	mcdonalds := merchants[0]
+	if mcdonalds.Name != "McDonald's" || mcdonalds.TransactionCount != 3 || len(mcdonalds.Aliases) != 2 {
+		t.Errorf("expected McDonald's with 3 transactions and 2 aliases, got %+v", mcdonalds)
+	}
+
+	tx, err := db.GetTransactionByID(ctx, richmond)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.MerchantID != mcdonalds.ID || tx.Details.Merchant != "McDonald's" {
+		t.Errorf("expected the canonical merchant on the Richmond transaction, got %d %q", tx.Details.MerchantID, tx.Details.Merchant)
+	}
+
+	// Aggregation and filters work on the canonical merchant
+	rows, err := db.Aggregate(ctx, GroupByMerchant)
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 2 || rows[0].Key != "Woolworths" || rows[1].Key != "McDonald's" || rows[1].Count != 3 {
+		t.Errorf("expected totals for the two canonical merchants, got %+v", rows)
+	}
+	ids, err := db.GetTransactionIDs(ctx, FilterByMerchant("McDonalds Richmond"))
+	if err != nil {
+		t.Fatalf("failed to get transaction ids: %v", err)
+	}
+	if len(ids) != 3 {
+		t.Errorf("expected filtering by an alias to find all 3 transactions, got %v", ids)
+	}
+
+	// A default category fills in for transactions the classifier couldn't categorise
+	category := "Food & Dining"
+	if err := db.UpdateMerchant(ctx, mcdonalds.ID, nil, &category, nil, nil); err != nil {
+		t.Fatalf("failed to update merchant: %v", err)
+	}
+	other := store("05/03/2024", "-4.00", "MACCAS", "McDonalds", "", types.TransactionCategoryOther)
+	if tx, err = db.GetTransactionByID(ctx, other); err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.Category != category {
+		t.Errorf("expected the merchant's default category, got %q", tx.Details.Category)
+	}
+}
+
+func TestResolveMerchantByEmbedding(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	// A fake embedder that places names mentioning "uber" close together
+	db.SetMerchantEmbedder(func(ctx context.Context, text string) ([]float32, error) {
+		if strings.Contains(strings.ToLower(text), "uber") {
+			return []float32{1, 0.05}, nil
+		}
+		return []float32{0, 1}, nil
+	})
+
+	for i, merchant := range []string{"Uber Eats", "UberEATS Delivery", "Menulog"} {
+		transaction := types.Transaction{Date: "01/03/2024", Amount: money("-20.00"), Payee: merchant + " " + string(rune('a'+i)), Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Category: "Food & Dining", SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	merchants, err := db.GetMerchants(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to get merchants: %v", err)
+	}
+	if len(merchants) != 2 || merchants[0].Name != "Uber Eats" || merchants[0].TransactionCount != 2 {
+		t.Errorf("expected the Uber Eats variants to resolve together, got %+v", merchants)
+	}
+}
+
+func TestMergeAndSplitMerchants(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	for i, merchant := range []string{"Bunnings Warehouse", "Bunnings", "Officeworks"} {
+		transaction := types.Transaction{Date: "01/03/2024", Amount: money("-30.00"), Payee: merchant + " " + string(rune('a'+i)), Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Category: "Home", SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	find := func(ref string) *Merchant {
+		m, err := db.FindMerchant(ctx, ref)
+		if err != nil {
+			t.Fatalf("failed to find merchant %q: %v", ref, err)
+		}
+		return m
+	}
+	target, source := find("Bunnings"), find("Bunnings Warehouse")
+	if target.ID == source.ID {
+		t.Fatal("expected the Bunnings names to start as separate merchants")
+	}
+
+	website := "https://www.bunnings.com.au"
+	if err := db.UpdateMerchant(ctx, source.ID, nil, nil, &website, nil); err != nil {
+		t.Fatalf("failed to update merchant: %v", err)
+	}
+	if err := db.MergeMerchants(ctx, target.ID, source.ID); err != nil {
+		t.Fatalf("failed to merge merchants: %v", err)
+	}
+	merged := find("Bunnings Warehouse")
+	if merged.ID != target.ID || merged.TransactionCount != 2 || merged.Website != website {
+		t.Errorf("expected the merged merchant to keep both transactions and the website, got %+v", merged)
+	}
+
+	// Splitting moves the alias and its transactions back out
+	newID, err := db.SplitMerchant(ctx, target.ID, []string{"Bunnings Warehouse"}, "Bunnings Warehouse")
+	if err != nil {
+		t.Fatalf("failed to split merchant: %v", err)
+	}
+	split := find("Bunnings Warehouse")
+	if split.ID != newID || split.TransactionCount != 1 {
+		t.Errorf("expected the split merchant to have 1 transaction, got %+v", split)
+	}
+	if remaining := find("Bunnings"); remaining.TransactionCount != 1 {
+		t.Errorf("expected Bunnings to keep 1 transaction, got %+v", remaining)
+	}
+
+	if _, err := db.SplitMerchant(ctx, target.ID, []string{"Officeworks"}, "Other"); err == nil {
+		t.Error("expected an error splitting an alias of another merchant")
+	}
+}
@@ -3,6 +3,10 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
 )
 
 // Migration represents a single database migration
@@ -37,6 +41,363 @@ var migrations = []Migration{
 			return err
 		},
 	},
+	{
+		ID: 2,
+		Up: func(db *sql.DB) error {
+			// Existing card numbers are masked by DB.Init once the column exists
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN card_token TEXT;
+				CREATE INDEX IF NOT EXISTS idx_transactions_card_token ON transactions(card_token);
+				CREATE TABLE IF NOT EXISTS cards (
+					token TEXT PRIMARY KEY,
+					masked_number TEXT NOT NULL,
+					bank TEXT NOT NULL,
+					cardholder TEXT,
+					account TEXT,
+					label TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 3,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`ALTER TABLE transactions ADD COLUMN model TEXT;`)
+			return err
+		},
+	},
+	{
+		ID: 4,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN recurring_series_id TEXT;
+				CREATE INDEX IF NOT EXISTS idx_transactions_recurring_series ON transactions(recurring_series_id);
+				CREATE TABLE IF NOT EXISTS recurring_series (
+					id TEXT PRIMARY KEY,
+					merchant TEXT NOT NULL,
+					bank TEXT NOT NULL,
+					type TEXT NOT NULL,
+					category TEXT,
+					cadence TEXT NOT NULL,
+					amount DECIMAL(15,2) NOT NULL,
+					previous_amount DECIMAL(15,2),
+					first_date TEXT NOT NULL,
+					last_date TEXT NOT NULL,
+					next_date TEXT NOT NULL,
+					transaction_count INTEGER NOT NULL
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 5,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS transaction_links (
+					transaction_id TEXT NOT NULL,
+					linked_id TEXT NOT NULL,
+					kind TEXT NOT NULL,
+					source TEXT NOT NULL DEFAULT 'auto',
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					PRIMARY KEY (transaction_id, linked_id, kind)
+				);
+				CREATE INDEX IF NOT EXISTS idx_transaction_links_linked ON transaction_links(linked_id, kind);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 6,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS transaction_splits (
+					transaction_id TEXT NOT NULL,
+					position INTEGER NOT NULL,
+					amount DECIMAL(15,2) NOT NULL,
+					category TEXT NOT NULL,
+					tags TEXT,
+					note TEXT,
+					PRIMARY KEY (transaction_id, position)
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 7,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN merchant_id INTEGER;
+				CREATE INDEX IF NOT EXISTS idx_transactions_merchant_id ON transactions(merchant_id);
+				CREATE TABLE IF NOT EXISTS merchants (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+					default_category TEXT,
+					website TEXT,
+					notes TEXT,
+					embedding BLOB,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+				CREATE TABLE IF NOT EXISTS merchant_aliases (
+					alias_key TEXT PRIMARY KEY,
+					alias TEXT NOT NULL,
+					merchant_id INTEGER NOT NULL
+				);
+				CREATE INDEX IF NOT EXISTS idx_merchant_aliases_merchant ON merchant_aliases(merchant_id);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 8,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN locality TEXT;
+				ALTER TABLE transactions ADD COLUMN state TEXT;
+				ALTER TABLE transactions ADD COLUMN postcode TEXT;
+				ALTER TABLE transactions ADD COLUMN country TEXT;
+				CREATE INDEX IF NOT EXISTS idx_transactions_country ON transactions(country, state);
+			`)
+			if err != nil {
+				return err
+			}
+			// Resolve the locations of transactions stored before places were
+			_, err = resolveLocations(context.Background(), db)
+			return err
+		},
+	},
+	{
+		ID: 9,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS tags (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);
+				CREATE TABLE IF NOT EXISTS transaction_tags (
+					transaction_id TEXT NOT NULL,
+					tag_id INTEGER NOT NULL,
+					PRIMARY KEY (transaction_id, tag_id)
+				);
+				CREATE INDEX IF NOT EXISTS idx_transaction_tags_tag ON transaction_tags(tag_id);
+			`)
+			if err != nil {
+				return err
+			}
+			// Move the comma-separated tags into the new tables before dropping the column
+			if err := migrateTagColumn(context.Background(), db); err != nil {
+				return err
+			}
+			_, err = db.Exec(`ALTER TABLE transactions DROP COLUMN tags;`)
+			return err
+		},
+	},
+	{
+		ID: 10,
+		Up: func(db *sql.DB) error {
+			// The full-text index gains a notes column, so it's recreated and rebuilt. Notes change in
+			// place, so the triggers remove the old values with the 'delete' command.
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN notes TEXT;
+				DROP TRIGGER IF EXISTS transactions_ai;
+				DROP TRIGGER IF EXISTS transactions_ad;
+				DROP TRIGGER IF EXISTS transactions_au;
+				DROP TABLE IF EXISTS transactions_fts;
+				CREATE VIRTUAL TABLE transactions_fts USING fts5(
+					search_body,
+					notes,
+					content='transactions',
+					content_rowid='rowid'
+				);
+				CREATE TRIGGER transactions_ai AFTER INSERT ON transactions BEGIN
+					INSERT INTO transactions_fts(rowid, search_body, notes) VALUES (new.rowid, new.search_body, new.notes);
+				END;
+				CREATE TRIGGER transactions_ad AFTER DELETE ON transactions BEGIN
+					INSERT INTO transactions_fts(transactions_fts, rowid, search_body, notes) VALUES ('delete', old.rowid, old.search_body, old.notes);
+				END;
+				CREATE TRIGGER transactions_au AFTER UPDATE ON transactions BEGIN
+					INSERT INTO transactions_fts(transactions_fts, rowid, search_body, notes) VALUES ('delete', old.rowid, old.search_body, old.notes);
+					INSERT INTO transactions_fts(rowid, search_body, notes) VALUES (new.rowid, new.search_body, new.notes);
+				END;
+				INSERT INTO transactions_fts(transactions_fts) VALUES ('rebuild');
+				CREATE TABLE IF NOT EXISTS attachments (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					transaction_id TEXT NOT NULL,
+					hash TEXT NOT NULL,
+					filename TEXT NOT NULL,
+					content_type TEXT NOT NULL,
+					size INTEGER NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE (transaction_id, hash)
+				);
+				CREATE INDEX IF NOT EXISTS idx_attachments_transaction ON attachments(transaction_id);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 11,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS budgets (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					category TEXT NOT NULL DEFAULT '',
+					tag TEXT NOT NULL DEFAULT '' COLLATE NOCASE,
+					period TEXT NOT NULL,
+					amount DECIMAL(15,2) NOT NULL,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					UNIQUE (category, tag, period)
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 12,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN deduction TEXT;
+				ALTER TABLE merchants ADD COLUMN default_deduction TEXT;
+				CREATE INDEX IF NOT EXISTS idx_transactions_deduction ON transactions(deduction);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 13,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS alerts (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					transaction_id TEXT NOT NULL,
+					kind TEXT NOT NULL,
+					message TEXT NOT NULL,
+					related_id TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					dismissed_at DATETIME,
+					UNIQUE (transaction_id, kind)
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 14,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS fx_rates (
+					date TEXT NOT NULL,
+					currency TEXT NOT NULL,
+					rate DECIMAL(18,8) NOT NULL,
+					PRIMARY KEY (date, currency)
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 15,
+		Up: func(db *sql.DB) error {
+			// Amounts were stored as floating point, and amounts with thousands separators as text,
+			// so they're converted to whole numbers of minor units. Stored amounts are all in the
+			// default currency, apart from foreign amounts.
+			foreignScale := fmt.Sprintf(`CASE
+				WHEN UPPER(foreign_currency) IN (%s) THEN 1
+				WHEN UPPER(foreign_currency) IN (%s) THEN 1000
+				ELSE 100 END`,
+				quotedList(types.CurrenciesWithMinorUnitDigits(0)), quotedList(types.CurrenciesWithMinorUnitDigits(3)))
+			_, err := db.Exec(`
+				ALTER TABLE transactions ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0;
+				ALTER TABLE transactions ADD COLUMN currency TEXT NOT NULL DEFAULT 'AUD';
+				ALTER TABLE transactions ADD COLUMN foreign_amount_minor INTEGER;
+				UPDATE transactions SET
+					amount_minor = CAST(ROUND(CAST(REPLACE(CAST(amount AS TEXT), ',', '') AS REAL) * 100) AS INTEGER),
+					foreign_currency = UPPER(foreign_currency),
+					foreign_amount_minor = CASE WHEN foreign_amount IS NULL THEN NULL
+						ELSE CAST(ROUND(foreign_amount * ` + foreignScale + `) AS INTEGER) END;
+				DROP INDEX IF EXISTS idx_transactions_amount;
+				ALTER TABLE transactions DROP COLUMN amount;
+				ALTER TABLE transactions DROP COLUMN foreign_amount;
+				CREATE INDEX IF NOT EXISTS idx_transactions_amount ON transactions(amount_minor);
+
+				ALTER TABLE transaction_splits ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0;
+				UPDATE transaction_splits SET amount_minor = CAST(ROUND(amount * 100) AS INTEGER);
+				ALTER TABLE transaction_splits DROP COLUMN amount;
+
+				ALTER TABLE budgets ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0;
+				UPDATE budgets SET amount_minor = CAST(ROUND(amount * 100) AS INTEGER);
+				ALTER TABLE budgets DROP COLUMN amount;
+
+				ALTER TABLE recurring_series ADD COLUMN amount_minor INTEGER NOT NULL DEFAULT 0;
+				ALTER TABLE recurring_series ADD COLUMN previous_amount_minor INTEGER;
+				UPDATE recurring_series SET
+					amount_minor = CAST(ROUND(amount * 100) AS INTEGER),
+					previous_amount_minor = CAST(ROUND(previous_amount * 100) AS INTEGER);
+				ALTER TABLE recurring_series DROP COLUMN amount;
+				ALTER TABLE recurring_series DROP COLUMN previous_amount;
+			`)
+			return err
+		},
+	},
+	{
+		ID: 16,
+		Up: func(db *sql.DB) error {
+			// Rates were all quoted in the default currency, which is now stored with each rate
+			_, err := db.Exec(`
+				ALTER TABLE fx_rates RENAME TO fx_rates_old;
+				CREATE TABLE fx_rates (
+					date TEXT NOT NULL,
+					currency TEXT NOT NULL,
+					quote TEXT NOT NULL DEFAULT 'AUD',
+					rate DECIMAL(18,8) NOT NULL,
+					PRIMARY KEY (date, currency, quote)
+				);
+				INSERT INTO fx_rates (date, currency, rate) SELECT date, currency, rate FROM fx_rates_old;
+				DROP TABLE fx_rates_old;
+
+				CREATE TABLE IF NOT EXISTS accounts (
+					name TEXT PRIMARY KEY COLLATE NOCASE,
+					currency TEXT NOT NULL
+				);
+			`)
+			return err
+		},
+	},
+	{
+		ID: 17,
+		Up: func(db *sql.DB) error {
+			_, err := db.Exec(`
+				CREATE TABLE IF NOT EXISTS trips (
+					id TEXT PRIMARY KEY,
+					name TEXT NOT NULL,
+					destination TEXT NOT NULL,
+					countries TEXT NOT NULL DEFAULT '',
+					start_date TEXT NOT NULL,
+					end_date TEXT NOT NULL
+				);
+				CREATE TABLE IF NOT EXISTS trip_transactions (
+					transaction_id TEXT PRIMARY KEY,
+					trip_id TEXT NOT NULL,
+					prebooked INTEGER NOT NULL DEFAULT 0
+				);
+				CREATE INDEX IF NOT EXISTS idx_trip_transactions_trip ON trip_transactions(trip_id);
+			`)
+			return err
+		},
+	},
+}
+
+// quotedList formats strings as a list of SQL string literals, for strings from code rather than input
+func quotedList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return strings.Join(quoted, ", ")
 }
 
 // ApplyMigrations applies all pending migrations to the database.
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/log"
+	"github.com/lox/bank-transaction-analyzer/internal/bank/ing"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+// TestReimportAfterMinorUnitsMigration upgrades a database from before amounts were stored as
+// minor units and imports the same statement again, which must find the existing transaction
+// rather than storing a duplicate
+func TestReimportAfterMinorUnitsMigration(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	statement := "!Type:Bank\nD01/03/2024\nT-1,234.56\nPFlight Centre Melbourne\n^\n"
+
+	details := types.TransactionDetails{Type: "purchase", Merchant: "Flight Centre", Category: "Travel", SearchBody: "flight centre"}
+	parse := func(imported bool) ([]string, *DB) {
+		transactions, err := ing.New().ParseTransactions(ctx, strings.NewReader(statement))
+		if err != nil {
+			t.Fatalf("failed to parse statement: %v", err)
+		}
+		database, err := New(dir, log.New(io.Discard), time.UTC)
+		if err != nil {
+			t.Fatalf("failed to open database: %v", err)
+		}
+		var ids []string
+		for _, tx := range transactions {
+			ids = append(ids, GenerateTransactionID(tx))
+			if exists, err := database.Has(ctx, tx); err != nil || exists != imported {
+				t.Fatalf("expected the transaction to exist only once imported, got %t: %v", exists, err)
+			}
+			if err := database.Store(ctx, tx, &details); err != nil {
+				t.Fatalf("failed to store transaction: %v", err)
+			}
+		}
+		return ids, database
+	}
+	_, database := parse(false)
+	database.Close()
+
+	// IDs were hashed from the amount as the export wrote it
+	sum := sha256.Sum256([]byte("Flight Centre Melbourne|-1,234.56|01/03/2024|ing-australia"))
+	legacyID := hex.EncodeToString(sum[:])[:8]
+
+	// Put the database back how it was before migration 15, with the amount as the export wrote it
+	raw, err := sql.Open("sqlite3", filepath.Join(dir, "transactions.db"))
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	_, err = raw.Exec(`
+		DROP INDEX idx_transactions_amount;
+		ALTER TABLE transactions ADD COLUMN amount DECIMAL(15,2) NOT NULL DEFAULT 0;
+		ALTER TABLE transactions ADD COLUMN foreign_amount DECIMAL(15,2);
+		UPDATE transactions SET amount = '-1,234.56', id = '` + legacyID + `';
+		ALTER TABLE transactions DROP COLUMN amount_minor;
+		ALTER TABLE transactions DROP COLUMN currency;
+		ALTER TABLE transactions DROP COLUMN foreign_amount_minor;
+		ALTER TABLE transaction_splits ADD COLUMN amount DECIMAL(15,2) NOT NULL DEFAULT 0;
+		ALTER TABLE transaction_splits DROP COLUMN amount_minor;
+		ALTER TABLE budgets ADD COLUMN amount DECIMAL(15,2) NOT NULL DEFAULT 0;
+		ALTER TABLE budgets DROP COLUMN amount_minor;
+		ALTER TABLE recurring_series ADD COLUMN amount DECIMAL(15,2) NOT NULL DEFAULT 0;
+		ALTER TABLE recurring_series ADD COLUMN previous_amount DECIMAL(15,2);
+		ALTER TABLE recurring_series DROP COLUMN amount_minor;
+		ALTER TABLE recurring_series DROP COLUMN previous_amount_minor;
+		DROP TABLE accounts;
+		DELETE FROM migrations WHERE id >= 15;
+	`)
+	raw.Close()
+	if err != nil {
+		t.Fatalf("failed to downgrade database: %v", err)
+	}
+
+	reimported, database := parse(true)
+	defer database.Close()
+	if reimported[0] != legacyID {
+		t.Errorf("expected the ID from before upgrading, got %s and %s", legacyID, reimported[0])
+	}
+	all, err := database.GetTransactions(ctx)
+	if err != nil {
+		t.Fatalf("failed to get transactions: %v", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("expected the transaction to be imported once, got %d", len(all))
+	}
+	if all[0].ID != legacyID || all[0].Amount.MinorUnits() != -123456 {
+		t.Errorf("expected %s for -1234.56, got %s for %s", legacyID, all[0].ID, all[0].Amount)
+	}
+}
@@ -0,0 +1,408 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Cadences a recurring series can have
+const (
+	CadenceWeekly      = "weekly"
+	CadenceFortnightly = "fortnightly"
+	CadenceMonthly     = "monthly"
+	CadenceQuarterly   = "quarterly"
+	CadenceAnnual      = "annual"
+)
+
+// cadence describes how often a series recurs and how much slack each payment gets
+type cadence struct {
+	name      string
+	days      float64 // Typical days between payments
+	tolerance float64 // Days an interval may differ from the typical interval
+	grace     int     // Days past the expected date before a series counts as stopped
+	minCount  int     // Payments needed before the series is trusted
+	next      func(time.Time) time.Time
+}
+
+var cadences = []cadence{
+	{CadenceWeekly, 7, 1.5, 4, 4, func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }},
+	{CadenceFortnightly, 14, 2.5, 6, 3, func(t time.Time) time.Time { return t.AddDate(0, 0, 14) }},
+	{CadenceMonthly, 30.44, 4.5, 10, 3, func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{CadenceQuarterly, 91.31, 12, 21, 3, func(t time.Time) time.Time { return t.AddDate(0, 3, 0) }},
+	{CadenceAnnual, 365.25, 25, 45, 2, func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+}
+
+// cadenceByName returns the cadence with the given name
+func cadenceByName(name string) (cadence, bool) {
+	for _, c := range cadences {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return cadence{}, false
+}
+
+// recurringAmountTolerance is how much a payment may differ from the previous one in a series,
+// which allows for price rises and usage-based bills
+var recurringAmountTolerance = decimal.NewFromFloat(0.2)
+
+// RecurringSeries is a run of payments to or from the same merchant at a regular cadence
+type RecurringSeries struct {
+	ID               string          `json:"id"`
+	Merchant         string          `json:"merchant"`
+	Bank             string          `json:"bank"`
+	Type             string          `json:"type"`
+	Category         string          `json:"category"`
+	Cadence          string          `json:"cadence"`
+	Amount           decimal.Decimal `json:"amount"`          // Most recent amount, expected for the next payment, in the base currency once stored
+	PreviousAmount   decimal.Decimal `json:"previous_amount"` // Amount before the most recent price change, in the base currency once stored
+	FirstDate        time.Time       `json:"first_date"`
+	LastDate         time.Time       `json:"last_date"`
+	NextDate         time.Time       `json:"next_date"`
+	TransactionCount int             `json:"transaction_count"`
+	TransactionIDs   []string        `json:"transaction_ids,omitempty"`
+}
+
+// Stopped reports whether the next payment is overdue by more than the cadence allows
+func (s RecurringSeries) Stopped(now time.Time) bool {
+	c, ok := cadenceByName(s.Cadence)
+	if !ok {
+		return false
+	}
+	return now.After(s.NextDate.AddDate(0, 0, c.grace))
+}
+
+// PriceChanged reports whether the most recent payment differs from the one before it
+func (s RecurringSeries) PriceChanged() bool {
+	return !s.PreviousAmount.IsZero() && !s.PreviousAmount.Equal(s.Amount)
+}
+
+// MonthlyAmount is the series amount spread over an average month
+func (s RecurringSeries) MonthlyAmount() decimal.Decimal {
+	c, ok := cadenceByName(s.Cadence)
+	if !ok {
+		return s.Amount
+	}
+	return s.Amount.Mul(decimal.NewFromFloat(30.44 / c.days)).Round(2)
+}
+
+// Status summarises a series as active, stopped or price changed
+func (s RecurringSeries) Status(now time.Time) string {
+	switch {
+	case s.Stopped(now):
+		return "stopped"
+	case s.PriceChanged():
+		return "price changed"
+	default:
+		return "active"
+	}
+}
+
+// recurringCandidate is a transaction considered for a recurring series
+type recurringCandidate struct {
+	id     string
+	date   time.Time
+	amount decimal.Decimal
+	t      types.TransactionWithDetails
+}
+
+// merchantNoiseWords are dropped when normalizing merchant names
+var merchantNoiseWords = map[string]bool{
+	"com": true, "net": true, "www": true, "au": true, "pty": true, "ltd": true, "inc": true,
+}
+
+// NormalizeMerchant reduces a merchant name to a key that ignores case, punctuation, domains and
+// store numbers, so "NETFLIX.COM" and "Netflix 1234" group together
+func NormalizeMerchant(merchant string) string {
+	words := strings.FieldsFunc(strings.ToLower(merchant), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var kept []string
+	for _, w := range words {
+		isNumber := strings.IndexFunc(w, func(r rune) bool { return !unicode.IsDigit(r) }) == -1
+		if merchantNoiseWords[w] || (isNumber && len(w) >= 3) {
+			continue
+		}
+		kept = append(kept, w)
+	}
+	return strings.Join(kept, " ")
+}
+
+// DetectRecurring finds recurring series in transactions. Transactions are grouped by normalized
+// merchant, currency and direction, split into runs of similar amounts, and kept when the gaps
+// between payments match a cadence. Amounts are in the currency the transactions were paid in.
+func DetectRecurring(transactions []types.TransactionWithDetails, location *time.Location) []RecurringSeries {
+	groups := make(map[string][]recurringCandidate)
+	for _, t := range transactions {
+		key := NormalizeMerchant(t.Details.Merchant)
+		if key == "" {
+			continue
+		}
+		date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+		if err != nil {
+			continue
+		}
+		amount := t.Amount.Amount
+		if amount.IsZero() {
+			continue
+		}
+		key = fmt.Sprintf("%s|%s|%s|%t", key, t.Bank, currencyOrDefault(t.Amount.Currency), amount.IsNegative())
+		groups[key] = append(groups[key], recurringCandidate{id: t.ID, date: date, amount: amount, t: t})
+	}
+
+	var series []RecurringSeries
+	for _, candidates := range groups {
+		sort.Slice(candidates, func(i, j int) bool {
+			if !candidates[i].date.Equal(candidates[j].date) {
+				return candidates[i].date.Before(candidates[j].date)
+			}
+			return candidates[i].id < candidates[j].id
+		})
+		for _, run := range splitByAmount(candidates) {
+			if s, ok := detectCadence(run); ok {
+				series = append(series, s)
+			}
+		}
+	}
+
+	sort.Slice(series, func(i, j int) bool {
+		if !series[i].NextDate.Equal(series[j].NextDate) {
+			return series[i].NextDate.Before(series[j].NextDate)
+		}
+		return series[i].ID < series[j].ID
+	})
+	return series
+}
+
+// splitByAmount splits date-ordered candidates into runs where each amount is close to the
+// previous amount in the same run
+func splitByAmount(candidates []recurringCandidate) [][]recurringCandidate {
+	var runs [][]recurringCandidate
+	for _, c := range candidates {
+		matched := false
+		for i, run := range runs {
+			last := run[len(run)-1].amount.Abs()
+			if c.amount.Abs().Sub(last).Abs().LessThanOrEqual(last.Mul(recurringAmountTolerance)) {
+				runs[i] = append(run, c)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			runs = append(runs, []recurringCandidate{c})
+		}
+	}
+	return runs
+}
+
+// detectCadence returns a series if the gaps between payments in the run match a cadence
+func detectCadence(run []recurringCandidate) (RecurringSeries, bool) {
+	if len(run) < 2 {
+		return RecurringSeries{}, false
+	}
+
+	intervals := make([]float64, 0, len(run)-1)
+	for i := 1; i < len(run); i++ {
+		intervals = append(intervals, run[i].date.Sub(run[i-1].date).Hours()/24)
+	}
+	sorted := append([]float64(nil), intervals...)
+	sort.Float64s(sorted)
+	median := sorted[len(sorted)/2]
+
+	for _, c := range cadences {
+		if len(run) < c.minCount || abs(median-c.days) > c.tolerance {
+			continue
+		}
+		// Allow the odd late or early payment, but most gaps must fit the cadence
+		regular := 0
+		for _, interval := range intervals {
+			if abs(interval-c.days) <= c.tolerance {
+				regular++
+			}
+		}
+		if float64(regular) < 0.75*float64(len(intervals)) {
+			continue
+		}
+
+		first, last := run[0], run[len(run)-1]
+		ids := make([]string, len(run))
+		for i, r := range run {
+			ids[i] = r.id
+		}
+		s := RecurringSeries{
+			ID:               recurringSeriesID(first.t, c.name, first.id),
+			Merchant:         last.t.Details.Merchant,
+			Bank:             last.t.Bank,
+			Type:             last.t.Details.Type,
+			Category:         last.t.Details.Category,
+			Cadence:          c.name,
+			Amount:           last.amount,
+			FirstDate:        first.date,
+			LastDate:         last.date,
+			NextDate:         c.next(last.date),
+			TransactionCount: len(run),
+			TransactionIDs:   ids,
+		}
+		if previous := run[len(run)-2].amount; !previous.Equal(last.amount) {
+			s.PreviousAmount = previous
+		}
+		return s, true
+	}
+	return RecurringSeries{}, false
+}
+
+// recurringSeriesID derives a stable ID from the merchant, cadence and first payment
+func recurringSeriesID(t types.TransactionWithDetails, cadence, firstID string) string {
+	sum := sha256.Sum256([]byte(NormalizeMerchant(t.Details.Merchant) + "|" + t.Bank + "|" + cadence + "|" + firstID))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// RefreshRecurringSeries detects recurring series across all transactions, replaces the stored
+// series and tags their member transactions. Series amounts are stored in the base currency, so
+// they can be totalled and forecast alongside other spending. Transfers between our own accounts,
+// such as credit card repayments, aren't considered.
+func (d *DB) RefreshRecurringSeries(ctx context.Context) ([]RecurringSeries, error) {
+	transactions, err := d.GetTransactions(ctx, ExcludeInternalTransfers())
+	if err != nil {
+		return nil, err
+	}
+	series := DetectRecurring(transactions, d.timezone)
+
+	byID := make(map[string]types.TransactionWithDetails, len(transactions))
+	for _, t := range transactions {
+		byID[t.ID] = t
+	}
+	for i := range series {
+		if series[i], err = d.seriesInBaseCurrency(ctx, series[i], byID); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE transactions SET recurring_series_id = NULL WHERE recurring_series_id IS NOT NULL`); err != nil {
+		return nil, fmt.Errorf("failed to clear recurring series: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recurring_series`); err != nil {
+		return nil, fmt.Errorf("failed to clear recurring series: %w", err)
+	}
+
+	for _, s := range series {
+		var previous sql.NullInt64
+		if !s.PreviousAmount.IsZero() {
+			previous = sql.NullInt64{Int64: types.NewMoney(s.PreviousAmount, d.baseCurrency).MinorUnits(), Valid: true}
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO recurring_series (
+				id, merchant, bank, type, category, cadence, amount_minor, previous_amount_minor,
+				first_date, last_date, next_date, transaction_count
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`,
+			s.ID, s.Merchant, s.Bank, s.Type, s.Category, s.Cadence, types.NewMoney(s.Amount, d.baseCurrency).MinorUnits(), previous,
+			s.FirstDate.Format("2006-01-02"), s.LastDate.Format("2006-01-02"), s.NextDate.Format("2006-01-02"), s.TransactionCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recurring series: %w", err)
+		}
+
+		params := []any{s.ID}
+		for _, id := range s.TransactionIDs {
+			params = append(params, id)
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE transactions SET recurring_series_id = ? WHERE id IN (`+placeholders(len(s.TransactionIDs))+`)`, params...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to tag recurring transactions: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recurring series: %w", err)
+	}
+
+	d.logger.Info("Refreshed recurring series", "count", len(series))
+	return series, nil
+}
+
+// seriesInBaseCurrency converts a series' latest and previous amounts to the base currency, at
+// the rates on the days they were paid
+func (d *DB) seriesInBaseCurrency(ctx context.Context, s RecurringSeries, transactions map[string]types.TransactionWithDetails) (RecurringSeries, error) {
+	ids := s.TransactionIDs
+	last := transactions[ids[len(ids)-1]]
+	amount, err := d.ToBaseCurrency(ctx, last.Amount, last.Date)
+	if err != nil {
+		return s, err
+	}
+	s.Amount = amount
+	if !s.PreviousAmount.IsZero() {
+		previous := transactions[ids[len(ids)-2]]
+		if s.PreviousAmount, err = d.ToBaseCurrency(ctx, previous.Amount, previous.Date); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
+
+// GetRecurringSeries returns the stored recurring series, soonest next payment first
+func (d *DB) GetRecurringSeries(ctx context.Context) ([]RecurringSeries, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT id, merchant, bank, type, COALESCE(category, ''), cadence, amount_minor, previous_amount_minor,
+			first_date, last_date, next_date, transaction_count
+		FROM recurring_series
+		ORDER BY next_date, merchant
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring series: %w", err)
+	}
+	defer rows.Close()
+
+	var series []RecurringSeries
+	for rows.Next() {
+		var s RecurringSeries
+		var amount int64
+		var previous sql.NullInt64
+		var first, last, next string
+		if err := rows.Scan(&s.ID, &s.Merchant, &s.Bank, &s.Type, &s.Category, &s.Cadence, &amount, &previous,
+			&first, &last, &next, &s.TransactionCount); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring series: %w", err)
+		}
+		s.Amount = d.fromBaseMinorUnits(amount)
+		if previous.Valid {
+			s.PreviousAmount = d.fromBaseMinorUnits(previous.Int64)
+		}
+		for _, date := range []struct {
+			value string
+			dest  *time.Time
+		}{{first, &s.FirstDate}, {last, &s.LastDate}, {next, &s.NextDate}} {
+			if *date.dest, err = time.ParseInLocation("2006-01-02", date.value, d.timezone); err != nil {
+				return nil, fmt.Errorf("invalid recurring series date %q: %w", date.value, err)
+			}
+		}
+		series = append(series, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating recurring series: %w", err)
+	}
+
+	return series, nil
+}
@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestNormalizeMerchant(t *testing.T) {
+	tests := map[string]string{
+		"NETFLIX.COM":       "netflix",
+		"Netflix 1234":      "netflix",
+		"Acme Pty Ltd":      "acme",
+		"McDonald's #4412":  "mcdonald s",
+		"7-Eleven":          "7 eleven",
+		"  ":                "",
+		"Spotify P1A2B3C4D": "spotify p1a2b3c4d",
+	}
+	for input, want := range tests {
+		if got := NormalizeMerchant(input); got != want {
+			t.Errorf("NormalizeMerchant(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestDetectRecurring(t *testing.T) {
+	transactions := []types.TransactionWithDetails{
+		// Monthly with a price rise in the last payment
+		testTransaction("n1", "03/01/2024", "-15.99", "purchase", "Netflix"),
+		testTransaction("n2", "03/02/2024", "-15.99", "purchase", "NETFLIX.COM"),
+		testTransaction("n3", "04/03/2024", "-15.99", "purchase", "Netflix"),
+		testTransaction("n4", "03/04/2024", "-18.99", "purchase", "Netflix"),
+		// Weekly
+		testTransaction("g1", "01/03/2024", "-20.00", "purchase", "Gym"),
+		testTransaction("g2", "08/03/2024", "-20.00", "purchase", "Gym"),
+		testTransaction("g3", "15/03/2024", "-20.00", "purchase", "Gym"),
+		testTransaction("g4", "22/03/2024", "-20.00", "purchase", "Gym"),
+		// Same merchant but irregular and different amounts
+		testTransaction("c1", "01/01/2024", "-4.50", "purchase", "Cafe"),
+		testTransaction("c2", "03/01/2024", "-12.00", "purchase", "Cafe"),
+		testTransaction("c3", "20/02/2024", "-4.50", "purchase", "Cafe"),
+		// A large one-off from the monthly merchant doesn't join the series
+		testTransaction("n5", "15/02/2024", "-120.00", "purchase", "Netflix"),
+	}
+
+	series := DetectRecurring(transactions, time.UTC)
+	if len(series) != 2 {
+		t.Fatalf("expected 2 series, got %d: %+v", len(series), series)
+	}
+
+	gym, netflix := series[0], series[1]
+	if gym.Merchant != "Gym" || gym.Cadence != CadenceWeekly || gym.TransactionCount != 4 {
+		t.Errorf("unexpected weekly series: %+v", gym)
+	}
+	if want := time.Date(2024, 3, 29, 0, 0, 0, 0, time.UTC); !gym.NextDate.Equal(want) {
+		t.Errorf("expected next gym payment on %s, got %s", want, gym.NextDate)
+	}
+
+	if netflix.Cadence != CadenceMonthly || netflix.TransactionCount != 4 {
+		t.Errorf("unexpected monthly series: %+v", netflix)
+	}
+	if !netflix.PriceChanged() || netflix.PreviousAmount.String() != "-15.99" || netflix.Amount.String() != "-18.99" {
+		t.Errorf("expected a price change from -15.99 to -18.99, got %s to %s", netflix.PreviousAmount, netflix.Amount)
+	}
+	if want := time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC); !netflix.NextDate.Equal(want) {
+		t.Errorf("expected next netflix payment on %s, got %s", want, netflix.NextDate)
+	}
+
+	if netflix.Stopped(time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected series to be active a week after the expected payment")
+	}
+	if !netflix.Stopped(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("expected series to be stopped a month after the expected payment")
+	}
+}
+
+func TestRefreshRecurringSeries(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	for _, date := range []string{"10/01/2024", "10/02/2024", "11/03/2024", "10/04/2024"} {
+		transaction := types.Transaction{Date: date, Amount: money("-11.99"), Payee: "SPOTIFY P1234 " + date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: "Spotify", Category: "Entertainment", SearchBody: "spotify"}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	detected, err := db.RefreshRecurringSeries(ctx)
+	if err != nil {
+		t.Fatalf("failed to refresh recurring series: %v", err)
+	}
+	if len(detected) != 1 {
+		t.Fatalf("expected 1 series, got %d", len(detected))
+	}
+
+	stored, err := db.GetRecurringSeries(ctx)
+	if err != nil {
+		t.Fatalf("failed to get recurring series: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("expected 1 stored series, got %d", len(stored))
+	}
+	s := stored[0]
+	if s.ID != detected[0].ID || s.Cadence != CadenceMonthly || s.Amount.String() != "-11.99" || s.TransactionCount != 4 {
+		t.Errorf("unexpected stored series: %+v", s)
+	}
+	if s.NextDate.Format("2006-01-02") != "2024-05-10" {
+		t.Errorf("expected next payment on 2024-05-10, got %s", s.NextDate.Format("2006-01-02"))
+	}
+
+	// Member transactions are tagged with the series
+	transactions, err := db.GetTransactions(ctx)
+	if err != nil {
+		t.Fatalf("failed to get transactions: %v", err)
+	}
+	for _, tx := range transactions {
+		if tx.Details.RecurringSeriesID != s.ID {
+			t.Errorf("expected transaction %s to be tagged with series %s, got %q", tx.ID, s.ID, tx.Details.RecurringSeriesID)
+		}
+	}
+
+	// Refreshing again replaces rather than duplicates the series
+	if _, err := db.RefreshRecurringSeries(ctx); err != nil {
+		t.Fatalf("failed to refresh recurring series: %v", err)
+	}
+	stored, err = db.GetRecurringSeries(ctx)
+	if err != nil {
+		t.Fatalf("failed to get recurring series: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Errorf("expected 1 stored series after a second refresh, got %d", len(stored))
+	}
+}
+
+func TestRefreshRecurringSeriesInBaseCurrency(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	if _, err := db.SetAccountCurrency(ctx, "wise", "usd"); err != nil {
+		t.Fatalf("failed to set account currency: %v", err)
+	}
+	for date, amount := range map[string]string{"10/01/2024": "-10.00", "10/02/2024": "-10.00", "10/03/2024": "-10.00", "10/04/2024": "-11.00"} {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: "GITHUB " + date, Bank: "wise"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: "GitHub", Category: "Services", SearchBody: "github"}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	if _, err := db.RefreshRecurringSeries(ctx); err == nil {
+		t.Fatal("expected an error without USD rates")
+	}
+
+	if err := db.ImportFXRates(ctx, []FXRate{
+		{Date: time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC), Currency: "USD", Rate: decimal.RequireFromString("1.50")},
+		{Date: time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC), Currency: "USD", Rate: decimal.RequireFromString("1.60")},
+	}); err != nil {
+		t.Fatalf("failed to import rates: %v", err)
+	}
+	if _, err := db.RefreshRecurringSeries(ctx); err != nil {
+		t.Fatalf("failed to refresh recurring series: %v", err)
+	}
+
+	// The latest and previous payments are converted at the rates on the days they were paid
+	stored, err := db.GetRecurringSeries(ctx)
+	if err != nil {
+		t.Fatalf("failed to get recurring series: %v", err)
+	}
+	if len(stored) != 1 {
+		t.Fatalf("expected 1 stored series, got %d", len(stored))
+	}
+	if s := stored[0]; s.Amount.StringFixed(2) != "-17.60" || s.PreviousAmount.StringFixed(2) != "-15.00" {
+		t.Errorf("expected -17.60 AUD, previously -15.00, got %s previously %s", s.Amount, s.PreviousAmount)
+	}
+}
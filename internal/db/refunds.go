@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultRefundWindow is how many days after a purchase a refund can arrive
+const DefaultRefundWindow = 120
+
+// RefundMatch links a refund to the purchase it reverses
+type RefundMatch struct {
+	RefundID   string          `json:"refund_id"`
+	PurchaseID string          `json:"purchase_id"`
+	Amount     decimal.Decimal `json:"amount"`
+	Full       bool            `json:"full"` // Whether the refund is for the whole purchase amount
+	Source     string          `json:"source"`
+}
+
+// refundCandidate is a transaction considered for refund linking
+type refundCandidate struct {
+	t        types.TransactionWithDetails
+	date     time.Time
+	amount   decimal.Decimal
+	merchant string
+}
+
+// nonPurchaseTypes are the debit types that can't be refunded
+var nonPurchaseTypes = map[string]bool{"transfer": true, "fee": true, "interest": true, "withdrawal": true}
+
+// MatchRefunds links each refund to the most likely earlier purchase from the same merchant within
+// window days. A purchase can take several partial refunds until its amount is used up. Exact
+// amounts are preferred, then the same bank and card, then the closest purchase. Pairs in rejected
+// are never matched, and refunded holds amounts already refunded by manual links.
+func MatchRefunds(transactions []types.TransactionWithDetails, location *time.Location, window int, rejected map[[2]string]bool, refunded map[string]decimal.Decimal) []RefundMatch {
+	var refunds, purchases []refundCandidate
+	for _, t := range transactions {
+		date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+		if err != nil {
+			continue
+		}
+		amount := t.Amount.Amount
+		merchant := NormalizeMerchant(t.Details.Merchant)
+		if merchant == "" {
+			continue
+		}
+		c := refundCandidate{t: t, date: date, amount: amount, merchant: merchant}
+		switch {
+		case t.Details.Type == "refund" && amount.IsPositive():
+			refunds = append(refunds, c)
+		case amount.IsNegative() && !nonPurchaseTypes[t.Details.Type]:
+			purchases = append(purchases, c)
+		}
+	}
+
+	// Link refunds oldest first, so earlier refunds use up a purchase before later ones
+	sort.Slice(refunds, func(i, j int) bool {
+		if !refunds[i].date.Equal(refunds[j].date) {
+			return refunds[i].date.Before(refunds[j].date)
+		}
+		return refunds[i].t.ID < refunds[j].t.ID
+	})
+
+	remaining := make(map[string]decimal.Decimal)
+	for _, p := range purchases {
+		remaining[p.t.ID] = p.amount.Abs().Sub(refunded[p.t.ID])
+	}
+
+	var matches []RefundMatch
+	for _, r := range refunds {
+		var best *refundCandidate
+		var bestScore float64
+		for i := range purchases {
+			p := &purchases[i]
+			if rejected[[2]string{r.t.ID, p.t.ID}] || !sameMerchant(r.merchant, p.merchant) {
+				continue
+			}
+			days := r.date.Sub(p.date).Hours() / 24
+			if days < 0 || days > float64(window) || r.amount.GreaterThan(remaining[p.t.ID]) {
+				continue
+			}
+			score := -days / 30
+			if r.amount.Equal(p.amount.Abs()) {
+				score += 10
+			}
+			if r.t.Bank == p.t.Bank {
+				score += 3
+			}
+			if r.t.Details.CardToken != "" && r.t.Details.CardToken == p.t.Details.CardToken {
+				score += 3
+			}
+			if best == nil || score > bestScore {
+				best, bestScore = p, score
+			}
+		}
+		if best == nil {
+			continue
+		}
+		remaining[best.t.ID] = remaining[best.t.ID].Sub(r.amount)
+		matches = append(matches, RefundMatch{
+			RefundID:   r.t.ID,
+			PurchaseID: best.t.ID,
+			Amount:     r.amount,
+			Full:       r.amount.Equal(best.amount.Abs()),
+			Source:     LinkSourceAuto,
+		})
+	}
+	return matches
+}
+
+// sameMerchant reports whether two normalized merchant names refer to the same merchant,
+// allowing one to be a longer form of the other such as "amazon" and "amazon marketplace"
+func sameMerchant(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+" ") || strings.HasPrefix(b, a+" ")
+}
+
+// RefreshRefundLinks links refunds to the purchases they reverse and replaces the automatic
+// refund links. Manual links and rejected pairs are kept.
+func (d *DB) RefreshRefundLinks(ctx context.Context, window int) ([]RefundMatch, error) {
+	links, err := d.getRefundLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manual := make(map[string]bool)
+	refunded := make(map[string]decimal.Decimal)
+	rejected := make(map[[2]string]bool)
+	for _, l := range links {
+		switch l.Source {
+		case LinkSourceManual:
+			manual[l.RefundID] = true
+			refunded[l.PurchaseID] = refunded[l.PurchaseID].Add(l.Amount)
+		case LinkSourceRejected:
+			rejected[[2]string{l.RefundID, l.PurchaseID}] = true
+		}
+	}
+
+	transactions, err := d.GetTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlinked := transactions[:0]
+	for _, t := range transactions {
+		if !manual[t.ID] {
+			unlinked = append(unlinked, t)
+		}
+	}
+	matches := MatchRefunds(unlinked, d.timezone, window, rejected, refunded)
+
+	pairs := make([][2]string, len(matches))
+	for i, m := range matches {
+		pairs[i] = [2]string{m.RefundID, m.PurchaseID}
+	}
+	if err := d.replaceAutoLinks(ctx, LinkKindRefund, pairs); err != nil {
+		return nil, err
+	}
+
+	d.logger.Info("Refreshed refund links", "count", len(matches))
+	return matches, nil
+}
+
+// GetRefundLinks returns the refunds linked to purchases, excluding rejected pairs
+func (d *DB) GetRefundLinks(ctx context.Context) ([]RefundMatch, error) {
+	links, err := d.getRefundLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []RefundMatch
+	for _, l := range links {
+		if l.Source != LinkSourceRejected {
+			matches = append(matches, l)
+		}
+	}
+	return matches, nil
+}
+
+// getRefundLinks returns all refund links, including rejected pairs
+func (d *DB) getRefundLinks(ctx context.Context) ([]RefundMatch, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT l.transaction_id, l.linked_id, l.source, COALESCE(r.amount_minor, 0), COALESCE(ABS(p.amount_minor), 0)
+		FROM transaction_links l
+		LEFT JOIN transactions r ON r.id = l.transaction_id
+		LEFT JOIN transactions p ON p.id = l.linked_id
+		WHERE l.kind = ?
+		ORDER BY r.date DESC, l.transaction_id
+	`, LinkKindRefund)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query refund links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []RefundMatch
+	for rows.Next() {
+		var m RefundMatch
+		var amount, purchase int64
+		if err := rows.Scan(&m.RefundID, &m.PurchaseID, &m.Source, &amount, &purchase); err != nil {
+			return nil, fmt.Errorf("failed to scan refund link: %w", err)
+		}
+		m.Amount = fromMinorUnits(amount)
+		m.Full = amount == purchase
+		links = append(links, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating refund links: %w", err)
+	}
+	return links, nil
+}
+
+// LinkRefund manually links a refund to the purchase it reverses, replacing any existing link on the refund
+func (d *DB) LinkRefund(ctx context.Context, refundID, purchaseID string) error {
+	refund, err := d.GetTransactionByID(ctx, refundID)
+	if err != nil {
+		return err
+	}
+	purchase, err := d.GetTransactionByID(ctx, purchaseID)
+	if err != nil {
+		return err
+	}
+	refundAmount, purchaseAmount := refund.Amount.Amount, purchase.Amount.Amount
+	if !refundAmount.IsPositive() || !purchaseAmount.IsNegative() {
+		return fmt.Errorf("refund %s must be a credit and purchase %s a debit", refundID, purchaseID)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM transaction_links
+		WHERE kind = ? AND transaction_id = ? AND (source != ? OR linked_id = ?)
+	`, LinkKindRefund, refundID, LinkSourceRejected, purchaseID); err != nil {
+		return fmt.Errorf("failed to remove existing refund link: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO transaction_links (transaction_id, linked_id, kind, source) VALUES (?, ?, ?, ?)
+	`, refundID, purchaseID, LinkKindRefund, LinkSourceManual); err != nil {
+		return fmt.Errorf("failed to link refund: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// UnlinkRefund removes the link from a refund to its purchase and stops linking from pairing
+// them again
+func (d *DB) UnlinkRefund(ctx context.Context, refundID string) error {
+	res, err := d.db.ExecContext(ctx, `
+		UPDATE transaction_links SET source = ?
+		WHERE kind = ? AND transaction_id = ? AND source != ?
+	`, LinkSourceRejected, LinkKindRefund, refundID, LinkSourceRejected)
+	if err != nil {
+		return fmt.Errorf("failed to unlink refund: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("transaction %s is not linked to a purchase", refundID)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestMatchRefunds(t *testing.T) {
+	transactions := []types.TransactionWithDetails{
+		// A full refund prefers the purchase with the exact amount over a closer one
+		testTransaction("shoes", "01/03/2024", "-80.00", "purchase", "The Iconic", onBank("amex")),
+		testTransaction("shirt", "10/03/2024", "-45.00", "purchase", "The Iconic", onBank("amex")),
+		testTransaction("shoes-refund", "15/03/2024", "80.00", "refund", "THE ICONIC PTY LTD", onBank("amex")),
+		// Two partial refunds share one purchase until its amount is used up
+		testTransaction("order", "01/04/2024", "-100.00", "purchase", "Amazon", onBank("ing-australia")),
+		testTransaction("partial-1", "05/04/2024", "30.00", "refund", "Amazon Marketplace", onBank("ing-australia")),
+		testTransaction("partial-2", "06/04/2024", "70.00", "refund", "Amazon", onBank("ing-australia")),
+		testTransaction("partial-3", "07/04/2024", "10.00", "refund", "Amazon", onBank("ing-australia")),
+		// Refunds never link to a later purchase, a different merchant, or outside the window
+		testTransaction("early-refund", "01/02/2024", "20.00", "refund", "JB Hi-Fi", onBank("amex")),
+		testTransaction("later", "02/02/2024", "-20.00", "purchase", "JB Hi-Fi", onBank("amex")),
+		testTransaction("other-refund", "20/03/2024", "45.00", "refund", "Myer", onBank("amex")),
+		testTransaction("old", "01/01/2023", "-60.00", "purchase", "Kmart", onBank("amex")),
+		testTransaction("old-refund", "01/03/2024", "60.00", "refund", "Kmart", onBank("amex")),
+	}
+
+	matches := MatchRefunds(transactions, time.UTC, DefaultRefundWindow, nil, nil)
+
+	got := make(map[string]RefundMatch)
+	for _, m := range matches {
+		got[m.RefundID] = m
+	}
+	want := map[string]string{
+		"shoes-refund": "shoes",
+		"partial-1":    "order",
+		"partial-2":    "order",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d matches, got %d: %+v", len(want), len(got), matches)
+	}
+	for refund, purchase := range want {
+		if got[refund].PurchaseID != purchase {
+			t.Errorf("expected %s to link to %s, got %q", refund, purchase, got[refund].PurchaseID)
+		}
+	}
+	if !got["shoes-refund"].Full || got["partial-1"].Full {
+		t.Errorf("expected only the shoes refund to be full, got %+v", matches)
+	}
+
+	// Rejected pairs are skipped, and manual refunds count against the purchase
+	matches = MatchRefunds(transactions, time.UTC, DefaultRefundWindow,
+		map[[2]string]bool{{"shoes-refund", "shoes"}: true},
+		map[string]decimal.Decimal{"order": decimal.NewFromInt(75)})
+	for _, m := range matches {
+		if m.RefundID == "shoes-refund" || m.RefundID == "partial-1" || m.RefundID == "partial-2" {
+			t.Errorf("expected %s not to match, got %+v", m.RefundID, m)
+		}
+	}
+}
+
+func TestRefreshRefundLinks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, payee, txType, category string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: payee, Bank: "amex"}
+		details := &types.TransactionDetails{Type: txType, Merchant: "Rebel Sport", Category: category, SearchBody: payee}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	purchase := store("01/03/2024", "-120.00", "REBEL SPORT CHADSTONE", "purchase", "Shopping")
+	refund := store("08/03/2024", "40.00", "REBEL SPORT REFUND", "refund", "Other")
+
+	matches, err := db.RefreshRefundLinks(ctx, DefaultRefundWindow)
+	if err != nil {
+		t.Fatalf("failed to refresh refund links: %v", err)
+	}
+	if len(matches) != 1 || matches[0].RefundID != refund || matches[0].PurchaseID != purchase {
+		t.Fatalf("expected the refund to link to the purchase, got %+v", matches)
+	}
+
+	tx, err := db.GetTransactionByID(ctx, purchase)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.RefundStatus() != "partially refunded" || tx.Details.RefundedAmount.StringFixed(2) != "40.00" {
+		t.Errorf("expected a partial refund of 40.00, got %q %s", tx.RefundStatus(), tx.Details.RefundedAmount)
+	}
+	if tx, err = db.GetTransactionByID(ctx, refund); err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.RefundOfID != purchase {
+		t.Errorf("expected refund to link to %s, got %q", purchase, tx.Details.RefundOfID)
+	}
+
+	// The refund nets against the purchase's category
+	rows, err := db.Aggregate(ctx, GroupByCategory)
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Key != "Shopping" || rows[0].Total.StringFixed(2) != "-80.00" {
+		t.Errorf("expected the refund to net against Shopping, got %+v", rows)
+	}
+
+	// Unlinking stops the pair being linked again
+	if err := db.UnlinkRefund(ctx, refund); err != nil {
+		t.Fatalf("failed to unlink refund: %v", err)
+	}
+	if matches, err = db.RefreshRefundLinks(ctx, DefaultRefundWindow); err != nil {
+		t.Fatalf("failed to refresh refund links: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches after unlinking, got %+v", matches)
+	}
+
+	// Manual links survive a refresh
+	if err := db.LinkRefund(ctx, refund, purchase); err != nil {
+		t.Fatalf("failed to link refund: %v", err)
+	}
+	if _, err := db.RefreshRefundLinks(ctx, DefaultRefundWindow); err != nil {
+		t.Fatalf("failed to refresh refund links: %v", err)
+	}
+	stored, err := db.GetRefundLinks(ctx)
+	if err != nil {
+		t.Fatalf("failed to get refund links: %v", err)
+	}
+	if len(stored) != 1 || stored[0].RefundID != refund || stored[0].Source != LinkSourceManual {
+		t.Errorf("expected the manual link to be kept, got %+v", stored)
+	}
+
+	if err := db.LinkRefund(ctx, purchase, refund); err == nil {
+		t.Error("expected an error linking a purchase as a refund")
+	}
+}
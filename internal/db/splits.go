@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// splitsColumn selects a transaction's splits as a JSON array, in the order they were set. Amounts
+// are in minor units of the transaction's currency.
+const splitsColumn = `(SELECT json_group_array(json_object(
+		'amount', s.amount_minor, 'category', s.category, 'tags', COALESCE(s.tags, ''), 'note', COALESCE(s.note, '')))
+		FROM transaction_splits s WHERE s.transaction_id = t.id)`
+
+// ValidateSplits checks that splits each have an allowed category and a non-zero amount with the
+// same sign as the transaction, in whole minor units of its currency, and that they sum to the
+// transaction amount as stored
+func ValidateSplits(amount types.Money, splits []types.Split) error {
+	digits := types.MinorUnitDigits(amount.Currency)
+	var total int64
+	for i, s := range splits {
+		if strings.TrimSpace(s.Category) == "" {
+			return fmt.Errorf("split %d has no category", i+1)
+		}
+		if _, ok := types.AllowedCategoriesMap[s.Category]; !ok {
+			allowed := make([]string, len(types.AllowedCategories))
+			for j, c := range types.AllowedCategories {
+				allowed[j] = c.Name
+			}
+			return fmt.Errorf("split %d has unknown category %q, expected one of: %s", i+1, s.Category, strings.Join(allowed, ", "))
+		}
+		if s.Amount.IsZero() || s.Amount.Sign() != amount.Amount.Sign() {
+			return fmt.Errorf("split %d amount %s must be non-zero with the same sign as %s", i+1, s.Amount.StringFixed(digits), amount)
+		}
+		// Splits are stored in minor units, so a fraction of a cent would be rounded away
+		split := types.NewMoney(s.Amount, amount.Currency)
+		if !split.Amount.Equal(s.Amount) {
+			return fmt.Errorf("split %d amount %s has more decimal places than %s has", i+1, s.Amount, split.Currency)
+		}
+		total += split.MinorUnits()
+	}
+	if total != amount.MinorUnits() {
+		return fmt.Errorf("splits sum to %s but the transaction amount is %s", types.MoneyFromMinorUnits(total, amount.Currency), amount)
+	}
+	return nil
+}
+
+// SetSplits replaces the splits on a transaction. Passing no splits removes them, so the
+// transaction counts wholly towards its own category again.
+func (d *DB) SetSplits(ctx context.Context, id string, splits []types.Split) error {
+	t, err := d.GetTransactionByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(splits) > 0 {
+		if err := ValidateSplits(t.Amount, splits); err != nil {
+			return err
+		}
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM transaction_splits WHERE transaction_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear splits: %w", err)
+	}
+	for i, s := range splits {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO transaction_splits (transaction_id, position, amount_minor, category, tags, note)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, id, i, types.NewMoney(s.Amount, t.Amount.Currency).MinorUnits(), s.Category, nullIfEmpty(s.Tags), nullIfEmpty(s.Note)); err != nil {
+			return fmt.Errorf("failed to store split: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ParseSplit parses a split written as amount:category[:tags[:note]], such as
+// "-45.20:Groceries" or "-30:Home:costco,bulk:paper towels"
+func ParseSplit(s string) (types.Split, error) {
+	parts := strings.SplitN(s, ":", 4)
+	if len(parts) < 2 {
+		return types.Split{}, fmt.Errorf("split %q must be amount:category[:tags[:note]]", s)
+	}
+	amount, err := decimal.NewFromString(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return types.Split{}, fmt.Errorf("invalid split amount %q: %w", parts[0], err)
+	}
+	split := types.Split{Amount: amount, Category: strings.TrimSpace(parts[1])}
+	if len(parts) > 2 {
+		split.Tags = strings.TrimSpace(parts[2])
+	}
+	if len(parts) > 3 {
+		split.Note = strings.TrimSpace(parts[3])
+	}
+	return split, nil
+}
+
+// ParseSplits parses a semicolon-separated list of splits in the form accepted by ParseSplit
+func ParseSplits(s string) ([]types.Split, error) {
+	var splits []types.Split
+	for _, part := range strings.Split(s, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		split, err := ParseSplit(part)
+		if err != nil {
+			return nil, err
+		}
+		splits = append(splits, split)
+	}
+	return splits, nil
+}
+
+// FormatSplits formats splits as the semicolon-separated list read by ParseSplits
+func FormatSplits(splits []types.Split) string {
+	parts := make([]string, len(splits))
+	for i, s := range splits {
+		parts[i] = s.Amount.StringFixed(2) + ":" + s.Category
+		if s.Tags != "" || s.Note != "" {
+			parts[i] += ":" + s.Tags
+		}
+		if s.Note != "" {
+			parts[i] += ":" + s.Note
+		}
+	}
+	return strings.Join(parts, "; ")
+}
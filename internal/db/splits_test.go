@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseSplits(t *testing.T) {
+	splits, err := ParseSplits("-80.00:Groceries; -30:Home:costco,bulk:paper towels: the big pack")
+	if err != nil {
+		t.Fatalf("failed to parse splits: %v", err)
+	}
+	if len(splits) != 2 {
+		t.Fatalf("expected 2 splits, got %+v", splits)
+	}
+	if splits[0].Amount.StringFixed(2) != "-80.00" || splits[0].Category != "Groceries" {
+		t.Errorf("unexpected first split: %+v", splits[0])
+	}
+	if splits[1].Tags != "costco,bulk" || splits[1].Note != "paper towels: the big pack" {
+		t.Errorf("unexpected second split: %+v", splits[1])
+	}
+	if got := FormatSplits(splits); got != "-80.00:Groceries; -30.00:Home:costco,bulk:paper towels: the big pack" {
+		t.Errorf("unexpected formatted splits: %q", got)
+	}
+
+	for _, bad := range []string{"Groceries", "abc:Groceries"} {
+		if _, err := ParseSplits(bad); err == nil {
+			t.Errorf("expected an error parsing %q", bad)
+		}
+	}
+}
+
+func TestValidateSplits(t *testing.T) {
+	amount := money("-100.00")
+	tests := []struct {
+		name   string
+		splits []types.Split
+		valid  bool
+	}{
+		{"sums to amount", []types.Split{
+			{Amount: decimal.RequireFromString("-60.00"), Category: "Groceries"},
+			{Amount: decimal.RequireFromString("-40.00"), Category: "Home"},
+		}, true},
+		{"short of amount", []types.Split{
+			{Amount: decimal.RequireFromString("-60.00"), Category: "Groceries"},
+		}, false},
+		{"opposite sign", []types.Split{
+			{Amount: decimal.RequireFromString("-120.00"), Category: "Groceries"},
+			{Amount: decimal.RequireFromString("20.00"), Category: "Home"},
+		}, false},
+		{"fractions of a cent", []types.Split{
+			{Amount: decimal.RequireFromString("-33.333"), Category: "Groceries"},
+			{Amount: decimal.RequireFromString("-33.333"), Category: "Home"},
+			{Amount: decimal.RequireFromString("-33.334"), Category: "Shopping"},
+		}, false},
+		{"trailing zeros", []types.Split{
+			{Amount: decimal.RequireFromString("-33.330"), Category: "Groceries"},
+			{Amount: decimal.RequireFromString("-66.67"), Category: "Home"},
+		}, true},
+		{"missing category", []types.Split{
+			{Amount: decimal.RequireFromString("-100.00")},
+		}, false},
+		{"unknown category", []types.Split{
+			{Amount: decimal.RequireFromString("-60.00"), Category: "Groceries"},
+			{Amount: decimal.RequireFromString("-40.00"), Category: "Household:Cleaning"},
+		}, false},
+		{"category in the wrong case", []types.Split{
+			{Amount: decimal.RequireFromString("-100.00"), Category: "groceries"},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSplits(amount, tt.splits)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid splits, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestSetSplits(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, merchant, category string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant, Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Category: category, SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	costco := store("02/03/2024", "-150.00", "Costco", "Groceries")
+	store("03/03/2024", "-20.00", "Woolworths", "Groceries")
+
+	splits := []types.Split{
+		{Amount: decimal.RequireFromString("-90.00"), Category: "Groceries"},
+		{Amount: decimal.RequireFromString("-45.00"), Category: "Home", Tags: "bulk"},
+		{Amount: decimal.RequireFromString("-15.00"), Category: "Shopping", Note: "birthday card"},
+	}
+	if err := db.SetSplits(ctx, costco, splits); err != nil {
+		t.Fatalf("failed to set splits: %v", err)
+	}
+	if err := db.SetSplits(ctx, costco, splits[:2]); err == nil {
+		t.Error("expected an error setting splits that don't sum to the amount")
+	}
+
+	tx, err := db.GetTransactionByID(ctx, costco)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if len(tx.Splits) != 3 || tx.Splits[1].Category != "Home" || tx.Splits[1].Tags != "bulk" || tx.Splits[2].Note != "birthday card" {
+		t.Fatalf("unexpected splits: %+v", tx.Splits)
+	}
+
+	// Each split counts towards its own category
+	rows, err := db.Aggregate(ctx, GroupByCategory)
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	totals := make(map[string]string)
+	for _, row := range rows {
+		totals[row.Key] = row.Total.StringFixed(2)
+	}
+	want := map[string]string{"Groceries": "-110.00", "Home": "-45.00", "Shopping": "-15.00"}
+	for category, total := range want {
+		if totals[category] != total {
+			t.Errorf("expected %s total %s, got %q", category, total, totals[category])
+		}
+	}
+
+	// Filtering by category only counts the matching splits
+	rows, err = db.Aggregate(ctx, GroupByMerchant, FilterByCategory("Home"))
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Key != "Costco" || rows[0].Total.StringFixed(2) != "-45.00" || rows[0].Count != 1 {
+		t.Errorf("expected only the Costco home split, got %+v", rows)
+	}
+	ids, err := db.GetTransactionIDs(ctx, FilterByCategory("Home"))
+	if err != nil {
+		t.Fatalf("failed to get transaction ids: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != costco {
+		t.Errorf("expected the split transaction in Home, got %v", ids)
+	}
+
+	// Splits survive the transaction being stored again
+	store("02/03/2024", "-150.00", "Costco", "Groceries")
+	if tx, err = db.GetTransactionByID(ctx, costco); err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if len(tx.Splits) != 3 {
+		t.Errorf("expected splits to survive a re-store, got %+v", tx.Splits)
+	}
+
+	if err := db.SetSplits(ctx, costco, nil); err != nil {
+		t.Fatalf("failed to clear splits: %v", err)
+	}
+	if tx, err = db.GetTransactionByID(ctx, costco); err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if len(tx.Splits) != 0 {
+		t.Errorf("expected no splits after clearing, got %+v", tx.Splits)
+	}
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// Summary periods
+const (
+	SummaryMonthly = "monthly"
+	SummaryYearly  = "yearly"
+)
+
+// SpendingTotal is what was spent in a category or at a merchant, as a positive amount
+type SpendingTotal struct {
+	Name   string          `json:"name"`
+	Count  int             `json:"count"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// SummaryChange is how a summary differs from an earlier period, positive when it went up
+type SummaryChange struct {
+	Period   string          `json:"period"`
+	Income   decimal.Decimal `json:"income"`
+	Expenses decimal.Decimal `json:"expenses"`
+	Net      decimal.Decimal `json:"net"`
+	// ExpensesPercent is the change in expenses as a percentage of the earlier period's, zero
+	// when nothing was spent then
+	ExpensesPercent decimal.Decimal `json:"expenses_percent"`
+}
+
+// SpendingSummary is the income and expenses over a period. Refunds reduce expenses rather
+// than counting as income, and transfers between your own accounts are left out.
+type SpendingSummary struct {
+	Period   string          `json:"period"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Income   decimal.Decimal `json:"income"`
+	Expenses decimal.Decimal `json:"expenses"`
+	Net      decimal.Decimal `json:"net"`
+	// SavingsRate is the net as a percentage of income, zero without income
+	SavingsRate   decimal.Decimal `json:"savings_rate"`
+	TopCategories []SpendingTotal `json:"top_categories"`
+	TopMerchants  []SpendingTotal `json:"top_merchants"`
+	// PreviousPeriod and PreviousYear compare against the period before and the same period a
+	// year earlier
+	PreviousPeriod *SummaryChange `json:"previous_period,omitempty"`
+	PreviousYear   *SummaryChange `json:"previous_year,omitempty"`
+}
+
+// SummarizeSpending totals income and expenses between start and end inclusive, with the top
+// categories and merchants by spending. Categories outside types.AllowedCategories count as
+// Other.
+func (d *DB) SummarizeSpending(ctx context.Context, start, end time.Time, top int, options ...TransactionQueryOption) (*SpendingSummary, error) {
+	options = append(options, FilterByDateRange(start, end), ExcludeInternalTransfers())
+
+	byType, err := d.Aggregate(ctx, GroupByType, options...)
+	if err != nil {
+		return nil, err
+	}
+	s := &SpendingSummary{Start: start, End: end}
+	for _, row := range byType {
+		if row.Key == "refund" {
+			s.Expenses = s.Expenses.Sub(row.Total)
+			continue
+		}
+		s.Income = s.Income.Add(row.Credits)
+		s.Expenses = s.Expenses.Sub(row.Debits)
+	}
+	s.Net = s.Income.Sub(s.Expenses)
+	if s.Income.IsPositive() {
+		s.SavingsRate = s.Net.Div(s.Income).Mul(decimal.NewFromInt(100)).Round(1)
+	}
+
+	byCategory, err := d.Aggregate(ctx, GroupByCategory, options...)
+	if err != nil {
+		return nil, err
+	}
+	categories := make(map[string]*SpendingTotal)
+	for _, row := range byCategory {
+		name := row.Key
+		if _, ok := types.AllowedCategoriesMap[name]; !ok {
+			name = "Other"
+		}
+		if categories[name] == nil {
+			categories[name] = &SpendingTotal{Name: name}
+		}
+		categories[name].Count += row.Count
+		categories[name].Amount = categories[name].Amount.Sub(row.Total)
+	}
+	for _, c := range types.AllowedCategories {
+		if total, ok := categories[c.Name]; ok && total.Amount.IsPositive() {
+			s.TopCategories = append(s.TopCategories, *total)
+		}
+	}
+	s.TopCategories = topSpending(s.TopCategories, top)
+
+	byMerchant, err := d.Aggregate(ctx, GroupByMerchant, options...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range byMerchant {
+		if row.Total.IsNegative() && row.Key != "" {
+			s.TopMerchants = append(s.TopMerchants, SpendingTotal{Name: row.Key, Count: row.Count, Amount: row.Total.Neg()})
+		}
+	}
+	s.TopMerchants = topSpending(s.TopMerchants, top)
+
+	return s, nil
+}
+
+// topSpending sorts totals by amount, largest first, keeping at most n
+func topSpending(totals []SpendingTotal, n int) []SpendingTotal {
+	sort.SliceStable(totals, func(i, j int) bool { return totals[i].Amount.GreaterThan(totals[j].Amount) })
+	if n > 0 && len(totals) > n {
+		totals = totals[:n]
+	}
+	return totals
+}
+
+// SummaryPeriodAt returns the month or year containing now, as its key and first and last days
+func SummaryPeriodAt(period string, now time.Time) (string, time.Time, time.Time, error) {
+	switch period {
+	case SummaryMonthly:
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		return start.Format("2006-01"), start, start.AddDate(0, 1, -1), nil
+	case SummaryYearly:
+		start := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+		return start.Format("2006"), start, start.AddDate(1, 0, -1), nil
+	default:
+		return "", time.Time{}, time.Time{}, fmt.Errorf("summary period must be %s or %s, got %q", SummaryMonthly, SummaryYearly, period)
+	}
+}
+
+// SpendingReport summarises the last count months or years up to and including the one
+// containing now, most recent first, each compared with the period before and the same
+// period a year earlier. The current period is only summarised to date.
+func (d *DB) SpendingReport(ctx context.Context, period string, count, top int, now time.Time, options ...TransactionQueryOption) ([]SpendingSummary, error) {
+	if _, _, _, err := SummaryPeriodAt(period, now); err != nil {
+		return nil, err
+	}
+	now = now.In(d.timezone)
+	if count < 1 {
+		count = 1
+	}
+
+	summarize := func(periodsAgo int) (*SpendingSummary, error) {
+		// Step back from the 1st, since month arithmetic from the 31st can skip a month
+		at := time.Date(now.Year(), now.Month()-time.Month(periodsAgo), 1, 0, 0, 0, 0, now.Location())
+		if period == SummaryYearly {
+			at = time.Date(now.Year()-periodsAgo, time.January, 1, 0, 0, 0, 0, now.Location())
+		}
+		key, start, end, err := SummaryPeriodAt(period, at)
+		if err != nil {
+			return nil, err
+		}
+		s, err := d.SummarizeSpending(ctx, start, end, top, options...)
+		if err != nil {
+			return nil, err
+		}
+		s.Period = key
+		return s, nil
+	}
+
+	cache := make(map[int]*SpendingSummary)
+	get := func(periodsAgo int) (*SpendingSummary, error) {
+		if s, ok := cache[periodsAgo]; ok {
+			return s, nil
+		}
+		s, err := summarize(periodsAgo)
+		if err != nil {
+			return nil, err
+		}
+		cache[periodsAgo] = s
+		return s, nil
+	}
+
+	var summaries []SpendingSummary
+	for i := 0; i < count; i++ {
+		s, err := get(i)
+		if err != nil {
+			return nil, err
+		}
+		previous, err := get(i + 1)
+		if err != nil {
+			return nil, err
+		}
+		s.PreviousPeriod = compareSummaries(s, previous)
+		// For years, the previous period is the previous year
+		if period == SummaryMonthly {
+			lastYear, err := get(i + 12)
+			if err != nil {
+				return nil, err
+			}
+			s.PreviousYear = compareSummaries(s, lastYear)
+		}
+		summaries = append(summaries, *s)
+	}
+	return summaries, nil
+}
+
+// compareSummaries returns how s changed from an earlier summary
+func compareSummaries(s, earlier *SpendingSummary) *SummaryChange {
+	c := &SummaryChange{
+		Period:   earlier.Period,
+		Income:   s.Income.Sub(earlier.Income),
+		Expenses: s.Expenses.Sub(earlier.Expenses),
+		Net:      s.Net.Sub(earlier.Net),
+	}
+	if earlier.Expenses.IsPositive() {
+		c.ExpensesPercent = c.Expenses.Div(earlier.Expenses).Mul(decimal.NewFromInt(100)).Round(1)
+	}
+	return c
+}
@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestSpendingReport(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	transactions := []struct {
+		date     string
+		amount   string
+		merchant string
+		txType   string
+		category string
+	}{
+		{"01/03/2024", "5000.00", "Employer", "deposit", "Other"},
+		{"02/03/2024", "-1000.00", "Woolworths", "purchase", "Groceries"},
+		{"05/03/2024", "-600.00", "JB Hi-Fi", "purchase", "Shopping"},
+		{"09/03/2024", "100.00", "JB Hi-Fi", "refund", "Shopping"},
+		{"10/03/2024", "-500.00", "Coles", "purchase", "Groceries"},
+		{"01/02/2024", "4000.00", "Employer", "deposit", "Other"},
+		{"02/02/2024", "-1000.00", "Woolworths", "purchase", "Groceries"},
+		{"03/03/2023", "-750.00", "Woolworths", "purchase", "Groceries"},
+	}
+	for _, tx := range transactions {
+		transaction := types.Transaction{Date: tx.date, Amount: money(tx.amount), Payee: tx.merchant + " " + tx.date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: tx.txType, Merchant: tx.merchant, Category: tx.category, SearchBody: tx.merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+	}
+
+	summaries, err := db.SpendingReport(ctx, SummaryMonthly, 2, 2, time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to get spending report: %v", err)
+	}
+	if len(summaries) != 2 || summaries[0].Period != "2024-03" || summaries[1].Period != "2024-02" {
+		t.Fatalf("expected March and February 2024, got %+v", summaries)
+	}
+
+	march := summaries[0]
+	// The refund reduces expenses rather than counting as income
+	if march.Income.StringFixed(2) != "5000.00" || march.Expenses.StringFixed(2) != "2000.00" ||
+		march.Net.StringFixed(2) != "3000.00" || march.SavingsRate.String() != "60" {
+		t.Errorf("unexpected March totals: income %s, expenses %s, net %s, savings rate %s",
+			march.Income, march.Expenses, march.Net, march.SavingsRate)
+	}
+	if len(march.TopCategories) != 2 || march.TopCategories[0].Name != "Groceries" || march.TopCategories[0].Amount.StringFixed(2) != "1500.00" ||
+		march.TopCategories[1].Name != "Shopping" || march.TopCategories[1].Amount.StringFixed(2) != "500.00" {
+		t.Errorf("unexpected top categories: %+v", march.TopCategories)
+	}
+	if len(march.TopMerchants) != 2 || march.TopMerchants[0].Name != "Woolworths" || march.TopMerchants[1].Name != "Coles" {
+		t.Errorf("unexpected top merchants: %+v", march.TopMerchants)
+	}
+
+	if c := march.PreviousPeriod; c == nil || c.Period != "2024-02" || c.Expenses.StringFixed(2) != "1000.00" ||
+		c.ExpensesPercent.String() != "100" || c.Income.StringFixed(2) != "1000.00" {
+		t.Errorf("unexpected change from February: %+v", c)
+	}
+	if c := march.PreviousYear; c == nil || c.Period != "2023-03" || c.Expenses.StringFixed(2) != "1250.00" {
+		t.Errorf("unexpected change from March 2023: %+v", c)
+	}
+
+	years, err := db.SpendingReport(ctx, SummaryYearly, 1, 5, time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("failed to get yearly report: %v", err)
+	}
+	if len(years) != 1 || years[0].Period != "2024" || years[0].Expenses.StringFixed(2) != "3000.00" ||
+		years[0].PreviousPeriod.Period != "2023" || years[0].PreviousYear != nil {
+		t.Errorf("unexpected yearly report: %+v", years)
+	}
+
+	if _, err := db.SpendingReport(ctx, "weekly", 1, 5, time.Now()); err == nil {
+		t.Error("expected an error for an unknown period")
+	}
+}
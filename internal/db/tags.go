@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// tagsColumn selects a transaction's tags as a JSON array, in name order
+const tagsColumn = `(SELECT json_group_array(name) FROM (SELECT tg.name FROM transaction_tags tt
+		JOIN tags tg ON tg.id = tt.tag_id WHERE tt.transaction_id = t.id ORDER BY tg.name COLLATE NOCASE))`
+
+// Tag is a tag with the number of transactions it's on
+type Tag struct {
+	ID               int64  `json:"id"`
+	Name             string `json:"name"`
+	TransactionCount int    `json:"transaction_count"`
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// ParseTags splits a comma-separated list of tags, trimming them and dropping empty and
+// duplicate tags, ignoring case
+func ParseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// decodeTags reads the tags selected by tagsColumn
+func decodeTags(s sql.NullString) ([]string, error) {
+	if !s.Valid || s.String == "[]" {
+		return nil, nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(s.String), &tags); err != nil {
+		return nil, fmt.Errorf("failed to decode tags: %w", err)
+	}
+	return tags, nil
+}
+
+// AddTags tags a transaction, creating any tags that don't exist yet. Tags already on the
+// transaction are left as they are.
+func (d *DB) AddTags(ctx context.Context, id string, tags ...string) error {
+	if _, err := d.GetTransactionByID(ctx, id); err != nil {
+		return err
+	}
+	return addTags(ctx, d.db, id, tags)
+}
+
+// addTags creates the tags if needed and links them to the transaction
+func addTags(ctx context.Context, exec execer, id string, tags []string) error {
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return err
+		}
+		if _, err := exec.ExecContext(ctx, `INSERT OR IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			return fmt.Errorf("failed to create tag %q: %w", tag, err)
+		}
+		if _, err := exec.ExecContext(ctx, `
+			INSERT OR IGNORE INTO transaction_tags (transaction_id, tag_id) SELECT ?, id FROM tags WHERE name = ?
+		`, id, tag); err != nil {
+			return fmt.Errorf("failed to tag transaction: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateTag checks a tag can be written in a comma-separated list
+func validateTag(tag string) error {
+	if strings.TrimSpace(tag) == "" {
+		return errors.New("tags can't be empty")
+	}
+	if strings.Contains(tag, ",") {
+		return fmt.Errorf("tag %q can't contain a comma", tag)
+	}
+	return nil
+}
+
+// RemoveTags removes tags from a transaction. Tags that aren't on it are ignored.
+func (d *DB) RemoveTags(ctx context.Context, id string, tags ...string) error {
+	for _, tag := range tags {
+		if _, err := d.db.ExecContext(ctx, `
+			DELETE FROM transaction_tags WHERE transaction_id = ? AND tag_id IN (SELECT id FROM tags WHERE name = ?)
+		`, id, tag); err != nil {
+			return fmt.Errorf("failed to remove tag %q: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// GetTags returns every tag with the number of transactions it's on, most used first
+func (d *DB) GetTags(ctx context.Context) ([]Tag, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT tg.id, tg.name, COUNT(tt.transaction_id) AS count
+		FROM tags tg LEFT JOIN transaction_tags tt ON tt.tag_id = tg.id
+		GROUP BY tg.id
+		ORDER BY count DESC, tg.name COLLATE NOCASE
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.TransactionCount); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// tagID returns the ID of a tag by name, ignoring case
+func (d *DB) tagID(ctx context.Context, name string) (int64, error) {
+	var id int64
+	err := d.db.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = ?`, name).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("tag %q not found", name)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find tag: %w", err)
+	}
+	return id, nil
+}
+
+// RenameTag renames a tag on every transaction it's on. Renaming onto an existing tag is an
+// error, use MergeTags to combine them.
+func (d *DB) RenameTag(ctx context.Context, from, to string) error {
+	if err := validateTag(to); err != nil {
+		return err
+	}
+	id, err := d.tagID(ctx, from)
+	if err != nil {
+		return err
+	}
+	if existing, err := d.tagID(ctx, to); err == nil && existing != id {
+		return fmt.Errorf("tag %q already exists, merge the tags instead", to)
+	}
+	if _, err := d.db.ExecContext(ctx, `UPDATE tags SET name = ? WHERE id = ?`, to, id); err != nil {
+		return fmt.Errorf("failed to rename tag: %w", err)
+	}
+	return nil
+}
+
+// MergeTags moves the source tags onto the target tag and deletes them. The target is created
+// if it doesn't exist.
+func (d *DB) MergeTags(ctx context.Context, target string, sources ...string) error {
+	if err := validateTag(target); err != nil {
+		return err
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `INSERT OR IGNORE INTO tags (name) VALUES (?)`, target); err != nil {
+		return fmt.Errorf("failed to create tag %q: %w", target, err)
+	}
+	for _, source := range sources {
+		if strings.EqualFold(source, target) {
+			continue
+		}
+		var sourceID int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM tags WHERE name = ?`, source).Scan(&sourceID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("tag %q not found", source)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find tag: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO transaction_tags (transaction_id, tag_id)
+			SELECT transaction_id, (SELECT id FROM tags WHERE name = ?) FROM transaction_tags WHERE tag_id = ?
+		`, target, sourceID); err != nil {
+			return fmt.Errorf("failed to move tag %q: %w", source, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM transaction_tags WHERE tag_id = ?`, sourceID); err != nil {
+			return fmt.Errorf("failed to remove tag %q: %w", source, err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE id = ?`, sourceID); err != nil {
+			return fmt.Errorf("failed to delete tag %q: %w", source, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// migrateTagColumn moves the comma-separated tags column into the tags tables
+func migrateTagColumn(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT id, tags FROM transactions WHERE tags IS NOT NULL AND tags != ''`)
+	if err != nil {
+		return fmt.Errorf("failed to query tags: %w", err)
+	}
+	tagged := make(map[string][]string)
+	for rows.Next() {
+		var id, tags string
+		if err := rows.Scan(&id, &tags); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan tags: %w", err)
+		}
+		tagged[id] = ParseTags(tags)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating tags: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for id, tags := range tagged {
+		if err := addTags(ctx, tx, id, tags); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestParseTags(t *testing.T) {
+	got := ParseTags(" travel, Japan ,,travel,TRAVEL, work ")
+	want := []string{"travel", "Japan", "work"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestTags(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, merchant string, tags ...string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant, Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Category: "Travel", SearchBody: merchant, Tags: tags}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	flight := store("01/03/2024", "-800.00", "Qantas", "travel", "japan")
+	hotel := store("02/03/2024", "-300.00", "Hotel", "travel", "Work")
+	store("03/03/2024", "-20.00", "Cafe")
+
+	tx, err := db.GetTransactionByID(ctx, flight)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if want := []string{"japan", "travel"}; !slices.Equal(tx.Details.Tags, want) {
+		t.Errorf("expected tags %v, got %v", want, tx.Details.Tags)
+	}
+
+	count := func(opts ...TransactionQueryOption) int {
+		ids, err := db.GetTransactionIDs(ctx, opts...)
+		if err != nil {
+			t.Fatalf("failed to get transaction ids: %v", err)
+		}
+		return len(ids)
+	}
+	if n := count(FilterByAnyTag("Japan", "work")); n != 2 {
+		t.Errorf("expected 2 transactions tagged japan or work, got %d", n)
+	}
+	if n := count(FilterByAllTags("travel", "japan")); n != 1 {
+		t.Errorf("expected 1 transaction tagged travel and japan, got %d", n)
+	}
+	if n := count(ExcludeTags("work")); n != 2 {
+		t.Errorf("expected 2 transactions not tagged work, got %d", n)
+	}
+
+	// Tags added later survive the transaction being stored again
+	if err := db.AddTags(ctx, hotel, "tokyo"); err != nil {
+		t.Fatalf("failed to add tags: %v", err)
+	}
+	store("02/03/2024", "-300.00", "Hotel", "travel")
+	if n := count(FilterByAllTags("travel", "tokyo", "work")); n != 1 {
+		t.Errorf("expected the hotel to keep its tags, got %d", n)
+	}
+	if err := db.RemoveTags(ctx, hotel, "TOKYO"); err != nil {
+		t.Fatalf("failed to remove tags: %v", err)
+	}
+	if n := count(FilterByAnyTag("tokyo")); n != 0 {
+		t.Errorf("expected no transactions tagged tokyo, got %d", n)
+	}
+	if err := db.AddTags(ctx, "missing", "travel"); err == nil {
+		t.Error("expected an error tagging a missing transaction")
+	}
+
+	rows, err := db.Aggregate(ctx, GroupByTag)
+	if err != nil {
+		t.Fatalf("failed to aggregate: %v", err)
+	}
+	totals := make(map[string]string)
+	for _, row := range rows {
+		totals[row.Key] = row.Total.StringFixed(2)
+	}
+	if totals["travel"] != "-1100.00" || totals["japan"] != "-800.00" || totals[""] != "-20.00" {
+		t.Errorf("unexpected tag totals: %v", totals)
+	}
+
+	if err := db.RenameTag(ctx, "japan", "work"); err == nil {
+		t.Error("expected an error renaming onto an existing tag")
+	}
+	if err := db.RenameTag(ctx, "japan", "Japan 2024"); err != nil {
+		t.Fatalf("failed to rename tag: %v", err)
+	}
+	if n := count(FilterByAnyTag("japan 2024")); n != 1 {
+		t.Errorf("expected 1 transaction tagged Japan 2024, got %d", n)
+	}
+
+	if err := db.MergeTags(ctx, "trips", "travel", "Japan 2024"); err != nil {
+		t.Fatalf("failed to merge tags: %v", err)
+	}
+	tags, err := db.GetTags(ctx)
+	if err != nil {
+		t.Fatalf("failed to get tags: %v", err)
+	}
+	var names []string
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	// Tags stay once nothing uses them, so they can be reused
+	if want := []string{"trips", "Work", "tokyo"}; !slices.Equal(names, want) {
+		t.Errorf("expected tags %v, got %v", want, names)
+	}
+	if tags[0].TransactionCount != 2 {
+		t.Errorf("expected trips on 2 transactions, got %d", tags[0].TransactionCount)
+	}
+}
+
+func TestMigrateTagColumn(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	transaction := types.Transaction{Date: "01/03/2024", Amount: money("-10.00"), Payee: "Cafe", Bank: "amex"}
+	if err := db.Store(ctx, transaction, &types.TransactionDetails{Type: "purchase", Merchant: "Cafe", SearchBody: "Cafe"}); err != nil {
+		t.Fatalf("failed to store transaction: %v", err)
+	}
+	id := GenerateTransactionID(transaction)
+
+	// Recreate the comma-separated column tags were stored in before they had their own tables
+	if _, err := db.db.ExecContext(ctx, `ALTER TABLE transactions ADD COLUMN tags TEXT`); err != nil {
+		t.Fatalf("failed to add tags column: %v", err)
+	}
+	if _, err := db.db.ExecContext(ctx, `UPDATE transactions SET tags = 'coffee, work,coffee' WHERE id = ?`, id); err != nil {
+		t.Fatalf("failed to set tags: %v", err)
+	}
+	if err := migrateTagColumn(ctx, db.db); err != nil {
+		t.Fatalf("failed to migrate tags: %v", err)
+	}
+
+	tx, err := db.GetTransactionByID(ctx, id)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if want := []string{"coffee", "work"}; !slices.Equal(tx.Details.Tags, want) {
+		t.Errorf("expected tags %v, got %v", want, tx.Details.Tags)
+	}
+}
@@ -0,0 +1,227 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// FinancialYear returns the first and last days of the Australian financial year ending on
+// 30 June of year, so FinancialYear(2024) runs from 1 July 2023 to 30 June 2024
+func FinancialYear(year int, loc *time.Location) (time.Time, time.Time) {
+	start := time.Date(year-1, time.July, 1, 0, 0, 0, 0, loc)
+	return start, start.AddDate(1, 0, -1)
+}
+
+// FinancialYearOf returns the financial year containing t, by the year it ends
+func FinancialYearOf(t time.Time) int {
+	if t.Month() >= time.July {
+		return t.Year() + 1
+	}
+	return t.Year()
+}
+
+// validateDeduction normalises a deduction category code, allowing empty for not deductible
+func validateDeduction(code string) (string, error) {
+	code = strings.TrimSpace(code)
+	if code == "" {
+		return "", nil
+	}
+	c, ok := types.DeductionCategoryByCode(code)
+	if !ok {
+		return "", fmt.Errorf("unknown deduction category %q", code)
+	}
+	return c.Code, nil
+}
+
+// SetDeduction sets the deduction category of a transaction. An empty code marks it as not
+// deductible, which also stops its merchant's default deduction applying to it.
+func (d *DB) SetDeduction(ctx context.Context, id, code string) error {
+	code, err := validateDeduction(code)
+	if err != nil {
+		return err
+	}
+	result, err := d.db.ExecContext(ctx, `UPDATE transactions SET deduction = ? WHERE id = ?`, code, id)
+	if err != nil {
+		return fmt.Errorf("failed to set deduction: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("transaction with ID %s not found", id)
+	}
+	return nil
+}
+
+// SetMerchantDeduction sets the deduction category applied to a merchant's transactions, such
+// as D5 for a work software subscription, or removes it with an empty code. It applies to
+// the merchant's transactions that haven't had a deduction set, returning how many changed.
+func (d *DB) SetMerchantDeduction(ctx context.Context, merchantID int64, code string) (int64, error) {
+	code, err := validateDeduction(code)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `UPDATE merchants SET default_deduction = ? WHERE id = ?`, nullIfEmpty(code), merchantID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set merchant deduction: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return 0, fmt.Errorf("merchant %d not found", merchantID)
+	}
+
+	var applied int64
+	if code != "" {
+		result, err = tx.ExecContext(ctx, `UPDATE transactions SET deduction = ? WHERE merchant_id = ? AND deduction IS NULL`, code, merchantID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to apply merchant deduction: %w", err)
+		}
+		applied, _ = result.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit merchant deduction: %w", err)
+	}
+	return applied, nil
+}
+
+// TaxItem is a transaction in a tax report, flagged when it's missing evidence
+type TaxItem struct {
+	types.TransactionWithDetails
+	// TaxAmount is the amount deducted, earned or charged as a positive amount in the base
+	// currency, net of refunds
+	TaxAmount      decimal.Decimal `json:"tax_amount"`
+	MissingReceipt bool            `json:"missing_receipt,omitempty"`
+	MissingNotes   bool            `json:"missing_notes,omitempty"`
+}
+
+// Flagged reports whether the item is missing a receipt or notes
+func (i TaxItem) Flagged() bool {
+	return i.MissingReceipt || i.MissingNotes
+}
+
+// DeductionTotal is the total claimed in a deduction category
+type DeductionTotal struct {
+	Code   string          `json:"code"`
+	Name   string          `json:"name"`
+	Count  int             `json:"count"`
+	Amount decimal.Decimal `json:"amount"`
+}
+
+// TaxReport summarises an Australian financial year for a tax return
+type TaxReport struct {
+	FinancialYear   int              `json:"financial_year"`
+	Start           time.Time        `json:"start"`
+	End             time.Time        `json:"end"`
+	Deductions      []DeductionTotal `json:"deductions"`
+	TotalDeductions decimal.Decimal  `json:"total_deductions"`
+	// Deductible lists every deductible transaction, donations included
+	Deductible     []TaxItem       `json:"deductible"`
+	Donations      []TaxItem       `json:"donations"`
+	TotalDonations decimal.Decimal `json:"total_donations"`
+	Interest       []TaxItem       `json:"interest"`
+	TotalInterest  decimal.Decimal `json:"total_interest"`
+	BankFees       []TaxItem       `json:"bank_fees"`
+	TotalBankFees  decimal.Decimal `json:"total_bank_fees"`
+}
+
+// Flagged returns the deductible items missing a receipt or notes
+func (r TaxReport) Flagged() []TaxItem {
+	var flagged []TaxItem
+	for _, item := range r.Deductible {
+		if item.Flagged() {
+			flagged = append(flagged, item)
+		}
+	}
+	return flagged
+}
+
+// GetTaxReport builds the tax report for a financial year, by the year it ends. Deductions are
+// totalled by category, with interest earned, donations and bank fees listed separately.
+// Transfers between your own accounts are left out.
+func (d *DB) GetTaxReport(ctx context.Context, year int) (*TaxReport, error) {
+	start, end := FinancialYear(year, d.timezone)
+	r := &TaxReport{FinancialYear: year, Start: start, End: end}
+	period := []TransactionQueryOption{FilterByDateRange(start, end), ExcludeInternalTransfers()}
+
+	deductible, err := d.GetTransactions(ctx, append(period, FilterByDeductible())...)
+	if err != nil {
+		return nil, err
+	}
+	totals := make(map[string]*DeductionTotal)
+	for _, t := range deductible {
+		item, err := d.taxItem(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		item.MissingReceipt = t.Details.AttachmentCount == 0
+		item.MissingNotes = strings.TrimSpace(t.Details.Notes) == ""
+		r.Deductible = append(r.Deductible, item)
+		if totals[t.Details.Deduction] == nil {
+			totals[t.Details.Deduction] = &DeductionTotal{Code: t.Details.Deduction}
+		}
+		totals[t.Details.Deduction].Count++
+		totals[t.Details.Deduction].Amount = totals[t.Details.Deduction].Amount.Add(item.TaxAmount)
+		r.TotalDeductions = r.TotalDeductions.Add(item.TaxAmount)
+		if t.Details.Deduction == "D9" {
+			r.Donations = append(r.Donations, item)
+			r.TotalDonations = r.TotalDonations.Add(item.TaxAmount)
+		}
+	}
+	// Deductions are listed in the order they appear on the tax return
+	for _, c := range types.AllowedDeductionCategories {
+		if total, ok := totals[c.Code]; ok {
+			total.Name = c.Name
+			r.Deductions = append(r.Deductions, *total)
+		}
+	}
+
+	interest, err := d.GetTransactions(ctx, append(period, FilterByType("interest"))...)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range interest {
+		item, err := d.taxItem(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		// Interest charged on a loan is an expense rather than interest earned
+		item.TaxAmount = item.TaxAmount.Neg()
+		if item.TaxAmount.IsPositive() {
+			r.Interest = append(r.Interest, item)
+			r.TotalInterest = r.TotalInterest.Add(item.TaxAmount)
+		}
+	}
+
+	fees, err := d.GetTransactions(ctx, append(period, FilterByType("fee"))...)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range fees {
+		item, err := d.taxItem(ctx, t)
+		if err != nil {
+			return nil, err
+		}
+		r.BankFees = append(r.BankFees, item)
+		r.TotalBankFees = r.TotalBankFees.Add(item.TaxAmount)
+	}
+
+	return r, nil
+}
+
+// taxItem wraps a transaction for a tax report, with what's been spent on it net of refunds in
+// the base currency
+func (d *DB) taxItem(ctx context.Context, t types.TransactionWithDetails) (TaxItem, error) {
+	spent := types.NewMoney(t.Amount.Amount.Add(t.Details.RefundedAmount).Neg(), t.Amount.Currency)
+	amount, err := d.ToBaseCurrency(ctx, spent, t.Date)
+	if err != nil {
+		return TaxItem{}, err
+	}
+	return TaxItem{TransactionWithDetails: t, TaxAmount: amount}, nil
+}
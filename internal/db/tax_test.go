@@ -0,0 +1,119 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestFinancialYear(t *testing.T) {
+	start, end := FinancialYear(2024, time.UTC)
+	if start.Format("2006-01-02") != "2023-07-01" || end.Format("2006-01-02") != "2024-06-30" {
+		t.Errorf("expected FY2024 to run from 2023-07-01 to 2024-06-30, got %s to %s", start.Format("2006-01-02"), end.Format("2006-01-02"))
+	}
+	if fy := FinancialYearOf(time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)); fy != 2024 {
+		t.Errorf("expected 1 July 2023 to be in FY2024, got %d", fy)
+	}
+	if fy := FinancialYearOf(time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)); fy != 2024 {
+		t.Errorf("expected 30 June 2024 to be in FY2024, got %d", fy)
+	}
+}
+
+func TestTaxReport(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	store := func(date, amount, merchant, txType string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant + " " + date, Bank: "ing"}
+		details := &types.TransactionDetails{Type: txType, Merchant: merchant, Category: "Other", SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	laptop := store("15/08/2023", "-2000.00", "Apple", "purchase")
+	store("01/09/2023", "-30.00", "Adobe", "purchase")
+	store("01/10/2023", "-30.00", "Adobe", "purchase")
+	redCross := store("20/12/2023", "-100.00", "Red Cross", "purchase")
+	store("31/01/2024", "12.34", "ING", "interest")
+	store("28/02/2024", "-5.00", "ING", "fee")
+	store("01/07/2024", "-30.00", "Adobe", "purchase") // FY2025
+	store("10/03/2024", "-60.00", "Cafe", "purchase")
+
+	if err := db.SetDeduction(ctx, laptop, "d5"); err != nil {
+		t.Fatalf("failed to set deduction: %v", err)
+	}
+	if err := db.SetDeduction(ctx, redCross, "D9"); err != nil {
+		t.Fatalf("failed to set deduction: %v", err)
+	}
+	if err := db.SetDeduction(ctx, laptop, "D99"); err == nil {
+		t.Error("expected an error for an unknown deduction category")
+	}
+
+	// A merchant rule applies to its existing transactions and ones stored later
+	adobe, err := db.FindMerchant(ctx, "Adobe")
+	if err != nil {
+		t.Fatalf("failed to find merchant: %v", err)
+	}
+	applied, err := db.SetMerchantDeduction(ctx, adobe.ID, "D5")
+	if err != nil {
+		t.Fatalf("failed to set merchant deduction: %v", err)
+	}
+	if applied != 3 {
+		t.Errorf("expected the rule to apply to 3 transactions, got %d", applied)
+	}
+	later := store("01/11/2023", "-30.00", "Adobe", "purchase")
+	tx, err := db.GetTransactionByID(ctx, later)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.Deduction != "D5" {
+		t.Errorf("expected the merchant's deduction to apply to a new transaction, got %q", tx.Details.Deduction)
+	}
+	// Marking a transaction as not deductible overrides the rule, even when it's stored again
+	if err := db.SetDeduction(ctx, later, ""); err != nil {
+		t.Fatalf("failed to clear deduction: %v", err)
+	}
+	store("01/11/2023", "-30.00", "Adobe", "purchase")
+
+	// The laptop has a receipt and notes, so it isn't flagged
+	receipt := filepath.Join(t.TempDir(), "receipt.pdf")
+	if err := os.WriteFile(receipt, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatalf("failed to write receipt: %v", err)
+	}
+	if _, err := db.AttachFile(ctx, laptop, receipt); err != nil {
+		t.Fatalf("failed to attach receipt: %v", err)
+	}
+	if err := db.SetNotes(ctx, laptop, "work laptop"); err != nil {
+		t.Fatalf("failed to set notes: %v", err)
+	}
+
+	report, err := db.GetTaxReport(ctx, 2024)
+	if err != nil {
+		t.Fatalf("failed to get tax report: %v", err)
+	}
+	if len(report.Deductions) != 2 || report.Deductions[0].Code != "D5" || report.Deductions[0].Count != 3 ||
+		report.Deductions[0].Amount.StringFixed(2) != "2060.00" || report.Deductions[1].Code != "D9" {
+		t.Errorf("unexpected deductions: %+v", report.Deductions)
+	}
+	if report.TotalDeductions.StringFixed(2) != "2160.00" {
+		t.Errorf("expected total deductions of 2160.00, got %s", report.TotalDeductions)
+	}
+	if len(report.Donations) != 1 || report.TotalDonations.StringFixed(2) != "100.00" {
+		t.Errorf("expected one donation of 100.00, got %d totalling %s", len(report.Donations), report.TotalDonations)
+	}
+	if len(report.Interest) != 1 || report.TotalInterest.StringFixed(2) != "12.34" {
+		t.Errorf("expected interest of 12.34, got %d totalling %s", len(report.Interest), report.TotalInterest)
+	}
+	if len(report.BankFees) != 1 || report.TotalBankFees.StringFixed(2) != "5.00" {
+		t.Errorf("expected bank fees of 5.00, got %d totalling %s", len(report.BankFees), report.TotalBankFees)
+	}
+	if flagged := report.Flagged(); len(flagged) != 3 {
+		t.Errorf("expected the Adobe and Red Cross transactions to be flagged, got %d", len(flagged))
+	}
+}
@@ -0,0 +1,340 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultTransferWindow is how many days apart the two sides of a transfer can be
+const DefaultTransferWindow = 4
+
+// TransferMatch is a debit paired with the credit it paid into another of our accounts
+type TransferMatch struct {
+	DebitID  string          `json:"debit_id"`
+	CreditID string          `json:"credit_id"`
+	Amount   decimal.Decimal `json:"amount"`
+	Score    int             `json:"score"`
+	Source   string          `json:"source"`
+}
+
+// transferCandidate is a transaction considered for a transfer match
+type transferCandidate struct {
+	t      types.TransactionWithDetails
+	date   time.Time
+	amount decimal.Decimal
+}
+
+// nonTransferTypes are the transaction types that can't be one side of a transfer
+var nonTransferTypes = map[string]bool{"purchase": true, "withdrawal": true, "refund": true, "fee": true, "interest": true}
+
+// paymentPattern matches payees that describe moving money rather than spending it, such as a
+// direct debit to a card issuer or a card payment received
+var paymentPattern = regexp.MustCompile(`(?i)\b(?:payment|direct debit|bpay|transfer)\b`)
+
+// MatchTransfers pairs opposite-signed transactions of the same amount within window days of each
+// other. Pairs across banks need some evidence, such as a transfer type or a payment payee on
+// either side, while pairs within a bank need a shared account number or reference. Each
+// transaction is matched at most once, best scoring pairs first. Pairs in rejected are never
+// matched.
+func MatchTransfers(transactions []types.TransactionWithDetails, location *time.Location, window int, rejected map[[2]string]bool) []TransferMatch {
+	byAmount := make(map[string][]transferCandidate)
+	for _, t := range transactions {
+		if nonTransferTypes[t.Details.Type] {
+			continue
+		}
+		date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+		if err != nil {
+			continue
+		}
+		amount := t.Amount.Amount
+		if amount.IsZero() {
+			continue
+		}
+		key := amount.Abs().StringFixed(2)
+		byAmount[key] = append(byAmount[key], transferCandidate{t: t, date: date, amount: amount})
+	}
+
+	var pairs []TransferMatch
+	for _, candidates := range byAmount {
+		for _, debit := range candidates {
+			if !debit.amount.IsNegative() {
+				continue
+			}
+			for _, credit := range candidates {
+				if !credit.amount.IsPositive() || rejected[[2]string{debit.t.ID, credit.t.ID}] {
+					continue
+				}
+				if score, ok := transferScore(debit, credit, window); ok {
+					pairs = append(pairs, TransferMatch{
+						DebitID:  debit.t.ID,
+						CreditID: credit.t.ID,
+						Amount:   credit.amount,
+						Score:    score,
+						Source:   LinkSourceAuto,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Score != pairs[j].Score {
+			return pairs[i].Score > pairs[j].Score
+		}
+		if pairs[i].DebitID != pairs[j].DebitID {
+			return pairs[i].DebitID < pairs[j].DebitID
+		}
+		return pairs[i].CreditID < pairs[j].CreditID
+	})
+
+	matched := make(map[string]bool)
+	var matches []TransferMatch
+	for _, p := range pairs {
+		if matched[p.DebitID] || matched[p.CreditID] {
+			continue
+		}
+		matched[p.DebitID], matched[p.CreditID] = true, true
+		matches = append(matches, p)
+	}
+	return matches
+}
+
+// transferScore scores how likely a debit and credit are two sides of one transfer
+func transferScore(debit, credit transferCandidate, window int) (int, bool) {
+	days := int(abs(credit.date.Sub(debit.date).Hours()/24) + 0.5)
+	if days > window {
+		return 0, false
+	}
+	score := window - days
+
+	evidence := 0
+	if sharesAccount(debit.t, credit.t) || sharesAccount(credit.t, debit.t) {
+		evidence += 3
+	}
+	if sharesReference(debit.t, credit.t) {
+		evidence += 3
+	}
+	if isPayment(debit.t) || isPayment(credit.t) {
+		evidence++
+	}
+	score += evidence
+
+	// Across banks an equal and opposite amount is still a coincidence without some evidence,
+	// such as a card purchase on the same day as an unrelated deposit
+	if debit.t.Bank != credit.t.Bank {
+		return score + 2, evidence > 0
+	}
+	// Within a bank, equal and opposite amounts are common, so ask for more than a coincidence
+	return score, evidence >= 3
+}
+
+// isPayment reports whether a transaction was classified as a transfer or its payee describes a payment
+func isPayment(t types.TransactionWithDetails) bool {
+	return t.Details.Type == "transfer" || paymentPattern.MatchString(t.Payee)
+}
+
+// sharesAccount reports whether an account number from a's transfer details appears on b
+func sharesAccount(a, b types.TransactionWithDetails) bool {
+	if a.Details.TransferDetails == nil {
+		return false
+	}
+	text := digitsOnly(b.Payee + " " + b.Details.Description)
+	if b.Details.TransferDetails != nil {
+		text += " " + digitsOnly(b.Details.TransferDetails.ToAccount+" "+b.Details.TransferDetails.FromAccount)
+	}
+	for _, account := range []string{a.Details.TransferDetails.ToAccount, a.Details.TransferDetails.FromAccount} {
+		// Short numbers such as BSBs alone would match too easily
+		if digits := digitsOnly(account); len(digits) >= 6 && strings.Contains(text, digits) {
+			return true
+		}
+	}
+	return false
+}
+
+// sharesReference reports whether both transactions carry the same transfer reference,
+// or one's reference appears in the other's payee
+func sharesReference(a, b types.TransactionWithDetails) bool {
+	ref := func(t types.TransactionWithDetails) string {
+		if t.Details.TransferDetails == nil {
+			return ""
+		}
+		return strings.ToLower(strings.TrimSpace(t.Details.TransferDetails.Reference))
+	}
+	refA, refB := ref(a), ref(b)
+	switch {
+	case len(refA) >= 4 && refA == refB:
+		return true
+	case len(refA) >= 4 && strings.Contains(strings.ToLower(b.Payee), refA):
+		return true
+	case len(refB) >= 4 && strings.Contains(strings.ToLower(a.Payee), refB):
+		return true
+	}
+	return false
+}
+
+// digitsOnly strips everything but digits, so account numbers compare regardless of spacing
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// RefreshTransferMatches matches transfers between our own accounts and replaces the automatic
+// transfer links. Manual links and rejected pairs are kept.
+func (d *DB) RefreshTransferMatches(ctx context.Context, window int) ([]TransferMatch, error) {
+	links, err := d.getTransferLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manual := make(map[string]bool)
+	rejected := make(map[[2]string]bool)
+	for _, l := range links {
+		switch l.Source {
+		case LinkSourceManual:
+			manual[l.DebitID], manual[l.CreditID] = true, true
+		case LinkSourceRejected:
+			rejected[[2]string{l.DebitID, l.CreditID}] = true
+		}
+	}
+
+	transactions, err := d.GetTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	unlinked := transactions[:0]
+	for _, t := range transactions {
+		if !manual[t.ID] {
+			unlinked = append(unlinked, t)
+		}
+	}
+	matches := MatchTransfers(unlinked, d.timezone, window, rejected)
+
+	pairs := make([][2]string, len(matches))
+	for i, m := range matches {
+		pairs[i] = [2]string{m.DebitID, m.CreditID}
+	}
+	if err := d.replaceAutoLinks(ctx, LinkKindTransfer, pairs); err != nil {
+		return nil, err
+	}
+
+	d.logger.Info("Refreshed transfer matches", "count", len(matches))
+	return matches, nil
+}
+
+// GetTransferMatches returns the matched transfer pairs, excluding rejected pairs
+func (d *DB) GetTransferMatches(ctx context.Context) ([]TransferMatch, error) {
+	links, err := d.getTransferLinks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []TransferMatch
+	for _, l := range links {
+		if l.Source != LinkSourceRejected {
+			matches = append(matches, l)
+		}
+	}
+	return matches, nil
+}
+
+// getTransferLinks returns all transfer links, including rejected pairs
+func (d *DB) getTransferLinks(ctx context.Context) ([]TransferMatch, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT l.transaction_id, l.linked_id, l.source, COALESCE(ABS(t.amount_minor), 0)
+		FROM transaction_links l
+		LEFT JOIN transactions t ON t.id = l.transaction_id
+		WHERE l.kind = ?
+		ORDER BY t.date DESC, l.transaction_id
+	`, LinkKindTransfer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query transfer links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []TransferMatch
+	for rows.Next() {
+		var m TransferMatch
+		var amount int64
+		if err := rows.Scan(&m.DebitID, &m.CreditID, &m.Source, &amount); err != nil {
+			return nil, fmt.Errorf("failed to scan transfer link: %w", err)
+		}
+		m.Amount = fromMinorUnits(amount)
+		links = append(links, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transfer links: %w", err)
+	}
+	return links, nil
+}
+
+// LinkTransfer manually pairs two transactions as the sides of a transfer, replacing any
+// existing transfer links on either side
+func (d *DB) LinkTransfer(ctx context.Context, a, b string) error {
+	ta, err := d.GetTransactionByID(ctx, a)
+	if err != nil {
+		return err
+	}
+	tb, err := d.GetTransactionByID(ctx, b)
+	if err != nil {
+		return err
+	}
+	amountA, amountB := ta.Amount.Amount, tb.Amount.Amount
+	if amountA.Sign() == amountB.Sign() {
+		return fmt.Errorf("transactions %s and %s must have opposite signs to be a transfer", a, b)
+	}
+	debit, credit := a, b
+	if amountA.IsPositive() {
+		debit, credit = b, a
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM transaction_links
+		WHERE kind = ? AND (transaction_id IN (?, ?) OR linked_id IN (?, ?)) AND source != ?
+	`, LinkKindTransfer, debit, credit, debit, credit, LinkSourceRejected); err != nil {
+		return fmt.Errorf("failed to remove existing transfer links: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM transaction_links WHERE kind = ? AND transaction_id = ? AND linked_id = ?
+	`, LinkKindTransfer, debit, credit); err != nil {
+		return fmt.Errorf("failed to remove rejected transfer link: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO transaction_links (transaction_id, linked_id, kind, source) VALUES (?, ?, ?, ?)
+	`, debit, credit, LinkKindTransfer, LinkSourceManual); err != nil {
+		return fmt.Errorf("failed to link transfer: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// UnlinkTransfer removes the transfer link on a transaction and stops matching from pairing
+// the same transactions again
+func (d *DB) UnlinkTransfer(ctx context.Context, id string) error {
+	res, err := d.db.ExecContext(ctx, `
+		UPDATE transaction_links SET source = ?
+		WHERE kind = ? AND (transaction_id = ? OR linked_id = ?) AND source != ?
+	`, LinkSourceRejected, LinkKindTransfer, id, id, LinkSourceRejected)
+	if err != nil {
+		return fmt.Errorf("failed to unlink transfer: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("transaction %s is not linked to a transfer", id)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestMatchTransfers(t *testing.T) {
+	transactions := []types.TransactionWithDetails{
+		// Credit card payment from the bank account, two days apart
+		testTransaction("ing-amex", "01/03/2024", "-500.00", "transfer", "ing-amex", onBank("ing-australia")),
+		testTransaction("amex-payment", "03/03/2024", "500.00", "credit", "amex-payment", onBank("amex")),
+		// A later payment of the same amount pairs with its own side rather than the first
+		testTransaction("ing-amex-2", "01/04/2024", "-500.00", "transfer", "ing-amex-2", onBank("ing-australia")),
+		testTransaction("amex-payment-2", "02/04/2024", "500.00", "credit", "amex-payment-2", onBank("amex")),
+		// Savings transfer within one bank, linked by account number
+		testTransaction("to-savings", "05/03/2024", "-1000.00", "transfer", "to-savings", onBank("ing-australia"), withTransfer(&types.TransferDetails{ToAccount: "923100 12345678"})),
+		testTransaction("from-everyday", "05/03/2024", "1000.00", "transfer", "from-everyday", onBank("ing-australia"), withTransfer(&types.TransferDetails{FromAccount: "923100 12345678"})),
+		// Equal and opposite amounts within one bank without evidence aren't a transfer
+		testTransaction("purchase", "10/03/2024", "-42.00", "purchase", "purchase", onBank("ing-australia")),
+		testTransaction("deposit", "11/03/2024", "42.00", "deposit", "deposit", onBank("ing-australia")),
+		// A card purchase and an unrelated deposit at another bank aren't a transfer either
+		testTransaction("jb-hifi", "15/03/2024", "-64.95", "purchase", "jb-hifi", onBank("amex")),
+		testTransaction("marketplace-sale", "15/03/2024", "64.95", "deposit", "marketplace-sale", onBank("ing-australia")),
+		// Nor is a pair across banks with nothing to say money moved between them
+		testTransaction("adjustment", "18/03/2024", "-300.00", "other", "adjustment", onBank("ing-australia")),
+		testTransaction("cashback", "18/03/2024", "300.00", "credit", "cashback", onBank("amex")),
+		// Refunds reverse purchases, they aren't transfers
+		testTransaction("shoes", "12/03/2024", "-80.00", "purchase", "shoes", onBank("amex")),
+		testTransaction("shoes-refund", "13/03/2024", "80.00", "refund", "shoes-refund", onBank("ing-australia")),
+		// Too far apart
+		testTransaction("old", "01/01/2024", "-250.00", "purchase", "old", onBank("ing-australia")),
+		testTransaction("new", "20/01/2024", "250.00", "credit", "new", onBank("amex")),
+	}
+
+	matches := MatchTransfers(transactions, time.UTC, DefaultTransferWindow, nil)
+
+	got := make(map[string]string)
+	for _, m := range matches {
+		got[m.DebitID] = m.CreditID
+	}
+	want := map[string]string{
+		"ing-amex":   "amex-payment",
+		"ing-amex-2": "amex-payment-2",
+		"to-savings": "from-everyday",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d matches, got %d: %v", len(want), len(got), got)
+	}
+	for debit, credit := range want {
+		if got[debit] != credit {
+			t.Errorf("expected %s to match %s, got %q", debit, credit, got[debit])
+		}
+	}
+
+	// Rejected pairs are skipped
+	matches = MatchTransfers(transactions, time.UTC, DefaultTransferWindow, map[[2]string]bool{{"to-savings", "from-everyday"}: true})
+	for _, m := range matches {
+		if m.DebitID == "to-savings" {
+			t.Errorf("expected rejected pair not to match, got %+v", m)
+		}
+	}
+}
+
+func TestRefreshTransferMatches(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, payee, bank, txType string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: payee, Bank: bank}
+		details := &types.TransactionDetails{Type: txType, Merchant: payee, Category: "Transfers", SearchBody: payee}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	debit := store("01/03/2024", "-500.00", "AMERICAN EXPRESS DIRECT DEBIT", "ing-australia", "transfer")
+	credit := store("02/03/2024", "500.00", "DIRECT DEBIT RECEIVED - THANK YOU", "amex", "credit")
+	purchase := store("02/03/2024", "-35.00", "Cafe", "amex", "purchase")
+
+	matches, err := db.RefreshTransferMatches(ctx, DefaultTransferWindow)
+	if err != nil {
+		t.Fatalf("failed to refresh transfer matches: %v", err)
+	}
+	if len(matches) != 1 || matches[0].DebitID != debit || matches[0].CreditID != credit {
+		t.Fatalf("expected the direct debit to match its payment, got %+v", matches)
+	}
+
+	tx, err := db.GetTransactionByID(ctx, credit)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.TransferMatchID != debit {
+		t.Errorf("expected credit to link to %s, got %q", debit, tx.Details.TransferMatchID)
+	}
+
+	// Both sides are left out when excluding internal transfers
+	ids, err := db.GetTransactionIDs(ctx, ExcludeInternalTransfers())
+	if err != nil {
+		t.Fatalf("failed to get transaction ids: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != purchase {
+		t.Errorf("expected only the purchase, got %v", ids)
+	}
+
+	// Unlinking stops the pair being matched again
+	if err := db.UnlinkTransfer(ctx, debit); err != nil {
+		t.Fatalf("failed to unlink transfer: %v", err)
+	}
+	if matches, err = db.RefreshTransferMatches(ctx, DefaultTransferWindow); err != nil {
+		t.Fatalf("failed to refresh transfer matches: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected no matches after unlinking, got %+v", matches)
+	}
+	if tx, err = db.GetTransactionByID(ctx, credit); err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.TransferMatchID != "" {
+		t.Errorf("expected no transfer link after unlinking, got %q", tx.Details.TransferMatchID)
+	}
+
+	// Manual links survive a refresh
+	if err := db.LinkTransfer(ctx, credit, debit); err != nil {
+		t.Fatalf("failed to link transfer: %v", err)
+	}
+	if _, err := db.RefreshTransferMatches(ctx, DefaultTransferWindow); err != nil {
+		t.Fatalf("failed to refresh transfer matches: %v", err)
+	}
+	stored, err := db.GetTransferMatches(ctx)
+	if err != nil {
+		t.Fatalf("failed to get transfer matches: %v", err)
+	}
+	if len(stored) != 1 || stored[0].DebitID != debit || stored[0].Source != LinkSourceManual {
+		t.Errorf("expected the manual link to be kept, got %+v", stored)
+	}
+
+	if err := db.LinkTransfer(ctx, debit, purchase); err == nil {
+		t.Error("expected an error linking two debits")
+	}
+}
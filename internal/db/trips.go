@@ -0,0 +1,432 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// travelCategory is the category of flights, accommodation and travel services, which are
+// counted towards the trip they were booked for
+const travelCategory = "Travel"
+
+// TripConfig sets how trips are detected
+type TripConfig struct {
+	// HomeCountry is the country you live in, as a name or ISO code
+	HomeCountry string
+	// HomeState is the state you live in, so interstate trips are found too, or empty for only
+	// trips abroad
+	HomeState string
+	// MaxGap is how many days can pass between spending away before a trip is over
+	MaxGap int
+	// MinTransactions is how many transactions away make a trip, so a one-off purchase from an
+	// overseas shop doesn't
+	MinTransactions int
+	// BookingWindow is how many days before a trip travel bookings are counted towards it
+	BookingWindow int
+}
+
+// DefaultTripConfig returns the usual trip settings for someone living in homeCountry, and
+// homeState when it's given
+func DefaultTripConfig(homeCountry, homeState string) TripConfig {
+	return TripConfig{HomeCountry: homeCountry, HomeState: homeState, MaxGap: 3, MinTransactions: 3, BookingWindow: 180}
+}
+
+// Trip is a run of spending away from home, with the travel booked for it beforehand
+type Trip struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Destination string `json:"destination"`
+	// Countries are the ISO codes of the countries spent in, most transactions first
+	Countries []string  `json:"countries,omitempty"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	// Cost is what the trip cost in the base currency net of refunds, bookings included, and
+	// Booked is the part of it paid before the trip started
+	Cost             decimal.Decimal `json:"cost"`
+	Booked           decimal.Decimal `json:"booked"`
+	TransactionCount int             `json:"transaction_count"`
+	TransactionIDs   []string        `json:"transaction_ids,omitempty"`
+	BookedIDs        []string        `json:"booked_ids,omitempty"`
+}
+
+// Days is how many days the trip lasted, counting the first and last
+func (t Trip) Days() int {
+	return int(t.EndDate.Sub(t.StartDate).Hours()/24+0.5) + 1
+}
+
+// tripCandidate is a transaction considered for a trip
+type tripCandidate struct {
+	t       types.TransactionWithDetails
+	date    time.Time
+	country string
+	state   string
+}
+
+// DetectTrips groups spending away from home into trips. Spending is away when it resolved to
+// somewhere outside the home country or state, or is in a foreign currency without a resolved
+// place. Runs with no more than MaxGap days between them are one trip, and need MinTransactions
+// to count. Transfers between your own accounts and recurring payments are left out.
+// International transaction fees and refunds join the trip of their purchase, and Travel
+// spending from home joins the next trip starting within BookingWindow days, or the one under
+// way.
+func DetectTrips(transactions []types.TransactionWithDetails, location *time.Location, config TripConfig) []Trip {
+	home := countryCode(config.HomeCountry)
+	homeState := stateCode(config.HomeState)
+
+	var away, bookings, followers []tripCandidate
+	for _, t := range transactions {
+		if t.Details.TransferMatchID != "" || t.Details.RecurringSeriesID != "" {
+			continue
+		}
+		date, err := time.ParseInLocation("02/01/2006", t.Date, location)
+		if err != nil {
+			continue
+		}
+		c := tripCandidate{t: t, date: date, country: countryCode(t.Details.Place.Country), state: stateCode(t.Details.Place.State)}
+		switch {
+		case t.Details.FXFeeOfID != "" || t.Details.RefundOfID != "":
+			followers = append(followers, c)
+		case c.country != "" && c.country != home,
+			c.country == "" && t.Details.ForeignAmount != nil,
+			homeState != "" && c.country == home && c.state != "" && c.state != homeState:
+			away = append(away, c)
+		case t.Details.Category == travelCategory && t.Amount.IsNegative():
+			bookings = append(bookings, c)
+		}
+	}
+	sort.SliceStable(away, func(i, j int) bool {
+		if !away[i].date.Equal(away[j].date) {
+			return away[i].date.Before(away[j].date)
+		}
+		return away[i].t.ID < away[j].t.ID
+	})
+
+	var runs [][]tripCandidate
+	for i, c := range away {
+		if i == 0 || c.date.Sub(away[i-1].date).Hours()/24 > float64(config.MaxGap) {
+			runs = append(runs, nil)
+		}
+		runs[len(runs)-1] = append(runs[len(runs)-1], c)
+	}
+
+	var trips []Trip
+	tripOf := make(map[string]int)
+	for _, run := range runs {
+		if len(run) < config.MinTransactions {
+			continue
+		}
+		trip := Trip{
+			ID:        tripID(run[0].t.ID),
+			StartDate: run[0].date,
+			EndDate:   run[len(run)-1].date,
+		}
+		for _, c := range run {
+			trip.TransactionIDs = append(trip.TransactionIDs, c.t.ID)
+			tripOf[c.t.ID] = len(trips)
+		}
+		trip.Countries, trip.Destination = tripDestination(run, home)
+		trip.Name = trip.Destination + " " + trip.StartDate.Format("Jan 2006")
+		trips = append(trips, trip)
+	}
+
+	for _, c := range bookings {
+		best := -1
+		for i, trip := range trips {
+			if c.date.After(trip.EndDate) || trip.StartDate.Sub(c.date).Hours()/24 > float64(config.BookingWindow) {
+				continue
+			}
+			if best < 0 || trip.StartDate.Before(trips[best].StartDate) {
+				best = i
+			}
+		}
+		if best < 0 {
+			continue
+		}
+		tripOf[c.t.ID] = best
+		if c.date.Before(trips[best].StartDate) {
+			trips[best].BookedIDs = append(trips[best].BookedIDs, c.t.ID)
+		} else {
+			trips[best].TransactionIDs = append(trips[best].TransactionIDs, c.t.ID)
+		}
+	}
+
+	for _, c := range followers {
+		of := c.t.Details.FXFeeOfID
+		if of == "" {
+			of = c.t.Details.RefundOfID
+		}
+		i, ok := tripOf[of]
+		if !ok {
+			continue
+		}
+		if slices.Contains(trips[i].BookedIDs, of) {
+			trips[i].BookedIDs = append(trips[i].BookedIDs, c.t.ID)
+		} else {
+			trips[i].TransactionIDs = append(trips[i].TransactionIDs, c.t.ID)
+		}
+	}
+
+	for i := range trips {
+		trips[i].TransactionCount = len(trips[i].TransactionIDs) + len(trips[i].BookedIDs)
+	}
+	return trips
+}
+
+// tripDestination names where a trip went, from the countries spent in or, for trips within the
+// home country, the states. Trips with nowhere resolved are named by the currencies spent in.
+func tripDestination(run []tripCandidate, home string) ([]string, string) {
+	byCount := func(counts map[string]int) []string {
+		var keys []string
+		for k := range counts {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if counts[keys[i]] != counts[keys[j]] {
+				return counts[keys[i]] > counts[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		return keys
+	}
+
+	countries, states, currencies := make(map[string]int), make(map[string]int), make(map[string]int)
+	for _, c := range run {
+		switch {
+		case c.country != "" && c.country != home:
+			countries[c.country]++
+		case c.country == home && c.state != "":
+			states[c.state]++
+		case c.t.Details.ForeignAmount != nil:
+			currencies[c.t.Details.ForeignAmount.Currency]++
+		}
+	}
+
+	if len(countries) > 0 {
+		codes := byCount(countries)
+		names := make([]string, len(codes))
+		for i, code := range codes {
+			names[i] = gazetteer.CountryName(code)
+		}
+		return codes, strings.Join(names, ", ")
+	}
+	if len(states) > 0 {
+		return []string{home}, strings.Join(byCount(states), ", ")
+	}
+	return nil, strings.Join(byCount(currencies), ", ") + " spending"
+}
+
+// tripID derives a stable ID from the first transaction away
+func tripID(firstID string) string {
+	sum := sha256.Sum256([]byte("trip|" + firstID))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// RefreshTrips detects trips across all transactions and replaces the stored trips. Trips found
+// again keep their names.
+func (d *DB) RefreshTrips(ctx context.Context, config TripConfig) ([]Trip, error) {
+	transactions, err := d.GetTransactions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	trips := DetectTrips(transactions, d.timezone, config)
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM trip_transactions`); err != nil {
+		return nil, fmt.Errorf("failed to clear trips: %w", err)
+	}
+	ids := make([]any, len(trips))
+	for i, trip := range trips {
+		ids[i] = trip.ID
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO trips (id, name, destination, countries, start_date, end_date) VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET destination = excluded.destination, countries = excluded.countries,
+				start_date = excluded.start_date, end_date = excluded.end_date
+		`, trip.ID, trip.Name, trip.Destination, strings.Join(trip.Countries, ","),
+			trip.StartDate.Format("2006-01-02"), trip.EndDate.Format("2006-01-02")); err != nil {
+			return nil, fmt.Errorf("failed to store trip: %w", err)
+		}
+		for _, members := range []struct {
+			ids    []string
+			booked bool
+		}{{trip.TransactionIDs, false}, {trip.BookedIDs, true}} {
+			for _, id := range members.ids {
+				if _, err := tx.ExecContext(ctx, `INSERT INTO trip_transactions (transaction_id, trip_id, prebooked) VALUES (?, ?, ?)`,
+					id, trip.ID, members.booked); err != nil {
+					return nil, fmt.Errorf("failed to store trip transaction: %w", err)
+				}
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM trips WHERE id NOT IN (`+placeholders(len(ids))+`)`, ids...); err != nil {
+		return nil, fmt.Errorf("failed to remove old trips: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit trips: %w", err)
+	}
+
+	d.logger.Info("Refreshed trips", "count", len(trips))
+	return trips, nil
+}
+
+// GetTrips returns the stored trips, most recent first, with what each cost in the base currency
+func (d *DB) GetTrips(ctx context.Context) ([]Trip, error) {
+	return d.queryTrips(ctx, "", nil)
+}
+
+// FindTrips returns the trips whose ID, name or destination contain query, ignoring case, most
+// recent first
+func (d *DB) FindTrips(ctx context.Context, query string) ([]Trip, error) {
+	pattern := "%" + escapeLike(query) + "%"
+	return d.queryTrips(ctx, `WHERE tr.id = ? OR tr.name LIKE ? ESCAPE '\' OR tr.destination LIKE ? ESCAPE '\'`,
+		[]any{query, pattern, pattern})
+}
+
+// GetTrip returns a trip by ID, with the IDs of its transactions
+func (d *DB) GetTrip(ctx context.Context, id string) (*Trip, error) {
+	trips, err := d.queryTrips(ctx, "WHERE tr.id = ?", []any{id})
+	if err != nil {
+		return nil, err
+	}
+	if len(trips) == 0 {
+		return nil, fmt.Errorf("trip %s not found", id)
+	}
+	trip := &trips[0]
+
+	rows, err := d.db.QueryContext(ctx, `
+		SELECT tt.transaction_id, tt.prebooked FROM trip_transactions tt JOIN transactions t ON t.id = tt.transaction_id
+		WHERE tt.trip_id = ? ORDER BY t.date, t.id
+	`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trip transactions: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var transactionID string
+		var booked bool
+		if err := rows.Scan(&transactionID, &booked); err != nil {
+			return nil, fmt.Errorf("failed to scan trip transaction: %w", err)
+		}
+		if booked {
+			trip.BookedIDs = append(trip.BookedIDs, transactionID)
+		} else {
+			trip.TransactionIDs = append(trip.TransactionIDs, transactionID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trip transactions: %w", err)
+	}
+	return trip, nil
+}
+
+// queryTrips returns the trips matching where, totalling what each cost
+func (d *DB) queryTrips(ctx context.Context, where string, params []any) ([]Trip, error) {
+	rows, err := d.db.QueryContext(ctx, `
+		WITH costs AS (
+			SELECT tt.trip_id, tt.prebooked, t.currency, substr(t.date, 1, 10) AS day,
+				`+d.baseAmountSQL("t.amount_minor")+` AS amount
+			FROM trip_transactions tt JOIN transactions t ON t.id = tt.transaction_id
+		)
+		SELECT tr.id, tr.name, tr.destination, tr.countries, tr.start_date, tr.end_date,
+			(SELECT COUNT(*) FROM costs c WHERE c.trip_id = tr.id),
+			(SELECT COALESCE(SUM(c.amount), 0) FROM costs c WHERE c.trip_id = tr.id),
+			(SELECT COALESCE(SUM(c.amount), 0) FROM costs c WHERE c.trip_id = tr.id AND c.prebooked),
+			(SELECT MIN(c.currency || ' ' || c.day) FROM costs c WHERE c.trip_id = tr.id AND c.amount IS NULL)
+		FROM trips tr `+where+`
+		ORDER BY tr.start_date DESC, tr.id
+	`, params...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trips: %w", err)
+	}
+	defer rows.Close()
+
+	var trips []Trip
+	for rows.Next() {
+		var trip Trip
+		var countries, start, end string
+		var cost, booked int64
+		var missing sql.NullString
+		if err := rows.Scan(&trip.ID, &trip.Name, &trip.Destination, &countries, &start, &end,
+			&trip.TransactionCount, &cost, &booked, &missing); err != nil {
+			return nil, fmt.Errorf("failed to scan trip: %w", err)
+		}
+		if missing.Valid {
+			currency, day, _ := strings.Cut(missing.String, " ")
+			return nil, missingRateError(currency, d.baseCurrency, day)
+		}
+		if countries != "" {
+			trip.Countries = strings.Split(countries, ",")
+		}
+		if trip.StartDate, err = time.ParseInLocation("2006-01-02", start, d.timezone); err != nil {
+			return nil, fmt.Errorf("invalid trip date %q: %w", start, err)
+		}
+		if trip.EndDate, err = time.ParseInLocation("2006-01-02", end, d.timezone); err != nil {
+			return nil, fmt.Errorf("invalid trip date %q: %w", end, err)
+		}
+		// Spending is negative, so the cost is what's left after refunds as a positive amount
+		trip.Cost = d.fromBaseMinorUnits(-cost)
+		trip.Booked = d.fromBaseMinorUnits(-booked)
+		trips = append(trips, trip)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating trips: %w", err)
+	}
+	return trips, nil
+}
+
+// RenameTrip sets the name of a trip, which is kept when trips are detected again
+func (d *DB) RenameTrip(ctx context.Context, id, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("trip name can't be empty")
+	}
+	res, err := d.db.ExecContext(ctx, `UPDATE trips SET name = ? WHERE id = ?`, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename trip: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("trip %s not found", id)
+	}
+	return nil
+}
+
+// TagTrip adds tags to every transaction on a trip, bookings included, returning how many were tagged
+func (d *DB) TagTrip(ctx context.Context, id string, tags ...string) (int, error) {
+	trip, err := d.GetTrip(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	ids := append(append([]string(nil), trip.TransactionIDs...), trip.BookedIDs...)
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	for _, transactionID := range ids {
+		if err := addTags(ctx, tx, transactionID, tags); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit trip tags: %w", err)
+	}
+	return len(ids), nil
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+func TestTrips(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	ctx := context.Background()
+
+	store := func(date, amount, merchant, location, category string) string {
+		transaction := types.Transaction{Date: date, Amount: money(amount), Payee: merchant + " " + date, Bank: "amex"}
+		details := &types.TransactionDetails{Type: "purchase", Merchant: merchant, Location: location, Category: category, SearchBody: merchant}
+		if err := db.Store(ctx, transaction, details); err != nil {
+			t.Fatalf("failed to store transaction: %v", err)
+		}
+		return GenerateTransactionID(transaction)
+	}
+	// Flights booked months ahead and a hotel booked during the trip count towards it
+	flights := store("01/02/2024", "-1200.00", "Qantas", "Sydney NSW", "Travel")
+	store("01/04/2024", "-45.00", "Ramen", "Tokyo JP", "Food & Dining")
+	store("02/04/2024", "-30.00", "Temple", "Kyoto Japan", "Entertainment")
+	store("03/04/2024", "-300.00", "Hotel", "Melbourne VIC", "Travel")
+	store("05/04/2024", "-25.00", "Sushi", "Osaka JP", "Food & Dining")
+	// Groceries at home aren't travel, and a single purchase in Sydney isn't a trip
+	store("03/04/2024", "-80.00", "Woolworths", "Richmond VIC", "Groceries")
+	store("20/05/2024", "-15.00", "Cafe", "Sydney NSW", "Food & Dining")
+
+	trips, err := db.RefreshTrips(ctx, DefaultTripConfig("AU", ""))
+	if err != nil {
+		t.Fatalf("failed to refresh trips: %v", err)
+	}
+	if len(trips) != 1 {
+		t.Fatalf("expected 1 trip, got %+v", trips)
+	}
+	id := trips[0].ID
+
+	stored, err := db.GetTrips(ctx)
+	if err != nil {
+		t.Fatalf("failed to get trips: %v", err)
+	}
+	trip := stored[0]
+	if trip.Destination != "Japan" || trip.Name != "Japan Apr 2024" || trip.Days() != 5 || trip.TransactionCount != 5 {
+		t.Errorf("unexpected trip: %+v", trip)
+	}
+	if trip.Cost.StringFixed(2) != "1600.00" || trip.Booked.StringFixed(2) != "1200.00" {
+		t.Errorf("expected a cost of 1600.00 with 1200.00 booked, got %s and %s", trip.Cost, trip.Booked)
+	}
+
+	// A name given to the trip survives detecting trips again
+	if err := db.RenameTrip(ctx, id, "Japan with the kids"); err != nil {
+		t.Fatalf("failed to rename trip: %v", err)
+	}
+	if _, err := db.RefreshTrips(ctx, DefaultTripConfig("AU", "")); err != nil {
+		t.Fatalf("failed to refresh trips: %v", err)
+	}
+	found, err := db.FindTrips(ctx, "kids")
+	if err != nil {
+		t.Fatalf("failed to find trips: %v", err)
+	}
+	if len(found) != 1 || found[0].ID != id {
+		t.Fatalf("expected to find the renamed trip, got %+v", found)
+	}
+
+	tagged, err := db.TagTrip(ctx, id, "japan-2024")
+	if err != nil {
+		t.Fatalf("failed to tag trip: %v", err)
+	}
+	if tagged != 5 {
+		t.Errorf("expected 5 transactions tagged, got %d", tagged)
+	}
+	tx, err := db.GetTransactionByID(ctx, flights)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+	if tx.Details.TripID != id || len(tx.Details.Tags) != 1 || tx.Details.Tags[0] != "japan-2024" {
+		t.Errorf("expected the flights on the trip and tagged, got trip %q and tags %v", tx.Details.TripID, tx.Details.Tags)
+	}
+	ids, err := db.GetTransactionIDs(ctx, FilterByTrip(id))
+	if err != nil {
+		t.Fatalf("failed to get trip transactions: %v", err)
+	}
+	if len(ids) != 5 {
+		t.Errorf("expected 5 transactions on the trip, got %d", len(ids))
+	}
+
+	// Interstate trips count once a home state is given
+	if trips, err = db.RefreshTrips(ctx, TripConfig{HomeCountry: "AU", HomeState: "VIC", MaxGap: 3, MinTransactions: 1, BookingWindow: 180}); err != nil {
+		t.Fatalf("failed to refresh trips: %v", err)
+	}
+	if len(trips) != 3 || trips[0].Destination != "NSW" {
+		t.Errorf("expected a trip to NSW first, got %+v", trips)
+	}
+}
@@ -0,0 +1,363 @@
+// Package gazetteer parses free-text transaction locations like "Sydney AU" or
+// "San Francisco USA" into a locality, state, postcode and country, using place
+// data bundled with the binary so no network lookups are needed.
+package gazetteer
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//go:embed data/countries.csv
+var countriesCSV []byte
+
+//go:embed data/regions.csv
+var regionsCSV []byte
+
+//go:embed data/localities.csv
+var localitiesCSV []byte
+
+// Place is a location resolved against the gazetteer. Country is an ISO 3166-1 alpha-2 code
+// and State is the state or territory's abbreviation, such as "NSW" or "CA".
+type Place struct {
+	Locality string `json:"locality,omitempty"`
+	State    string `json:"state,omitempty"`
+	Postcode string `json:"postcode,omitempty"`
+	Country  string `json:"country,omitempty"`
+}
+
+// IsZero reports whether nothing about the place is known
+func (p Place) IsZero() bool {
+	return p == Place{}
+}
+
+// String formats the place the way it would be written on an envelope, e.g. "Bondi NSW 2026, AU"
+func (p Place) String() string {
+	var parts []string
+	for _, s := range []string{p.Locality, p.State, p.Postcode} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	s := strings.Join(parts, " ")
+	if p.Country != "" {
+		if s != "" {
+			s += ", "
+		}
+		s += p.Country
+	}
+	return s
+}
+
+type region struct {
+	country, code, name string
+}
+
+type locality struct {
+	name, state, postcode, country string
+}
+
+// gazetteer holds the bundled place data, keyed by tokenized name
+type gazetteer struct {
+	countries     map[string]string // name, alias or code to alpha-2 code
+	countryNames  map[string]string // alpha-2 code to name
+	regions       map[string][]region
+	regionsByCode map[string][]region
+	localities    map[string][]locality
+}
+
+var (
+	loadOnce sync.Once
+	places   *gazetteer
+)
+
+// load parses the bundled data the first time it's needed
+func load() *gazetteer {
+	loadOnce.Do(func() {
+		g := &gazetteer{
+			countries:     make(map[string]string),
+			countryNames:  make(map[string]string),
+			regions:       make(map[string][]region),
+			regionsByCode: make(map[string][]region),
+			localities:    make(map[string][]locality),
+		}
+		for _, f := range readCSV(countriesCSV) {
+			code := f[0]
+			g.countryNames[code] = f[2]
+			g.countries[code] = code
+			g.countries[f[1]] = code
+			g.countries[key(f[2])] = code
+			for _, alias := range strings.Split(f[3], "|") {
+				if alias != "" {
+					g.countries[key(alias)] = code
+				}
+			}
+		}
+		for _, f := range readCSV(regionsCSV) {
+			r := region{country: f[0], code: f[1], name: f[2]}
+			g.regions[key(r.name)] = append(g.regions[key(r.name)], r)
+			g.regionsByCode[r.code] = append(g.regionsByCode[r.code], r)
+		}
+		for _, f := range readCSV(localitiesCSV) {
+			l := locality{name: f[0], state: f[1], postcode: f[2], country: f[3]}
+			g.localities[key(l.name)] = append(g.localities[key(l.name)], l)
+		}
+		places = g
+	})
+	return places
+}
+
+// readCSV splits the bundled data into fields, skipping comments. The files are simple enough
+// that no field contains a comma.
+func readCSV(data []byte) [][]string {
+	var records [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		records = append(records, strings.Split(line, ","))
+	}
+	return records
+}
+
+// tokenize upper-cases text and splits it into words, dropping punctuation and apostrophes so
+// "St. Kilda" and "ST KILDA" read the same
+func tokenize(s string) []string {
+	s = strings.NewReplacer("'", "", "’", "").Replace(strings.ToUpper(s))
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// key is the form names are looked up by
+func key(s string) string {
+	return strings.Join(tokenize(s), " ")
+}
+
+// CountryName returns the name of a country from its alpha-2 code, or the code if unknown
+func CountryName(code string) string {
+	if name, ok := load().countryNames[strings.ToUpper(code)]; ok {
+		return name
+	}
+	return code
+}
+
+// CountryCode returns the alpha-2 code for a country name, alias or code, such as "Japan",
+// "USA" or "gb", or "" if the country isn't known
+func CountryCode(s string) string {
+	return load().countries[key(s)]
+}
+
+// StateCode returns the abbreviation for a state name or abbreviation, such as "Victoria" or
+// "nsw", or "" if the state isn't known
+func StateCode(s string) string {
+	g := load()
+	if rs := g.regions[key(s)]; len(rs) > 0 {
+		return rs[0].code
+	}
+	if rs := g.regionsByCode[key(s)]; len(rs) > 0 {
+		return rs[0].code
+	}
+	return ""
+}
+
+// Parse resolves a free-text location into a place. Words that aren't recognised are kept as the
+// locality when a country, state or postcode was found alongside them; otherwise an
+// unrecognisable location such as "Online" parses to the zero Place.
+func Parse(text string) Place {
+	g := load()
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return Place{}
+	}
+
+	// The end of a location can name a country or a state, like CA for Canada or California or
+	// Georgia for either, so try both readings and keep the first that names a known locality.
+	// Australian states are read as states first.
+	readings := []bool{true}
+	if n, _ := g.matchCountry(tokens); n > 0 {
+		if m, rs := g.matchRegion(tokens, ""); m == n {
+			readings = []bool{true, false}
+			if rs[0].country == "AU" {
+				readings = []bool{false, true}
+			}
+		}
+	}
+
+	var first Place
+	for i, readCountry := range readings {
+		p, matched := g.parse(tokens, readCountry)
+		if matched {
+			return p
+		}
+		if i == 0 {
+			first = p
+		}
+	}
+	return first
+}
+
+// parse reads a country, postcode and state from the end of tokens and looks up the rest as a
+// locality, reporting whether a known locality was found. The country is only read when
+// readCountry is set.
+func (g *gazetteer) parse(tokens []string, readCountry bool) (Place, bool) {
+	var p Place
+	var popped []string
+
+	if n, code := g.matchCountry(tokens); readCountry && n > 0 {
+		p.Country = code
+		popped, tokens = tokens[len(tokens)-n:], tokens[:len(tokens)-n]
+	}
+	tokens = p.popPostcode(tokens)
+
+	// An abbreviation like WA is shared by several states, so try each until one has the locality
+	n, regions := g.matchRegion(tokens, p.Country)
+	if n == 0 {
+		return g.resolve(p, tokens, popped)
+	}
+	var first Place
+	for i, r := range regions {
+		rp := p
+		rp.State, rp.Country = r.code, r.country
+		resolved, matched := g.resolve(rp, tokens[:len(tokens)-n], tokens[len(tokens)-n:])
+		if matched {
+			return resolved, true
+		}
+		if i == 0 {
+			first = resolved
+		}
+	}
+	return first, false
+}
+
+// resolve looks up the tokens left once the country and state are read as a locality consistent
+// with them. A suburb that isn't in the gazetteer but ends in one that is, like North Ryde, takes
+// its state and country from the known one.
+func (g *gazetteer) resolve(p Place, tokens, popped []string) (Place, bool) {
+	tokens = p.popPostcode(tokens)
+	if p.Postcode != "" && len(p.Postcode) == 4 && p.State == "" {
+		p.State = postcodeState(p.Postcode)
+	}
+
+	// A location that is only a country or state may also name a city, like Singapore or New York
+	if len(tokens) == 0 {
+		tokens = popped
+	}
+	for n := len(tokens); n > 0; n-- {
+		for _, l := range g.localities[strings.Join(tokens[len(tokens)-n:], " ")] {
+			if (p.Country != "" && l.country != p.Country) || (p.State != "" && l.state != "" && l.state != p.State) {
+				continue
+			}
+			p.Locality, p.Country = l.name, l.country
+			if l.state != "" {
+				p.State = l.state
+			}
+			if n < len(tokens) {
+				p.Locality = title(tokens)
+			}
+			return p, true
+		}
+	}
+
+	if !p.IsZero() && len(tokens) > 0 && !slices.Equal(tokens, popped) {
+		p.Locality = title(tokens)
+	}
+	return p, false
+}
+
+// matchCountry finds a country named by the trailing tokens, returning how many tokens it spans
+func (g *gazetteer) matchCountry(tokens []string) (int, string) {
+	for n := min(len(tokens), 6); n > 0; n-- {
+		if code, ok := g.countries[strings.Join(tokens[len(tokens)-n:], " ")]; ok {
+			return n, code
+		}
+	}
+	return 0, ""
+}
+
+// matchRegion finds the states named or abbreviated by the trailing tokens, limited to the
+// country when it's known, returning how many tokens they span. Australian states come first.
+func (g *gazetteer) matchRegion(tokens []string, country string) (int, []region) {
+	for n := min(len(tokens), 4); n > 0; n-- {
+		k := strings.Join(tokens[len(tokens)-n:], " ")
+		candidates := g.regions[k]
+		if n == 1 {
+			candidates = append(slices.Clone(candidates), g.regionsByCode[k]...)
+		}
+		var matched []region
+		for _, r := range candidates {
+			if country == "" || r.country == country {
+				matched = append(matched, r)
+			}
+		}
+		if len(matched) > 0 {
+			return n, matched
+		}
+	}
+	return 0, nil
+}
+
+// popPostcode takes a trailing Australian (4 digit) or US (5 digit) postcode off tokens
+func (p *Place) popPostcode(tokens []string) []string {
+	if p.Postcode != "" || len(tokens) == 0 {
+		return tokens
+	}
+	last := tokens[len(tokens)-1]
+	if strings.IndexFunc(last, func(r rune) bool { return !unicode.IsDigit(r) }) != -1 {
+		return tokens
+	}
+	switch {
+	case len(last) == 4 && (p.Country == "" || p.Country == "AU"):
+		p.Country = "AU"
+	case len(last) == 5 && (p.Country == "" || p.Country == "US"):
+		p.Country = "US"
+	default:
+		return tokens
+	}
+	p.Postcode = last
+	return tokens[:len(tokens)-1]
+}
+
+// postcodeStates maps Australian postcode ranges to their state
+var postcodeStates = []struct {
+	from, to int
+	state    string
+}{
+	{200, 299, "ACT"}, {800, 999, "NT"}, {1000, 2599, "NSW"}, {2600, 2618, "ACT"},
+	{2619, 2899, "NSW"}, {2900, 2920, "ACT"}, {2921, 2999, "NSW"}, {3000, 3999, "VIC"},
+	{4000, 4999, "QLD"}, {5000, 5999, "SA"}, {6000, 6999, "WA"}, {7000, 7999, "TAS"},
+	{8000, 8999, "VIC"}, {9000, 9999, "QLD"},
+}
+
+// postcodeState returns the state an Australian postcode belongs to
+func postcodeState(postcode string) string {
+	var n int
+	if _, err := fmt.Sscanf(postcode, "%d", &n); err != nil {
+		return ""
+	}
+	for _, r := range postcodeStates {
+		if n >= r.from && n <= r.to {
+			return r.state
+		}
+	}
+	return ""
+}
+
+// title formats upper-case tokens as a title-cased name
+func title(tokens []string) string {
+	words := make([]string, len(tokens))
+	for i, t := range tokens {
+		r := []rune(strings.ToLower(t))
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,58 @@
+package gazetteer
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		location string
+		want     Place
+	}{
+		{"Sydney AU", Place{Locality: "Sydney", State: "NSW", Country: "AU"}},
+		{"SYDNEY NSW AUS", Place{Locality: "Sydney", State: "NSW", Country: "AU"}},
+		{"Bondi Junction NSW 2022", Place{Locality: "Bondi Junction", State: "NSW", Postcode: "2022", Country: "AU"}},
+		{"St. Kilda, Victoria", Place{Locality: "St Kilda", State: "VIC", Country: "AU"}},
+		{"Richmond VIC", Place{Locality: "Richmond", State: "VIC", Country: "AU"}},
+		{"Richmond NSW", Place{Locality: "Richmond", State: "NSW", Country: "AU"}},
+		{"Paddington 4064", Place{Locality: "Paddington", State: "QLD", Postcode: "4064", Country: "AU"}},
+		{"North Ryde NSW", Place{Locality: "North Ryde", State: "NSW", Country: "AU"}},
+		{"Adelaide SA", Place{Locality: "Adelaide", State: "SA", Country: "AU"}},
+		{"Perth WA", Place{Locality: "Perth", State: "WA", Country: "AU"}},
+		{"Seattle WA", Place{Locality: "Seattle", State: "WA", Country: "US"}},
+		{"San Francisco USA", Place{Locality: "San Francisco", State: "CA", Country: "US"}},
+		{"SAN FRANCISCO CA", Place{Locality: "San Francisco", State: "CA", Country: "US"}},
+		{"Vancouver CA", Place{Locality: "Vancouver", Country: "CA"}},
+		{"Atlanta Georgia", Place{Locality: "Atlanta", State: "GA", Country: "US"}},
+		{"New York", Place{Locality: "New York", State: "NY", Country: "US"}},
+		{"Singapore", Place{Locality: "Singapore", Country: "SG"}},
+		{"Tokyo Japan", Place{Locality: "Tokyo", Country: "JP"}},
+		{"London United Kingdom", Place{Locality: "London", Country: "GB"}},
+		{"Kyoto JPN", Place{Locality: "Kyoto", Country: "JP"}},
+		{"Somewhere Small NZ", Place{Locality: "Somewhere Small", Country: "NZ"}},
+		{"Japan", Place{Country: "JP"}},
+		{"Online", Place{}},
+		{"", Place{}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.location); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestCodes(t *testing.T) {
+	if got := CountryCode("united states"); got != "US" {
+		t.Errorf("expected US, got %q", got)
+	}
+	if got := CountryCode("JPN"); got != "JP" {
+		t.Errorf("expected JP, got %q", got)
+	}
+	if got := CountryName("nz"); got != "New Zealand" {
+		t.Errorf("expected New Zealand, got %q", got)
+	}
+	if got := StateCode("victoria"); got != "VIC" {
+		t.Errorf("expected VIC, got %q", got)
+	}
+	if got := StateCode("nsw"); got != "NSW" {
+		t.Errorf("expected NSW, got %q", got)
+	}
+}
@@ -0,0 +1,42 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for list_alerts
+func (s *Server) listAlertsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	includeDismissed, err := boolArgument(request, "include_dismissed")
+	if err != nil {
+		return nil, err
+	}
+
+	alerts, err := s.db.GetAlerts(ctx, includeDismissed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get alerts: %w", err)
+	}
+	if len(alerts) == 0 {
+		return mcp.NewToolResultText("No alerts found."), nil
+	}
+
+	result := "Alerts:\n\n"
+	for _, a := range alerts {
+		dismissed := ""
+		if a.Dismissed {
+			dismissed = " (dismissed)"
+		}
+		result += fmt.Sprintf("[%s] %s%s\n", a.Kind, a.Message, dismissed)
+		if t := a.Transaction; t != nil {
+			result += fmt.Sprintf("  Date: %s, Amount: %s, Merchant: %s, Bank: %s\n", t.Date, t.Amount, t.Details.Merchant, t.Bank)
+		}
+		result += fmt.Sprintf("  Transaction ID: %s\n", a.TransactionID)
+		if a.RelatedID != "" {
+			result += fmt.Sprintf("  Duplicates: %s\n", a.RelatedID)
+		}
+		result += fmt.Sprintf("  Alert ID: %d\n\n", a.ID)
+	}
+	return mcp.NewToolResultText(result), nil
+}
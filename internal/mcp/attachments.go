@@ -0,0 +1,52 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for attach_file
+func (s *Server) attachFileHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, ok := request.Params.Arguments["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("id is required and must be a string")
+	}
+	path, ok := request.Params.Arguments["path"].(string)
+	if !ok || path == "" {
+		return nil, errors.New("path is required and must be a string")
+	}
+
+	a, err := s.db.AttachFile(ctx, id, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach file: %w", err)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Attached %s to transaction %s as attachment %d, stored at %s.",
+		a.Filename, id, a.ID, s.db.AttachmentPath(a))), nil
+}
+
+// Handler for list_attachments
+func (s *Server) listAttachmentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, ok := request.Params.Arguments["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("id is required and must be a string")
+	}
+
+	attachments, err := s.db.GetAttachments(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+	if len(attachments) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("Transaction %s has no attachments.", id)), nil
+	}
+
+	result := fmt.Sprintf("Attachments for transaction %s:\n\n", id)
+	for _, a := range attachments {
+		result += fmt.Sprintf("%s (%s, %d bytes)\n", a.Filename, a.ContentType, a.Size)
+		result += fmt.Sprintf("  ID: %d\n", a.ID)
+		result += fmt.Sprintf("  Path: %s\n", s.db.AttachmentPath(&a))
+	}
+	return mcp.NewToolResultText(result), nil
+}
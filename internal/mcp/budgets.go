@@ -0,0 +1,36 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for budget_status
+func (s *Server) budgetStatusHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	statuses, err := s.db.GetBudgetStatus(ctx, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget status: %w", err)
+	}
+	if len(statuses) == 0 {
+		return mcp.NewToolResultText("No budgets have been set."), nil
+	}
+
+	result := "Budgets:\n\n"
+	breached := 0
+	for _, b := range statuses {
+		flag := ""
+		if b.Breached() {
+			breached++
+			flag = " [!]"
+		}
+		result += fmt.Sprintf("%s (%s from %s) - %s%s\n", b.Name(), b.Period, b.Start.Format("2006-01-02"), b.Status, flag)
+		result += fmt.Sprintf("  Budgeted: %s, Spent: %s, Remaining: %s\n",
+			b.Amount.StringFixed(2), b.Spent.StringFixed(2), b.Remaining.StringFixed(2))
+		result += fmt.Sprintf("  Projected by %s: %s\n\n", b.End.AddDate(0, 0, -1).Format("2006-01-02"), b.Projected.StringFixed(2))
+	}
+	result += fmt.Sprintf("%d of %d budgets are over or on pace to go over.\n", breached, len(statuses))
+	return mcp.NewToolResultText(result), nil
+}
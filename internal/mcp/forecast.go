@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/shopspring/decimal"
+)
+
+// Handler for cash_flow_forecast
+func (s *Server) cashFlowForecastHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	balanceArg, ok := request.Params.Arguments["balance"].(string)
+	if !ok || balanceArg == "" {
+		return nil, errors.New("balance is required and must be a string")
+	}
+	balance, err := decimal.NewFromString(balanceArg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid balance %q: %w", balanceArg, err)
+	}
+	lowBalance := decimal.Zero
+	if v, ok := request.Params.Arguments["low_balance"].(string); ok && v != "" {
+		if lowBalance, err = decimal.NewFromString(v); err != nil {
+			return nil, fmt.Errorf("invalid low_balance %q: %w", v, err)
+		}
+	}
+	days, err := intArgument(request, "days", db.DefaultForecastDays)
+	if err != nil {
+		return nil, err
+	}
+	bank, _ := request.Params.Arguments["bank"].(string)
+
+	f, err := s.db.ForecastCashFlow(ctx, time.Now(), db.ForecastOptions{
+		Balance:    balance,
+		Days:       days,
+		LowBalance: lowBalance,
+		Bank:       bank,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to forecast cash flow: %w", err)
+	}
+
+	result := fmt.Sprintf("Cash Flow Forecast from %s to %s, starting from %s:\n", f.Start.Format("2006-01-02"), f.End.Format("2006-01-02"), f.OpeningBalance.StringFixed(2))
+	result += fmt.Sprintf("Discretionary spending of %s a day, averaged over the last %d days\n", f.DailyDiscretionary.StringFixed(2), f.LookbackDays)
+	for _, n := range []int{30, 60, 90} {
+		if b, ok := f.BalanceAfter(n); ok {
+			result += fmt.Sprintf("Balance after %d days: %s\n", n, b.StringFixed(2))
+		}
+	}
+	if len(f.Days) > 0 {
+		lowest := f.Lowest()
+		result += fmt.Sprintf("Lowest balance: %s on %s\n", lowest.Balance.StringFixed(2), lowest.Date.Format("2006-01-02"))
+	}
+	if low := f.LowBalanceDays(); len(low) > 0 {
+		result += fmt.Sprintf("WARNING: %d days are expected to end below %s, starting %s\n", len(low), f.LowBalance.StringFixed(2), low[0].Date.Format("2006-01-02"))
+	}
+
+	result += "\nDay by day:\n"
+	for _, day := range f.Days {
+		flag := ""
+		if day.Low {
+			flag = " [low]"
+		}
+		result += fmt.Sprintf("%s: %s%s", day.Date.Format("2006-01-02"), day.Balance.StringFixed(2), flag)
+		for i, p := range day.Payments {
+			if i == 0 {
+				result += " -"
+			}
+			result += " " + p.String()
+		}
+		result += "\n"
+	}
+	return mcp.NewToolResultText(result), nil
+}
@@ -0,0 +1,55 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for fx_summary
+func (s *Server) fxSummaryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	currency, _ := request.Params.Arguments["currency"].(string)
+	days, err := intArgument(request, "days", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []db.TransactionQueryOption{db.FilterByForeignCurrency(currency)}
+	if days > 0 {
+		opts = append(opts, db.FilterByDays(days))
+	}
+	report, err := s.db.GetFXReport(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get foreign spending: %w", err)
+	}
+	if len(report.Currencies) == 0 {
+		return mcp.NewToolResultText("No foreign spending found."), nil
+	}
+
+	result := fmt.Sprintf("Foreign spending of %s with %s in international transaction fees:\n", report.TotalAmount.StringFixed(2), report.TotalFees.StringFixed(2))
+	for _, c := range report.Currencies {
+		result += fmt.Sprintf("- %s: %d purchases, %s %s for %s plus %s fees, effective rate %s",
+			c.Currency, c.Count, c.ForeignAmount.StringFixed(2), c.Currency, c.Amount.StringFixed(2), c.Fees.StringFixed(2), c.EffectiveRate)
+		if !c.MarkupPercent.IsZero() {
+			result += fmt.Sprintf(", %s%% over mid-market", c.MarkupPercent.StringFixed(2))
+		}
+		result += "\n"
+	}
+
+	result += "\nPurchases:\n"
+	for _, t := range report.Transactions {
+		result += fmt.Sprintf("- %s %s (%s): %s %s for %s", t.Date, t.Details.Merchant, t.ID,
+			t.Details.ForeignAmount.Amount.StringFixed(2), t.Details.ForeignAmount.Currency, t.Amount)
+		if t.Details.FXFee.IsPositive() {
+			result += fmt.Sprintf(" plus %s fee", t.Details.FXFee.StringFixed(2))
+		}
+		result += fmt.Sprintf(", implied rate %s, effective rate %s", t.ImpliedRate, t.EffectiveRate)
+		if !t.MidMarketRate.IsZero() {
+			result += fmt.Sprintf(", mid-market %s (%s%% markup)", t.MidMarketRate, t.MarkupPercent.StringFixed(2))
+		}
+		result += "\n"
+	}
+	return mcp.NewToolResultText(result), nil
+}
@@ -0,0 +1,57 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for income_summary
+func (s *Server) incomeSummaryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	period, _ := request.Params.Arguments["period"].(string)
+	if period == "" {
+		period = db.SummaryMonthly
+	}
+	count, err := intArgument(request, "periods", 3)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sources, err := s.db.GetIncomeSources(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get income sources: %w", err)
+	}
+	if len(sources) == 0 {
+		return mcp.NewToolResultText("No income found."), nil
+	}
+	periods, err := s.db.IncomeReport(ctx, period, count, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get income report: %w", err)
+	}
+
+	result := fmt.Sprintf("Income sources, in %s:\n", s.db.BaseCurrency())
+	for _, src := range sources {
+		result += fmt.Sprintf("- %s (%s): %d deposits totalling %s, last %s on %s", src.Name, src.Kind,
+			src.TransactionCount, src.Total.StringFixed(2), src.LastAmount.StringFixed(2), src.LastDate.Format("2006-01-02"))
+		if src.Cadence != "" {
+			result += fmt.Sprintf(", paid %s, usually %s, next expected %s, %s", src.Cadence, src.UsualAmount.StringFixed(2),
+				src.NextDate.Format("2006-01-02"), src.Status(now))
+			if src.DaysLate > 0 {
+				result += fmt.Sprintf(" (last deposit %d days after expected)", src.DaysLate)
+			}
+		}
+		result += "\n"
+	}
+
+	for _, p := range periods {
+		result += fmt.Sprintf("\n%s: %s\n", p.Period, p.Total.StringFixed(2))
+		for _, total := range p.Sources {
+			result += fmt.Sprintf("- %s (%s): %s from %d deposits\n", total.Name, total.Kind, total.Amount.StringFixed(2), total.Count)
+		}
+	}
+	return mcp.NewToolResultText(result), nil
+}
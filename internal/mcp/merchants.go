@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for list_merchants
+func (s *Server) listMerchantsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, _ := request.Params.Arguments["query"].(string)
+
+	merchants, err := s.db.GetMerchants(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merchants: %w", err)
+	}
+	if len(merchants) == 0 {
+		return mcp.NewToolResultText("No merchants found."), nil
+	}
+
+	result := "Merchants:\n\n"
+	for _, m := range merchants {
+		result += fmt.Sprintf("%s - %d transactions\n", m.Name, m.TransactionCount)
+		result += fmt.Sprintf("  ID: %d\n", m.ID)
+		if m.DefaultCategory != "" {
+			result += fmt.Sprintf("  Default category: %s\n", m.DefaultCategory)
+		}
+		if m.Website != "" {
+			result += fmt.Sprintf("  Website: %s\n", m.Website)
+		}
+		if m.Notes != "" {
+			result += fmt.Sprintf("  Notes: %s\n", m.Notes)
+		}
+		if len(m.Aliases) > 0 {
+			result += fmt.Sprintf("  Aliases: %s\n", strings.Join(m.Aliases, ", "))
+		}
+		result += "\n"
+	}
+	return mcp.NewToolResultText(result), nil
+}
+
+// Handler for update_merchant
+func (s *Server) updateMerchantHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ref, ok := request.Params.Arguments["merchant"].(string)
+	if !ok || ref == "" {
+		return nil, errors.New("merchant is required and must be a string")
+	}
+
+	var name, category, website, notes *string
+	if v, ok := request.Params.Arguments["name"].(string); ok && v != "" {
+		name = &v
+	}
+	if v, ok := request.Params.Arguments["default_category"].(string); ok {
+		if _, valid := types.AllowedCategoriesMap[v]; v != "" && !valid {
+			var allowed []string
+			for k := range types.AllowedCategoriesMap {
+				allowed = append(allowed, k)
+			}
+			return nil, fmt.Errorf("invalid category '%s'. Allowed categories: %v", v, allowed)
+		}
+		category = &v
+	}
+	if v, ok := request.Params.Arguments["website"].(string); ok {
+		website = &v
+	}
+	if v, ok := request.Params.Arguments["notes"].(string); ok {
+		notes = &v
+	}
+
+	m, err := s.db.FindMerchant(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.UpdateMerchant(ctx, m.ID, name, category, website, notes); err != nil {
+		return nil, fmt.Errorf("failed to update merchant: %w", err)
+	}
+	return mcp.NewToolResultText("Merchant updated successfully."), nil
+}
+
+// Handler for merge_merchants
+func (s *Server) mergeMerchantsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	targetRef, ok := request.Params.Arguments["target"].(string)
+	if !ok || targetRef == "" {
+		return nil, errors.New("target is required and must be a string")
+	}
+	sourcesArg, _ := request.Params.Arguments["sources"].(string)
+
+	target, err := s.db.FindMerchant(ctx, targetRef)
+	if err != nil {
+		return nil, err
+	}
+	var sources []int64
+	for _, ref := range strings.Split(sourcesArg, ",") {
+		if ref = strings.TrimSpace(ref); ref == "" {
+			continue
+		}
+		m, err := s.db.FindMerchant(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, m.ID)
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("sources must name at least one merchant")
+	}
+
+	if err := s.db.MergeMerchants(ctx, target.ID, sources...); err != nil {
+		return nil, fmt.Errorf("failed to merge merchants: %w", err)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Merged %d merchants into %s.", len(sources), target.Name)), nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/charmbracelet/log"
 	"github.com/lox/bank-transaction-analyzer/internal/db"
@@ -56,6 +57,33 @@ func (s *Server) Run() error {
 		mcp.WithString("bank",
 			mcp.Description("Filter by bank/source (e.g. 'amex', 'ing-australia')"),
 		),
+		mcp.WithString("card",
+			mcp.Description("Filter by card (card token or last 4 digits). Use list_cards tool to see available cards."),
+		),
+		mcp.WithString("merchant",
+			mcp.Description("Filter by merchant name or alias. Use list_merchants tool to see available merchants."),
+		),
+		mcp.WithString("country",
+			mcp.Description("Filter by country the transaction was made in, as a name or ISO code (e.g. 'Japan', 'US')"),
+		),
+		mcp.WithString("state",
+			mcp.Description("Filter by state the transaction was made in, as a name or abbreviation (e.g. 'NSW', 'California')"),
+		),
+		mcp.WithString("locality",
+			mcp.Description("Filter by city or suburb the transaction was made in (e.g. 'Bondi Junction')"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Comma-separated tags, matching transactions with any of them. Use list_tags tool to see available tags."),
+		),
+		mcp.WithString("all_tags",
+			mcp.Description("Comma-separated tags, matching transactions with all of them"),
+		),
+		mcp.WithString("exclude_tags",
+			mcp.Description("Comma-separated tags to leave out transactions with"),
+		),
+		mcp.WithString("cardholder",
+			mcp.Description("Filter by cardholder name (e.g. 'Sam')"),
+		),
 	), s.searchTransactionsHandler)
 
 	mcpServer.AddTool(mcp.NewTool("list_transactions",
@@ -85,6 +113,33 @@ func (s *Server) Run() error {
 		mcp.WithString("max_amount",
 			mcp.Description("Filter by maximum amount (e.g. '500')"),
 		),
+		mcp.WithString("card",
+			mcp.Description("Filter by card (card token or last 4 digits). Use list_cards tool to see available cards."),
+		),
+		mcp.WithString("merchant",
+			mcp.Description("Filter by merchant name or alias. Use list_merchants tool to see available merchants."),
+		),
+		mcp.WithString("country",
+			mcp.Description("Filter by country the transaction was made in, as a name or ISO code (e.g. 'Japan', 'US')"),
+		),
+		mcp.WithString("state",
+			mcp.Description("Filter by state the transaction was made in, as a name or abbreviation (e.g. 'NSW', 'California')"),
+		),
+		mcp.WithString("locality",
+			mcp.Description("Filter by city or suburb the transaction was made in (e.g. 'Bondi Junction')"),
+		),
+		mcp.WithString("tags",
+			mcp.Description("Comma-separated tags, matching transactions with any of them. Use list_tags tool to see available tags."),
+		),
+		mcp.WithString("all_tags",
+			mcp.Description("Comma-separated tags, matching transactions with all of them"),
+		),
+		mcp.WithString("exclude_tags",
+			mcp.Description("Comma-separated tags to leave out transactions with"),
+		),
+		mcp.WithString("cardholder",
+			mcp.Description("Filter by cardholder name (e.g. 'Sam')"),
+		),
 	), s.listTransactionsHandler)
 
 	mcpServer.AddTool(mcp.NewTool("list_categories",
@@ -102,8 +157,29 @@ func (s *Server) Run() error {
 		mcp.WithDescription("List all available banks/sources for transactions"),
 	), s.listBanksHandler)
 
+	mcpServer.AddTool(mcp.NewTool("list_cards",
+		mcp.WithDescription("List all cards seen on transactions with their cardholder and account"),
+	), s.listCardsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("update_card",
+		mcp.WithDescription("Assign a cardholder, account or label to a card"),
+		mcp.WithString("card",
+			mcp.Required(),
+			mcp.Description("Card token or last 4 digits"),
+		),
+		mcp.WithString("cardholder",
+			mcp.Description("Name of the person the card belongs to (optional)"),
+		),
+		mcp.WithString("account",
+			mcp.Description("Account the card is attached to (optional)"),
+		),
+		mcp.WithString("label",
+			mcp.Description("Label for the card, e.g. 'Supplementary Amex' (optional)"),
+		),
+	), s.updateCardHandler)
+
 	mcpServer.AddTool(mcp.NewTool("update_transaction",
-		mcp.WithDescription("Update merchant, type, details_category, or tags for a transaction by ID"),
+		mcp.WithDescription("Update merchant, type, details_category, tags, notes or deduction for a transaction by ID"),
 		mcp.WithString("id",
 			mcp.Required(),
 			mcp.Description("Transaction ID to update"),
@@ -120,8 +196,181 @@ func (s *Server) Run() error {
 		mcp.WithString("tags",
 			mcp.Description("Comma-separated tags to add (optional)"),
 		),
+		mcp.WithString("notes",
+			mcp.Description("Notes about the transaction, e.g. 'client dinner, claimable', replacing any existing notes (optional)"),
+		),
+		mcp.WithString("deduction",
+			mcp.Description("ATO deduction category such as D5 for other work-related expenses, or 'none' to mark it as not deductible (optional)"),
+		),
 	), s.updateTransactionHandler)
 
+	mcpServer.AddTool(mcp.NewTool("split_transaction",
+		mcp.WithDescription("Split a transaction across categories. Splits must sum to the transaction amount and replace any existing splits"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Transaction ID to split"),
+		),
+		mcp.WithString("splits",
+			mcp.Required(),
+			mcp.Description("Semicolon-separated splits as amount:category[:tags[:note]], e.g. '-80.00:Groceries;-20.00:Home:costco'. Empty to remove the splits"),
+		),
+	), s.splitTransactionHandler)
+
+	mcpServer.AddTool(mcp.NewTool("list_subscriptions",
+		mcp.WithDescription("List recurring payments and subscriptions with their cadence, expected next payment and status (active, stopped or price changed)"),
+		mcp.WithString("include_stopped",
+			mcp.Description("Include series that have stopped (true/false, default: false)"),
+		),
+		mcp.WithString("include_income",
+			mcp.Description("Include recurring income such as salary (true/false, default: false)"),
+		),
+	), s.listSubscriptionsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("list_merchants",
+		mcp.WithDescription("List canonical merchants with their aliases, default category and transaction counts"),
+		mcp.WithString("query",
+			mcp.Description("Only merchants whose name or an alias contains this text (optional)"),
+		),
+	), s.listMerchantsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("update_merchant",
+		mcp.WithDescription("Rename a merchant or set its default category, website or notes"),
+		mcp.WithString("merchant",
+			mcp.Required(),
+			mcp.Description("Merchant ID, name or alias"),
+		),
+		mcp.WithString("name",
+			mcp.Description("New canonical name (optional)"),
+		),
+		mcp.WithString("default_category",
+			mcp.Description("Category applied to new transactions the classifier leaves uncategorised (optional)"),
+		),
+		mcp.WithString("website",
+			mcp.Description("Merchant website (optional)"),
+		),
+		mcp.WithString("notes",
+			mcp.Description("Notes about the merchant (optional)"),
+		),
+	), s.updateMerchantHandler)
+
+	mcpServer.AddTool(mcp.NewTool("merge_merchants",
+		mcp.WithDescription("Merge duplicate merchants into one, moving their aliases and transactions"),
+		mcp.WithString("target",
+			mcp.Required(),
+			mcp.Description("Merchant ID, name or alias to keep"),
+		),
+		mcp.WithString("sources",
+			mcp.Required(),
+			mcp.Description("Comma-separated merchant IDs, names or aliases to merge into the target"),
+		),
+	), s.mergeMerchantsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("list_tags",
+		mcp.WithDescription("List tags with the number of transactions that have them"),
+	), s.listTagsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("tag_transaction",
+		mcp.WithDescription("Add or remove tags on a transaction by ID"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Transaction ID to tag"),
+		),
+		mcp.WithString("add",
+			mcp.Description("Comma-separated tags to add (optional)"),
+		),
+		mcp.WithString("remove",
+			mcp.Description("Comma-separated tags to remove (optional)"),
+		),
+	), s.tagTransactionHandler)
+
+	mcpServer.AddTool(mcp.NewTool("attach_file",
+		mcp.WithDescription("Attach a file such as a PDF or JPEG receipt to a transaction"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Transaction ID to attach the file to"),
+		),
+		mcp.WithString("path",
+			mcp.Required(),
+			mcp.Description("Path of the file to attach, which is copied into the attachment store"),
+		),
+	), s.attachFileHandler)
+
+	mcpServer.AddTool(mcp.NewTool("list_attachments",
+		mcp.WithDescription("List the files attached to a transaction, with the paths to open them from"),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Transaction ID"),
+		),
+	), s.listAttachmentsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("budget_status",
+		mcp.WithDescription("Show spending against each category and tag budget this month or year, with the projected spend at the current pace. Spending excludes transfers between your own accounts. Budgets that are over, or on pace to go over, are flagged."),
+	), s.budgetStatusHandler)
+
+	mcpServer.AddTool(mcp.NewTool("spending_summary",
+		mcp.WithDescription("Summarise income, expenses, net savings rate and top categories and merchants by month or year, compared with the previous period and the same month a year earlier. Transfers between your own accounts are excluded and refunds reduce expenses."),
+		mcp.WithString("period",
+			mcp.Description("monthly or yearly (default monthly)"),
+		),
+		mcp.WithString("periods",
+			mcp.Description("Number of periods to summarise, most recent first (default 1)"),
+		),
+		mcp.WithString("top",
+			mcp.Description("Number of top categories and merchants (default 5)"),
+		),
+	), s.spendingSummaryHandler)
+
+	mcpServer.AddTool(mcp.NewTool("list_alerts",
+		mcp.WithDescription("List alerts raised on unusual imported transactions: duplicate charges, amounts far above a merchant's usual, large first charges at a merchant, foreign spending when not travelling, and new fees"),
+		mcp.WithString("include_dismissed",
+			mcp.Description("Include alerts that have been dismissed (true/false, default: false)"),
+		),
+	), s.listAlertsHandler)
+
+	mcpServer.AddTool(mcp.NewTool("cash_flow_forecast",
+		mcp.WithDescription("Forecast the balance day by day from recurring income and bills, such as salary, rent and subscriptions, plus average discretionary spending per category, warning about days expected to end with a low balance"),
+		mcp.WithString("balance",
+			mcp.Required(),
+			mcp.Description("Current balance to forecast from, e.g. '5230.10'"),
+		),
+		mcp.WithString("days",
+			mcp.Description("Number of days to forecast, such as 30, 60 or 90 (default 90)"),
+		),
+		mcp.WithString("low_balance",
+			mcp.Description("Warn about days expected to end below this balance (default 0)"),
+		),
+		mcp.WithString("bank",
+			mcp.Description("Only forecast one bank's transactions and recurring payments (optional)"),
+		),
+	), s.cashFlowForecastHandler)
+
+	mcpServer.AddTool(mcp.NewTool("fx_summary",
+		mcp.WithDescription("Summarise foreign spending by original currency, with the exchange rate each purchase was converted at, its linked international transaction fee, and the markup over loaded mid-market rates"),
+		mcp.WithString("currency",
+			mcp.Description("Only include spending in this currency, e.g. USD (optional)"),
+		),
+		mcp.WithString("days",
+			mcp.Description("Only include the last N days (optional)"),
+		),
+	), s.fxSummaryHandler)
+
+	mcpServer.AddTool(mcp.NewTool("trip_cost",
+		mcp.WithDescription("Show what trips away from home cost, such as 'how much did the Japan trip cost', including flights and accommodation booked beforehand. A single matching trip is broken down into its transactions"),
+		mcp.WithString("trip",
+			mcp.Description("Trip ID, name or destination to look up, e.g. 'Japan' (optional, all trips when empty)"),
+		),
+	), s.tripCostHandler)
+
+	mcpServer.AddTool(mcp.NewTool("income_summary",
+		mcp.WithDescription("Identify income sources such as salary, interest, government payments and side income, with pay cycles and whether the latest salary deposit was late or different from usual, and total income by source per month or Australian financial year"),
+		mcp.WithString("period",
+			mcp.Description("Total income by 'monthly' or 'financial-year' (default monthly)"),
+		),
+		mcp.WithString("periods",
+			mcp.Description("Number of months or financial years to total, most recent first (default 3)"),
+		),
+	), s.incomeSummaryHandler)
+
 	// Start the stdio server
 	if err := server.ServeStdio(mcpServer); err != nil {
 		return err
@@ -170,6 +419,31 @@ func (s *Server) searchTransactionsHandler(ctx context.Context, request mcp.Call
 		}
 	}
 
+	// Optional filters
+	var filters []db.TransactionQueryOption
+	if bank, _ := request.Params.Arguments["bank"].(string); bank != "" {
+		filters = append(filters, db.FilterByBank(bank))
+	}
+	if card, _ := request.Params.Arguments["card"].(string); card != "" {
+		filters = append(filters, db.FilterByCard(card))
+	}
+	if cardholder, _ := request.Params.Arguments["cardholder"].(string); cardholder != "" {
+		filters = append(filters, db.FilterByCardholder(cardholder))
+	}
+	if merchant, _ := request.Params.Arguments["merchant"].(string); merchant != "" {
+		filters = append(filters, db.FilterByMerchant(merchant))
+	}
+	if country, _ := request.Params.Arguments["country"].(string); country != "" {
+		filters = append(filters, db.FilterByCountry(country))
+	}
+	if state, _ := request.Params.Arguments["state"].(string); state != "" {
+		filters = append(filters, db.FilterByState(state))
+	}
+	if locality, _ := request.Params.Arguments["locality"].(string); locality != "" {
+		filters = append(filters, db.FilterByLocality(locality))
+	}
+	filters = append(filters, tagFilters(request)...)
+
 	// Perform the search using the decoupled search package
 	searchResults, err := search.HybridSearch(
 		ctx,
@@ -182,6 +456,7 @@ func (s *Server) searchTransactionsHandler(ctx context.Context, request mcp.Call
 		search.WithDays(days),
 		search.OrderByRelevance(),
 		search.WithVectorThreshold(0.4),
+		search.WithFilters(filters...),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search transactions: %w", err)
@@ -204,22 +479,50 @@ func (s *Server) searchTransactionsHandler(ctx context.Context, request mcp.Call
 			t := searchResult.TransactionWithDetails
 
 			result += fmt.Sprintf("%s: %s - %s\n", t.Date, t.Amount, t.Payee)
+			result += fmt.Sprintf("  ID: %s\n", t.ID)
 			result += fmt.Sprintf("  Type: %s\n", t.Details.Type)
+			if t.Details.TransferMatchID != "" {
+				result += fmt.Sprintf("  Internal transfer, other side: %s\n", t.Details.TransferMatchID)
+			}
+			if status := t.RefundStatus(); status != "" {
+				result += fmt.Sprintf("  Status: %s (%s)\n", status, t.Details.RefundedAmount.StringFixed(2))
+			}
+			if t.Details.RefundOfID != "" {
+				result += fmt.Sprintf("  Refund of: %s\n", t.Details.RefundOfID)
+			}
 			if t.Details.Merchant != "" {
 				result += fmt.Sprintf("  Merchant: %s\n", t.Details.Merchant)
 			}
 			if t.Details.Location != "" {
 				result += fmt.Sprintf("  Location: %s\n", t.Details.Location)
 			}
+			if !t.Details.Place.IsZero() {
+				result += fmt.Sprintf("  Place: %s\n", t.Details.Place)
+			}
 			if t.Details.Category != "" {
 				result += fmt.Sprintf("  Category: %s\n", t.Details.Category)
 			}
+			for _, split := range t.Splits {
+				result += fmt.Sprintf("  Split: %s\n", split)
+			}
+			if len(t.Details.Tags) > 0 {
+				result += fmt.Sprintf("  Tags: %s\n", strings.Join(t.Details.Tags, ", "))
+			}
+			if t.Details.Notes != "" {
+				result += fmt.Sprintf("  Notes: %s\n", t.Details.Notes)
+			}
+			if t.Details.AttachmentCount > 0 {
+				result += fmt.Sprintf("  Attachments: %d\n", t.Details.AttachmentCount)
+			}
 			if t.Details.Description != "" {
 				result += fmt.Sprintf("  Description: %s\n", t.Details.Description)
 			}
 			if t.Details.CardNumber != "" {
 				result += fmt.Sprintf("  Card Number: %s\n", t.Details.CardNumber)
 			}
+			if t.Details.Cardholder != "" {
+				result += fmt.Sprintf("  Cardholder: %s\n", t.Details.Cardholder)
+			}
 			if t.Details.ForeignAmount != nil {
 				result += fmt.Sprintf("  Foreign Amount: %s %s\n", t.Details.ForeignAmount.Amount, t.Details.ForeignAmount.Currency)
 			}
@@ -280,6 +583,12 @@ func (s *Server) listTransactionsHandler(ctx context.Context, request mcp.CallTo
 	txType, _ := request.Params.Arguments["type"].(string)
 	category, _ := request.Params.Arguments["category"].(string)
 	bank, _ := request.Params.Arguments["bank"].(string)
+	card, _ := request.Params.Arguments["card"].(string)
+	cardholder, _ := request.Params.Arguments["cardholder"].(string)
+	merchant, _ := request.Params.Arguments["merchant"].(string)
+	country, _ := request.Params.Arguments["country"].(string)
+	state, _ := request.Params.Arguments["state"].(string)
+	locality, _ := request.Params.Arguments["locality"].(string)
 	minAmount, hasMinAmount := request.Params.Arguments["min_amount"].(string)
 	maxAmount, hasMaxAmount := request.Params.Arguments["max_amount"].(string)
 
@@ -308,6 +617,25 @@ func (s *Server) listTransactionsHandler(ctx context.Context, request mcp.CallTo
 	if bank != "" {
 		opts = append(opts, db.FilterByBank(bank))
 	}
+	if card != "" {
+		opts = append(opts, db.FilterByCard(card))
+	}
+	if cardholder != "" {
+		opts = append(opts, db.FilterByCardholder(cardholder))
+	}
+	if merchant != "" {
+		opts = append(opts, db.FilterByMerchant(merchant))
+	}
+	if country != "" {
+		opts = append(opts, db.FilterByCountry(country))
+	}
+	if state != "" {
+		opts = append(opts, db.FilterByState(state))
+	}
+	if locality != "" {
+		opts = append(opts, db.FilterByLocality(locality))
+	}
+	opts = append(opts, tagFilters(request)...)
 	// Add amount filters if provided
 	if hasMinAmount && hasMaxAmount {
 		// Convert to absolute value filtering
@@ -332,7 +660,7 @@ func (s *Server) listTransactionsHandler(ctx context.Context, request mcp.CallTo
 		result += "No transactions found matching your criteria.\n\n"
 	} else {
 		// Determine if we're showing limited results
-		if txType != "" || category != "" || bank != "" || hasMinAmount || hasMaxAmount {
+		if txType != "" || category != "" || bank != "" || card != "" || cardholder != "" || hasMinAmount || hasMaxAmount {
 			// When filtering by type, category, or bank, just show the filtered count
 			result += fmt.Sprintf("Found %d transactions", len(filtered))
 			if txType != "" {
@@ -344,6 +672,12 @@ func (s *Server) listTransactionsHandler(ctx context.Context, request mcp.CallTo
 			if bank != "" {
 				result += fmt.Sprintf(" from bank '%s'", bank)
 			}
+			if card != "" {
+				result += fmt.Sprintf(" on card '%s'", card)
+			}
+			if cardholder != "" {
+				result += fmt.Sprintf(" by cardholder '%s'", cardholder)
+			}
 
 			// Add message about amount filtering for clarity
 			if hasMinAmount && hasMaxAmount && minAmount == maxAmount {
@@ -364,22 +698,50 @@ func (s *Server) listTransactionsHandler(ctx context.Context, request mcp.CallTo
 
 		for _, t := range filtered {
 			result += fmt.Sprintf("%s: %s - %s\n", t.Date, t.Amount, t.Payee)
+			result += fmt.Sprintf("  ID: %s\n", t.ID)
 			result += fmt.Sprintf("  Type: %s\n", t.Details.Type)
+			if t.Details.TransferMatchID != "" {
+				result += fmt.Sprintf("  Internal transfer, other side: %s\n", t.Details.TransferMatchID)
+			}
+			if status := t.RefundStatus(); status != "" {
+				result += fmt.Sprintf("  Status: %s (%s)\n", status, t.Details.RefundedAmount.StringFixed(2))
+			}
+			if t.Details.RefundOfID != "" {
+				result += fmt.Sprintf("  Refund of: %s\n", t.Details.RefundOfID)
+			}
 			if t.Details.Merchant != "" {
 				result += fmt.Sprintf("  Merchant: %s\n", t.Details.Merchant)
 			}
 			if t.Details.Category != "" {
 				result += fmt.Sprintf("  Category: %s\n", t.Details.Category)
 			}
+			for _, split := range t.Splits {
+				result += fmt.Sprintf("  Split: %s\n", split)
+			}
+			if len(t.Details.Tags) > 0 {
+				result += fmt.Sprintf("  Tags: %s\n", strings.Join(t.Details.Tags, ", "))
+			}
+			if t.Details.Notes != "" {
+				result += fmt.Sprintf("  Notes: %s\n", t.Details.Notes)
+			}
+			if t.Details.AttachmentCount > 0 {
+				result += fmt.Sprintf("  Attachments: %d\n", t.Details.AttachmentCount)
+			}
 			if t.Details.Description != "" {
 				result += fmt.Sprintf("  Description: %s\n", t.Details.Description)
 			}
 			if t.Details.Location != "" {
 				result += fmt.Sprintf("  Location: %s\n", t.Details.Location)
 			}
+			if !t.Details.Place.IsZero() {
+				result += fmt.Sprintf("  Place: %s\n", t.Details.Place)
+			}
 			if t.Details.CardNumber != "" {
 				result += fmt.Sprintf("  Card Number: %s\n", t.Details.CardNumber)
 			}
+			if t.Details.Cardholder != "" {
+				result += fmt.Sprintf("  Cardholder: %s\n", t.Details.Cardholder)
+			}
 			if t.Details.ForeignAmount != nil {
 				result += fmt.Sprintf("  Foreign Amount: %s %s\n",
 					t.Details.ForeignAmount.Amount,
@@ -459,6 +821,57 @@ func (s *Server) listBanksHandler(ctx context.Context, request mcp.CallToolReque
 	return mcp.NewToolResultText(result), nil
 }
 
+func (s *Server) listCardsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cards, err := s.db.GetCards(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cards: %w", err)
+	}
+	if len(cards) == 0 {
+		return mcp.NewToolResultText("No cards found."), nil
+	}
+
+	result := "Cards:\n\n"
+	for _, c := range cards {
+		result += fmt.Sprintf("%s (%s) - %d transactions\n", c.MaskedNumber, c.Bank, c.TransactionCount)
+		result += fmt.Sprintf("  Token: %s\n", c.Token)
+		if c.Cardholder != "" {
+			result += fmt.Sprintf("  Cardholder: %s\n", c.Cardholder)
+		}
+		if c.Account != "" {
+			result += fmt.Sprintf("  Account: %s\n", c.Account)
+		}
+		if c.Label != "" {
+			result += fmt.Sprintf("  Label: %s\n", c.Label)
+		}
+		result += "\n"
+	}
+	return mcp.NewToolResultText(result), nil
+}
+
+func (s *Server) updateCardHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	card, ok := request.Params.Arguments["card"].(string)
+	if !ok || card == "" {
+		return nil, errors.New("card is required and must be a string")
+	}
+
+	var cardholder, account, label *string
+	if v, ok := request.Params.Arguments["cardholder"].(string); ok {
+		cardholder = &v
+	}
+	if v, ok := request.Params.Arguments["account"].(string); ok {
+		account = &v
+	}
+	if v, ok := request.Params.Arguments["label"].(string); ok {
+		label = &v
+	}
+
+	if err := s.db.UpdateCard(ctx, card, cardholder, account, label); err != nil {
+		return nil, fmt.Errorf("failed to update card: %w", err)
+	}
+
+	return mcp.NewToolResultText("Card updated successfully."), nil
+}
+
 // Handler for update_transaction
 func (s *Server) updateTransactionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	id, ok := request.Params.Arguments["id"].(string)
@@ -496,10 +909,29 @@ func (s *Server) updateTransactionHandler(ctx context.Context, request mcp.CallT
 	if v, ok := request.Params.Arguments["tags"].(string); ok && v != "" {
 		tags = &v
 	}
+	notes, hasNotes := request.Params.Arguments["notes"].(string)
+	deduction, hasDeduction := request.Params.Arguments["deduction"].(string)
+	hasDeduction = hasDeduction && deduction != ""
+	if strings.EqualFold(deduction, "none") {
+		deduction = ""
+	}
 
-	err := s.db.UpdateTransaction(ctx, id, merchant, txType, category, tags)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update transaction: %w", err)
+	// Without notes or a deduction, UpdateTransaction reports when there's nothing to update
+	if merchant != nil || txType != nil || category != nil || tags != nil || (!hasNotes && !hasDeduction) {
+		err := s.db.UpdateTransaction(ctx, id, merchant, txType, category, tags)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update transaction: %w", err)
+		}
+	}
+	if hasNotes {
+		if err := s.db.SetNotes(ctx, id, notes); err != nil {
+			return nil, fmt.Errorf("failed to update transaction: %w", err)
+		}
+	}
+	if hasDeduction {
+		if err := s.db.SetDeduction(ctx, id, deduction); err != nil {
+			return nil, fmt.Errorf("failed to update transaction: %w", err)
+		}
 	}
 
 	return mcp.NewToolResultText("Transaction updated successfully."), nil
@@ -0,0 +1,31 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for split_transaction
+func (s *Server) splitTransactionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, ok := request.Params.Arguments["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("id is required and must be a string")
+	}
+	arg, _ := request.Params.Arguments["splits"].(string)
+
+	splits, err := db.ParseSplits(arg)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SetSplits(ctx, id, splits); err != nil {
+		return nil, fmt.Errorf("failed to split transaction: %w", err)
+	}
+	if len(splits) == 0 {
+		return mcp.NewToolResultText("Transaction splits removed."), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Transaction split into %d parts.", len(splits))), nil
+}
@@ -0,0 +1,76 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/shopspring/decimal"
+)
+
+func (s *Server) listSubscriptionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	includeStopped, err := boolArgument(request, "include_stopped")
+	if err != nil {
+		return nil, err
+	}
+	includeIncome, err := boolArgument(request, "include_income")
+	if err != nil {
+		return nil, err
+	}
+
+	series, err := s.db.GetRecurringSeries(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring series: %w", err)
+	}
+
+	now := time.Now()
+	monthly := decimal.Zero
+	result := "Recurring Payments:\n\n"
+	var count int
+	for _, rs := range series {
+		if (!includeStopped && rs.Stopped(now)) || (!includeIncome && rs.Amount.IsPositive()) {
+			continue
+		}
+		count++
+		result += fmt.Sprintf("%s - %s %s (%s)\n", rs.Merchant, rs.Amount.StringFixed(2), rs.Cadence, rs.Status(now))
+		result += fmt.Sprintf("  Category: %s, Bank: %s\n", rs.Category, rs.Bank)
+		result += fmt.Sprintf("  Last: %s, Next expected: %s, Payments: %d\n",
+			rs.LastDate.Format("2006-01-02"), rs.NextDate.Format("2006-01-02"), rs.TransactionCount)
+		if rs.PriceChanged() {
+			result += fmt.Sprintf("  Price changed from %s\n", rs.PreviousAmount.StringFixed(2))
+		}
+		result += fmt.Sprintf("  ID: %s\n\n", rs.ID)
+		if !rs.Stopped(now) {
+			monthly = monthly.Add(rs.MonthlyAmount())
+		}
+	}
+	if count == 0 {
+		return mcp.NewToolResultText("No recurring payments found."), nil
+	}
+
+	result += fmt.Sprintf("Active recurring total per month: %s\n", monthly.StringFixed(2))
+	return mcp.NewToolResultText(result), nil
+}
+
+// boolArgument parses an optional boolean argument given as a bool or string
+func boolArgument(request mcp.CallToolRequest, name string) (bool, error) {
+	switch v := request.Params.Arguments[name].(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return v, nil
+	case string:
+		if v == "" {
+			return false, nil
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("%s must be true or false: %w", name, err)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+}
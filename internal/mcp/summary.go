@@ -0,0 +1,77 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for spending_summary
+func (s *Server) spendingSummaryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	period, _ := request.Params.Arguments["period"].(string)
+	if period == "" {
+		period = db.SummaryMonthly
+	}
+	periods, err := intArgument(request, "periods", 1)
+	if err != nil {
+		return nil, err
+	}
+	top, err := intArgument(request, "top", 5)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries, err := s.db.SpendingReport(ctx, period, periods, top, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarise spending: %w", err)
+	}
+
+	result := "Spending Summary (transfers between your own accounts excluded):\n\n"
+	for _, sum := range summaries {
+		result += fmt.Sprintf("%s: income %s, expenses %s, net %s, savings rate %s%%\n",
+			sum.Period, sum.Income.StringFixed(2), sum.Expenses.StringFixed(2), sum.Net.StringFixed(2), sum.SavingsRate.StringFixed(1))
+		for _, c := range []*db.SummaryChange{sum.PreviousPeriod, sum.PreviousYear} {
+			if c != nil {
+				result += fmt.Sprintf("  vs %s: income %s, expenses %s (%s%%), net %s\n",
+					c.Period, c.Income.StringFixed(2), c.Expenses.StringFixed(2), c.ExpensesPercent.StringFixed(1), c.Net.StringFixed(2))
+			}
+		}
+		result += "  Top categories:\n"
+		for _, t := range sum.TopCategories {
+			result += fmt.Sprintf("    %s - %s (%d transactions)\n", t.Name, t.Amount.StringFixed(2), t.Count)
+		}
+		result += "  Top merchants:\n"
+		for _, t := range sum.TopMerchants {
+			result += fmt.Sprintf("    %s - %s (%d transactions)\n", t.Name, t.Amount.StringFixed(2), t.Count)
+		}
+		result += "\n"
+	}
+	return mcp.NewToolResultText(result), nil
+}
+
+// intArgument parses an optional integer argument given as a number or string
+func intArgument(request mcp.CallToolRequest, name string, defaultValue int) (int, error) {
+	switch v := request.Params.Arguments[name].(type) {
+	case nil:
+		return defaultValue, nil
+	case int:
+		return v, nil
+	case float64:
+		return int(v), nil
+	case string:
+		if v == "" {
+			return defaultValue, nil
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a valid integer: %w", name, err)
+		}
+		return i, nil
+	default:
+		return 0, fmt.Errorf("%s must be a number or string", name)
+	}
+}
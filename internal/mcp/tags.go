@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for list_tags
+func (s *Server) listTagsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	tags, err := s.db.GetTags(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return mcp.NewToolResultText("No tags found."), nil
+	}
+
+	result := "Tags:\n\n"
+	for _, tag := range tags {
+		result += fmt.Sprintf("%s - %d transactions\n", tag.Name, tag.TransactionCount)
+	}
+	return mcp.NewToolResultText(result), nil
+}
+
+// Handler for tag_transaction
+func (s *Server) tagTransactionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, ok := request.Params.Arguments["id"].(string)
+	if !ok || id == "" {
+		return nil, errors.New("id is required and must be a string")
+	}
+	add, _ := request.Params.Arguments["add"].(string)
+	remove, _ := request.Params.Arguments["remove"].(string)
+	if add == "" && remove == "" {
+		return nil, errors.New("at least one of add or remove is required")
+	}
+
+	if err := s.db.AddTags(ctx, id, db.ParseTags(add)...); err != nil {
+		return nil, fmt.Errorf("failed to add tags: %w", err)
+	}
+	if err := s.db.RemoveTags(ctx, id, db.ParseTags(remove)...); err != nil {
+		return nil, fmt.Errorf("failed to remove tags: %w", err)
+	}
+
+	tx, err := s.db.GetTransactionByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tx.Details.Tags) == 0 {
+		return mcp.NewToolResultText(fmt.Sprintf("Transaction %s has no tags.", id)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Transaction %s is tagged %s.", id, strings.Join(tx.Details.Tags, ", "))), nil
+}
+
+// tagFilters returns the query options for the tags, all_tags and exclude_tags arguments
+func tagFilters(request mcp.CallToolRequest) []db.TransactionQueryOption {
+	var opts []db.TransactionQueryOption
+	if tags, _ := request.Params.Arguments["tags"].(string); tags != "" {
+		opts = append(opts, db.FilterByAnyTag(db.ParseTags(tags)...))
+	}
+	if tags, _ := request.Params.Arguments["all_tags"].(string); tags != "" {
+		opts = append(opts, db.FilterByAllTags(db.ParseTags(tags)...))
+	}
+	if tags, _ := request.Params.Arguments["exclude_tags"].(string); tags != "" {
+		opts = append(opts, db.ExcludeTags(db.ParseTags(tags)...))
+	}
+	return opts
+}
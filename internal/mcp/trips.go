@@ -0,0 +1,65 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/db"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Handler for trip_cost
+func (s *Server) tripCostHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, _ := request.Params.Arguments["trip"].(string)
+
+	var trips []db.Trip
+	var err error
+	if query = strings.TrimSpace(query); query != "" {
+		trips, err = s.db.FindTrips(ctx, query)
+	} else {
+		trips, err = s.db.GetTrips(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trips: %w", err)
+	}
+	if len(trips) == 0 {
+		if query != "" {
+			return mcp.NewToolResultText(fmt.Sprintf("No trip matches %q.", query)), nil
+		}
+		return mcp.NewToolResultText("No trips found."), nil
+	}
+
+	var result string
+	for _, t := range trips {
+		result += fmt.Sprintf("- %s (%s): %s to %s, %d days, %d transactions, cost %s %s including %s booked beforehand\n",
+			t.Name, t.ID, t.StartDate.Format("2006-01-02"), t.EndDate.Format("2006-01-02"), t.Days(),
+			t.TransactionCount, t.Cost.StringFixed(2), s.db.BaseCurrency(), t.Booked.StringFixed(2))
+	}
+	if len(trips) > 1 {
+		return mcp.NewToolResultText(result), nil
+	}
+
+	// A single trip is broken down into its transactions
+	trip, err := s.db.GetTrip(ctx, trips[0].ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip: %w", err)
+	}
+	transactions, err := s.db.GetTransactions(ctx, db.FilterByTrip(trip.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trip transactions: %w", err)
+	}
+	slices.Reverse(transactions)
+
+	result += "\nTransactions:\n"
+	for _, t := range transactions {
+		result += fmt.Sprintf("- %s %s (%s): %s %s, %s", t.Date, t.Details.Merchant, t.ID,
+			t.Amount, t.Amount.Currency, t.Details.Category)
+		if slices.Contains(trip.BookedIDs, t.ID) {
+			result += ", booked beforehand"
+		}
+		result += "\n"
+	}
+	return mcp.NewToolResultText(result), nil
+}
@@ -15,6 +15,14 @@ type Transaction struct {
 	Category string
 	Number   string
 	Memo     string
+	Splits   []Split
+}
+
+// Split is one split line of a QIF transaction, allocating part of its amount to a category
+type Split struct {
+	Category string
+	Memo     string
+	Amount   string
 }
 
 // ParseFile reads a QIF file and returns a slice of transactions
@@ -36,6 +44,9 @@ func ParseReader(r io.Reader) ([]Transaction, error) {
 		"L": "category",
 		"N": "number",
 		"M": "memo",
+		"S": "split_category",
+		"E": "split_memo",
+		"$": "split_amount",
 	}
 
 	scanner := bufio.NewScanner(r)
@@ -70,6 +81,19 @@ func ParseReader(r io.Reader) ([]Transaction, error) {
 				current.Number = line[1:]
 			case "memo":
 				current.Memo = line[1:]
+			case "split_category":
+				// Each split starts with its category, followed by its memo and amount
+				current.Splits = append(current.Splits, Split{Category: line[1:]})
+			case "split_memo", "split_amount":
+				if len(current.Splits) == 0 {
+					current.Splits = append(current.Splits, Split{})
+				}
+				split := &current.Splits[len(current.Splits)-1]
+				if fieldName == "split_memo" {
+					split.Memo = line[1:]
+				} else {
+					split.Amount = line[1:]
+				}
 			}
 		}
 	}
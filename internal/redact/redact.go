@@ -0,0 +1,270 @@
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+)
+
+// Kinds of values that can be redacted
+const (
+	KindCard    = "CARD"
+	KindAccount = "ACCOUNT"
+	KindPhone   = "PHONE"
+	KindName    = "NAME"
+	KindNumber  = "NUMBER"
+)
+
+var (
+	// Full card numbers (13-19 digits, optionally grouped) and masked forms like 1234...5678 or XXXX-XXXX-XXXX-5678
+	cardPattern = regexp.MustCompile(`\b(?:\d{4}[ -]?){3}\d{1,7}\b|\b\d{4,6}(?:\.{2,3}|[xX*]{4,})\d{4}\b|\b(?:[xX*]{4}[ -]?){3}\d{4}\b`)
+
+	// BSB followed by an account number (e.g. "033134 452177" or "062-692 87654321")
+	bsbAccountPattern = regexp.MustCompile(`\b\d{3}-?\d{3}\s+\d{6,10}\b`)
+
+	// Explicitly labelled BSB and account numbers (e.g. "BSB 062-692", "Account 87654321")
+	labelledAccountPattern = regexp.MustCompile(`(?i)\b(?:BSB|ACC(?:OUN)?T(?:\s+(?:NO\.?|NUMBER))?|A/C)[\s:#]*(\d{3}-?\d{3}|\d{6,10})\b`)
+
+	// Australian phone numbers, including 1300/1800 numbers and 13 numbers written like 13 22 21
+	phonePattern = regexp.MustCompile(`(?:\+61[ -]?|\b0)[2-478](?:[ -]?\d){8}\b|\b1[38]00(?:[ -]?\d){6}\b|\b13 \d{2} \d{2}\b`)
+
+	// 13 numbers written without spaces, such as "PH 132221", which are only phone numbers after a
+	// phone keyword since receipt and reference numbers look the same
+	labelledPhonePattern = regexp.MustCompile(`(?i)\b(?:PH|PHONE|TEL|CALL)[\s:.#]*(13\d{4})\b`)
+
+	// Any run of six or more digits, used in strict mode for receipt and reference numbers
+	numberPattern = regexp.MustCompile(`\b\d{6,}\b`)
+
+	// Transfer phrases that introduce a counterparty name
+	transferNamePattern = regexp.MustCompile(`(?i)\b(?:transfer|payment|osko(?:\s+payment)?|pay\s*anyone|fast\s+transfer|deposit)\s+(?:to|from)\s+`)
+
+	// Bare "To"/"From" that introduce a counterparty name, used in strict mode
+	strictNamePattern = regexp.MustCompile(`(?i)\b(?:to|from)\s+`)
+
+	placeholderPattern = regexp.MustCompile(`<?\b(CARD|ACCOUNT|PHONE|NAME|NUMBER)_(\d+)\b>?`)
+)
+
+// nameStopWords end a counterparty name when scanning transfer text
+var nameStopWords = map[string]struct{}{
+	"BSB": {}, "ACCOUNT": {}, "ACCT": {}, "A/C": {}, "REF": {}, "REFERENCE": {}, "RECEIPT": {},
+	"ON": {}, "DATE": {}, "TIME": {}, "CARD": {}, "VIA": {}, "FOR": {}, "AT": {}, "TO": {}, "FROM": {},
+	"PTY": {}, "LTD": {}, "INC": {}, "BANK": {}, "SAVINGS": {}, "THE": {}, "AND": {},
+}
+
+// Redactor replaces sensitive values in transaction text with stable placeholders
+type Redactor struct {
+	strict bool
+}
+
+// New creates a new Redactor. In strict mode, any counterparty introduced by
+// "To" or "From" and any long digit run is also redacted.
+func New(strict bool) *Redactor {
+	return &Redactor{strict: strict}
+}
+
+// Strict returns whether the redactor is running in strict mode
+func (r *Redactor) Strict() bool {
+	return r.strict
+}
+
+// Redaction holds the redacted text and the placeholders needed to restore it. Apply and
+// Restore are safe to call concurrently, since helper tools the LLM calls together share it.
+type Redaction struct {
+	Text string
+
+	strict  bool
+	mu      sync.Mutex
+	values  map[string]string // placeholder -> original value
+	byValue map[string]string // original value -> placeholder
+	counts  map[string]int
+}
+
+// Redact replaces card numbers, account numbers, phone numbers and transfer
+// counterparty names in text with placeholders like <CARD_1>. The same value
+// always maps to the same placeholder within a Redaction.
+func (r *Redactor) Redact(text string) *Redaction {
+	rd := &Redaction{
+		strict:  r.strict,
+		values:  make(map[string]string),
+		byValue: make(map[string]string),
+		counts:  make(map[string]int),
+	}
+	rd.Text = rd.Apply(text)
+	return rd
+}
+
+// Apply redacts further text using the same placeholders as the original text,
+// for example results from tools the LLM calls while classifying a transaction
+func (rd *Redaction) Apply(text string) string {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	// Order matters: the more specific patterns run first so that, for example,
+	// a BSB and account pair is not split into a card number and a number.
+	text = rd.replaceAll(text, cardPattern, KindCard)
+	text = rd.replaceAll(text, bsbAccountPattern, KindAccount)
+	text = rd.replaceSubmatches(text, labelledAccountPattern, KindAccount)
+	text = rd.replaceAll(text, phonePattern, KindPhone)
+	text = rd.replaceSubmatches(text, labelledPhonePattern, KindPhone)
+	text = rd.replaceNames(text, transferNamePattern)
+
+	if rd.strict {
+		text = rd.replaceNames(text, strictNamePattern)
+		text = rd.replaceAll(text, numberPattern, KindNumber)
+	}
+
+	return text
+}
+
+// Len returns the number of distinct values that were redacted
+func (rd *Redaction) Len() int {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	return len(rd.values)
+}
+
+// Restore replaces any placeholders in s with their original values. Both the
+// bracketed form (<CARD_1>) and the bare form (CARD_1) are recognised, since
+// models do not always copy placeholders verbatim.
+func (rd *Redaction) Restore(s string) string {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+
+	if s == "" || len(rd.values) == 0 {
+		return s
+	}
+	return placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := placeholderPattern.FindStringSubmatch(match)
+		if original, ok := rd.values[fmt.Sprintf("<%s_%s>", m[1], m[2])]; ok {
+			return original
+		}
+		return match
+	})
+}
+
+// RestoreDetails restores the original values into every text field of the
+// classified details, including the card number and transfer details
+func (rd *Redaction) RestoreDetails(details *types.TransactionDetails) {
+	if rd.Len() == 0 {
+		return
+	}
+
+	details.Merchant = rd.Restore(details.Merchant)
+	details.Location = rd.Restore(details.Location)
+	details.Description = rd.Restore(details.Description)
+	details.SearchBody = rd.Restore(details.SearchBody)
+	details.CardNumber = rd.Restore(details.CardNumber)
+
+	if details.TransferDetails != nil {
+		details.TransferDetails.ToAccount = rd.Restore(details.TransferDetails.ToAccount)
+		details.TransferDetails.FromAccount = rd.Restore(details.TransferDetails.FromAccount)
+		details.TransferDetails.Reference = rd.Restore(details.TransferDetails.Reference)
+	}
+}
+
+func placeholder(kind string, n int) string {
+	return fmt.Sprintf("<%s_%d>", kind, n)
+}
+
+// placeholderFor returns the placeholder for a value, allocating a new one if needed
+func (rd *Redaction) placeholderFor(kind, value string) string {
+	if p, ok := rd.byValue[value]; ok {
+		return p
+	}
+	rd.counts[kind]++
+	p := placeholder(kind, rd.counts[kind])
+	rd.values[p] = value
+	rd.byValue[value] = p
+	return p
+}
+
+func (rd *Redaction) replaceAll(text string, re *regexp.Regexp, kind string) string {
+	return re.ReplaceAllStringFunc(text, func(match string) string {
+		return rd.placeholderFor(kind, match)
+	})
+}
+
+// replaceSubmatches replaces only the first capture group of each match
+func (rd *Redaction) replaceSubmatches(text string, re *regexp.Regexp, kind string) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2], loc[3]
+		if start < 0 {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(rd.placeholderFor(kind, text[start:end]))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// replaceNames redacts up to four name-like words following each match of re
+func (rd *Redaction) replaceNames(text string, re *regexp.Regexp) string {
+	var sb strings.Builder
+	last := 0
+	for _, loc := range re.FindAllStringIndex(text, -1) {
+		if loc[1] < last {
+			continue
+		}
+		start, end := scanName(text, loc[1])
+		if start == end {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		sb.WriteString(rd.placeholderFor(KindName, text[start:end]))
+		last = end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// scanName returns the byte range of a person-like name starting at offset,
+// stopping at digits, placeholders, stop words or after four words
+func scanName(text string, offset int) (int, int) {
+	end := offset
+	words := 0
+	pos := offset
+	for words < 4 && pos < len(text) {
+		// Skip whitespace between words
+		for pos < len(text) && text[pos] == ' ' {
+			pos++
+		}
+		wordStart := pos
+		for pos < len(text) && text[pos] != ' ' {
+			pos++
+		}
+		word := text[wordStart:pos]
+		if !isNameWord(word) {
+			break
+		}
+		end = pos
+		words++
+	}
+	// A single word is too ambiguous to be treated as a personal name
+	if words < 2 {
+		return offset, offset
+	}
+	return offset, end
+}
+
+func isNameWord(word string) bool {
+	if word == "" {
+		return false
+	}
+	if _, stop := nameStopWords[strings.ToUpper(strings.Trim(word, ".,:"))]; stop {
+		return false
+	}
+	for _, c := range word {
+		if !unicode.IsLetter(c) && c != '\'' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
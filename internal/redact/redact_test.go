@@ -0,0 +1,120 @@
+package redact
+
+import (
+	"testing"
+
+	"github.com/lox/bank-transaction-analyzer/internal/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		strict   bool
+		text     string
+		expected string
+	}{
+		{
+			name:     "masked_card_number",
+			text:     "EFTPOS PURCHASE AMAZON.COM.AU SYDNEY AU ON 12 MAR Card 1234...5678",
+			expected: "EFTPOS PURCHASE AMAZON.COM.AU SYDNEY AU ON 12 MAR Card <CARD_1>",
+		},
+		{
+			name:     "full_card_number",
+			text:     "Visa Purchase 4622 3912 3456 7890 Woolworths",
+			expected: "Visa Purchase <CARD_1> Woolworths",
+		},
+		{
+			name:     "bsb_and_account",
+			text:     "Internet Transfer To 033134 452177 Receipt 123456",
+			expected: "Internet Transfer To <ACCOUNT_1> Receipt 123456",
+		},
+		{
+			name:     "labelled_bsb_account_and_name",
+			text:     "Transfer to Nicole Smith BSB 062-692 Account 87654321 Reference: BIRTHDAY GIFT",
+			expected: "Transfer to <NAME_1> BSB <ACCOUNT_1> Account <ACCOUNT_2> Reference: BIRTHDAY GIFT",
+		},
+		{
+			name:     "phone_number",
+			text:     "ACME PLUMBING 0412 345 678 MELBOURNE",
+			expected: "ACME PLUMBING <PHONE_1> MELBOURNE",
+		},
+		{
+			name:     "spaced_13_number",
+			text:     "QANTAS BOOKINGS 13 13 13 MASCOT",
+			expected: "QANTAS BOOKINGS <PHONE_1> MASCOT",
+		},
+		{
+			name:     "labelled_13_number",
+			text:     "TELSTRA PH 132200 MELBOURNE",
+			expected: "TELSTRA PH <PHONE_1> MELBOURNE",
+		},
+		{
+			name:     "six_digits_starting_with_13_are_not_a_phone_number",
+			text:     "Internet Transfer Receipt 134567 Invoice 130021",
+			expected: "Internet Transfer Receipt 134567 Invoice 130021",
+		},
+		{
+			name:     "single_word_after_transfer_is_not_a_name",
+			text:     "Transfer to Savings",
+			expected: "Transfer to Savings",
+		},
+		{
+			name:     "strict_redacts_receipt_numbers",
+			strict:   true,
+			text:     "Internet Transfer To 033134 452177 Receipt 123456",
+			expected: "Internet Transfer To <ACCOUNT_1> Receipt <NUMBER_1>",
+		},
+		{
+			name:     "strict_redacts_bare_to_names",
+			strict:   true,
+			text:     "To John Citizen Ref Rent",
+			expected: "To <NAME_1> Ref Rent",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rd := New(tc.strict).Redact(tc.text)
+			assert.Equal(t, tc.expected, rd.Text)
+		})
+	}
+}
+
+func TestRedactStablePlaceholders(t *testing.T) {
+	rd := New(false).Redact("Card 1234...5678 refund Card 1234...5678")
+	assert.Equal(t, "Card <CARD_1> refund Card <CARD_1>", rd.Text)
+	assert.Equal(t, 1, rd.Len())
+}
+
+func TestApplySharesPlaceholders(t *testing.T) {
+	rd := New(false).Redact("Card 1234...5678 at Woolworths")
+	assert.Equal(t, "Card <CARD_1> at Woolworths", rd.Text)
+
+	// Text redacted later reuses existing placeholders and allocates new ones
+	assert.Equal(t, "Refund <CARD_1> call <PHONE_1>", rd.Apply("Refund 1234...5678 call 0412 345 678"))
+	assert.Equal(t, "0412 345 678", rd.Restore("<PHONE_1>"))
+}
+
+func TestRestoreDetails(t *testing.T) {
+	rd := New(false).Redact("Transfer to Nicole Smith BSB 062-692 Account 87654321 Card 1234...5678")
+
+	details := &types.TransactionDetails{
+		Merchant:    "<NAME_1>",
+		Description: "Personal transfer to <NAME_1>",
+		CardNumber:  "CARD_1",
+		SearchBody:  "<NAME_1> Personal transfer",
+		TransferDetails: &types.TransferDetails{
+			ToAccount: "<ACCOUNT_2>",
+			Reference: "<UNKNOWN_1>",
+		},
+	}
+	rd.RestoreDetails(details)
+
+	assert.Equal(t, "Nicole Smith", details.Merchant)
+	assert.Equal(t, "Personal transfer to Nicole Smith", details.Description)
+	assert.Equal(t, "1234...5678", details.CardNumber)
+	assert.Equal(t, "Nicole Smith Personal transfer", details.SearchBody)
+	assert.Equal(t, "87654321", details.TransferDetails.ToAccount)
+	assert.Equal(t, "<UNKNOWN_1>", details.TransferDetails.Reference)
+}
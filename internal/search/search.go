@@ -28,6 +28,7 @@ type searchOptions struct {
 	orderBy         SearchOrder
 	vectorThreshold float32
 	dateCutoff      *time.Time
+	filters         []db.TransactionQueryOption
 }
 
 // SearchOption is a function that modifies SearchOptions
@@ -75,6 +76,13 @@ func WithDateCutoff(cutoff time.Time) SearchOption {
 	}
 }
 
+// WithFilters applies additional database filters (e.g. bank or cardholder) to search results
+func WithFilters(filters ...db.TransactionQueryOption) SearchOption {
+	return func(opts *searchOptions) {
+		opts.filters = append(opts.filters, filters...)
+	}
+}
+
 // TextSearch performs a full-text search on transactions using a query and SearchOptions
 func TextSearch(ctx context.Context, dbConn *db.DB, query string, opts ...SearchOption) ([]types.TransactionSearchResult, int, error) {
 	var searchOpts searchOptions
@@ -90,6 +98,7 @@ func TextSearch(ctx context.Context, dbConn *db.DB, query string, opts ...Search
 	if searchOpts.limit > 0 {
 		dbOpts = append(dbOpts, db.WithLimit(searchOpts.limit))
 	}
+	dbOpts = append(dbOpts, searchOpts.filters...)
 
 	orderBy := db.OrderByDate
 	if searchOpts.orderBy == searchOrderRelevance {
@@ -150,10 +159,28 @@ func VectorSearch(
 	// Total count of vector results before applying date filter and limit
 	totalVectorResults := len(vectorResults)
 
+	// Apply any additional database filters up front by restricting to matching IDs
+	var allowedIDs map[string]bool
+	if len(options.filters) > 0 {
+		ids := make([]string, len(vectorResults))
+		for i, result := range vectorResults {
+			ids[i] = result.ID
+		}
+		matching, err := dbConn.GetTransactionIDs(ctx, append(options.filters, db.FilterByIDs(ids...))...)
+		if err != nil {
+			return types.SearchResults{}, fmt.Errorf("failed to filter vector results: %w", err)
+		}
+		allowedIDs = make(map[string]bool, len(matching))
+		for _, id := range matching {
+			allowedIDs[id] = true
+		}
+	}
+
 	// Fetch each transaction by ID and build result set
 	var results []types.TransactionSearchResult
 	var fetchErrors int
 	var filteredOutByDate int
+	var filteredOut int
 
 	// Calculate the cutoff date
 	var cutoffDate *time.Time
@@ -167,6 +194,11 @@ func VectorSearch(
 	}
 
 	for _, result := range vectorResults {
+		if allowedIDs != nil && !allowedIDs[result.ID] {
+			filteredOut++
+			continue
+		}
+
 		// Fetch transaction by ID
 		tx, err := dbConn.GetTransactionByID(ctx, result.ID)
 		if err != nil {
@@ -177,6 +209,7 @@ func VectorSearch(
 					"id", result.ID,
 					"error", err)
 			}
+			fetchErrors++
 			continue
 		}
 
@@ -225,11 +258,8 @@ func VectorSearch(
 		})
 	}
 
-	// Calculate total count as the sum of results, fetch errors, and date-filtered items
-	totalCount := len(results)
-	if (options.limit > 0 && len(results) >= options.limit) || fetchErrors > 0 || filteredOutByDate > 0 {
-		totalCount = totalVectorResults - fetchErrors
-	}
+	// Calculate total count as all vector results less those that failed to fetch or were filtered out
+	totalCount := totalVectorResults - fetchErrors - filteredOutByDate - filteredOut
 
 	logger.Info("Vector search completed",
 		"query", query,
@@ -237,6 +267,7 @@ func VectorSearch(
 		"total_count", totalCount,
 		"fetch_errors", fetchErrors,
 		"filtered_by_date", filteredOutByDate,
+		"filtered_out", filteredOut,
 		"threshold", options.vectorThreshold,
 		"orderBy", options.orderBy,
 		"duration", time.Since(startTime))
@@ -270,8 +301,8 @@ func HybridSearch(
 	startTime := time.Now()
 
 	// Perform text search
-	textResults, textTotalCount, err := dbConn.SearchTransactionsByText(ctx,
-		query, db.OrderByRelevance, db.FilterByDays(options.days), db.WithLimit(options.limit*2))
+	textOpts := append([]db.TransactionQueryOption{db.FilterByDays(options.days), db.WithLimit(options.limit * 2)}, options.filters...)
+	textResults, textTotalCount, err := dbConn.SearchTransactionsByText(ctx, query, db.OrderByRelevance, textOpts...)
 	if err != nil {
 		return types.SearchResults{}, fmt.Errorf("text search failed: %w", err)
 	}
@@ -318,8 +349,7 @@ func HybridSearch(
 
 	// Process text search results
 	for i, result := range textResults {
-		// Generate transaction ID
-		txID := db.GenerateTransactionID(result.Transaction)
+		txID := transactionID(result.TransactionWithDetails)
 
 		// Store or update the result in the combined map
 		if info, exists := combinedResults[txID]; exists {
@@ -336,8 +366,7 @@ func HybridSearch(
 
 	// Process vector search results
 	for i, result := range vectorResults.Results {
-		// Generate transaction ID
-		txID := db.GenerateTransactionID(result.Transaction)
+		txID := transactionID(result.TransactionWithDetails)
 
 		// Store or update the result in the combined map
 		if info, exists := combinedResults[txID]; exists {
@@ -415,3 +444,11 @@ func sortSearchResultsByRRFScore(results []types.TransactionSearchResult) {
 		return results[i].Scores.RRFScore > results[j].Scores.RRFScore
 	})
 }
+
+// transactionID returns the stored ID of a transaction, falling back to generating it
+func transactionID(t types.TransactionWithDetails) string {
+	if t.ID != "" {
+		return t.ID
+	}
+	return db.GenerateTransactionID(t.Transaction)
+}
@@ -52,7 +52,7 @@ func TestTextSearch(t *testing.T) {
 	// Create a test transaction with today's date
 	transaction := types.Transaction{
 		Date:   time.Now().Format("02/01/2006"),
-		Amount: "100.00",
+		Amount: types.MustParseMoney("100.00", types.DefaultCurrency),
 		Payee:  "Coffee Shop",
 		Bank:   "Test Bank",
 	}
@@ -146,7 +146,7 @@ func TestVectorSearch(t *testing.T) {
 	// Insert a transaction
 	transaction := types.Transaction{
 		Date:   time.Now().Format("02/01/2006"),
-		Amount: "100.00",
+		Amount: types.MustParseMoney("100.00", types.DefaultCurrency),
 		Payee:  "Vector Store",
 		Bank:   "Test Bank",
 	}
@@ -193,13 +193,13 @@ func TestVectorSearch_AllTimeByDefault(t *testing.T) {
 	transactions := []types.Transaction{
 		{
 			Date:   today.Format("02/01/2006"),
-			Amount: "100.00",
+			Amount: types.MustParseMoney("100.00", types.DefaultCurrency),
 			Payee:  "Recent Store",
 			Bank:   "Test Bank",
 		},
 		{
 			Date:   oldDate.Format("02/01/2006"),
-			Amount: "50.00",
+			Amount: types.MustParseMoney("50.00", types.DefaultCurrency),
 			Payee:  "Old Store",
 			Bank:   "Test Bank",
 		},
@@ -278,7 +278,7 @@ func TestHybridSearch(t *testing.T) {
 	// Insert a transaction
 	transaction := types.Transaction{
 		Date:   time.Now().Format("02/01/2006"),
-		Amount: "100.00",
+		Amount: types.MustParseMoney("100.00", types.DefaultCurrency),
 		Payee:  "Hybrid Store",
 		Bank:   "Test Bank",
 	}
@@ -0,0 +1,119 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultCurrency is the currency of transaction amounts, since bank exports don't include one
+const DefaultCurrency = "AUD"
+
+// minorUnitDigits are the ISO 4217 currencies whose minor unit isn't a hundredth
+var minorUnitDigits = map[string]int32{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// MinorUnitDigits returns how many decimal places a currency's amounts have, 2 for most
+func MinorUnitDigits(currency string) int32 {
+	if digits, ok := minorUnitDigits[strings.ToUpper(currency)]; ok {
+		return digits
+	}
+	return 2
+}
+
+// CurrenciesWithMinorUnitDigits returns the currencies whose amounts have the given number of
+// decimal places, other than the usual 2
+func CurrenciesWithMinorUnitDigits(digits int32) []string {
+	var currencies []string
+	for currency, d := range minorUnitDigits {
+		if d == digits {
+			currencies = append(currencies, currency)
+		}
+	}
+	return currencies
+}
+
+// Money is an exact amount in a currency. It's stored as a whole number of the currency's minor
+// units, such as cents, so totals never drift.
+type Money struct {
+	Amount   decimal.Decimal `json:"amount" jsonschema:"required"`
+	Currency string          `json:"currency" jsonschema:"required"`
+}
+
+// NewMoney returns an amount in a currency, rounded to the currency's minor unit
+func NewMoney(amount decimal.Decimal, currency string) Money {
+	currency = strings.ToUpper(currency)
+	return Money{Amount: amount.Round(MinorUnitDigits(currency)), Currency: currency}
+}
+
+// MoneyFromMinorUnits returns an amount from a whole number of the currency's minor units
+func MoneyFromMinorUnits(units int64, currency string) Money {
+	currency = strings.ToUpper(currency)
+	return Money{Amount: decimal.New(units, -MinorUnitDigits(currency)), Currency: currency}
+}
+
+// ParseMoney parses an amount as written in a bank export, such as "-1,234.56" or "$12.50"
+func ParseMoney(s, currency string) (Money, error) {
+	cleaned := strings.NewReplacer(",", "", "$", "", " ", "").Replace(strings.TrimSpace(s))
+	amount, err := decimal.NewFromString(cleaned)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	m := NewMoney(amount, currency)
+	if !m.Amount.Equal(amount) {
+		return Money{}, fmt.Errorf("invalid amount %q: more decimal places than %s has", s, m.Currency)
+	}
+	return m, nil
+}
+
+// MustParseMoney is like ParseMoney but panics if the amount is invalid, for amounts in code
+func MustParseMoney(s, currency string) Money {
+	m, err := ParseMoney(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// MinorUnits returns the amount as a whole number of the currency's minor units, such as cents
+func (m Money) MinorUnits() int64 {
+	return m.Amount.Shift(MinorUnitDigits(m.Currency)).Round(0).IntPart()
+}
+
+// String formats the amount to the currency's minor unit without the currency, such as "-12.50"
+func (m Money) String() string {
+	return m.Amount.StringFixed(MinorUnitDigits(m.Currency))
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount.IsZero()
+}
+
+// IsNegative reports whether the amount is money going out
+func (m Money) IsNegative() bool {
+	return m.Amount.IsNegative()
+}
+
+// IsPositive reports whether the amount is money coming in
+func (m Money) IsPositive() bool {
+	return m.Amount.IsPositive()
+}
+
+// Abs returns the amount without its sign
+func (m Money) Abs() Money {
+	return Money{Amount: m.Amount.Abs(), Currency: m.Currency}
+}
+
+// MarshalJSON writes the amount to the currency's minor unit, so -12.50 isn't written as -12.5
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}{m.String(), m.Currency})
+}
@@ -1,6 +1,11 @@
 package types
 
-import "github.com/shopspring/decimal"
+import (
+	"strings"
+
+	"github.com/lox/bank-transaction-analyzer/internal/gazetteer"
+	"github.com/shopspring/decimal"
+)
 
 const (
 	TransactionTypeOther     = "other"
@@ -79,20 +84,75 @@ var AllowedCategoriesMap = map[string]struct{}{
 	"Other":          {},
 }
 
+// DeductionCategory is a category of tax deduction, as labelled on the ATO individual tax return
+type DeductionCategory struct {
+	Code string
+	Name string
+}
+
+// AllowedDeductionCategories is a list of all allowed deduction categories
+var AllowedDeductionCategories = []DeductionCategory{
+	{Code: "D1", Name: "Work-related car expenses"},
+	{Code: "D2", Name: "Work-related travel expenses"},
+	{Code: "D3", Name: "Work-related clothing, laundry and dry-cleaning expenses"},
+	{Code: "D4", Name: "Work-related self-education expenses"},
+	{Code: "D5", Name: "Other work-related expenses"},
+	{Code: "D6", Name: "Low-value pool deduction"},
+	{Code: "D7", Name: "Interest deductions"},
+	{Code: "D8", Name: "Dividend deductions"},
+	{Code: "D9", Name: "Gifts or donations"},
+	{Code: "D10", Name: "Cost of managing tax affairs"},
+	{Code: "D15", Name: "Other deductions"},
+}
+
+// DeductionCategoryByCode returns the deduction category with a code such as "D5", ignoring case
+func DeductionCategoryByCode(code string) (DeductionCategory, bool) {
+	for _, c := range AllowedDeductionCategories {
+		if strings.EqualFold(c.Code, code) {
+			return c, true
+		}
+	}
+	return DeductionCategory{}, false
+}
+
 // Transaction represents a bank transaction
 type Transaction struct {
 	Date   string `json:"date"`
-	Amount string `json:"amount"`
+	Amount Money  `json:"amount"`
 	Payee  string `json:"payee"`
 	Bank   string `json:"bank"`
+
+	// AmountText is the amount as written in the bank export, such as "-1,234.56", which the
+	// transaction ID is hashed from so IDs stay the same as before amounts were parsed
+	AmountText string `json:"-"`
+
+	// Splits allocate the amount across categories, from the bank export or from storage
+	Splits []Split `json:"splits,omitempty"`
 }
 
-// ForeignAmountDetails contains details about a foreign currency amount
-type ForeignAmountDetails struct {
-	Amount   decimal.Decimal `json:"amount" jsonschema:"required"`
-	Currency string          `json:"currency" jsonschema:"required"`
+// Split allocates part of a transaction's amount to a category
+type Split struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Category string          `json:"category"`
+	Tags     string          `json:"tags,omitempty"`
+	Note     string          `json:"note,omitempty"`
 }
 
+// String formats the split as its amount and category, followed by any tags and note
+func (s Split) String() string {
+	str := s.Amount.StringFixed(2) + " " + s.Category
+	if s.Tags != "" {
+		str += " [" + s.Tags + "]"
+	}
+	if s.Note != "" {
+		str += " (" + s.Note + ")"
+	}
+	return str
+}
+
+// ForeignAmountDetails is the amount in a foreign currency that a transaction was converted from
+type ForeignAmountDetails = Money
+
 // TransferDetails contains details about a bank transfer
 type TransferDetails struct {
 	ToAccount   string `json:"to_account,omitempty"`
@@ -113,10 +173,97 @@ type TransactionDetails struct {
 	// Optional fields
 	ForeignAmount   *ForeignAmountDetails `json:"foreign_amount,omitempty"`
 	TransferDetails *TransferDetails      `json:"transfer_details,omitempty"`
-	Tags            string                `json:"tags,omitempty"`
+	Tags            []string              `json:"tags,omitempty"`
+
+	// Card attribution, populated from storage rather than by the LLM
+	CardToken  string `json:"card_token,omitempty"`
+	Cardholder string `json:"cardholder,omitempty"`
+
+	// Model is the LLM that classified the transaction, set by the analyzer
+	Model string `json:"model,omitempty"`
+
+	// RecurringSeriesID links the transaction to a detected recurring series, populated from storage
+	RecurringSeriesID string `json:"recurring_series_id,omitempty"`
+
+	// TransferMatchID is the other side of a transfer between our own accounts, populated from storage
+	TransferMatchID string `json:"transfer_match_id,omitempty"`
+
+	// MerchantID is the canonical merchant the merchant name resolved to, populated from storage
+	MerchantID int64 `json:"merchant_id,omitempty"`
+
+	// Place is the location resolved against the gazetteer, populated from storage
+	Place gazetteer.Place `json:"place,omitzero"`
+
+	// RefundOfID is the purchase a refund reverses, populated from storage
+	RefundOfID string `json:"refund_of_id,omitempty"`
+
+	// RefundedAmount is the total refunded against a purchase, populated from storage
+	RefundedAmount decimal.Decimal `json:"refunded_amount,omitzero"`
+
+	// Notes are written by the user rather than the LLM, populated from storage
+	Notes string `json:"notes,omitempty"`
+
+	// AttachmentCount is the number of files such as receipts attached, populated from storage
+	AttachmentCount int `json:"attachment_count,omitempty"`
+
+	// Deduction is the code of the tax deduction category for deductible transactions, such as
+	// "D5", populated from storage
+	Deduction string `json:"deduction,omitempty"`
+
+	// FXFeeOfID is the foreign purchase an international transaction fee was charged for,
+	// populated from storage
+	FXFeeOfID string `json:"fx_fee_of_id,omitempty"`
+
+	// FXFee is the total of the international transaction fees charged for a foreign purchase,
+	// as a positive amount, populated from storage
+	FXFee decimal.Decimal `json:"fx_fee,omitzero"`
+
+	// TripID is the trip the transaction was spent on or booked for, populated from storage
+	TripID string `json:"trip_id,omitempty"`
+}
+
+// EmbeddingText is the text embedded for semantic search, the search body followed by any notes
+func (d TransactionDetails) EmbeddingText() string {
+	if d.Notes == "" {
+		return d.SearchBody
+	}
+	return d.SearchBody + " " + d.Notes
 }
 
 type TransactionWithDetails struct {
+	// ID is the stored transaction ID, set when read from the database
+	ID string `json:"id,omitempty"`
 	Transaction
 	Details TransactionDetails `json:"details"`
 }
+
+// ImpliedRate is the amount paid per unit of the foreign currency, before any separate
+// international transaction fee, or false for transactions without a foreign amount
+func (t TransactionWithDetails) ImpliedRate() (decimal.Decimal, bool) {
+	return t.rate(decimal.Zero)
+}
+
+// EffectiveRate is the amount paid per unit of the foreign currency, including any linked
+// international transaction fees
+func (t TransactionWithDetails) EffectiveRate() (decimal.Decimal, bool) {
+	return t.rate(t.Details.FXFee)
+}
+
+func (t TransactionWithDetails) rate(fee decimal.Decimal) (decimal.Decimal, bool) {
+	if t.Details.ForeignAmount == nil || t.Details.ForeignAmount.Amount.IsZero() {
+		return decimal.Zero, false
+	}
+	return t.Amount.Amount.Abs().Add(fee).Div(t.Details.ForeignAmount.Amount.Abs()).Round(6), true
+}
+
+// RefundStatus describes how much of a purchase has been refunded: "refunded", "partially refunded",
+// or empty when nothing has been
+func (t TransactionWithDetails) RefundStatus() string {
+	if !t.Details.RefundedAmount.IsPositive() {
+		return ""
+	}
+	if t.Details.RefundedAmount.GreaterThanOrEqual(t.Amount.Amount.Abs()) {
+		return "refunded"
+	}
+	return "partially refunded"
+}